@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.backup FILE`, copying the database as of its last commit,
+// WAL included, to a new file. Progress is reported like a table scan.
+func HandleBackup(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) != 2 {
+		return usageError(".backup file")
+	}
+	var progress func(copied, total int64)
+	if showProgress && !quiet {
+		last, reported := time.Now(), false
+		progress = func(copied, total int64) {
+			if time.Since(last) >= ProgressInterval {
+				last, reported = time.Now(), true
+				fmt.Fprintf(os.Stderr, "\rbacking up: %d of %d pages", copied, total)
+			}
+		}
+		defer func() {
+			if reported {
+				fmt.Fprint(os.Stderr, "\r\x1b[K")
+			}
+		}()
+	}
+	return sqlitefile.Backup(fields[1], db, progress)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Set with --bench N to run the command N times and report its latency
+var benchRuns int
+
+// Runs cmd benchRuns times with the file in the page cache of the
+// operating system and benchRuns times after dropping it from the cache
+// and reloading the database, then reports the latency, the pages read
+// and the memory allocated per run, and the allocations per cell
+// decoded. Results are discarded. Cold runs are skipped where the cache
+// cannot be dropped.
+func runBench(cmd string, db *sqlitefile.Database) error {
+	saved := output
+	output = io.Discard
+	defer func() { output = saved }()
+	// the first run warms the cache
+	if err := runCommand(cmd, db); err != nil {
+		return err
+	}
+	warm, usage, err := benchCommand(cmd, db, false)
+	if err != nil {
+		return err
+	}
+	writeBenchResult("warm", warm, usage)
+	if err := evictPageCache(db.File); err != nil {
+		fmt.Fprintf(os.Stderr, "skipping cold runs: %s\n", err)
+		return nil
+	}
+	cold, usage, err := benchCommand(cmd, db, true)
+	if err != nil {
+		return err
+	}
+	writeBenchResult("cold", cold, usage)
+	return nil
+}
+
+// What the last run of a benchmark read and allocated
+type benchUsage struct {
+	Pages  int64
+	Cells  int64
+	Allocs uint64
+	Bytes  uint64
+}
+
+// Times benchRuns runs of cmd, returning their durations sorted and what
+// the last run read and allocated
+func benchCommand(cmd string, db *sqlitefile.Database, cold bool) ([]time.Duration, benchUsage, error) {
+	durations := make([]time.Duration, benchRuns)
+	usage := benchUsage{}
+	for i := range durations {
+		if cold {
+			// start from a database as just opened, without the pages its
+			// own cache and read-ahead kept from the runs before
+			if err := db.Reload(); err != nil {
+				return nil, usage, err
+			}
+			if err := evictPageCache(db.File); err != nil {
+				return nil, usage, err
+			}
+			if db.Wal != nil {
+				// the WAL is an os file when the database is
+				if wal, ok := db.Wal.File.(interface{ Fd() uintptr }); ok {
+					if err := evictPageCache(wal); err != nil {
+						return nil, usage, err
+					}
+				}
+			}
+		}
+		stats := db.Stats()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		if err := runCommand(cmd, db); err != nil {
+			return nil, usage, err
+		}
+		durations[i] = time.Since(start)
+		runtime.ReadMemStats(&after)
+		usage = benchUsage{
+			Pages:  db.Stats().PagesRead - stats.PagesRead,
+			Cells:  db.Stats().CellsDecoded - stats.CellsDecoded,
+			Allocs: after.Mallocs - before.Mallocs,
+			Bytes:  after.TotalAlloc - before.TotalAlloc,
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations, usage, nil
+}
+
+func writeBenchResult(name string, durations []time.Duration, usage benchUsage) {
+	p95 := durations[(len(durations)*95+99)/100-1]
+	fmt.Fprintf(os.Stdout, "%s: %d runs, min %s, median %s, p95 %s, %d pages read, %d allocations of %d bytes per run",
+		name, len(durations), durations[0], durations[len(durations)/2], p95, usage.Pages, usage.Allocs, usage.Bytes)
+	if usage.Cells > 0 {
+		fmt.Fprintf(os.Stdout, ", %.1f per cell decoded", float64(usage.Allocs)/float64(usage.Cells))
+	}
+	fmt.Fprintln(os.Stdout)
+}
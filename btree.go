@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Index keys longer than this are cut short when drawing a b-tree
+const BtreeKeyDisplayWidth = 40
+
+// A page of a b-tree with the range of keys stored in its subtree,
+// rowids for table b-trees and records for index b-trees
+type btreeNode struct {
+	Page     int64
+	Type     uint8
+	Cells    int
+	First    string
+	Last     string
+	Children []*btreeNode
+	// pages of the overflow chain of each cell that spills over
+	Overflow [][]int64
+}
+
+// Finds the root page of the table or index called name
+func btreeRoot(db *sqlitefile.Database, name string) (int64, error) {
+	name = sqlitefile.CleanKeyString(name)
+	if name == "sqlite_schema" || name == "sqlite_master" {
+		return sqlitefile.SchemaRootPage, nil
+	}
+	rows, err := sqlitefile.ReadSchemaRows(db)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if row.Name == name && row.RootPage > 0 {
+			return row.RootPage, nil
+		}
+	}
+	return 0, sqlitefile.NotFoundError("no such table or index: %s", name)
+}
+
+// Reads the b-tree rooted at pageNumber into memory. Only the key range
+// of each page is kept, not its cells.
+func loadBtree(db *sqlitefile.Database, pageNumber int64) (*btreeNode, error) {
+	return loadBtreeNode(db, pageNumber, map[int64]bool{})
+}
+
+func loadBtreeNode(db *sqlitefile.Database, pageNumber int64, seen map[int64]bool) (*btreeNode, error) {
+	if seen[pageNumber] {
+		return nil, fmt.Errorf("page %d is referenced more than once", pageNumber)
+	}
+	seen[pageNumber] = true
+	p, err := sqlitefile.ReadRawPage(db, pageNumber)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := sqlitefile.PageTypeNames[p.PageType()]; !ok {
+		return nil, fmt.Errorf("page %d is not a b-tree page", pageNumber)
+	}
+	node := &btreeNode{Page: pageNumber, Type: p.PageType(), Cells: p.CellCount()}
+	for i := 0; i < p.CellCount() && p.PageType() != sqlitefile.InteriorTableType; i++ {
+		_, _, overflow := p.CellPayload(i)
+		chain := []int64{}
+		for overflow != 0 {
+			if seen[int64(overflow)] {
+				return nil, fmt.Errorf("page %d is referenced more than once", overflow)
+			}
+			seen[int64(overflow)] = true
+			chain = append(chain, int64(overflow))
+			op, err := sqlitefile.ReadRawPage(db, int64(overflow))
+			if err != nil {
+				return nil, err
+			}
+			overflow = binary.BigEndian.Uint32(op.Data)
+		}
+		if len(chain) > 0 {
+			node.Overflow = append(node.Overflow, chain)
+		}
+	}
+	if !p.IsLeaf() {
+		for i := 0; i <= p.CellCount(); i++ {
+			child, err := loadBtreeNode(db, int64(p.ChildPage(i)), seen)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+	}
+	// interior index cells hold entries of their own, which lie
+	// between the subtrees of their neighbouring children
+	if p.IsLeaf() || p.PageType() == sqlitefile.InteriorIndexType {
+		if p.CellCount() > 0 {
+			if node.First, err = btreeCellKey(db, p, 0); err != nil {
+				return nil, err
+			}
+			if node.Last, err = btreeCellKey(db, p, p.CellCount()-1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(node.Children) > 0 {
+		if first := node.Children[0].First; first != "" {
+			node.First = first
+		}
+		if last := node.Children[len(node.Children)-1].Last; last != "" {
+			node.Last = last
+		}
+	}
+	return node, nil
+}
+
+// The key of cell i, its rowid on table pages and its record on index pages
+func btreeCellKey(db *sqlitefile.Database, p *sqlitefile.RawPage, i int) (string, error) {
+	if p.PageType() == sqlitefile.LeafTableType || p.PageType() == sqlitefile.InteriorTableType {
+		return fmt.Sprint(p.CellRowID(i)), nil
+	}
+	values, err := sqlitefile.ReadCellValues(db, p, i)
+	if err != nil {
+		return "", err
+	}
+	return truncateDisplay(sqlitefile.FormatValueTuple(values), BtreeKeyDisplayWidth), nil
+}
+
+// Depth of the tree, a lone leaf having depth 1
+func (n *btreeNode) Depth() int {
+	depth := 0
+	for _, child := range n.Children {
+		depth = max(depth, child.Depth())
+	}
+	return depth + 1
+}
+
+// Number of pages in the tree
+func (n *btreeNode) PageCount() int {
+	count := 1
+	for _, child := range n.Children {
+		count += child.PageCount()
+	}
+	return count
+}
+
+// The range of keys below the page, like "rowids 1 .. 90"
+func (n *btreeNode) KeyRange() string {
+	if n.Type == sqlitefile.LeafIndexType || n.Type == sqlitefile.InteriorIndexType {
+		return fmt.Sprintf("keys %s .. %s", n.First, n.Last)
+	}
+	return fmt.Sprintf("rowids %s .. %s", n.First, n.Last)
+}
+
+// Handles `.btree [--dot] name`, drawing the b-tree of a table or index
+// as an indented tree with the page number, cell count and key range of
+// each page. With --dot the tree is written as a Graphviz graph instead.
+func HandleBtree(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	dot := len(fields) == 3 && fields[1] == "--dot"
+	if dot {
+		fields = append(fields[:1], fields[2])
+	}
+	if len(fields) != 2 {
+		return usageError(".btree [--dot] table|index")
+	}
+	root, err := btreeRoot(db, fields[1])
+	if err != nil {
+		return err
+	}
+	tree, err := loadBtree(db, root)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(output)
+	if dot {
+		writeBtreeDot(out, fields[1], tree)
+		return out.Flush()
+	}
+	fmt.Fprintf(out, "%s: depth %d, %d pages\n", fields[1], tree.Depth(), tree.PageCount())
+	writeBtreeNode(out, tree, "", "")
+	return out.Flush()
+}
+
+func writeBtreeNode(w io.Writer, n *btreeNode, prefix, childPrefix string) {
+	fmt.Fprintf(w, "%spage %d (%s, %d cells", prefix, n.Page, sqlitefile.PageTypeNames[n.Type], n.Cells)
+	if n.First != "" {
+		fmt.Fprintf(w, ", %s", n.KeyRange())
+	}
+	fmt.Fprintln(w, ")")
+	for i, child := range n.Children {
+		if i == len(n.Children)-1 {
+			writeBtreeNode(w, child, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			writeBtreeNode(w, child, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
+
+// Writes the tree as a Graphviz digraph with a box per page, solid edges
+// to child pages and dashed edges along overflow chains
+func writeBtreeDot(w io.Writer, name string, tree *btreeNode) {
+	fmt.Fprintf(w, "digraph %s {\n", dotString(name))
+	fmt.Fprintln(w, "  node [shape=box, fontname=monospace];")
+	var walk func(n *btreeNode)
+	walk = func(n *btreeNode) {
+		label := fmt.Sprintf("page %d\n%s\n%d cells", n.Page, sqlitefile.PageTypeNames[n.Type], n.Cells)
+		if n.First != "" {
+			label += "\n" + n.KeyRange()
+		}
+		fmt.Fprintf(w, "  p%d [label=%s];\n", n.Page, dotString(label))
+		for _, chain := range n.Overflow {
+			from := fmt.Sprintf("p%d", n.Page)
+			for _, page := range chain {
+				fmt.Fprintf(w, "  p%d [label=\"overflow %d\", shape=note];\n", page, page)
+				fmt.Fprintf(w, "  %s -> p%d [style=dashed];\n", from, page)
+				from = fmt.Sprintf("p%d", page)
+			}
+		}
+		for _, child := range n.Children {
+			fmt.Fprintf(w, "  p%d -> p%d;\n", n.Page, child.Page)
+			walk(child)
+		}
+	}
+	walk(tree)
+	fmt.Fprintln(w, "}")
+}
+
+// Quotes s as a DOT string, with newlines turned into line breaks
+func dotString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.changeset FILE`, decoding a changeset or patchset made by
+// the session extension and writing each change as the statement that
+// makes it. Columns are named after the table of the same name in the
+// database, or c0, c1 and so on when it has no such table.
+func HandleChangeset(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) != 2 {
+		return usageError(".changeset file")
+	}
+	data, err := os.ReadFile(fields[1])
+	if err != nil {
+		return err
+	}
+	tables, err := sqlitefile.DecodeChangeset(data)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return writeJSONDocument(tables)
+	}
+	out := bufio.NewWriter(output)
+	for _, t := range tables {
+		kind := "changeset"
+		if t.Patchset {
+			kind = "patchset"
+		}
+		fmt.Fprintf(out, "-- %s: %d changes (%s)\n", t.Name, len(t.Changes), kind)
+		columns := changesetColumns(db, t)
+		for _, c := range t.Changes {
+			fmt.Fprintln(out, formatChange(t, columns, c))
+		}
+	}
+	return out.Flush()
+}
+
+func changesetColumns(db *sqlitefile.Database, t sqlitefile.ChangesetTable) []string {
+	if schema, ok := db.Tables[sqlitefile.CleanKeyString(t.Name)]; ok {
+		if names := schema.ColumnNames(); len(names) == len(t.PrimaryKey) {
+			return names
+		}
+	}
+	names := make([]string, len(t.PrimaryKey))
+	for i := range names {
+		names[i] = fmt.Sprintf("c%d", i)
+	}
+	return names
+}
+
+// Writes a change as an INSERT, DELETE or UPDATE statement. Rows are
+// found by their primary key, the old values a changeset keeps for the
+// other columns follow in a comment.
+func formatChange(t sqlitefile.ChangesetTable, columns []string, c sqlitefile.Change) string {
+	table := sqlitefile.QuoteIdentifier(t.Name)
+	var stmt string
+	var notes []string
+	if c.Indirect {
+		notes = append(notes, "indirect")
+	}
+	switch c.Op {
+	case sqlitefile.ChangeInsert:
+		values := make([]string, len(c.New))
+		for i, v := range c.New {
+			values[i] = sqlitefile.FormatSQLValue(v)
+		}
+		stmt = fmt.Sprintf("INSERT INTO %s VALUES(%s);", table, strings.Join(values, ","))
+	case sqlitefile.ChangeDelete:
+		stmt = fmt.Sprintf("DELETE FROM %s WHERE %s;", table, changeAssignments(columns, c.Old, t.PrimaryKey, true, " AND "))
+		if old := changeAssignments(columns, c.Old, t.PrimaryKey, false, ", "); old != "" {
+			notes = append(notes, "was "+old)
+		}
+	case sqlitefile.ChangeUpdate:
+		// a patchset keeps the primary key in the new row
+		key := c.Old
+		if t.Patchset {
+			key = c.New
+		}
+		stmt = fmt.Sprintf("UPDATE %s SET %s WHERE %s;", table,
+			changeAssignments(columns, c.New, t.PrimaryKey, false, ", "),
+			changeAssignments(columns, key, t.PrimaryKey, true, " AND "))
+		if old := changeAssignments(columns, c.Old, t.PrimaryKey, false, ", "); old != "" {
+			notes = append(notes, "was "+old)
+		}
+	}
+	if len(notes) > 0 {
+		stmt += " -- " + strings.Join(notes, ", ")
+	}
+	return stmt
+}
+
+// Joins column=value for the defined values of the primary key columns,
+// or of the other columns
+func changeAssignments(columns []string, values []any, pk []bool, key bool, sep string) string {
+	parts := []string{}
+	for i, v := range values {
+		if _, undefined := v.(sqlitefile.Undefined); undefined || pk[i] != key {
+			continue
+		}
+		parts = append(parts, sqlitefile.QuoteIdentifier(columns[i])+"="+sqlitefile.FormatSQLValue(v))
+	}
+	return strings.Join(parts, sep)
+}
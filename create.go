@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Parses the optional page size argument of .createdb
+func parseCreateDatabaseCommand(cmd string) (int, error) {
+	fields := strings.Fields(cmd)
+	if len(fields) == 1 {
+		return sqlitefile.DefaultPageSize, nil
+	}
+	if len(fields) > 2 {
+		return 0, usageError(".createdb [page size]")
+	}
+	pageSize, err := strconv.Atoi(fields[1])
+	if err != nil || pageSize < 512 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		return 0, fmt.Errorf("page size must be a power of two between 512 and 65536: %s", fields[1])
+	}
+	return pageSize, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.defrag [page]`, compacting the given b-tree page or every
+// b-tree page with freeblocks or fragmented bytes. Prints the space
+// that was scattered over each page before it was compacted.
+func HandleDefragment(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	target := int64(0)
+	if len(fields) > 2 {
+		return usageError(".defrag [page]")
+	}
+	if len(fields) == 2 {
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid page number: %s", fields[1])
+		}
+		target = n
+	}
+	compacted, err := db.Defragment(target)
+	for _, f := range compacted {
+		fmt.Fprintf(output, "page %d: %d bytes in %d freeblocks, %d fragmented bytes\n",
+			f.Page, f.FreeblockBytes, f.Freeblocks, f.FragmentedBytes)
+	}
+	return err
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// A row of a table as stored, with affinity applied and a rowid
+// alias holding the rowid. Rows of WITHOUT ROWID tables have no rowid
+// and are matched by Key, their primary key as SQL values.
+type diffRow struct {
+	RowID  int64
+	Key    string
+	Values []any
+}
+
+// Handles `.diff other.db`, writing the SQL that turns the database into
+// other.db like sqldiff does. Schema objects missing from either side are
+// created or dropped and tables whose definition changed are recreated
+// with all of their rows. Rows of the remaining tables are matched by
+// rowid, or by primary key in WITHOUT ROWID tables, and written as
+// INSERT, UPDATE and DELETE statements.
+func HandleDiff(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) != 2 {
+		return usageError(".diff other.db")
+	}
+	other, err := sqlitefile.Open(fields[1], openOptions...)
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+	from, err := sqlitefile.ReadSchemaRows(db)
+	if err != nil {
+		return err
+	}
+	to, err := sqlitefile.ReadSchemaRows(other)
+	if err != nil {
+		return err
+	}
+	fromByName := map[string]sqlitefile.SchemaRow{}
+	for _, row := range from {
+		fromByName[row.Name] = row
+	}
+	toByName := map[string]sqlitefile.SchemaRow{}
+	for _, row := range to {
+		toByName[row.Name] = row
+	}
+	same := func(row sqlitefile.SchemaRow) bool {
+		old, ok := fromByName[row.Name]
+		return ok && old.Type == row.Type && normalizeSQL(old.SQL) == normalizeSQL(row.SQL)
+	}
+	// dropping a table takes its indexes and triggers with it
+	droppedTables := map[string]bool{}
+	for _, row := range from {
+		if next, ok := toByName[row.Name]; row.Type == "table" && (!ok || !same(next)) {
+			droppedTables[row.Name] = true
+		}
+	}
+	out := bufio.NewWriter(output)
+	for _, row := range from {
+		_, kept := toByName[row.Name]
+		if kept || !isDiffedObject(row) || (row.Type != "table" && droppedTables[row.TableName]) {
+			continue
+		}
+		fmt.Fprintf(out, "DROP %s %s;\n", strings.ToUpper(row.Type), sqlitefile.QuoteIdentifier(row.Name))
+	}
+	for _, row := range to {
+		if !isDiffedObject(row) {
+			continue
+		}
+		old, exists := fromByName[row.Name]
+		if same(row) && !(row.Type != "table" && droppedTables[row.TableName]) {
+			if row.Type == "table" {
+				if err := diffTableRows(db, other, row.Name, out); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if exists && !(old.Type != "table" && droppedTables[old.TableName]) {
+			fmt.Fprintf(out, "DROP %s %s;\n", strings.ToUpper(old.Type), sqlitefile.QuoteIdentifier(old.Name))
+		}
+		fmt.Fprintln(out, row.SQL+";")
+		if row.Type == "table" {
+			if err := diffTableRows(nil, other, row.Name, out); err != nil {
+				return err
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// Internal tables and automatic indexes follow from the rest
+func isDiffedObject(row sqlitefile.SchemaRow) bool {
+	return row.SQL != "" && !strings.HasPrefix(row.Name, "sqlite_")
+}
+
+// Collapses whitespace so reformatted but equal definitions compare equal
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// Reads the rows of a table in rowid order, or those of a WITHOUT ROWID
+// table in the order of their key. Virtual tables have no rows of their
+// own, those of their shadow tables are diffed instead.
+func readDiffRows(db *sqlitefile.Database, table string, key []int) ([]diffRow, error) {
+	schema, ok := db.Tables[table]
+	if !ok {
+		return nil, sqlitefile.TableNotFoundError(table)
+	}
+	rows := []diffRow{}
+	if root, err := schema.RootPage(); err != nil || root == 0 {
+		return rows, err
+	}
+	err := db.ForEachRow(table, func(rowid int64, c *sqlitefile.Record) error {
+		values := make([]any, schema.ColumnCount())
+		for i := range values {
+			v, err := c.ReadDataFromHeaderIndex(i)
+			if err != nil {
+				return err
+			}
+			values[i] = schema.ApplyAffinity(i, v)
+			if i == schema.RowidColumn {
+				values[i] = rowid
+			}
+		}
+		row := diffRow{RowID: rowid, Values: values}
+		if key != nil {
+			keyValues := make([]string, len(key))
+			for i, col := range key {
+				keyValues[i] = sqlitefile.FormatSQLValue(values[col])
+			}
+			row.Key = strings.Join(keyValues, ",")
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if key != nil {
+		slices.SortFunc(rows, func(a, b diffRow) int { return strings.Compare(a.Key, b.Key) })
+	}
+	return rows, err
+}
+
+// Writes the statements that turn the rows of table in from into those
+// in to. A nil from stands for an empty table.
+func diffTableRows(from, to *sqlitefile.Database, table string, w io.Writer) error {
+	schema := to.Tables[table]
+	names := schema.ColumnNames()
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = sqlitefile.QuoteIdentifier(name)
+	}
+	target := sqlitefile.QuoteIdentifier(table)
+	// rows are matched by rowid, or by primary key in WITHOUT ROWID tables
+	var key []int
+	compare := func(a, b diffRow) int { return cmp.Compare(a.RowID, b.RowID) }
+	where := func(r diffRow) string {
+		if schema.RowidColumn >= 0 {
+			return fmt.Sprintf("%s=%d", quoted[schema.RowidColumn], r.RowID)
+		}
+		return fmt.Sprintf("rowid=%d", r.RowID)
+	}
+	if schema.WithoutRowid {
+		definition, err := to.Schema(table)
+		if err != nil {
+			return err
+		}
+		for _, name := range definition.PrimaryKey {
+			key = append(key, schema.ColumnMap[sqlitefile.CleanKeyString(name)])
+		}
+		compare = func(a, b diffRow) int { return strings.Compare(a.Key, b.Key) }
+		where = func(r diffRow) string {
+			terms := make([]string, len(key))
+			for i, col := range key {
+				terms[i] = quoted[col] + "=" + sqlitefile.FormatSQLValue(r.Values[col])
+			}
+			return strings.Join(terms, " AND ")
+		}
+	}
+	insert := func(r diffRow) {
+		values := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			values[i] = sqlitefile.FormatSQLValue(v)
+		}
+		if schema.RowidColumn >= 0 || schema.WithoutRowid {
+			fmt.Fprintf(w, "INSERT INTO %s(%s) VALUES(%s);\n",
+				target, strings.Join(quoted, ","), strings.Join(values, ","))
+			return
+		}
+		fmt.Fprintf(w, "INSERT INTO %s(rowid,%s) VALUES(%d,%s);\n",
+			target, strings.Join(quoted, ","), r.RowID, strings.Join(values, ","))
+	}
+	newRows, err := readDiffRows(to, table, key)
+	if err != nil {
+		return err
+	}
+	oldRows := []diffRow{}
+	if from != nil {
+		if oldRows, err = readDiffRows(from, table, key); err != nil {
+			return err
+		}
+	}
+	i, j := 0, 0
+	for i < len(oldRows) || j < len(newRows) {
+		switch {
+		case j == len(newRows) || (i < len(oldRows) && compare(oldRows[i], newRows[j]) < 0):
+			fmt.Fprintf(w, "DELETE FROM %s WHERE %s;\n", target, where(oldRows[i]))
+			i++
+		case i == len(oldRows) || compare(newRows[j], oldRows[i]) < 0:
+			insert(newRows[j])
+			j++
+		default:
+			changes := []string{}
+			for k, v := range newRows[j].Values {
+				if k < len(oldRows[i].Values) && sqlitefile.FormatSQLValue(oldRows[i].Values[k]) == sqlitefile.FormatSQLValue(v) {
+					continue
+				}
+				changes = append(changes, quoted[k]+"="+sqlitefile.FormatSQLValue(v))
+			}
+			if len(changes) > 0 {
+				fmt.Fprintf(w, "UPDATE %s SET %s WHERE %s;\n",
+					target, strings.Join(changes, ", "), where(newRows[j]))
+			}
+			i++
+			j++
+		}
+	}
+	return nil
+}
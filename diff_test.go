@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// The diff applied by sqlite3 turns the database into the other one,
+// WITHOUT ROWID rows matched by primary key and virtual tables through
+// their shadow tables
+func TestDiffRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "a.db")
+	to := filepath.Join(dir, "b.db")
+	schema := `
+		CREATE TABLE t(id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE k(x, y TEXT, z INTEGER, PRIMARY KEY(z DESC, x)) WITHOUT ROWID;
+		CREATE VIRTUAL TABLE docs USING fts5(body);
+		INSERT INTO t VALUES (1, 'one'), (2, 'two');
+		INSERT INTO k VALUES ('a', '1', 1), ('b', '2', 1), ('c', '3', 2);
+		INSERT INTO docs VALUES ('the quick brown fox');`
+	sqlite3(t, from, schema, "")
+	sqlite3(t, to, schema+`
+		DELETE FROM t WHERE id = 1;
+		DELETE FROM k WHERE x = 'a';
+		UPDATE k SET y = '9' WHERE x = 'b';
+		INSERT INTO k VALUES ('d', '4', 3);
+		INSERT INTO docs VALUES ('hello fox');`, "")
+
+	db, err := sqlitefile.Open(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var diff bytes.Buffer
+	saved := output
+	output = &diff
+	defer func() { output = saved }()
+	if err := HandleDiff(".diff "+to, db); err != nil {
+		t.Fatal(err)
+	}
+	// shadow tables are only writable with the defensive flag off
+	sqlite3(t, from, "", ".dbconfig defensive off\n"+diff.String())
+
+	if got := sqlite3(t, from, "PRAGMA integrity_check", ""); got != "ok" {
+		t.Fatalf("integrity check after the diff: %s", got)
+	}
+	for _, sql := range []string{
+		".dump",
+		"SELECT rowid FROM docs WHERE docs MATCH 'fox' ORDER BY rowid",
+	} {
+		if got, want := sqlite3(t, from, sql, ""), sqlite3(t, to, sql, ""); got != want {
+			t.Errorf("%s after the diff:\n%s\nwant:\n%s", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.dump [table]`, writing the SQL that recreates the database,
+// or a single table with its indexes and triggers, in the format of
+// the sqlite3 shell. Tables come first in schema order, each followed
+// by its rows, then the indexes, triggers and views. Like the shell,
+// virtual tables are written straight into sqlite_schema, as creating
+// them would create their shadow tables, which the dump creates itself
+// with IF NOT EXISTS and fills with their rows.
+func HandleDump(cmd string, db *sqlitefile.Database, w io.Writer) error {
+	only := sqlitefile.CleanKeyString(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), ".dump")))
+	if only != "" {
+		if _, ok := db.Tables[only]; !ok {
+			return sqlitefile.TableNotFoundError(only)
+		}
+	}
+	rows, err := sqlitefile.ReadSchemaRows(db)
+	if err != nil {
+		return err
+	}
+	// rows are streamed out, large tables are not held in memory
+	out := bufio.NewWriter(w)
+	for _, row := range rows {
+		if row.Type == "table" && isVirtualTableSQL(row.SQL) && (only == "" || row.Name == only) {
+			out.WriteString("/* WARNING: Script requires that SQLITE_DBCONFIG_DEFENSIVE be disabled */\n")
+			break
+		}
+	}
+	out.WriteString("PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n")
+	writableSchema := false
+	for _, row := range rows {
+		if row.Type != "table" || (only != "" && row.Name != only) {
+			continue
+		}
+		switch {
+		case row.Name == "sqlite_sequence":
+			out.WriteString("DELETE FROM sqlite_sequence;\n")
+		case row.Name == "sqlite_stat1":
+			out.WriteString("ANALYZE sqlite_schema;\n")
+		case strings.HasPrefix(row.Name, "sqlite_"):
+			continue
+		case isVirtualTableSQL(row.SQL):
+			if !writableSchema {
+				out.WriteString("PRAGMA writable_schema=ON;\n")
+				writableSchema = true
+			}
+			out.WriteString("INSERT INTO sqlite_schema(type,name,tbl_name,rootpage,sql)VALUES('table'," +
+				sqlitefile.FormatSQLValue(row.Name) + "," + sqlitefile.FormatSQLValue(row.TableName) + ",0," +
+				sqlitefile.FormatSQLValue(row.SQL) + ");\n")
+			continue
+		case quotedTableNameRegexp.MatchString(row.SQL):
+			// shadow tables, which sqlite creates with quoted names
+			out.WriteString("CREATE TABLE IF NOT EXISTS " + row.SQL[len("CREATE TABLE "):] + ";\n")
+		default:
+			out.WriteString(row.SQL + ";\n")
+		}
+		if err := dumpTableRows(db, row, out); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		if row.Type == "table" || row.SQL == "" || (only != "" && row.TableName != only) {
+			continue
+		}
+		out.WriteString(row.SQL + ";\n")
+	}
+	if writableSchema {
+		out.WriteString("PRAGMA writable_schema=OFF;\n")
+	}
+	out.WriteString("COMMIT;\n")
+	return out.Flush()
+}
+
+// A CREATE TABLE statement whose table name is quoted with ' or ", as
+// the sqlite3 shell recognizes shadow tables by
+var quotedTableNameRegexp = regexp.MustCompile(`^CREATE TABLE ['"]`)
+
+func isVirtualTableSQL(sql string) bool {
+	return len(sql) >= 20 && strings.EqualFold(sql[:20], "CREATE VIRTUAL TABLE")
+}
+
+// Writes the rows of a table as INSERT statements, those of a WITHOUT
+// ROWID table in primary key order
+func dumpTableRows(db *sqlitefile.Database, row sqlitefile.SchemaRow, out *bufio.Writer) error {
+	name := sqlitefile.CleanKeyString(row.Name)
+	schema, ok := db.Tables[name]
+	if !ok {
+		return sqlitefile.TableNotFoundError(row.Name)
+	}
+	prefix := "INSERT INTO " + sqlitefile.QuoteIdentifier(row.Name) + " VALUES("
+	return db.ForEachRow(name, func(rowid int64, c *sqlitefile.Record) error {
+		values := make([]string, schema.ColumnCount())
+		for i := range values {
+			v, err := c.ReadDataFromHeaderIndex(i)
+			if err != nil {
+				return err
+			}
+			v = schema.ApplyAffinity(i, v)
+			if i == schema.RowidColumn {
+				v = rowid
+			}
+			values[i] = sqlitefile.FormatSQLValue(v)
+		}
+		out.WriteString(prefix + strings.Join(values, ",") + ");\n")
+		return nil
+	})
+}
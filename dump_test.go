@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Runs sql, or what stdin holds when it is empty, with the sqlite3 shell
+// on the database at path, skipping the test where it is not installed
+func sqlite3(t *testing.T, path string, sql string, stdin string) string {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	args := []string{"-bail", path}
+	if sql != "" {
+		args = append(args, sql)
+	}
+	cmd := exec.Command("sqlite3", args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 %s: %v\n%s", sql, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// A dump read back by sqlite3 gives the same database, virtual tables
+// with the rows of their shadow tables included
+func TestDumpRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.db")
+	sqlite3(t, path, `
+		CREATE TABLE t(id INTEGER PRIMARY KEY, name TEXT, data BLOB);
+		INSERT INTO t VALUES (1, 'one', x'00ff'), (2, 'it''s', NULL);
+		CREATE INDEX t_name ON t(name);
+		CREATE TABLE w(k TEXT PRIMARY KEY, v) WITHOUT ROWID;
+		INSERT INTO w VALUES ('b', 2), ('a', 1);
+		CREATE VIRTUAL TABLE docs USING fts5(title, body);
+		INSERT INTO docs VALUES ('hello', 'the quick brown fox'), ('again', 'hello fox');
+		CREATE VIRTUAL TABLE boxes USING rtree(id, x0, x1);
+		INSERT INTO boxes VALUES (1, 0, 10), (2, 5, 15);
+		CREATE TRIGGER t_insert AFTER INSERT ON t BEGIN INSERT INTO w VALUES (new.name, new.id); END;`, "")
+	db, err := sqlitefile.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var dump bytes.Buffer
+	if err := HandleDump(".dump", db, &dump); err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(dir, "b.db")
+	sqlite3(t, copied, "", dump.String())
+
+	if got := sqlite3(t, copied, "PRAGMA integrity_check", ""); got != "ok" {
+		t.Fatalf("integrity check of the restored database: %s", got)
+	}
+	for _, sql := range []string{
+		".dump",
+		"SELECT rowid, title FROM docs WHERE docs MATCH 'hello' ORDER BY rowid",
+		"SELECT id FROM boxes WHERE x1 > 12",
+	} {
+		if got, want := sqlite3(t, copied, sql, ""), sqlite3(t, path, sql, ""); got != want {
+			t.Errorf("%s on the restored database:\n%s\nwant:\n%s", sql, got, want)
+		}
+	}
+}
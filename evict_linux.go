@@ -0,0 +1,11 @@
+//go:build linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// Asks the kernel to drop the cached pages of the file, so the next
+// read goes to the disk
+func evictPageCache(f interface{ Fd() uintptr }) error {
+	return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func evictPageCache(f interface{ Fd() uintptr }) error {
+	return errors.New("dropping the page cache is not supported on this platform")
+}
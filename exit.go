@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Exit codes, so scripts can tell failures apart
+const (
+	ExitFailure  = 1 // a query or command failed
+	ExitUsage    = 2 // bad arguments or an unknown command
+	ExitDatabase = 3 // the database could not be opened or created
+	ExitNotFound = 4 // a table, index or column does not exist
+)
+
+// An error along with the exit code it ends the program with
+type exitError struct {
+	Code int
+	Err  error
+}
+
+func (e *exitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.Err
+}
+
+// Reports a command called with the wrong arguments
+func usageError(usage string) error {
+	return &exitError{ExitUsage, errors.New("usage: " + usage)}
+}
+
+// The exit code for err, ExitFailure unless it says otherwise
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if errors.Is(err, sqlitefile.ErrNotFound) {
+		return ExitNotFound
+	}
+	return ExitFailure
+}
+
+// Prints err and exits with the given code
+func exit(code int, err error) {
+	log.Print(err.Error())
+	os.Exit(code)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Set with --export and --out to stream the rows of SELECT statements
+// into a file rather than printing them in the current output mode.
+// Without --out the rows go to the output.
+var (
+	exportFormat string
+	exportPath   string
+)
+
+var ExportFormats = []string{"csv", "json"}
+
+func isExportFormat(name string) bool {
+	for _, f := range ExportFormats {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes rows one at a time as they are read, so large tables are
+// never held in memory. CSV starts with a header of the column names
+// and JSON is an array of objects with blobs encoded as base64.
+type rowExporter struct {
+	format  string
+	w       *bufio.Writer
+	file    *os.File
+	columns []string
+	rows    int
+}
+
+// Starts an export of rows with the given columns into exportPath
+func newRowExporter(columns []string) (*rowExporter, error) {
+	e := &rowExporter{format: exportFormat, columns: columns}
+	if exportPath == "" {
+		e.w = bufio.NewWriter(output)
+	} else {
+		f, err := os.Create(exportPath)
+		if err != nil {
+			return nil, err
+		}
+		e.file = f
+		e.w = bufio.NewWriter(f)
+	}
+	if e.format == "csv" {
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = formatCsvValue(c)
+		}
+		e.w.WriteString(strings.Join(header, ",") + "\r\n")
+	}
+	return e, nil
+}
+
+func (e *rowExporter) WriteRow(values []any) error {
+	switch e.format {
+	case "csv":
+		for i, v := range values {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			e.w.WriteString(formatCsvValue(v))
+		}
+		e.w.WriteString("\r\n")
+	case "json":
+		if e.rows == 0 {
+			e.w.WriteString("[\n")
+		} else {
+			e.w.WriteString(",\n")
+		}
+		writeExportJSONObject(e.w, e.columns, values)
+	default:
+		return fmt.Errorf("unknown export format %q", e.format)
+	}
+	e.rows++
+	return nil
+}
+
+// Finishes the export, closing the file it was written to
+func (e *rowExporter) Close() error {
+	if e.format == "json" {
+		if e.rows == 0 {
+			e.w.WriteString("[]\n")
+		} else {
+			e.w.WriteString("\n]\n")
+		}
+	}
+	err := e.w.Flush()
+	if e.file != nil {
+		if closeErr := e.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func writeExportJSONObject(w io.StringWriter, columns []string, values []any) {
+	w.WriteString("{")
+	for i, v := range values {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		name := ""
+		if i < len(columns) {
+			name = columns[i]
+		}
+		value := formatJSONValue(v)
+		if b, ok := v.([]byte); ok {
+			value = jsonString(base64.StdEncoding.EncodeToString(b))
+		}
+		w.WriteString(jsonString(name) + ":" + value)
+	}
+	w.WriteString("}")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.fts`, listing the full-text search tables with their
+// module, columns and the shadow tables that hold their index
+func HandleFTS(db *sqlitefile.Database) error {
+	tables, err := db.FTSTables()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return writeJSONDocument(tables)
+	}
+	for _, t := range tables {
+		fmt.Fprintf(output, "%s %s(%s)\n", t.Name, t.Module, strings.Join(t.Columns, ", "))
+		for _, s := range t.ShadowTables {
+			fmt.Fprintf(output, "  %s\n", s)
+		}
+	}
+	return nil
+}
+
+// Handles `.match TABLE TERM`, printing the rows of a full-text search
+// table that hold the term. The text of each row is read from the
+// content shadow table, contentless tables only show the rowids.
+func HandleMatch(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) != 3 {
+		return usageError(".match table term")
+	}
+	table, term := fields[1], strings.Trim(fields[2], "'\"")
+	t, err := db.FTSTable(table)
+	if err != nil {
+		return err
+	}
+	rowids, err := db.Match(table, term)
+	if err != nil {
+		return err
+	}
+	result := &resultSet{Columns: []string{"rowid"}, Rows: [][]any{}}
+	content, err := db.OpenCursor(table + "_content")
+	if errors.Is(err, sqlitefile.ErrNotFound) {
+		content = nil
+	} else if err != nil {
+		return err
+	} else {
+		result.Columns = append(result.Columns, t.Columns...)
+	}
+	for _, rowid := range rowids {
+		row := []any{rowid}
+		if content != nil {
+			found, err := content.SeekRowid(rowid)
+			if err != nil {
+				return err
+			}
+			// the first column of the content table is the rowid
+			for i := range t.Columns {
+				var v any
+				if found {
+					if v, err = content.Column(i + 1); err != nil {
+						return err
+					}
+				}
+				row = append(row, v)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return writeResult(output, result)
+}
@@ -1,5 +1,24 @@
 module github.com/lindeneg/sql-exploration
 
-go 1.20
+go 1.21
 
-require github.com/xwb1989/sqlparser v0.0.0-20180606152119-120387863bf2 // indirect
+require (
+	github.com/chzyer/readline v1.5.1
+	github.com/xwb1989/sqlparser v0.0.0-20180606152119-120387863bf2
+	go.opentelemetry.io/otel v1.29.0
+	go.opentelemetry.io/otel/sdk v1.29.0
+	go.opentelemetry.io/otel/trace v1.29.0
+	golang.org/x/sys v0.24.0
+	google.golang.org/grpc v1.66.3
+	google.golang.org/protobuf v1.34.1
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.29.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240604185151-ef581f913117 // indirect
+)
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Set with --grpc to answer queries over gRPC instead of running a
+// command
+var grpcAddr string
+
+// The service of query.proto. It takes a SELECT and streams its result,
+// the column names first and then a message for every row, sending each
+// row as it is read. Its messages are protobuf's own StringValue and
+// ListValue, so there is no generated code to keep in step.
+var queryServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sqlexploration.Query",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Query",
+		Handler:       handleGRPCQuery,
+		ServerStreams: true,
+	}},
+	Metadata: "query.proto",
+}
+
+// The database is not safe for concurrent use, so queries take turns
+// and one streaming a large result holds up the others until it is done.
+type queryService struct {
+	sync.Mutex
+	db *sqlitefile.Database
+}
+
+// Serves queryServiceDesc on grpcAddr until the program exits
+func runGRPCServer(db *sqlitefile.Database) error {
+	listener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer()
+	s.RegisterService(&queryServiceDesc, &queryService{db: db})
+	fmt.Fprintf(os.Stderr, "-- serving %s over gRPC on %s\n", db.Name(), listener.Addr())
+	return s.Serve(listener)
+}
+
+func handleGRPCQuery(srv any, stream grpc.ServerStream) error {
+	req := &wrapperspb.StringValue{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(*queryService).query(req.Value, stream)
+}
+
+func (s *queryService) query(sql string, stream grpc.ServerStream) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	defer func(start time.Time) { recordCommand(s.db, start, err) }(time.Now())
+	rows, err := s.db.Query(sql)
+	if err != nil {
+		// other than a missing table, the statement is at fault
+		if !errors.Is(err, sqlitefile.ErrNotFound) {
+			err = &exitError{ExitUsage, err}
+		}
+		return grpcError(err)
+	}
+	defer rows.Close()
+	columns := rows.Columns()
+	header := &structpb.ListValue{}
+	for _, c := range columns {
+		header.Values = append(header.Values, structpb.NewStringValue(c))
+	}
+	if err := stream.SendMsg(header); err != nil {
+		return err
+	}
+	values := make([]any, len(columns))
+	dest := make([]any, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return grpcError(err)
+		}
+		row := &structpb.ListValue{Values: make([]*structpb.Value, len(values))}
+		for i, v := range values {
+			row.Values[i] = grpcValue(v)
+		}
+		if err := stream.SendMsg(row); err != nil {
+			return err
+		}
+	}
+	return grpcError(rows.Err())
+}
+
+// Integers a double cannot hold exactly are sent as their decimal text,
+// blobs as base64 like the JSON export, and reals a double has no
+// number for as null
+func grpcValue(v any) *structpb.Value {
+	switch v := v.(type) {
+	case int64:
+		if v < -1<<53 || v > 1<<53 {
+			return structpb.NewStringValue(strconv.FormatInt(v, 10))
+		}
+		return structpb.NewNumberValue(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return structpb.NewNullValue()
+		}
+		return structpb.NewNumberValue(v)
+	case string:
+		return structpb.NewStringValue(v)
+	case []byte:
+		return structpb.NewStringValue(base64.StdEncoding.EncodeToString(v))
+	}
+	return structpb.NewNullValue()
+}
+
+// Reports bad requests and missing tables with their own status codes,
+// everything else as an internal error
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	code := codes.Internal
+	switch exitCode(err) {
+	case ExitUsage:
+		code = codes.InvalidArgument
+	case ExitNotFound:
+		code = codes.NotFound
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+const HexdumpBytesPerLine = 16
+
+// A labelled byte range of a page
+type pageRegion struct {
+	Start int
+	End   int
+	Label string
+}
+
+// Parses the page number argument of commands like `.hexdump N`
+func parsePageArgument(cmd string) (int64, error) {
+	fields := strings.Fields(cmd)
+	if len(fields) != 2 {
+		return 0, usageError(fields[0] + " page")
+	}
+	n, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid page number: %s", fields[1])
+	}
+	return n, nil
+}
+
+// Handles `.hexdump N`, printing page N as hex and ASCII split into its
+// regions. The b-tree header is decoded field by field and every cell
+// pointer is shown with the cell it points to, while the cell content
+// area is split into cells, freeblocks and fragments. Pages that are
+// not b-tree pages are dumped without annotations.
+func HandleHexdump(cmd string, db *sqlitefile.Database) error {
+	n, err := parsePageArgument(cmd)
+	if err != nil {
+		return err
+	}
+	p, err := sqlitefile.ReadRawPage(db, n)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(output)
+	fmt.Fprintf(out, "page %d at offset %d\n", n, sqlitefile.PageNumberToOffset(int64(len(p.Data)), n))
+	regions, err := pageRegions(p)
+	if err != nil {
+		fmt.Fprintf(out, "not a b-tree page: %s\n", err)
+		regions = []pageRegion{{0, len(p.Data), "content"}}
+	}
+	for _, r := range regions {
+		fmt.Fprintf(out, "%s [%d..%d)\n", r.Label, r.Start, r.End)
+		switch r.Label {
+		case "b-tree header":
+			writeBtreeHeaderFields(out, p)
+		case "cell pointer array":
+			for i := 0; i < p.CellCount(); i++ {
+				offset := p.CellPointerOffset(i)
+				fmt.Fprintf(out, "  %04x  %02x %02x  cell %d at %d\n",
+					offset, p.Data[offset], p.Data[offset+1], i, p.CellPointer(i))
+			}
+		default:
+			writeHexLines(out, p.Data, r.Start, r.End)
+		}
+	}
+	return out.Flush()
+}
+
+func writeBtreeHeaderFields(w io.Writer, p *sqlitefile.RawPage) {
+	hdr := p.HeaderOffset()
+	field := func(offset, size int, name string, value any) {
+		hex := make([]string, size)
+		for i := range hex {
+			hex[i] = fmt.Sprintf("%02x", p.Data[hdr+offset+i])
+		}
+		fmt.Fprintf(w, "  %04x  %-11s  %-20s %v\n", hdr+offset, strings.Join(hex, " "), name, value)
+	}
+	field(0, 1, "page type", fmt.Sprintf("%d (%s)", p.PageType(), sqlitefile.PageTypeNames[p.PageType()]))
+	field(1, 2, "first freeblock", p.FirstFreeblock())
+	field(3, 2, "cell count", p.CellCount())
+	field(5, 2, "cell content start", p.CellContentStart())
+	field(7, 1, "fragmented bytes", p.FragmentedBytes())
+	if !p.IsLeaf() {
+		field(8, 4, "right-most pointer", p.RightMostPointer())
+	}
+}
+
+// Splits a b-tree page into the database header on page 1, the b-tree
+// header, the cell pointer array, the unallocated gap, the cells,
+// freeblocks and fragmented bytes of the content area and the reserved
+// space. Fails when the page does not look like a b-tree page.
+func pageRegions(p *sqlitefile.RawPage) (regions []pageRegion, err error) {
+	if _, ok := sqlitefile.PageTypeNames[p.PageType()]; !ok {
+		return nil, fmt.Errorf("unknown page type %d", p.PageType())
+	}
+	pointers := p.CellPointerOffset(p.CellCount())
+	if pointers > p.CellContentStart() || p.CellContentStart() > p.Usable {
+		return nil, errors.New("cell pointer array overlaps the cell content area")
+	}
+	// sizes are decoded from the cells, which may be garbage
+	defer func() {
+		if r := recover(); r != nil {
+			regions, err = nil, fmt.Errorf("invalid cell: %v", r)
+		}
+	}()
+	hdr := p.HeaderOffset()
+	if hdr > 0 {
+		regions = append(regions, pageRegion{0, hdr, "database header"})
+	}
+	regions = append(regions,
+		pageRegion{hdr, hdr + p.HeaderSize(), "b-tree header"},
+		pageRegion{hdr + p.HeaderSize(), pointers, "cell pointer array"},
+		pageRegion{pointers, p.CellContentStart(), "unallocated"})
+	content := []pageRegion{}
+	for i := 0; i < p.CellCount(); i++ {
+		start := p.CellPointer(i)
+		if start < p.CellContentStart() || start >= p.Usable {
+			return nil, fmt.Errorf("cell %d at %d is outside the cell content area", i, start)
+		}
+		content = append(content, pageRegion{start, min(start+p.CellSize(i), p.Usable), fmt.Sprintf("cell %d", i)})
+	}
+	for _, b := range p.Freeblocks() {
+		content = append(content, pageRegion{b.Offset, min(b.Offset+b.Size, p.Usable), fmt.Sprintf("freeblock of %d bytes", b.Size)})
+	}
+	sort.Slice(content, func(i, j int) bool { return content[i].Start < content[j].Start })
+	// whatever is not covered by cells or freeblocks is fragmented
+	at := p.CellContentStart()
+	for _, r := range content {
+		if r.Start > at {
+			regions = append(regions, pageRegion{at, r.Start, "fragment"})
+		}
+		regions = append(regions, r)
+		at = max(at, r.End)
+	}
+	if at < p.Usable {
+		regions = append(regions, pageRegion{at, p.Usable, "fragment"})
+	}
+	if p.Usable < len(p.Data) {
+		regions = append(regions, pageRegion{p.Usable, len(p.Data), "reserved"})
+	}
+	return regions, nil
+}
+
+// Writes data[start:end] in lines of 16 bytes as offset, hex and ASCII.
+// Runs of identical lines are collapsed into a single "*" like hexdump.
+func writeHexLines(w io.Writer, data []byte, start, end int) {
+	previous := ""
+	collapsed := false
+	for offset := start; offset < end; {
+		// lines are aligned to 16 bytes within the page
+		lineEnd := min(end, (offset/HexdumpBytesPerLine+1)*HexdumpBytesPerLine)
+		line := data[offset:lineEnd]
+		if string(line) == previous && lineEnd < end {
+			if !collapsed {
+				fmt.Fprintln(w, "  *")
+				collapsed = true
+			}
+			offset = lineEnd
+			continue
+		}
+		previous, collapsed = string(line), false
+		var hex, ascii strings.Builder
+		for i := offset % HexdumpBytesPerLine; i > 0; i-- {
+			hex.WriteString("   ")
+			ascii.WriteByte(' ')
+		}
+		for _, b := range line {
+			fmt.Fprintf(&hex, "%02x ", b)
+			if b >= 0x20 && b < 0x7f {
+				ascii.WriteByte(b)
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+		fmt.Fprintf(w, "  %04x  %-48s |%-16s|\n", offset-offset%HexdumpBytesPerLine, hex.String(), ascii.String())
+		offset = lineEnd
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Set with --json to print .dbinfo, .tables, .schema, .roots and .counts
+// as JSON documents for scripts
+var jsonOutput bool
+
+func writeJSONDocument(v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(output, string(b))
+	return err
+}
+
+// Names of the text encodings stored in the database header
+var textEncodingNames = map[uint32]string{1: "utf8", 2: "utf16le", 3: "utf16be"}
+
+// Handles `.dbinfo`, printing the fields of the database header and
+// the number of schema objects of each type like the sqlite3 shell
+func HandleDbinfo(db *sqlitefile.Database) error {
+	rows, err := sqlitefile.ReadSchemaRows(db)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	schemaSize := 0
+	for _, row := range rows {
+		counts[row.Type]++
+		schemaSize += len(row.SQL)
+	}
+	h := db.Header
+	if jsonOutput {
+		return writeJSONDocument(struct {
+			PageSize          int64  `json:"page_size"`
+			WriteFormat       uint8  `json:"write_format"`
+			ReadFormat        uint8  `json:"read_format"`
+			ReservedBytes     uint8  `json:"reserved_bytes"`
+			FileChangeCounter uint32 `json:"file_change_counter"`
+			PageCount         uint32 `json:"page_count"`
+			FreelistCount     uint32 `json:"freelist_count"`
+			SchemaCookie      uint32 `json:"schema_cookie"`
+			SchemaFormat      uint32 `json:"schema_format"`
+			DefaultCacheSize  uint32 `json:"default_cache_size"`
+			AutovacuumTopRoot uint32 `json:"autovacuum_top_root"`
+			IncrementalVacuum uint32 `json:"incremental_vacuum"`
+			TextEncoding      string `json:"text_encoding"`
+			UserVersion       uint32 `json:"user_version"`
+			ApplicationID     uint32 `json:"application_id"`
+			SoftwareVersion   uint32 `json:"software_version"`
+			TableCount        int    `json:"table_count"`
+			IndexCount        int    `json:"index_count"`
+			TriggerCount      int    `json:"trigger_count"`
+			ViewCount         int    `json:"view_count"`
+			SchemaSize        int    `json:"schema_size"`
+		}{
+			h.PageSizeBytes(), h.WriteFileFormat, h.ReadFileFormat, h.ReservedPageSpace,
+			h.FileChangeCounter, h.DatabasePageSize, h.NumberOfFreeListPages,
+			h.SchemaCookie, h.SchemaFormat, h.PageCacheSize, h.LargestPageInVMode,
+			h.IncrementalVMode, textEncodingNames[h.TextEncoding], h.UserVersionPragma,
+			h.ApplicationID, h.SqliteVersion, counts["table"], counts["index"],
+			counts["trigger"], counts["view"], schemaSize,
+		})
+	}
+	fields := []struct {
+		Name  string
+		Value any
+	}{
+		{"database page size:", h.PageSizeBytes()},
+		{"write format:", h.WriteFileFormat},
+		{"read format:", h.ReadFileFormat},
+		{"reserved bytes:", h.ReservedPageSpace},
+		{"file change counter:", h.FileChangeCounter},
+		{"database page count:", h.DatabasePageSize},
+		{"freelist page count:", h.NumberOfFreeListPages},
+		{"schema cookie:", h.SchemaCookie},
+		{"schema format:", h.SchemaFormat},
+		{"default cache size:", h.PageCacheSize},
+		{"autovacuum top root:", h.LargestPageInVMode},
+		{"incremental vacuum:", h.IncrementalVMode},
+		{"text encoding:", fmt.Sprintf("%d (%s)", h.TextEncoding, textEncodingNames[h.TextEncoding])},
+		{"user version:", h.UserVersionPragma},
+		{"application id:", h.ApplicationID},
+		{"software version:", h.SqliteVersion},
+		{"number of tables:", counts["table"]},
+		{"number of indexes:", counts["index"]},
+		{"number of triggers:", counts["trigger"]},
+		{"number of views:", counts["view"]},
+		{"schema size:", schemaSize},
+	}
+	for _, f := range fields {
+		fmt.Fprintf(output, "%-20s %v\n", f.Name, f.Value)
+	}
+	return nil
+}
+
+// Handles `.tables [pattern]`, listing the tables whose names match
+// the LIKE pattern, or all of them
+func HandleTables(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) > 2 {
+		return usageError(".tables [pattern]")
+	}
+	names := []string{}
+	for _, name := range db.TableNames() {
+		if len(fields) == 1 || likeMatch(strings.Trim(fields[1], "'\""), name) {
+			names = append(names, name)
+		}
+	}
+	if jsonOutput {
+		return writeJSONDocument(names)
+	}
+	if len(names) > 0 {
+		fmt.Fprintln(output, strings.Join(names, " "))
+	}
+	return nil
+}
+
+// Handles `.schema [table]`, printing the statements that created the
+// schema objects, or only those of a table and its indexes and triggers
+func HandleSchema(cmd string, db *sqlitefile.Database) error {
+	only := sqlitefile.CleanKeyString(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), ".schema")))
+	rows, err := sqlitefile.ReadSchemaRows(db)
+	if err != nil {
+		return err
+	}
+	selected := []sqlitefile.SchemaRow{}
+	for _, row := range rows {
+		if row.SQL == "" || (only != "" && row.TableName != only) {
+			continue
+		}
+		selected = append(selected, row)
+	}
+	if jsonOutput {
+		return writeJSONDocument(selected)
+	}
+	for _, row := range selected {
+		fmt.Fprintln(output, row.SQL+";")
+	}
+	return nil
+}
+
+// Handles `.roots`, listing every schema object with its root page,
+// sorted by type and name
+func HandleRoots(db *sqlitefile.Database) error {
+	type root struct {
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		TableName string `json:"tbl_name"`
+		RootPage  int64  `json:"rootpage"`
+	}
+	rows, err := sqlitefile.ReadSchemaRows(db)
+	if err != nil {
+		return err
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Type != rows[j].Type {
+			return rows[i].Type < rows[j].Type
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	roots := make([]root, len(rows))
+	result := &resultSet{Columns: []string{"type", "name", "tbl_name", "rootpage"}, Rows: [][]any{}}
+	for i, row := range rows {
+		roots[i] = root{row.Type, row.Name, row.TableName, row.RootPage}
+		result.Rows = append(result.Rows, []any{row.Type, row.Name, row.TableName, row.RootPage})
+	}
+	if jsonOutput {
+		return writeJSONDocument(roots)
+	}
+	return writeResult(output, result)
+}
+
+// Handles `.counts`, printing the number of rows in every table
+func HandleCounts(db *sqlitefile.Database) error {
+	type tableCount struct {
+		Table string `json:"table"`
+		Rows  int64  `json:"rows"`
+	}
+	counts := []tableCount{}
+	// a table that cannot be counted is reported after the others
+	failed := []error{}
+	for _, name := range db.TableNames() {
+		n, err := db.CountRows(name)
+		if errors.Is(err, sqlitefile.ErrVirtualTable) {
+			continue
+		} else if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		counts = append(counts, tableCount{name, n})
+	}
+	if jsonOutput {
+		if err := writeJSONDocument(counts); err != nil {
+			return err
+		}
+		return errors.Join(failed...)
+	}
+	for _, c := range counts {
+		fmt.Fprintf(output, "%s: %d\n", c.Table, c.Rows)
+	}
+	return errors.Join(failed...)
+}
+
+// Handles `.analyze`, walking every b-tree and printing its rows, depth
+// and pages. .counts answers from the result until the database changes.
+func HandleAnalyze(db *sqlitefile.Database) error {
+	btrees, err := db.Analyze()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return writeJSONDocument(btrees)
+	}
+	result := &resultSet{Columns: []string{"name", "type", "tbl_name", "rows", "depth", "pages", "leaf_pages", "overflow_pages"}, Rows: [][]any{}}
+	for _, s := range btrees {
+		kind := "table"
+		if s.Index {
+			kind = "index"
+		}
+		result.Rows = append(result.Rows, []any{s.Name, kind, s.Table, s.Rows, int64(s.Depth), s.Pages, s.LeafPages, s.OverflowPages})
+	}
+	return writeResult(output, result)
+}
+
+// Matches s against an SQL LIKE pattern, where % matches any run of
+// characters and _ a single one. Like sqlite, only ASCII letters are
+// compared case-insensitively.
+func likeMatch(pattern, s string) bool {
+	p, r := []rune(pattern), []rune(s)
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		for ; i < len(p); i++ {
+			switch {
+			case p[i] == '%':
+				for k := j; k <= len(r); k++ {
+					if match(i+1, k) {
+						return true
+					}
+				}
+				return false
+			case j == len(r):
+				return false
+			case p[i] != '_' && asciiLower(p[i]) != asciiLower(r[j]):
+				return false
+			}
+			j++
+		}
+		return j == len(r)
+	}
+	return match(0, 0)
+}
+
+func asciiLower(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// Diagnostics about the database go to stderr through logger. Only
+// errors are shown unless -v asks for warnings or -vv for debug output
+// as well.
+var (
+	logLevel = new(slog.LevelVar)
+	logger   = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+)
+
+func init() {
+	logLevel.Set(slog.LevelError)
+}
+
+// Sets how much is logged from the number of v's given, as in -vv.
+// A negative count silences the logger, as --quiet does.
+func setVerbosity(n int) {
+	switch {
+	case n < 0:
+		logLevel.Set(slog.LevelError + 1)
+	case n == 0:
+		logLevel.Set(slog.LevelError)
+	case n == 1:
+		logLevel.Set(slog.LevelInfo)
+	default:
+		logLevel.Set(slog.LevelDebug)
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lindeneg/sql-exploration/sqlitefile"
 	"github.com/xwb1989/sqlparser"
 )
 
@@ -14,44 +17,285 @@ import (
 
 var t int64
 var timing bool = false
+var quiet bool = false
+
+// Options every database is opened with, set from the flags
+var openOptions = []sqlitefile.Option{sqlitefile.WithLogger(logger)}
 
 func main() {
-	if len(os.Args) < 3 {
-		log.Fatal("please provide arguments: file command")
-	}
-	if len(os.Args) > 3 && os.Args[3] == "-t" {
-		timing = true
-		t = time.Now().UnixMilli()
+	if len(os.Args) < 2 {
+		exit(ExitUsage, errors.New("please provide arguments: file [command]"))
 	}
 	databaseFile := os.Args[1]
-	cmd := os.Args[2]
-	db, err := newDatabaseFile(databaseFile)
+	cmd := ""
+	modeSet := false
+	flags := os.Args[2:]
+	// comparing databases takes the second one before the command
+	if len(flags) > 1 && strings.HasPrefix(flags[1], ".diff") {
+		cmd = ".diff " + flags[0]
+		flags = flags[2:]
+	}
+	for i := 0; i < len(flags); i++ {
+		switch arg := flags[i]; arg {
+		case "--export", "--out", "--bench", "--metrics", "--serve", "--grpc", "--nullvalue", "-nullvalue", "--blob":
+			if i+1 == len(flags) {
+				exit(ExitUsage, errors.New(arg+" needs a value"))
+			}
+			i++
+			if arg == "--bench" {
+				runs, err := strconv.Atoi(flags[i])
+				if err != nil || runs < 1 {
+					exit(ExitUsage, errors.New("--bench needs a number of runs"))
+				}
+				benchRuns = runs
+			} else if arg == "--out" {
+				exportPath = flags[i]
+			} else if arg == "--metrics" {
+				metricsAddr = flags[i]
+			} else if arg == "--serve" {
+				serveAddr = flags[i]
+			} else if arg == "--grpc" {
+				grpcAddr = flags[i]
+			} else if arg == "--nullvalue" || arg == "-nullvalue" {
+				nullValue = flags[i]
+			} else if arg == "--blob" {
+				if blobMode = flags[i]; !isBlobMode(blobMode) {
+					exit(ExitUsage, fmt.Errorf("unknown blob mode %q, use one of %s", blobMode, strings.Join(BlobModes, ", ")))
+				}
+			} else if exportFormat = flags[i]; !isExportFormat(exportFormat) {
+				exit(ExitUsage, fmt.Errorf("unknown export format %q, use one of %s", exportFormat, strings.Join(ExportFormats, ", ")))
+			}
+		case "-v", "-vv":
+			setVerbosity(len(arg) - 1)
+		case "--json":
+			jsonOutput = true
+		case "-t", "--time":
+			timing = true
+		case "-q", "--quiet":
+			quiet = true
+			setVerbosity(-1)
+		case "--watch":
+			watch = true
+		case "--tail":
+			tail = true
+		case "--no-progress":
+			showProgress = false
+		case "--no-color":
+			colorOutput = false
+		case "-j":
+			openOptions = append(openOptions, sqlitefile.WithIgnoreJournal())
+		case "-l":
+			openOptions = append(openOptions, sqlitefile.WithSharedLock())
+		default:
+			// output modes can be picked like in the sqlite3 shell, e.g. -csv
+			name := strings.TrimPrefix(arg, "-")
+			switch {
+			case name != arg && isOutputMode(name):
+				resultMode.Name = name
+				modeSet = true
+			case name != arg:
+				exit(ExitUsage, fmt.Errorf("unknown option %s", arg))
+			// the command can come before or after the flags
+			case cmd == "":
+				cmd = arg
+			default:
+				exit(ExitUsage, fmt.Errorf("unexpected argument %q, the command is %q", arg, cmd))
+			}
+		}
+	}
+	if watch && cmd == "" {
+		exit(ExitUsage, errors.New("--watch needs a command"))
+	}
+	if serveAddr != "" && (cmd != "" || watch) {
+		exit(ExitUsage, errors.New("--serve takes no command"))
+	}
+	if grpcAddr != "" && (cmd != "" || watch) {
+		exit(ExitUsage, errors.New("--grpc takes no command"))
+	}
+	if grpcAddr != "" && serveAddr != "" {
+		exit(ExitUsage, errors.New("--serve and --grpc cannot be used together"))
+	}
+	if tail && (cmd != "" || watch || serveAddr != "" || grpcAddr != "") {
+		exit(ExitUsage, errors.New("--tail takes no command"))
+	}
+	if metricsAddr != "" && cmd != "" && !watch {
+		exit(ExitUsage, errors.New("--metrics needs --watch, --serve, --grpc or the interactive shell"))
+	}
+	if benchRuns > 0 && cmd == "" {
+		exit(ExitUsage, errors.New("--bench needs a command"))
+	}
+	if terminalOutput && !modeSet {
+		resultMode.Name = "box"
+	}
+	// the export format defaults to the extension of the file
+	if exportPath != "" && exportFormat == "" {
+		if exportFormat = strings.TrimPrefix(filepath.Ext(exportPath), "."); !isExportFormat(exportFormat) {
+			exit(ExitUsage, errors.New("--out needs --export csv|json"))
+		}
+	}
+	t = time.Now().UnixMilli()
+	if strings.HasPrefix(strings.TrimSpace(cmd), ".createdb") {
+		pageSize, err := parseCreateDatabaseCommand(cmd)
+		if err != nil {
+			exit(exitCode(err), err)
+		}
+		if err := sqlitefile.Create(databaseFile, pageSize); err != nil {
+			exit(ExitDatabase, err)
+		}
+		return
+	}
+	if vfs := remoteVFS(databaseFile); vfs != nil {
+		openOptions = append(openOptions, sqlitefile.WithVFS(vfs), sqlitefile.WithReadAhead(RemoteReadAhead))
+	}
+	db, err := sqlitefile.Open(databaseFile, openOptions...)
+	if err != nil {
+		exit(ExitDatabase, err)
+	}
+	if err := serveMetrics(); err != nil {
+		exit(ExitFailure, err)
+	}
+	// without a command the database is opened in the interactive shell
+	if serveAddr != "" {
+		err = runServer(db)
+	} else if grpcAddr != "" {
+		err = runGRPCServer(db)
+	} else if tail {
+		err = runTail(db)
+	} else if cmd == "" {
+		err = runRepl(db)
+	} else if watch {
+		err = runWatch(cmd, db)
+	} else if benchRuns > 0 {
+		err = runBench(cmd, db)
+	} else if err = runCommand(cmd, db); err == nil {
+		printTiming()
+	}
+	closeOutput()
+	db.Close()
 	if err != nil {
-		log.Fatal(err.Error())
+		exit(exitCode(err), err)
+	}
+}
+
+func printTiming() {
+	if timing && !quiet {
+		diff := float64(time.Now().UnixMilli() - t)
+		fmt.Println(diff/1000, "seconds")
+	}
+}
+
+// Handles `.timer on|off`, printing how long each command took
+func HandleTimer(cmd string) error {
+	fields := strings.Fields(cmd)
+	if len(fields) != 2 || (fields[1] != "on" && fields[1] != "off") {
+		return usageError(".timer on|off")
+	}
+	timing = fields[1] == "on"
+	return nil
+}
+
+// Executes a single dot-command or SQL statement against the database.
+// Output redirected with .once goes back to stdout afterwards.
+func runCommand(cmd string, db *sqlitefile.Database) (err error) {
+	defer func(start time.Time) { recordCommand(db, start, err) }(time.Now())
+	if strings.HasPrefix(cmd, ".output") || strings.HasPrefix(cmd, ".once") {
+		return HandleOutput(cmd)
+	}
+	if outputOnce {
+		defer closeOutput()
+	}
+	return executeCommand(cmd, db)
+}
+
+func executeCommand(cmd string, db *sqlitefile.Database) error {
+	if strings.HasPrefix(cmd, ".timer") {
+		return HandleTimer(cmd)
 	}
-	defer db.File.Close()
 	switch cmd {
 	case ".dbinfo":
-		fmt.Printf("database page size: \t%v\n", db.Header.PageSize)
-		fmt.Printf("number of tables: \t%v\n", len(db.Tables))
-		break
-	case ".tables":
-		fmt.Println(strings.Join(db.TableNames(), " "))
+		return HandleDbinfo(db)
 	case ".roots":
-		fmt.Println(db)
-	default:
+		return HandleRoots(db)
+	case ".counts":
+		return HandleCounts(db)
+	case ".analyze":
+		return HandleAnalyze(db)
+	}
+	if strings.HasPrefix(cmd, ".tables") {
+		return HandleTables(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".schema") {
+		return HandleSchema(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".dump") {
+		return HandleDump(cmd, db, output)
+	}
+	if strings.HasPrefix(cmd, ".hexdump") {
+		return HandleHexdump(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".page") {
+		return HandlePage(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".read") {
+		return HandleRead(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".diff") {
+		return HandleDiff(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".recover") {
+		return HandleRecover(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".cell") {
+		return HandleCell(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".match") {
+		return HandleMatch(cmd, db)
+	}
+	if cmd == ".fts" {
+		return HandleFTS(db)
+	}
+	if strings.HasPrefix(cmd, ".rtree") {
+		return HandleRTree(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".backup") {
+		return HandleBackup(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".changeset") {
+		return HandleChangeset(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".sqlar") {
+		return HandleSQLAR(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".btree") {
+		return HandleBtree(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".mode") {
+		return HandleMode(cmd)
+	}
+	if strings.HasPrefix(cmd, ".nullvalue") {
+		return HandleNullValue(cmd)
+	}
+	if strings.HasPrefix(cmd, ".blob") {
+		return HandleBlob(cmd)
+	}
+	if strings.HasPrefix(cmd, ".defrag") {
+		return HandleDefragment(cmd, db)
+	}
+	if strings.HasPrefix(cmd, ".verify-unique") {
+		return HandleVerifyUnique(cmd, db)
+	}
+	if sqlparser.Preview(cmd) == sqlparser.StmtSelect {
 		stmt, err := sqlparser.Parse(cmd)
 		if err != nil {
-			log.Fatal("unknown command/query: " + cmd)
+			return &exitError{ExitUsage, errors.New("unknown command/query: " + cmd)}
 		}
-		switch stmt := stmt.(type) {
-		case *sqlparser.Select:
-			HandleSelect(NewSelectCtx(stmt), db)
+		if stmt, ok := stmt.(*sqlparser.Select); ok {
+			return HandleSelect(sqlitefile.NewSelectCtx(stmt), db)
 		}
 	}
-	if timing {
-		diff := float64(time.Now().UnixMilli() - t)
-		fmt.Println(diff/1000, "seconds")
+	err := db.Exec(cmd)
+	if errors.Is(err, sqlitefile.ErrUnknownStatement) {
+		return &exitError{ExitUsage, errors.New("unknown command/query: " + cmd)}
 	}
-
+	return err
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Set with --metrics to serve the counters of a watched database, or
+// one opened in the interactive shell, over HTTP
+var metricsAddr string
+
+// Counters served by the metrics endpoint. Commands update them as they
+// finish, so the HTTP handlers never touch the database itself.
+var metrics struct {
+	sync.Mutex
+	stats          sqlitefile.Stats
+	commands       int64
+	commandErrors  int64
+	commandSeconds float64
+}
+
+// Updates the metrics once a command has run
+func recordCommand(db *sqlitefile.Database, start time.Time, err error) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.stats = db.Stats()
+	metrics.commands++
+	if err != nil {
+		metrics.commandErrors++
+	}
+	metrics.commandSeconds += time.Since(start).Seconds()
+}
+
+type metric struct {
+	name  string
+	help  string
+	value float64
+}
+
+func currentMetrics() []metric {
+	metrics.Lock()
+	defer metrics.Unlock()
+	s := metrics.stats
+	return []metric{
+		{"pages_read_total", "Pages read by the b-tree code.", float64(s.PagesRead)},
+		{"cache_hits_total", "Pages found in the page cache.", float64(s.CacheHits)},
+		{"cache_misses_total", "Pages missing from the page cache.", float64(s.CacheMisses)},
+		{"cells_decoded_total", "Records decoded from b-tree cells.", float64(s.CellsDecoded)},
+		{"bytes_read_total", "Bytes read from the database file and WAL.", float64(s.BytesRead)},
+		{"seeks_total", "Seeks of the page reader.", float64(s.Seeks)},
+		{"commands_total", "Commands run.", float64(metrics.commands)},
+		{"command_errors_total", "Commands that failed.", float64(metrics.commandErrors)},
+		{"command_seconds_total", "Time spent running commands.", metrics.commandSeconds},
+	}
+}
+
+// Writes the metrics, all of them counters, in the Prometheus text format
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+func handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range currentMetrics() {
+		name := "sqlexploration_" + m.name
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %v\n", name, m.help, name, name, m.value)
+	}
+}
+
+// Serves the metrics as expvar JSON on /debug/vars and in the
+// Prometheus format on /metrics, until the program exits
+func serveMetrics() error {
+	if metricsAddr == "" {
+		return nil
+	}
+	expvar.Publish("sqlexploration", expvar.Func(func() any {
+		vars := map[string]float64{}
+		for _, m := range currentMetrics() {
+			vars[m.name] = m.value
+		}
+		return vars
+	}))
+	http.HandleFunc("/metrics", handlePrometheus)
+	listener, err := net.Listen("tcp", metricsAddr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "-- serving metrics on http://%s/metrics\n", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, nil); err != nil && !errors.Is(err, net.ErrClosed) {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+	}()
+	return nil
+}
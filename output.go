@@ -0,0 +1,496 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// The rows produced by a query along with the column names
+type resultSet struct {
+	Columns []string
+	Rows    [][]any
+}
+
+// How query results are printed, changed with .mode. The insert
+// mode writes INSERT statements into the table named by Table.
+type outputMode struct {
+	Name  string
+	Table string
+}
+
+var resultMode = outputMode{Name: "list", Table: "table"}
+
+// Results written to a terminal are aligned in a box unless a mode is
+// picked, have long values cut short and are colored unless NO_COLOR is
+// set or --no-color is given. Piped output stays in list mode.
+var (
+	terminalOutput = readline.IsTerminal(int(os.Stdout.Fd()))
+	colorOutput    = os.Getenv("NO_COLOR") == ""
+)
+
+// Longest value shown in a column when writing to a terminal
+const TerminalColumnWidth = 40
+
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorDim   = "\x1b[2m"
+)
+
+var OutputModes = []string{"list", "column", "box", "csv", "tabs", "tsv", "json", "markdown", "insert"}
+
+func isOutputMode(name string) bool {
+	for _, m := range OutputModes {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// How the text output modes show NULL and blobs, set with .nullvalue
+// and .blob. Blobs are written as they are unless shown as hex, base64
+// or only their size. JSON and INSERT output keep the values.
+var (
+	nullValue = ""
+	blobMode  = "raw"
+)
+
+var BlobModes = []string{"raw", "hex", "base64", "size"}
+
+// Formats a value for the text output modes
+func formatDisplayValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return nullValue
+	case []byte:
+		switch blobMode {
+		case "hex":
+			return strings.ToUpper(hex.EncodeToString(v))
+		case "base64":
+			return base64.StdEncoding.EncodeToString(v)
+		case "size":
+			return fmt.Sprintf("(%d-byte blob)", len(v))
+		}
+	}
+	return sqlitefile.FormatValue(v)
+}
+
+// Handles `.nullvalue text`, the text NULL is shown as, which may be
+// quoted to hold spaces or be empty
+func HandleNullValue(cmd string) error {
+	value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), ".nullvalue"))
+	if value == "" {
+		return usageError(".nullvalue text")
+	}
+	if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+		value = value[1 : n-1]
+	}
+	nullValue = value
+	return nil
+}
+
+// Handles `.blob [raw|hex|base64|size]`, printing the current way blobs
+// are shown without arguments
+func HandleBlob(cmd string) error {
+	fields := strings.Fields(cmd)
+	if len(fields) == 1 {
+		fmt.Fprintf(output, "current blob mode: %s\n", blobMode)
+		return nil
+	}
+	if len(fields) != 2 || !isBlobMode(fields[1]) {
+		return usageError(fmt.Sprintf(".blob [%s]", strings.Join(BlobModes, "|")))
+	}
+	blobMode = fields[1]
+	return nil
+}
+
+func isBlobMode(name string) bool {
+	for _, m := range BlobModes {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Handles `.mode [name] [table]`, printing the current mode without arguments
+func HandleMode(cmd string) error {
+	fields := strings.Fields(cmd)
+	if len(fields) == 1 {
+		fmt.Fprintf(output, "current output mode: %s\n", resultMode.Name)
+		return nil
+	}
+	name := strings.ToLower(fields[1])
+	if !isOutputMode(name) || len(fields) > 3 || (len(fields) == 3 && name != "insert") {
+		return usageError(fmt.Sprintf(".mode [%s] [table]", strings.Join(OutputModes, "|")))
+	}
+	resultMode = outputMode{Name: name, Table: "table"}
+	if len(fields) == 3 {
+		resultMode.Table = sqlitefile.CleanKeyString(fields[2])
+	}
+	return nil
+}
+
+// Prints the result set in the current output mode
+func writeResult(w io.Writer, r *resultSet) error {
+	var out strings.Builder
+	switch resultMode.Name {
+	case "list":
+		writeSeparated(&out, r, "|", formatDisplayValue)
+	case "tabs", "tsv":
+		writeSeparated(&out, r, "\t", formatDisplayValue)
+	case "csv":
+		writeSeparated(&out, r, ",", formatCsvValue)
+	case "json":
+		writeJSON(&out, r)
+	case "insert":
+		for _, row := range r.Rows {
+			values := make([]string, len(row))
+			for i, v := range row {
+				values[i] = sqlitefile.FormatSQLValue(v)
+			}
+			fmt.Fprintf(&out, "INSERT INTO %s VALUES(%s);\n", sqlitefile.QuoteIdentifier(resultMode.Table), strings.Join(values, ","))
+		}
+	case "column", "box", "markdown":
+		writeColumns(&out, r, resultMode.Name, w == io.Writer(os.Stdout) && terminalOutput)
+	default:
+		return fmt.Errorf("unknown output mode %q", resultMode.Name)
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func writeSeparated(out *strings.Builder, r *resultSet, separator string, format func(any) string) {
+	rowSeparator := "\n"
+	if separator == "," {
+		// like sqlite, csv rows end in CRLF as RFC 4180 asks for
+		rowSeparator = "\r\n"
+	}
+	for _, row := range r.Rows {
+		for i, v := range row {
+			if i > 0 {
+				out.WriteString(separator)
+			}
+			out.WriteString(format(v))
+		}
+		out.WriteString(rowSeparator)
+	}
+}
+
+// Quotes text containing the separator, quotes, control
+// characters or non-ASCII bytes, doubling embedded quotes
+func formatCsvValue(v any) string {
+	s := formatDisplayValue(v)
+	switch v.(type) {
+	case string, []byte:
+	default:
+		return s
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == ',' {
+			return "\"" + strings.ReplaceAll(s, "\"", "\"\"") + "\""
+		}
+	}
+	return s
+}
+
+// Writes the rows as an array of objects keyed by column name,
+// one object per line like the sqlite3 shell
+func writeJSON(out *strings.Builder, r *resultSet) {
+	for i, row := range r.Rows {
+		if i == 0 {
+			out.WriteString("[{")
+		} else {
+			out.WriteString(",\n{")
+		}
+		for j, v := range row {
+			if j > 0 {
+				out.WriteString(",")
+			}
+			name := ""
+			if j < len(r.Columns) {
+				name = r.Columns[j]
+			}
+			out.WriteString(jsonString(name) + ":" + formatJSONValue(v))
+		}
+		out.WriteString("}")
+	}
+	if len(r.Rows) > 0 {
+		out.WriteString("]\n")
+	}
+}
+
+func formatJSONValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "null"
+		}
+	case string:
+		return jsonString(v)
+	case []byte:
+		return jsonString(string(v))
+	}
+	return sqlitefile.FormatValue(v)
+}
+
+// Escapes quotes, backslashes and control characters,
+// leaving other characters as they are
+func jsonString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString("\\\"")
+		case '\\':
+			b.WriteString("\\\\")
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\b':
+			b.WriteString("\\b")
+		case '\f':
+			b.WriteString("\\f")
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&b, "\\u%04x", r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Aligns the values in columns as wide as their widest value or header.
+// Values spanning several lines continue on the following lines. On a
+// terminal wide values are cut short and the header and rules colored.
+func writeColumns(out *strings.Builder, r *resultSet, style string, terminal bool) {
+	if len(r.Rows) == 0 {
+		return
+	}
+	widths := make([]int, len(r.Columns))
+	for i, name := range r.Columns {
+		widths[i] = displayWidth(name)
+	}
+	cells := make([][][]string, len(r.Rows))
+	for i, row := range r.Rows {
+		cells[i] = make([][]string, len(row))
+		for j, v := range row {
+			lines := strings.Split(formatDisplayValue(v), "\n")
+			for k, line := range lines {
+				line = printableCell(line)
+				if terminal {
+					line = truncateDisplay(line, TerminalColumnWidth)
+				}
+				lines[k] = line
+				if j < len(widths) {
+					widths[j] = max(widths[j], displayWidth(line))
+				}
+			}
+			cells[i][j] = lines
+		}
+	}
+	pad := func(s string, width int, center bool) string {
+		n := width - displayWidth(s)
+		if n <= 0 {
+			return s
+		}
+		if center {
+			return strings.Repeat(" ", n/2) + s + strings.Repeat(" ", n-n/2)
+		}
+		return s + strings.Repeat(" ", n)
+	}
+	paint := func(s, color string) string {
+		if !terminal || !colorOutput {
+			return s
+		}
+		return color + s + colorReset
+	}
+	rule := func(left, fill, middle, right string) {
+		parts := make([]string, len(widths))
+		for i, w := range widths {
+			parts[i] = strings.Repeat(fill, w+2)
+		}
+		out.WriteString(paint(left+strings.Join(parts, middle)+right, colorDim) + "\n")
+	}
+	line := func(values []string, center bool, color string) {
+		padded := make([]string, len(widths))
+		for i, w := range widths {
+			v := ""
+			if i < len(values) {
+				v = values[i]
+			}
+			padded[i] = pad(v, w, center)
+			if color != "" {
+				padded[i] = paint(padded[i], color)
+			}
+		}
+		switch style {
+		case "box":
+			bar := paint("│", colorDim)
+			out.WriteString(bar + " " + strings.Join(padded, " "+bar+" ") + " " + bar + "\n")
+		case "markdown":
+			out.WriteString("| " + strings.Join(padded, " | ") + " |\n")
+		default:
+			out.WriteString(strings.Join(padded, "  ") + "\n")
+		}
+	}
+	switch style {
+	case "box":
+		rule("┌", "─", "┬", "┐")
+		line(r.Columns, true, colorBold)
+		rule("├", "─", "┼", "┤")
+	case "markdown":
+		line(r.Columns, true, "")
+		rule("|", "-", "|", "|")
+	default:
+		line(r.Columns, false, colorBold)
+		dashes := make([]string, len(widths))
+		for i, w := range widths {
+			dashes[i] = strings.Repeat("-", w)
+		}
+		line(dashes, false, colorDim)
+	}
+	for _, row := range cells {
+		height := 1
+		for _, lines := range row {
+			height = max(height, len(lines))
+		}
+		for h := 0; h < height; h++ {
+			values := make([]string, len(row))
+			for j, lines := range row {
+				if h < len(lines) {
+					values[j] = lines[h]
+				}
+			}
+			line(values, false, "")
+		}
+	}
+	if style == "box" {
+		rule("└", "─", "┴", "┘")
+	}
+}
+
+// Replaces the bytes of a cell that are not UTF-8 and the control
+// characters, which raw blobs may hold, with U+FFFD so that the cell
+// takes the columns it is measured to take
+func printableCell(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if unicode.IsControl(r) {
+			r = utf8.RuneError
+		}
+		b.WriteRune(r)
+		i += size
+	}
+	return b.String()
+}
+
+// East Asian wide and fullwidth characters and emoji, which take two
+// columns of a terminal
+var wideRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1},
+		{0x2e80, 0x303e, 1},
+		{0x3041, 0x33ff, 1},
+		{0x3400, 0x4dbf, 1},
+		{0x4e00, 0x9fff, 1},
+		{0xa000, 0xa4cf, 1},
+		{0xac00, 0xd7a3, 1},
+		{0xf900, 0xfaff, 1},
+		{0xfe30, 0xfe4f, 1},
+		{0xff00, 0xff60, 1},
+		{0xffe0, 0xffe6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1f300, 0x1f64f, 1},
+		{0x1f900, 0x1f9ff, 1},
+		{0x20000, 0x2fffd, 1},
+		{0x30000, 0x3fffd, 1},
+	},
+}
+
+// The columns of a terminal a character takes: two for wide ones, none
+// for combining marks and format characters
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case unicode.Is(wideRunes, r):
+		return 2
+	}
+	return 1
+}
+
+// The columns of a terminal s takes
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// Where query results and command output are written, stdout unless
+// redirected to a file with .output, or with .once for one command
+var (
+	output     io.Writer = os.Stdout
+	outputFile *os.File
+	outputOnce bool
+)
+
+// Handles `.output [file]` and `.once file`. Without a file, or with
+// "stdout", output goes back to stdout.
+func HandleOutput(cmd string) error {
+	fields := strings.Fields(cmd)
+	name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), fields[0]))
+	if err := closeOutput(); err != nil {
+		return err
+	}
+	if fields[0] == ".once" && name == "" {
+		return usageError(".once file")
+	}
+	if name == "" || name == "stdout" {
+		return nil
+	}
+	f, err := os.Create(sqlitefile.CleanKeyString(name))
+	if err != nil {
+		return err
+	}
+	output = f
+	outputFile = f
+	outputOnce = fields[0] == ".once"
+	return nil
+}
+
+// Closes the file output was redirected to and returns to stdout
+func closeOutput() error {
+	output = os.Stdout
+	outputOnce = false
+	if outputFile == nil {
+		return nil
+	}
+	err := outputFile.Close()
+	outputFile = nil
+	return err
+}
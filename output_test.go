@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Raw blobs and wide characters are measured by the columns they take,
+// so every line of an aligned table is as wide as the others
+func TestWriteColumnsWidths(t *testing.T) {
+	r := &resultSet{
+		Columns: []string{"name", "data"},
+		Rows: [][]any{
+			{"漢字テキスト", []byte{0xff, 0xfe, 0x00, 'a', 0x07}},
+			{"é", []byte("plain")},
+			{"x", []byte("日本")},
+		},
+	}
+	for _, style := range []string{"box", "markdown", "column"} {
+		var out strings.Builder
+		writeColumns(&out, r, style, false)
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		for _, line := range lines {
+			if style == "column" {
+				line = strings.TrimRight(line, " ")
+				if w := displayWidth(line); w > displayWidth(lines[1]) {
+					t.Errorf("%s: %q is %d columns wide, more than the rule", style, line, w)
+				}
+				continue
+			}
+			if w := displayWidth(line); w != displayWidth(lines[0]) {
+				t.Errorf("%s: %q is %d columns wide, not %d", style, line, w, displayWidth(lines[0]))
+			}
+		}
+	}
+}
+
+func TestTruncateDisplay(t *testing.T) {
+	for _, test := range []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"a longer value", 10, "a longe..."},
+		{"漢字漢字漢字漢字", 10, "漢字漢..."},
+	} {
+		if got := truncateDisplay(test.s, test.width); got != test.want {
+			t.Errorf("truncateDisplay(%q, %d) = %q, want %q", test.s, test.width, got, test.want)
+		}
+	}
+}
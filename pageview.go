@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.page N`, decoding page N according to what it is used for.
+// B-tree pages show their header and every cell with its decoded record,
+// freelist trunks the leaves they hold, overflow pages the next page of
+// their chain and pointer map pages their entries.
+func HandlePage(cmd string, db *sqlitefile.Database) error {
+	n, err := parsePageArgument(cmd)
+	if err != nil {
+		return err
+	}
+	p, err := sqlitefile.ReadRawPage(db, n)
+	if err != nil {
+		return err
+	}
+	uses, err := sqlitefile.MapPages(db)
+	if err != nil {
+		return err
+	}
+	use := uses[n]
+	out := bufio.NewWriter(output)
+	fmt.Fprintf(out, "page %d: %s", n, use.Kind)
+	if use.Owner != "" {
+		fmt.Fprintf(out, " of %s", use.Owner)
+	}
+	if use.Parent != 0 {
+		fmt.Fprintf(out, ", referenced by page %d", use.Parent)
+	}
+	fmt.Fprintln(out)
+	switch use.Kind {
+	case sqlitefile.PageBtree:
+		writeBtreeHeaderFields(out, p)
+		for i := 0; i < p.CellCount(); i++ {
+			if err := writeBtreeCell(out, db, p, i); err != nil {
+				return err
+			}
+		}
+	case sqlitefile.PageOverflow:
+		fmt.Fprintf(out, "  next overflow page  %d\n", binary.BigEndian.Uint32(p.Data))
+	case sqlitefile.PageFreelistTrunk:
+		count := int(binary.BigEndian.Uint32(p.Data[4:]))
+		leaves := []string{}
+		for i := 0; i < count && 8+4*i+4 <= len(p.Data); i++ {
+			leaves = append(leaves, fmt.Sprint(binary.BigEndian.Uint32(p.Data[8+4*i:])))
+		}
+		fmt.Fprintf(out, "  next trunk page     %d\n", binary.BigEndian.Uint32(p.Data))
+		fmt.Fprintf(out, "  leaf count          %d\n", count)
+		fmt.Fprintf(out, "  leaves              %s\n", strings.Join(leaves, " "))
+	case sqlitefile.PagePtrmap:
+		writePtrmapEntries(out, p)
+	}
+	return out.Flush()
+}
+
+var ptrmapTypeNames = map[byte]string{
+	1: "root page",
+	2: "free page",
+	3: "first overflow page",
+	4: "later overflow page",
+	5: "non-root b-tree page",
+}
+
+// Each 5 byte entry describes the page following the pointer map page
+// by its position: a type and the parent page
+func writePtrmapEntries(w io.Writer, p *sqlitefile.RawPage) {
+	for i := 0; i+5 <= p.Usable; i += 5 {
+		kind := p.Data[i]
+		if kind == 0 {
+			break
+		}
+		fmt.Fprintf(w, "  page %-8d %-22s parent %d\n",
+			p.Number+int64(i/5)+1, ptrmapTypeNames[kind], binary.BigEndian.Uint32(p.Data[i+1:]))
+	}
+}
+
+func writeBtreeCell(w io.Writer, db *sqlitefile.Database, p *sqlitefile.RawPage, i int) error {
+	fmt.Fprintf(w, "cell %d at %d, %d bytes:", i, p.CellPointer(i), p.CellSize(i))
+	if !p.IsLeaf() {
+		fmt.Fprintf(w, " left child %d,", p.CellLeftChild(i))
+	}
+	if p.PageType() == sqlitefile.InteriorTableType {
+		fmt.Fprintf(w, " rowid %d\n", p.CellRowID(i))
+		return nil
+	}
+	if p.PageType() == sqlitefile.LeafTableType {
+		fmt.Fprintf(w, " rowid %d,", p.CellRowID(i))
+	}
+	payloadSize, local, overflow := p.CellPayload(i)
+	fmt.Fprintf(w, " payload %d bytes", payloadSize)
+	if overflow != 0 {
+		fmt.Fprintf(w, " (%d local, overflow page %d)", len(local), overflow)
+	}
+	values, err := sqlitefile.ReadCellValues(db, p, i)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n  %s\n", sqlitefile.FormatValueTuple(values))
+	return nil
+}
+
+// Cuts s down to width columns of a terminal, marking the cut with "..."
+func truncateDisplay(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	n := 0
+	for i, r := range s {
+		if n += runeWidth(r); n > width-3 {
+			return s[:i] + "..."
+		}
+	}
+	return s
+}
+
+// Longest decoded value shown by .cell
+const CellValueDisplayWidth = 60
+
+// Handles `.cell PAGE INDEX`, showing every field of a cell with its
+// offset and bytes: the left child pointer, the payload size and rowid
+// varints, the record header with the serial type of each column, the
+// decoded column values and the overflow chain. Fields stored on an
+// overflow page have no offset on the page and are shown with "----".
+func HandleCell(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) != 3 {
+		return usageError(".cell page index")
+	}
+	n, err := parsePageArgument(strings.Join(fields[:2], " "))
+	if err != nil {
+		return err
+	}
+	i, err := strconv.Atoi(fields[2])
+	if err != nil || i < 0 {
+		return fmt.Errorf("invalid cell index: %s", fields[2])
+	}
+	p, err := sqlitefile.ReadRawPage(db, n)
+	if err != nil {
+		return err
+	}
+	if _, ok := sqlitefile.PageTypeNames[p.PageType()]; !ok {
+		return fmt.Errorf("page %d is not a b-tree page", n)
+	}
+	if i >= p.CellCount() {
+		return fmt.Errorf("page %d has %d cells", n, p.CellCount())
+	}
+	l := p.CellLayout(i)
+	out := bufio.NewWriter(output)
+	fmt.Fprintf(out, "page %d cell %d at offset %d, %d bytes (%s)\n",
+		n, i, l.Start, l.End-l.Start, sqlitefile.PageTypeNames[p.PageType()])
+	field := func(at int, data []byte, name string, value any) {
+		offset := "----"
+		if at >= 0 {
+			offset = fmt.Sprintf("%04x", at)
+		}
+		hex := []string{}
+		for j, b := range data {
+			if j == 8 {
+				hex = append(hex, "..")
+				break
+			}
+			hex = append(hex, fmt.Sprintf("%02x", b))
+		}
+		fmt.Fprintf(out, "  %s  %-26s %-20s %v\n", offset, strings.Join(hex, " "), name, value)
+	}
+	varint := func(f sqlitefile.VarintField, name string) {
+		field(f.Start, p.Data[f.Start:f.End], name, f.Value)
+	}
+	if !p.IsLeaf() {
+		field(l.Start, p.Data[l.Start:l.Start+4], "left child", l.LeftChild)
+	}
+	if p.PageType() != sqlitefile.InteriorTableType {
+		varint(l.PayloadSize, "payload size")
+	}
+	if p.PageType() == sqlitefile.LeafTableType || p.PageType() == sqlitefile.InteriorTableType {
+		varint(l.RowID, "rowid")
+	}
+	if p.PageType() == sqlitefile.InteriorTableType {
+		return out.Flush()
+	}
+	payload, err := sqlitefile.AssembleCellPayload(p, i, func(n int64) (*sqlitefile.RawPage, error) { return sqlitefile.ReadRawPage(db, n) })
+	if err != nil {
+		return err
+	}
+	record, err := sqlitefile.DecodeRecordLayout(payload)
+	if err != nil {
+		return err
+	}
+	values, err := sqlitefile.NewRecordCell(0, payload)
+	if err != nil {
+		return err
+	}
+	values.TextEncoding = db.TextEncoding
+	// offsets into the payload are only on this page within the local part
+	pageOffset := func(at int) int {
+		if at < l.Local {
+			return l.PayloadStart + at
+		}
+		return -1
+	}
+	fmt.Fprintln(out, "record header")
+	h := record.HeaderSize
+	field(pageOffset(h.Start), payload[h.Start:h.End], "header size", h.Value)
+	for j, c := range record.Columns {
+		field(pageOffset(c.Type.Start), payload[c.Type.Start:c.Type.End],
+			fmt.Sprintf("column %d type", j), fmt.Sprintf("%d (%s)", c.Type.Value, sqlitefile.NewCellHeader(c.Type.Value)))
+	}
+	fmt.Fprintln(out, "record content")
+	for j, c := range record.Columns {
+		v, err := values.ReadDataFromHeaderIndex(j)
+		if err != nil {
+			return err
+		}
+		field(pageOffset(c.Start), payload[c.Start:c.End],
+			fmt.Sprintf("column %d", j), truncateDisplay(sqlitefile.FormatSQLValue(v), CellValueDisplayWidth))
+	}
+	if l.Overflow != 0 {
+		chain := []string{}
+		for next := l.Overflow; next != 0; {
+			chain = append(chain, fmt.Sprint(next))
+			op, err := sqlitefile.ReadRawPage(db, int64(next))
+			if err != nil {
+				return err
+			}
+			next = binary.BigEndian.Uint32(op.Data)
+		}
+		fmt.Fprintf(out, "  %04x  %-26s %-20s %s\n", l.PayloadStart+l.Local,
+			fmt.Sprintf("% x", p.Data[l.PayloadStart+l.Local:l.End]), "overflow chain", strings.Join(chain, " -> "))
+	}
+	return out.Flush()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// Whether scans report their progress on stderr, only done on a
+// terminal and turned off with --no-progress or --quiet
+var showProgress = readline.IsTerminal(int(os.Stderr.Fd()))
+
+// Time a scan runs before its progress is first reported, and between
+// reports after that
+const ProgressInterval = 500 * time.Millisecond
+
+// Counts the pages a table scan has read. The total is estimated from
+// the average number of children of the interior pages read on each
+// level of the b-tree, and gets closer as more of them are read.
+type scanProgress struct {
+	table    string
+	pages    int
+	children []int
+	interior []int
+	last     time.Time
+	reported bool
+}
+
+func newScanProgress(table string) *scanProgress {
+	if !showProgress || quiet {
+		return nil
+	}
+	return &scanProgress{table: table, last: time.Now()}
+}
+
+// Records a page read at depth, the root being at depth 0, with the
+// given number of children, which is 0 for leaf pages
+func (p *scanProgress) Visit(depth, children int) {
+	if p == nil {
+		return
+	}
+	p.pages++
+	if children > 0 {
+		for len(p.interior) <= depth {
+			p.interior = append(p.interior, 0)
+			p.children = append(p.children, 0)
+		}
+		p.interior[depth]++
+		p.children[depth] += children
+	}
+	if time.Since(p.last) >= ProgressInterval {
+		p.last = time.Now()
+		p.reported = true
+		fmt.Fprintf(os.Stderr, "\rscanning %s: %d of ~%d pages", p.table, p.pages, p.Estimate())
+	}
+}
+
+// Estimated number of pages in the b-tree
+func (p *scanProgress) Estimate() int {
+	total, level := 1.0, 1.0
+	for d := range p.interior {
+		level *= float64(p.children[d]) / float64(p.interior[d])
+		total += level
+	}
+	return max(int(total), p.pages)
+}
+
+// Clears the progress line once the scan is over
+func (p *scanProgress) Done() {
+	if p != nil && p.reported {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.recover [table]`, searching the free space of the database
+// for rows that were deleted but not yet overwritten, and writing them as
+// INSERT statements with a comment saying where they were found.
+func HandleRecover(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) > 2 {
+		return usageError(".recover [table]")
+	}
+	names := db.TableNames()
+	if len(fields) == 2 {
+		names = []string{sqlitefile.CleanKeyString(fields[1])}
+	}
+	records, err := db.Recover(names)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(output)
+	for _, r := range records {
+		schema := db.Tables[r.Table]
+		values := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			v = schema.ApplyAffinity(i, v)
+			if i == schema.RowidColumn && r.HasRowID {
+				v = r.RowID
+			}
+			values[i] = sqlitefile.FormatSQLValue(v)
+		}
+		fmt.Fprintf(out, "INSERT INTO %s VALUES(%s); -- page %d offset %d, %s\n",
+			sqlitefile.QuoteIdentifier(r.Table), strings.Join(values, ","), r.Page, r.Offset, r.Source)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Leaf pages read ahead of table scans of remote databases, where every
+// page missing from the chunk cache costs a round trip
+const RemoteReadAhead = 8
+
+// Picks the VFS for databases given as a URL, reading the credentials of
+// S3 and GCS from the environment variables their own tools use.
+// Returns nil for local files.
+func remoteVFS(name string) sqlitefile.VFS {
+	switch {
+	case strings.HasPrefix(name, "http://"), strings.HasPrefix(name, "https://"):
+		return sqlitefile.NewHTTPVFS()
+	case strings.HasPrefix(name, "s3://"):
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		return sqlitefile.NewS3VFS(sqlitefile.S3Config{
+			Region:          region,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+		})
+	case strings.HasPrefix(name, "gs://"):
+		return sqlitefile.NewGCSVFS(sqlitefile.GCSConfig{Token: os.Getenv("CLOUDSDK_AUTH_ACCESS_TOKEN")})
+	}
+	return nil
+}
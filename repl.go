@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+const (
+	ReplPrompt             = "sqlite> "
+	ReplContinuationPrompt = "   ...> "
+	ReplHistoryFile        = ".sql_exploration_history"
+)
+
+// Dot-commands offered by tab completion
+var ReplDotCommands = []string{
+	".analyze", ".backup", ".blob", ".btree", ".cell", ".changeset", ".counts", ".dbinfo", ".defrag", ".diff", ".dump", ".exit", ".fts", ".hexdump",
+	".match", ".mode", ".nullvalue", ".once", ".output", ".page", ".quit", ".read", ".recover", ".roots", ".rtree",
+	".schema", ".sqlar", ".tables", ".timer", ".verify-unique",
+}
+
+// Reads dot-commands and SQL statements from the terminal until .quit,
+// .exit or end of input. Dot-commands take up a single line while SQL
+// statements may span several lines and end with a semicolon. Input is
+// remembered across sessions in a history file in the home directory.
+func runRepl(db *sqlitefile.Database) error {
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, ReplHistoryFile)
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:                 ReplPrompt,
+		HistoryFile:            historyFile,
+		DisableAutoSaveHistory: true,
+		AutoComplete:           &replCompleter{db},
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+	pending := ""
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			// Ctrl-C abandons the statement being typed
+			pending = ""
+			rl.SetPrompt(ReplPrompt)
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if pending == "" {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, ".") {
+				rl.SaveHistory(trimmed)
+				if trimmed == ".quit" || trimmed == ".exit" {
+					return nil
+				}
+				runReplCommand(trimmed, db)
+				continue
+			}
+		}
+		pending += line + "\n"
+		statements, rest := splitStatements(pending)
+		if len(statements) == 0 {
+			rl.SetPrompt(ReplContinuationPrompt)
+			continue
+		}
+		rl.SaveHistory(strings.Join(strings.Fields(pending[:len(pending)-len(rest)]), " "))
+		for _, stmt := range statements {
+			runReplCommand(stmt, db)
+		}
+		pending = strings.TrimLeft(rest, " \t\n")
+		if pending == "" {
+			rl.SetPrompt(ReplPrompt)
+		} else {
+			rl.SetPrompt(ReplContinuationPrompt)
+		}
+	}
+}
+
+// Runs a command, reporting errors and panics instead of exiting
+// so the session survives a failing statement
+func runReplCommand(cmd string, db *sqlitefile.Database) {
+	t = time.Now().UnixMilli()
+	if err := runCommandRecovered(cmd, db); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return
+	}
+	printTiming()
+}
+
+// Runs a command, turning a panic into an error
+func runCommandRecovered(cmd string, db *sqlitefile.Database) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return runCommand(cmd, db)
+}
+
+// Completes dot-commands at the start of a line and table and column
+// names elsewhere. Columns of the tables named on the line are offered
+// first, those of every table when none is named yet.
+type replCompleter struct {
+	db *sqlitefile.Database
+}
+
+func (c *replCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	head := string(line[:pos])
+	start := strings.LastIndexFunc(head, func(r rune) bool {
+		return strings.ContainsRune(" \t\n,()=<>'\"", r)
+	}) + 1
+	word := head[start:]
+	candidates := []string{}
+	if strings.HasPrefix(word, ".") && strings.TrimSpace(head[:start]) == "" {
+		candidates = ReplDotCommands
+	} else {
+		candidates = c.names(head)
+	}
+	completions := [][]rune{}
+	seen := map[string]bool{}
+	for _, name := range candidates {
+		if seen[name] || len(name) < len(word) || !strings.EqualFold(name[:len(word)], word) {
+			continue
+		}
+		seen[name] = true
+		completions = append(completions, []rune(name[len(word):]+" "))
+	}
+	return completions, len([]rune(word))
+}
+
+// Table names followed by column names, sorted
+func (c *replCompleter) names(line string) []string {
+	tables := c.db.TableNames()
+	mentioned := []string{}
+	for _, word := range strings.FieldsFunc(line, func(r rune) bool {
+		return strings.ContainsRune(" \t\n,()", r)
+	}) {
+		if _, ok := c.db.Tables[sqlitefile.CleanKeyString(word)]; ok {
+			mentioned = append(mentioned, sqlitefile.CleanKeyString(word))
+		}
+	}
+	if len(mentioned) == 0 {
+		mentioned = tables
+	}
+	columns := []string{}
+	for _, table := range mentioned {
+		columns = append(columns, c.db.Tables[table].ColumnNames()...)
+	}
+	sort.Strings(columns)
+	return append(tables, columns...)
+}
+
+// Splits off the complete statements, those terminated by a semicolon
+// outside of quotes and comments, returning them without the semicolon
+// along with the incomplete remainder
+func splitStatements(sql string) ([]string, string) {
+	statements := []string{}
+	start := 0
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return statements, sql[start:]
+			}
+			i += end
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return statements, sql[start:]
+			}
+			i += end + 3
+		case c == ';':
+			if stmt := strings.TrimSpace(sql[start:i]); stmt != "" {
+				statements = append(statements, stmt)
+			}
+			start = i + 1
+		}
+	}
+	return statements, sql[start:]
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	for _, test := range []struct {
+		sql       string
+		want      []string
+		remainder string
+	}{
+		{"SELECT 1; SELECT 2", []string{"SELECT 1"}, " SELECT 2"},
+		{"SELECT ';'; ", []string{"SELECT ';'"}, " "},
+		{"SELECT 1 -- a; b\n;", []string{"SELECT 1 -- a; b"}, ""},
+		{"SELECT /* a; b */ 1;", []string{"SELECT /* a; b */ 1"}, ""},
+		{"SELECT /* a; b", []string{}, "SELECT /* a; b"},
+		{"SELECT /*/ ; */ 1;", []string{"SELECT /*/ ; */ 1"}, ""},
+		{"SELECT 1 /**/; SELECT 2;", []string{"SELECT 1 /**/", "SELECT 2"}, ""},
+	} {
+		got, remainder := splitStatements(test.sql)
+		if !reflect.DeepEqual(got, test.want) || remainder != test.remainder {
+			t.Errorf("splitStatements(%q) = %q, %q, want %q, %q", test.sql, got, remainder, test.want, test.remainder)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.rtree [table [min max ...]]`. Without a table it lists the
+// R*Tree tables, otherwise it prints the boxes of the table overlapping
+// the box given by the minimum and maximum of each dimension in turn,
+// or all of them. Auxiliary columns are read from the %_rowid table.
+func HandleRTree(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) == 1 {
+		tables, err := db.RTreeTables()
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return writeJSONDocument(tables)
+		}
+		for _, t := range tables {
+			module := "rtree"
+			if t.Integer {
+				module = "rtree_i32"
+			}
+			fmt.Fprintf(output, "%s %s(%s), %d dimensions\n", t.Name, module, strings.Join(append(t.Columns, t.Aux...), ", "), t.Dimensions)
+			for _, s := range t.ShadowTables {
+				fmt.Fprintf(output, "  %s\n", s)
+			}
+		}
+		return nil
+	}
+	box := []float64{}
+	for _, f := range fields[2:] {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return usageError(".rtree [table [min max ...]]")
+		}
+		box = append(box, v)
+	}
+	t, err := db.RTreeTable(fields[1])
+	if err != nil {
+		return err
+	}
+	entries, err := db.RTreeSearch(t.Name, box)
+	if err != nil {
+		return err
+	}
+	var aux *sqlitefile.Cursor
+	if len(t.Aux) > 0 {
+		if aux, err = db.OpenCursor(t.Name + "_rowid"); err != nil {
+			return err
+		}
+	}
+	result := &resultSet{Columns: append(append([]string{}, t.Columns...), t.Aux...), Rows: [][]any{}}
+	for _, e := range entries {
+		row := []any{e.Rowid}
+		for _, c := range e.Coords {
+			if t.Integer {
+				row = append(row, int64(c))
+			} else {
+				row = append(row, c)
+			}
+		}
+		if aux != nil {
+			found, err := aux.SeekRowid(e.Rowid)
+			if err != nil {
+				return err
+			}
+			// the rowid and node number come before the auxiliary columns
+			for i := range t.Aux {
+				var v any
+				if found {
+					if v, err = aux.Column(2 + i); err != nil {
+						return err
+					}
+				}
+				row = append(row, v)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return writeResult(output, result)
+}
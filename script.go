@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Longest line accepted in a script, long INSERT statements included
+const MaxScriptLineSize = 16 * 1024 * 1024
+
+// Handles `.read file`, running the dot-commands and SQL statements in
+// file, or standard input for "-"
+func HandleRead(cmd string, db *sqlitefile.Database) error {
+	name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), ".read"))
+	if name == "" {
+		return usageError(".read file|-")
+	}
+	if name == "-" {
+		return runScript(os.Stdin, "stdin", db)
+	}
+	f, err := os.Open(sqlitefile.CleanKeyString(name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return runScript(f, name, db)
+}
+
+// Runs a script the way the interactive shell reads its input: dot-commands
+// take up a line of their own and SQL statements end with a semicolon. A
+// failing statement is reported with the line it starts on and the script
+// carries on with the next one.
+func runScript(r io.Reader, name string, db *sqlitefile.Database) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, MaxScriptLineSize)
+	failed, line := 0, 0
+	run := func(stmt string, at int) {
+		if err := runCommandRecovered(stmt, db); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s line %d: %s\n", name, at, err)
+			failed++
+		}
+	}
+	pending, pendingLine := "", 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if pending == "" {
+			trimmed := strings.TrimSpace(text)
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, ".") {
+				run(trimmed, line)
+				continue
+			}
+			pendingLine = line
+		}
+		pending += text + "\n"
+		statements, rest := splitStatements(pending)
+		for _, stmt := range statements {
+			run(stmt, pendingLine)
+		}
+		if len(statements) > 0 {
+			pending, pendingLine = strings.TrimLeft(rest, " \t\n"), line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s line %d: %w", name, line+1, err)
+	}
+	// the last statement may lack its semicolon
+	if stmt := strings.TrimSpace(pending); stmt != "" {
+		run(stmt, pendingLine)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d statements in %s failed", failed, name)
+	}
+	return nil
+}
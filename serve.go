@@ -0,0 +1,272 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Set with --serve to browse the database in a web browser instead of
+// running a command
+var serveAddr string
+
+// Rows in a page of query results, unless the request asks for another
+// number up to ServeMaxPageSize
+const (
+	ServePageSize    = 100
+	ServeMaxPageSize = 1000
+)
+
+//go:embed web/index.html
+var webUI []byte
+
+// Serves the page of the web UI and the JSON it reads:
+//
+//	/api/tables  the tables with their schema, columns and indexes
+//	/api/query   a page of the rows of ?sql=, from ?offset= for ?limit=
+//
+// The database is not safe for concurrent use, so requests take turns.
+type server struct {
+	sync.Mutex
+	db *sqlitefile.Database
+	// the last query with more rows than its page, kept open for the
+	// request of the next page
+	last *pagedRows
+}
+
+// Rows of a query read up to the end of a page
+type pagedRows struct {
+	sql  string
+	rows *sqlitefile.Rows
+	// the file change counter when the query started, as the rows
+	// cannot be read on once the database changed
+	changeCounter uint32
+	// the index of the row the rows are on when onRow, otherwise of the
+	// row Next reads next
+	next  int
+	onRow bool
+}
+
+// Serves the web UI on serveAddr until the program exits
+func runServer(db *sqlitefile.Database) error {
+	s := &server{db: db}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/tables", s.handleTables)
+	mux.HandleFunc("/api/query", s.handleQuery)
+	listener, err := net.Listen("tcp", serveAddr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "-- serving %s on http://%s/\n", db.Name(), listener.Addr())
+	return http.Serve(listener, mux)
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(webUI)
+}
+
+type serveTable struct {
+	Name    string                 `json:"name"`
+	SQL     string                 `json:"sql"`
+	Columns []string               `json:"columns"`
+	Indexes []sqlitefile.SchemaRow `json:"indexes"`
+}
+
+func (s *server) handleTables(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	rows, err := sqlitefile.ReadSchemaRows(s.db)
+	if err != nil {
+		writeServeError(w, err)
+		return
+	}
+	tables := []serveTable{}
+	for _, name := range s.db.TableNames() {
+		t := serveTable{Name: name, Columns: s.db.Tables[name].ColumnNames(), Indexes: []sqlitefile.SchemaRow{}}
+		for _, row := range rows {
+			switch {
+			case row.Type == "table" && sqlitefile.CleanKeyString(row.Name) == name:
+				t.SQL = row.SQL
+			case row.Type == "index" && row.SQL != "" && sqlitefile.CleanKeyString(row.TableName) == name:
+				t.Indexes = append(t.Indexes, row)
+			}
+		}
+		tables = append(tables, t)
+	}
+	writeServeJSON(w, tables)
+}
+
+type serveResult struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+	Offset  int      `json:"offset"`
+	// whether there are rows after this page
+	More    bool    `json:"more"`
+	Seconds float64 `json:"seconds"`
+}
+
+func (s *server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		writeServeError(w, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", ServePageSize)
+	if err != nil {
+		writeServeError(w, err)
+		return
+	}
+	limit = min(max(limit, 1), ServeMaxPageSize)
+	start := time.Now()
+	result, err := s.query(r.URL.Query().Get("sql"), offset, limit)
+	recordCommand(s.db, start, err)
+	if err != nil {
+		writeServeError(w, err)
+		return
+	}
+	result.Seconds = time.Since(start).Seconds()
+	writeServeJSON(w, result)
+}
+
+// Reads limit rows after skipping offset, and one more to tell whether
+// there is another page. A page that starts where the last one ended
+// reads on from its rows rather than skipping offset rows again.
+func (s *server) query(sql string, offset, limit int) (*serveResult, error) {
+	p, err := s.pagedRows(sql, offset)
+	if err != nil {
+		return nil, err
+	}
+	result := &serveResult{Columns: p.rows.Columns(), Rows: [][]any{}, Offset: offset}
+	for {
+		if !p.onRow {
+			if !p.rows.Next() {
+				break
+			}
+			p.onRow = true
+		}
+		if p.next < offset {
+			p.next, p.onRow = p.next+1, false
+			continue
+		}
+		if len(result.Rows) == limit {
+			result.More = true
+			break
+		}
+		values := make([]any, len(result.Columns))
+		dest := make([]any, len(values))
+		for j := range values {
+			dest[j] = &values[j]
+		}
+		if err := p.rows.Scan(dest...); err != nil {
+			p.rows.Close()
+			return nil, err
+		}
+		for j, v := range values {
+			values[j] = serveValue(v)
+		}
+		result.Rows = append(result.Rows, values)
+		p.next, p.onRow = p.next+1, false
+	}
+	if err := p.rows.Err(); err != nil || !result.More {
+		p.rows.Close()
+		return result, err
+	}
+	s.last = p
+	return result, nil
+}
+
+// The rows of the last query when the page at offset continues them and
+// the database did not change since, or else the rows of a new query
+func (s *server) pagedRows(sql string, offset int) (*pagedRows, error) {
+	counter, err := s.db.ReadFileChangeCounter()
+	if err != nil {
+		return nil, err
+	}
+	p := s.last
+	s.last = nil
+	if p != nil && p.sql == sql && p.next <= offset && p.changeCounter == counter {
+		return p, nil
+	}
+	if p != nil {
+		p.rows.Close()
+	}
+	rows, err := s.db.Query(sql)
+	if err != nil {
+		// other than a missing table, the statement is at fault
+		if !errors.Is(err, sqlitefile.ErrNotFound) {
+			err = &exitError{ExitUsage, err}
+		}
+		return nil, err
+	}
+	return &pagedRows{sql: sql, rows: rows, changeCounter: counter}, nil
+}
+
+// Blobs are sent as base64 text, like --export json does, reals JSON
+// cannot hold as null and integers a JavaScript number cannot hold
+// exactly, those beyond 2^53, as decimal text
+func serveValue(v any) any {
+	switch v := v.(type) {
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case int64:
+		if v > 1<<53 || v < -1<<53 {
+			return strconv.FormatInt(v, 10)
+		}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	}
+	return v
+}
+
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, &exitError{ExitUsage, fmt.Errorf("%s must be a number", name)}
+	}
+	return n, nil
+}
+
+func writeServeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Reports bad requests and missing tables as such, everything else as
+// a server error
+func writeServeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch exitCode(err) {
+	case ExitUsage:
+		status = http.StatusBadRequest
+	case ExitNotFound:
+		status = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Integers beyond 2^53 come as text so that JavaScript does not round
+// them, smaller ones as numbers
+func TestServeLargeIntegers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.db")
+	if err := sqlitefile.Create(path, 4096); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlitefile.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, sql := range []string{
+		"CREATE TABLE t(a INTEGER)",
+		"INSERT INTO t VALUES (9007199254740993)",
+		"INSERT INTO t VALUES (-9007199254740993)",
+		"INSERT INTO t VALUES (9007199254740992)",
+		"INSERT INTO t VALUES (42)",
+	} {
+		if err := db.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &server{db: db}
+	w := httptest.NewRecorder()
+	s.handleQuery(w, httptest.NewRequest("GET", "/api/query?sql="+url.QueryEscape("SELECT a FROM t"), nil))
+	var result struct {
+		Rows [][]any `json:"rows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	want := [][]any{{"9007199254740993"}, {"-9007199254740993"}, {float64(9007199254740992)}, {float64(42)}}
+	if !reflect.DeepEqual(result.Rows, want) {
+		t.Errorf("rows = %v, want %v", result.Rows, want)
+	}
+}
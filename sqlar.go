@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.sqlar list|extract`. list prints the files of an SQLite
+// archive, extract writes them, or the named files and directories,
+// below the current directory or the one given with -C.
+func HandleSQLAR(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) < 2 || (fields[1] != "list" && fields[1] != "extract") || (fields[1] == "list" && len(fields) > 2) {
+		return usageError(".sqlar list|extract [-C dir] [name ...]")
+	}
+	files, err := db.SQLARFiles()
+	if err != nil {
+		return err
+	}
+	if fields[1] == "list" {
+		return listSQLAR(files)
+	}
+	dir, names := ".", fields[2:]
+	if len(names) > 0 && names[0] == "-C" {
+		if len(names) < 2 {
+			return usageError(".sqlar list|extract [-C dir] [name ...]")
+		}
+		dir, names = names[1], names[2:]
+	}
+	return extractSQLAR(files, dir, names)
+}
+
+func listSQLAR(files []sqlitefile.SQLARFile) error {
+	if jsonOutput {
+		return writeJSONDocument(files)
+	}
+	result := &resultSet{Columns: []string{"mode", "size", "compressed", "mtime", "name"}, Rows: [][]any{}}
+	for _, f := range files {
+		result.Rows = append(result.Rows, []any{
+			f.FileMode().String(), f.Size, int64(len(f.Data)), f.Mtime.Format("2006-01-02 15:04:05"), f.Name,
+		})
+	}
+	return writeResult(output, result)
+}
+
+// Writes the files to dir, restoring their permissions and modification
+// times. Names that would end up outside of dir are refused.
+func extractSQLAR(files []sqlitefile.SQLARFile, dir string, names []string) error {
+	var dirs []sqlitefile.SQLARFile
+	extracted := 0
+	for _, f := range files {
+		if !sqlarSelected(f.Name, names) {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(f.Name)) {
+			return fmt.Errorf("refusing to extract %q outside of %s", f.Name, dir)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		mode := f.FileMode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()|0o700); err != nil {
+				return err
+			}
+			// written last so extracting the files inside does not
+			// change the time
+			dirs = append(dirs, f)
+		case mode&fs.ModeSymlink != 0:
+			os.Remove(target)
+			if err := os.Symlink(string(f.Data), target); err != nil {
+				return err
+			}
+		default:
+			content, err := f.Content()
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, content, mode.Perm()); err != nil {
+				return err
+			}
+			if err := os.Chtimes(target, f.Mtime, f.Mtime); err != nil {
+				return err
+			}
+		}
+		extracted++
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target := filepath.Join(dir, filepath.FromSlash(dirs[i].Name))
+		if err := os.Chtimes(target, dirs[i].Mtime, dirs[i].Mtime); err != nil {
+			return err
+		}
+	}
+	if extracted == 0 && len(names) > 0 {
+		return sqlitefile.NotFoundError("no such file in archive: %s", strings.Join(names, ", "))
+	}
+	logger.Info("extracted sqlar files", "count", extracted, "dir", dir)
+	return nil
+}
+
+// Whether name is one of names or inside one of them, every name when
+// names is empty
+func sqlarSelected(name string, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	name = path.Clean(name)
+	for _, n := range names {
+		n = path.Clean(n)
+		if name == n || n == "." || strings.HasPrefix(name, n+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,366 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const identifierPattern = `("[^"]+"|\[[^\]]+\]|` + "`[^`]+`" + `|[^\s(;]+)`
+
+var AlterTableRegexp = regexp.MustCompile(
+	`(?is)^\s*alter\s+table\s+` + identifierPattern + `\s+rename\s+(?:to\s+` + identifierPattern +
+		`|(?:column\s+)?` + identifierPattern + `\s+to\s+` + identifierPattern + `)\s*;?\s*$`)
+
+// A token of an SQL statement, positioned by byte offsets
+// and the parenthesis depth it appears at
+type sqlToken struct {
+	Start int
+	End   int
+	Depth int
+	Text  string
+}
+
+func (t sqlToken) IsIdentifier() bool {
+	switch t.Text[0] {
+	case '"', '`', '[':
+		return true
+	}
+	return t.Text[0] == '_' || t.Text[0] >= 'A' && t.Text[0] <= 'Z' || t.Text[0] >= 'a' && t.Text[0] <= 'z'
+}
+
+// Splits sql into words, quoted identifiers, string literals and single
+// punctuation characters. Whitespace is dropped.
+func tokenizeSQL(sql string) []sqlToken {
+	tokens := []sqlToken{}
+	depth := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			for i++; i < len(sql); i++ {
+				if sql[i] == end {
+					// doubled quotes are escaped quotes
+					if end != ']' && i+1 < len(sql) && sql[i+1] == end {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+		case c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= 0x80:
+			for i < len(sql) && (sql[i] == '_' || sql[i] == '$' || sql[i] >= '0' && sql[i] <= '9' ||
+				sql[i] >= 'A' && sql[i] <= 'Z' || sql[i] >= 'a' && sql[i] <= 'z' || sql[i] >= 0x80) {
+				i++
+			}
+		default:
+			i++
+		}
+		if i > len(sql) {
+			i = len(sql)
+		}
+		if c == ')' {
+			depth--
+		}
+		tokens = append(tokens, sqlToken{start, i, depth, sql[start:i]})
+		if c == '(' {
+			depth++
+		}
+	}
+	return tokens
+}
+
+// Quotes an identifier the way sqlite writes renamed objects
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Replaces the text of the given tokens in sql
+func replaceTokens(sql string, tokens []sqlToken, replacement string) string {
+	var buf strings.Builder
+	last := 0
+	for _, t := range tokens {
+		buf.WriteString(sql[last:t.Start])
+		buf.WriteString(replacement)
+		last = t.End
+	}
+	buf.WriteString(sql[last:])
+	return buf.String()
+}
+
+func matchesIdentifier(t sqlToken, name string) bool {
+	return t.IsIdentifier() && strings.EqualFold(dequoteIdentifier(t.Text), name)
+}
+
+// Finds the column references to name in a CREATE TABLE statement: the
+// name of a column definition and identifiers inside the parentheses of
+// constraints, except for the columns of a REFERENCES clause, which
+// belong to another table.
+func columnReferencesInTable(sql string, name string) []sqlToken {
+	tokens := tokenizeSQL(sql)
+	found := []sqlToken{}
+	definitionStart := false
+	afterReferences := false
+	skipDepth := -1
+	for i, t := range tokens {
+		switch {
+		case t.Text == "(" && t.Depth == 0:
+			definitionStart = true
+			continue
+		case t.Text == "," && t.Depth == 1:
+			definitionStart = true
+			afterReferences = false
+			continue
+		case strings.EqualFold(t.Text, "references"):
+			afterReferences = true
+			continue
+		case t.Text == "(" && afterReferences && skipDepth < 0:
+			skipDepth = t.Depth
+			continue
+		case t.Text == ")" && t.Depth == skipDepth:
+			skipDepth = -1
+			afterReferences = false
+			continue
+		}
+		if definitionStart {
+			definitionStart = false
+			if !isTableConstraint(t.Text) && matchesIdentifier(t, name) {
+				found = append(found, t)
+			}
+			continue
+		}
+		// identifiers at depth 2 or deeper are inside the parentheses of
+		// constraints, CHECK and generated column expressions
+		if t.Depth >= 2 && skipDepth < 0 && isColumnReference(tokens, i, name) {
+			found = append(found, t)
+		}
+	}
+	return found
+}
+
+// Whether tokens[i] names the column name in an expression, rather than
+// a function or a collation of the same name
+func isColumnReference(tokens []sqlToken, i int, name string) bool {
+	if !matchesIdentifier(tokens[i], name) {
+		return false
+	}
+	if i+1 < len(tokens) && tokens[i+1].Text == "(" {
+		return false
+	}
+	return i == 0 || !strings.EqualFold(tokens[i-1].Text, "collate")
+}
+
+// Finds the references to the column name in the indexed columns and
+// expressions of a CREATE INDEX statement, sql starting at their
+// opening parenthesis, and in the WHERE clause of a partial index
+func columnReferencesInIndex(sql string, name string) []sqlToken {
+	found := []sqlToken{}
+	tokens := tokenizeSQL(sql)
+	for i := range tokens {
+		if isColumnReference(tokens, i, name) {
+			found = append(found, tokens[i])
+		}
+	}
+	return found
+}
+
+// Runs ALTER TABLE ... RENAME TO and RENAME COLUMN by rewriting the
+// statements stored in sqlite_schema, both of the table and of its
+// indexes. The table data does not change. Like sqlite, renamed
+// identifiers are written double quoted.
+func alterTable(sql string, db *Database) error {
+	matches := AlterTableRegexp.FindStringSubmatch(sql)
+	if matches == nil {
+		return errors.New("unsupported ALTER TABLE statement, only RENAME TO and RENAME COLUMN are supported")
+	}
+	tableName := dequoteIdentifier(matches[1])
+	schema, ok := db.Tables[CleanKeyString(tableName)]
+	if !ok {
+		return TableNotFoundError(tableName)
+	}
+	if strings.HasPrefix(strings.ToLower(tableName), "sqlite_") {
+		return fmt.Errorf("table %s may not be altered", tableName)
+	}
+	tx, err := beginWrite(db)
+	if err != nil {
+		return err
+	}
+	if err := tx.checkDependentObjects(tableName); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if matches[2] != "" {
+		err = tx.renameTable(db, schema, dequoteIdentifier(matches[2]))
+	} else {
+		err = tx.renameColumn(db, schema, dequoteIdentifier(matches[3]), dequoteIdentifier(matches[4]))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.schemaChanged = true
+	return tx.Commit()
+}
+
+// Views and triggers are stored as SQL text that is not rewritten,
+// so renaming anything they might refer to is refused.
+func (tx *writeTxn) checkDependentObjects(tableName string) error {
+	return tx.walkTableLeaves(SchemaRootPage, func(p *RawPage) error {
+		for i := 0; i < p.CellCount(); i++ {
+			c, err := tx.cellRecord(p, i)
+			if err != nil {
+				return err
+			}
+			kind, _ := c.ReadDataFromHeaderIndex(0)
+			name, _ := c.ReadDataFromHeaderIndex(1)
+			sql, _ := c.ReadDataFromHeaderIndex(4)
+			text, _ := sql.(string)
+			if (kind == "view" || kind == "trigger") &&
+				strings.Contains(strings.ToLower(text), strings.ToLower(tableName)) {
+				return fmt.Errorf("cannot rename, %s %v may refer to %s", kind, name, tableName)
+			}
+		}
+		return nil
+	})
+}
+
+func (tx *writeTxn) renameTable(db *Database, schema *Record, newName string) error {
+	oldName, err := schema.TableName()
+	if err != nil {
+		return err
+	}
+	if _, ok := db.Tables[CleanKeyString(newName)]; ok {
+		return fmt.Errorf("there is already another table or index with this name: %s", newName)
+	}
+	if strings.HasPrefix(strings.ToLower(newName), "sqlite_") {
+		return fmt.Errorf("object name reserved for internal use: %s", newName)
+	}
+	quoted := QuoteIdentifier(newName)
+	err = tx.updateSchemaRow(schema.RowID, func(values []any) error {
+		sql, _ := values[4].(string)
+		m := CreateTableRegexp.FindStringSubmatchIndex(sql)
+		if m == nil {
+			return fmt.Errorf("cannot parse schema of table %s", oldName)
+		}
+		values[1], values[2], values[4] = newName, newName, sql[:m[4]]+quoted+sql[m[5]:]
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, index := range db.TableIndicies(oldName) {
+		err := tx.updateSchemaRow(index.RowID, func(values []any) error {
+			values[2] = newName
+			// automatic indexes are named after their table
+			name, _ := values[1].(string)
+			prefix := "sqlite_autoindex_" + oldName + "_"
+			if strings.HasPrefix(strings.ToLower(name), strings.ToLower(prefix)) {
+				values[1] = "sqlite_autoindex_" + newName + "_" + name[len(prefix):]
+			}
+			sql, ok := values[4].(string)
+			if !ok {
+				return nil
+			}
+			def, err := ParseIndexDefinition(sql)
+			if err != nil {
+				return fmt.Errorf("cannot parse schema of index %s: %w", name, err)
+			}
+			values[4] = sql[:def.tableStart] + quoted + sql[def.tableEnd:]
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *writeTxn) renameColumn(db *Database, schema *Record, oldColumn string, newColumn string) error {
+	tableName, err := schema.TableName()
+	if err != nil {
+		return err
+	}
+	if _, ok := schema.ColumnMap[CleanKeyString(oldColumn)]; !ok {
+		return columnNotFoundError("no such column: %q", oldColumn)
+	}
+	if _, ok := schema.ColumnMap[CleanKeyString(newColumn)]; ok {
+		return fmt.Errorf("duplicate column name: %s", newColumn)
+	}
+	quoted := QuoteIdentifier(newColumn)
+	err = tx.updateSchemaRow(schema.RowID, func(values []any) error {
+		sql, _ := values[4].(string)
+		values[4] = replaceTokens(sql, columnReferencesInTable(sql, oldColumn), quoted)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, index := range db.TableIndicies(tableName) {
+		err := tx.updateSchemaRow(index.RowID, func(values []any) error {
+			sql, ok := values[4].(string)
+			if !ok {
+				return nil
+			}
+			def, err := ParseIndexDefinition(sql)
+			if err != nil {
+				return fmt.Errorf("cannot parse schema of index %v: %w", values[1], err)
+			}
+			columns := sql[def.columnsStart:]
+			values[4] = sql[:def.columnsStart] + replaceTokens(columns, columnReferencesInIndex(columns, oldColumn), quoted)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewrites the sqlite_schema row with the given rowid, which keeps
+// its rowid so the order of the schema is unchanged
+func (tx *writeTxn) updateSchemaRow(rowID int64, update func(values []any) error) error {
+	leaf, _, err := tx.findTableLeaf(SchemaRootPage, rowID)
+	if err != nil {
+		return err
+	}
+	idx := -1
+	for i := 0; i < leaf.CellCount(); i++ {
+		if leaf.CellRowID(i) == rowID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("schema row %d not found", rowID)
+	}
+	c, err := tx.cellRecord(leaf, idx)
+	if err != nil {
+		return err
+	}
+	values := make([]any, len(c.Header))
+	for i := range values {
+		if values[i], err = c.ReadDataFromHeaderIndex(i); err != nil {
+			return err
+		}
+	}
+	if len(values) != 5 {
+		return fmt.Errorf("schema row %d has %d columns", rowID, len(values))
+	}
+	if err := update(values); err != nil {
+		return err
+	}
+	if err := tx.deleteTableRow(SchemaRootPage, rowID); err != nil {
+		return err
+	}
+	return tx.insertTableRow(SchemaRootPage, "sqlite_schema", &rowID, values)
+}
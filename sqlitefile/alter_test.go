@@ -0,0 +1,40 @@
+package sqlitefile
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// Renaming a column rewrites every reference to it: in CHECK and
+// generated column expressions of the table, and in the expressions
+// and WHERE clauses of its indexes, but not functions, collations or
+// strings of the same name
+func TestRenameColumnReferences(t *testing.T) {
+	db, path := sqlite3Database(t, `
+		CREATE TABLE p(n INT CHECK (n > 0 AND abs(n) < 100), g AS (n * 2), k TEXT, CHECK (n <> k));
+		CREATE INDEX p_e ON p(n + 1) WHERE n > 2;
+		CREATE INDEX p_f ON p(lower(n), k COLLATE nocase DESC) WHERE n IS NOT NULL AND k = 'n';
+		CREATE INDEX p_g ON p(k) WHERE n > 0;
+		INSERT INTO p(n, k) VALUES (1, 'a'), (3, 'n');`)
+	if err := db.Exec("ALTER TABLE p RENAME COLUMN n TO m"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	want := `CREATE TABLE p("m" INT CHECK ("m" > 0 AND abs("m") < 100), g AS ("m" * 2), k TEXT, CHECK ("m" <> k))
+CREATE INDEX p_e ON p("m" + 1) WHERE "m" > 2
+CREATE INDEX p_f ON p(lower("m"), k COLLATE nocase DESC) WHERE "m" IS NOT NULL AND k = 'n'
+CREATE INDEX p_g ON p(k) WHERE "m" > 0`
+	if got := sqlite3(t, path, "SELECT sql FROM sqlite_schema"); got != want {
+		t.Fatalf("schema after the rename:\n%s\nwant:\n%s", got, want)
+	}
+	if got := sqlite3(t, path, "PRAGMA integrity_check"); got != "ok" {
+		t.Fatalf("integrity check: %s", got)
+	}
+	if got := sqlite3(t, path, "SELECT m, g FROM p WHERE m > 2"); got != "3|6" {
+		t.Errorf("SELECT m, g = %q", got)
+	}
+	// the renamed CHECK constraint still holds
+	if out, err := exec.Command("sqlite3", path, "INSERT INTO p(m, k) VALUES (-1, 'x')").CombinedOutput(); err == nil {
+		t.Errorf("sqlite3 inserted a row the CHECK constraint refuses: %s", out)
+	}
+}
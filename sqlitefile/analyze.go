@@ -0,0 +1,106 @@
+package sqlitefile
+
+import "sort"
+
+// The size of a table or index b-tree, as counted by Analyze
+type BtreeStats struct {
+	Name string `json:"name"`
+	// the table of an index, the name itself for a table
+	Table string `json:"tbl_name"`
+	Index bool   `json:"index"`
+	Root  int64  `json:"rootpage"`
+	// rows of a table, entries of an index
+	Rows int64 `json:"rows"`
+	// levels of pages from the root down to the leaves
+	Depth         int   `json:"depth"`
+	Pages         int64 `json:"pages"`
+	LeafPages     int64 `json:"leaf_pages"`
+	OverflowPages int64 `json:"overflow_pages"`
+}
+
+// Statistics of every b-tree and the file change counter they were
+// collected at
+type analysis struct {
+	changeCounter uint32
+	btrees        []*BtreeStats
+}
+
+// Walks every table and index b-tree, sqlite_schema included, counting
+// its rows, depth and pages. That reads every b-tree page of the file,
+// which is why it is not done on open. The result is kept until the
+// database changes and CountRows answers from it.
+func (db *Database) Analyze() ([]*BtreeStats, error) {
+	counter, err := db.ReadFileChangeCounter()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ReadSchemaRows(db)
+	if err != nil {
+		return nil, err
+	}
+	btrees := []*BtreeStats{{Name: "sqlite_schema", Table: "sqlite_schema", Root: SchemaRootPage}}
+	for _, row := range rows {
+		if row.RootPage > 0 {
+			btrees = append(btrees, &BtreeStats{Name: row.Name, Table: row.TableName, Index: row.Type == "index", Root: row.RootPage})
+		}
+	}
+	seen := map[int64]bool{}
+	for _, s := range btrees {
+		if err := db.analyzePage(s, s.Root, 1, seen); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(btrees, func(i, j int) bool { return btrees[i].Name < btrees[j].Name })
+	db.analysis = &analysis{changeCounter: counter, btrees: btrees}
+	return btrees, nil
+}
+
+// The statistics of the last Analyze, nil when it was not called or the
+// database changed since
+func (db *Database) Analysis() []*BtreeStats {
+	if db.analysis == nil {
+		return nil
+	}
+	if counter, err := db.ReadFileChangeCounter(); err != nil || counter != db.analysis.changeCounter {
+		db.analysis = nil
+		return nil
+	}
+	return db.analysis.btrees
+}
+
+func (db *Database) analyzePage(s *BtreeStats, pageNumber int64, depth int, seen map[int64]bool) error {
+	if seen[pageNumber] {
+		return corruptPageError(pageNumber, "referenced more than once")
+	}
+	seen[pageNumber] = true
+	p, err := ReadRawPage(db, pageNumber)
+	if err != nil {
+		return err
+	}
+	switch p.PageType() {
+	case LeafTableType, LeafIndexType, InteriorTableType, InteriorIndexType:
+	default:
+		return corruptPageError(pageNumber, "not a b-tree page")
+	}
+	s.Pages++
+	s.Depth = max(s.Depth, depth)
+	if p.PageType() != InteriorTableType {
+		s.Rows += int64(p.CellCount())
+		for i := 0; i < p.CellCount(); i++ {
+			l := p.CellLayout(i)
+			if spill := int64(l.PayloadSize.Value) - int64(l.Local); spill > 0 {
+				s.OverflowPages += (spill + int64(p.Usable) - 5) / int64(p.Usable-4)
+			}
+		}
+	}
+	if p.IsLeaf() {
+		s.LeafPages++
+		return nil
+	}
+	for i := 0; i <= p.CellCount(); i++ {
+		if err := db.analyzePage(s, int64(p.ChildPage(i)), depth+1, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
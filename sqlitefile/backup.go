@@ -0,0 +1,84 @@
+package sqlitefile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Copies the pages of src as of its last commit, those in the WAL
+// included, to a new database file at dst, like sqlite3_backup does for
+// a read-only source. progress, when not nil, is called after each page
+// with the number of pages copied and the total. The copy is removed
+// and ErrDatabaseChanged returned when a writer commits to the database
+// file or restarts the WAL while it runs, as the pages would no longer
+// belong to one version.
+func Backup(dst string, src *Database, progress func(copied, total int64)) (err error) {
+	before, err := src.readSnapshotID()
+	if err != nil {
+		return err
+	}
+	pageSize := src.Header.PageSizeBytes()
+	total, err := src.PageCount()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	w := bufio.NewWriterSize(f, int(pageSize))
+	page := make([]byte, pageSize)
+	for n := int64(1); n <= total; n++ {
+		if _, err := src.Reader.readThrough(page, (n-1)*pageSize); err != nil {
+			return fmt.Errorf("failed to read page %d: %w", n, err)
+		}
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(n, total)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	after, err := src.readSnapshotID()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(before, after) {
+		return fmt.Errorf("%w while copying %d pages to %s", ErrDatabaseChanged, total, dst)
+	}
+	return f.Sync()
+}
+
+// Reads what changes when the database moves to another version under
+// a reader: the change counter in the database file, and the checkpoint
+// sequence number and salts of the WAL header, which a writer rewrites
+// before reusing the WAL. Commits appended to the WAL do not affect the
+// snapshot the WAL was read at, a checkpoint copying them into the
+// database file is only noticed when it changes the change counter.
+func (db *Database) readSnapshotID() ([]byte, error) {
+	id := make([]byte, 4, 16)
+	if _, err := db.readAt(id, 24); err != nil {
+		return nil, err
+	}
+	if db.Wal != nil {
+		header := make([]byte, 12)
+		if _, err := db.Wal.File.ReadAt(header, 12); err != nil {
+			return nil, err
+		}
+		id = append(id, header...)
+	}
+	return id, nil
+}
@@ -0,0 +1,195 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Inserts cell as the idx-th cell of page p, splitting the page when it
+// is full. The path holds the interior pages above p as returned by
+// the descent that located it.
+//
+// A split moves the lower half of the cells to a newly allocated left
+// sibling while p keeps the upper half, so the parent's pointer to p
+// stays valid and only a divider for the new sibling has to be inserted
+// into the parent, which may in turn split. A full root is first moved
+// into a new child so the root page number never changes and the tree
+// grows by one level.
+func (tx *writeTxn) insertCell(path []btreeStep, p *RawPage, idx int, cell []byte) error {
+	err := p.InsertCell(idx, cell)
+	if err == nil {
+		tx.Write(p)
+		return nil
+	}
+	if !errors.Is(err, errPageFull) {
+		return err
+	}
+	cells := p.Cells()
+	cells = append(cells[:idx], append([][]byte{cell}, cells[idx:]...)...)
+	if len(path) == 0 {
+		child, err := tx.allocatePage()
+		if err != nil {
+			return err
+		}
+		pageType := p.PageType()
+		rightMost := uint32(0)
+		if !p.IsLeaf() {
+			rightMost = p.RightMostPointer()
+		}
+		p.Reset(interiorPageType(pageType))
+		p.SetRightMostPointer(uint32(child.Number))
+		tx.Write(p)
+		child.Reset(pageType)
+		if rightMost != 0 {
+			child.SetRightMostPointer(rightMost)
+		}
+		path = []btreeStep{{Page: p, Child: 0}}
+		p = child
+	}
+	return tx.splitPage(path, p, cells, idx == len(cells)-1)
+}
+
+// Distributes cells over p and a new left sibling and inserts the
+// divider into the parent. When the new cell was appended to the end of
+// a table leaf, as with ascending rowids, the left sibling takes all the
+// old cells and p only the new one, which keeps sequentially filled
+// pages full rather than half empty.
+//
+// Table leaves copy the largest rowid of the left sibling into the
+// divider, while every other page type moves its middle cell up, as
+// index entries are stored exactly once.
+func (tx *writeTxn) splitPage(path []btreeStep, p *RawPage, cells [][]byte, appended bool) error {
+	pageType := p.PageType()
+	capacity := p.Usable - p.HeaderOffset() - p.HeaderSize()
+	split := -1
+	if appended && pageType == LeafTableType {
+		split = len(cells) - 1
+	} else {
+		split = balancedSplit(cells, capacity, pageType == LeafTableType)
+	}
+	if split <= 0 || split >= len(cells) {
+		return fmt.Errorf("cannot split page %d", p.Number)
+	}
+	left, err := tx.allocatePage()
+	if err != nil {
+		return err
+	}
+	rightMost := uint32(0)
+	if !p.IsLeaf() {
+		rightMost = p.RightMostPointer()
+	}
+	left.Reset(pageType)
+	p.Reset(pageType)
+	var divider []byte
+	switch pageType {
+	case LeafTableType:
+		if err := left.SetCells(cells[:split]); err != nil {
+			return err
+		}
+		divider = tableInteriorCell(uint32(left.Number), left.CellRowID(split-1))
+		if err := p.SetCells(cells[split:]); err != nil {
+			return err
+		}
+	case InteriorTableType:
+		// the middle cell moves up, its left child
+		// becomes the right-most child of the left sibling
+		middle := cells[split]
+		if err := left.SetCells(cells[:split]); err != nil {
+			return err
+		}
+		left.SetRightMostPointer(cellLeftChild(middle))
+		rowID, _ := ReadVarint(middle[4:])
+		divider = tableInteriorCell(uint32(left.Number), rowID)
+		if err := p.SetCells(cells[split+1:]); err != nil {
+			return err
+		}
+		p.SetRightMostPointer(rightMost)
+	case LeafIndexType:
+		if err := left.SetCells(cells[:split]); err != nil {
+			return err
+		}
+		divider = append(leftChildPrefix(uint32(left.Number)), cells[split]...)
+		if err := p.SetCells(cells[split+1:]); err != nil {
+			return err
+		}
+	case InteriorIndexType:
+		middle := cells[split]
+		if err := left.SetCells(cells[:split]); err != nil {
+			return err
+		}
+		left.SetRightMostPointer(cellLeftChild(middle))
+		divider = append(leftChildPrefix(uint32(left.Number)), middle[4:]...)
+		if err := p.SetCells(cells[split+1:]); err != nil {
+			return err
+		}
+		p.SetRightMostPointer(rightMost)
+	default:
+		return fmt.Errorf("splitting page type %d is not supported", pageType)
+	}
+	tx.Write(left)
+	tx.Write(p)
+	parent := path[len(path)-1]
+	return tx.insertCell(path[:len(path)-1], parent.Page, parent.Child, divider)
+}
+
+// Picks the split point that divides the cells most evenly by size
+// while both halves still fit the page. Unless the page is a table
+// leaf the middle cell moves to the parent, so it is not counted
+// on either side.
+func balancedSplit(cells [][]byte, capacity int, keepsMiddle bool) int {
+	sizes := make([]int, len(cells)+1)
+	for i, c := range cells {
+		sizes[i+1] = sizes[i] + maxInt(len(c), MinCellSize) + 2
+	}
+	total := sizes[len(cells)]
+	best, bestDiff := -1, total
+	for i := 1; i < len(cells); i++ {
+		leftSize := sizes[i]
+		rightSize := total - sizes[i]
+		if !keepsMiddle {
+			if i == len(cells)-1 {
+				break
+			}
+			rightSize -= sizes[i+1] - sizes[i]
+		}
+		if leftSize > capacity || rightSize > capacity {
+			continue
+		}
+		diff := leftSize - rightSize
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < bestDiff {
+			best, bestDiff = i, diff
+		}
+	}
+	return best
+}
+
+func interiorPageType(pageType uint8) uint8 {
+	if pageType == LeafIndexType {
+		return InteriorIndexType
+	}
+	if pageType == LeafTableType {
+		return InteriorTableType
+	}
+	return pageType
+}
+
+func tableInteriorCell(leftChild uint32, rowID int64) []byte {
+	cell := make([]byte, 4, 4+VarintLen(rowID))
+	cell[0] = byte(leftChild >> 24)
+	cell[1] = byte(leftChild >> 16)
+	cell[2] = byte(leftChild >> 8)
+	cell[3] = byte(leftChild)
+	return AppendVarint(cell, rowID)
+}
+
+// The 4-byte left child pointer that starts every interior cell
+func leftChildPrefix(leftChild uint32) []byte {
+	return []byte{byte(leftChild >> 24), byte(leftChild >> 16), byte(leftChild >> 8), byte(leftChild)}
+}
+
+func cellLeftChild(cell []byte) uint32 {
+	return uint32(cell[0])<<24 | uint32(cell[1])<<16 | uint32(cell[2])<<8 | uint32(cell[3])
+}
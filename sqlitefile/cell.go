@@ -0,0 +1,916 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// Type of a column in a record, the serial type in the record header
+// with the length taken out of the types for blobs and text
+// https://www.sqlite.org/fileformat.html#record_format
+type SerialType int
+
+const (
+	SerialNull SerialType = iota
+	Serial8TwosComplement
+	Serial16TwosComplement
+	Serial24TwosComplement
+	Serial32TwosComplement
+	Serial48TwosComplement
+	Serial64TwosComplement
+	SerialFloat
+	Serial0
+	Serial1
+	SerialInternal1
+	SerialInternal2
+	SerialBlob
+	SerialText
+)
+
+var serialTypeNames = [...]string{
+	SerialNull:             "NULL",
+	Serial8TwosComplement:  "INT8",
+	Serial16TwosComplement: "INT16",
+	Serial24TwosComplement: "INT24",
+	Serial32TwosComplement: "INT32",
+	Serial48TwosComplement: "INT48",
+	Serial64TwosComplement: "INT64",
+	SerialFloat:            "FLOAT",
+	Serial0:                "ZERO",
+	Serial1:                "ONE",
+	SerialInternal1:        "RESERVED(10)",
+	SerialInternal2:        "RESERVED(11)",
+	SerialBlob:             "BLOB",
+	SerialText:             "TEXT",
+}
+
+func (t SerialType) String() string {
+	if t < 0 || int(t) >= len(serialTypeNames) {
+		return fmt.Sprintf("SerialType(%d)", int(t))
+	}
+	return serialTypeNames[t]
+}
+
+type CellType int
+
+const (
+	CellTypeUnknown CellType = iota
+	CellTypeTable
+	CellTypeIndex
+	CellTypeView
+	CellTypeTrigger
+)
+
+var (
+	TableTypeBytes   = []byte{116, 97, 98, 108, 101}
+	IndexTypeBytes   = []byte{105, 110, 100, 101, 120}
+	ViewTypeBytes    = []byte("view")
+	TriggerTypeBytes = []byte("trigger")
+	IndexKeyRegexp   = regexp.MustCompile("\\((.*)\\)")
+)
+
+type columnMap map[string]int
+
+type ColumnAffinity int
+
+const (
+	AffinityBlob ColumnAffinity = iota
+	AffinityText
+	AffinityNumeric
+	AffinityInteger
+	AffinityReal
+)
+
+// Determines the column affinity from a declared type
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity
+func newColumnAffinity(declaredType string) ColumnAffinity {
+	t := strings.ToUpper(declaredType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return AffinityInteger
+	case strings.Contains(t, "CHAR"),
+		strings.Contains(t, "CLOB"),
+		strings.Contains(t, "TEXT"):
+		return AffinityText
+	case len(t) == 0, strings.Contains(t, "BLOB"):
+		return AffinityBlob
+	case strings.Contains(t, "REAL"),
+		strings.Contains(t, "FLOA"),
+		strings.Contains(t, "DOUB"):
+		return AffinityReal
+	}
+	return AffinityNumeric
+}
+
+func (c columnMap) String() string {
+	var buf strings.Builder
+	for k, v := range c {
+		buf.WriteString(
+			fmt.Sprintf("(Col=%s,Idx=%d) ", k, v))
+	}
+	return buf.String()
+}
+
+type CellHeader struct {
+	Type SerialType
+	Size int64
+}
+
+func NewCellHeader(variant int64) CellHeader {
+	// 12 and 13 are the empty blob and text
+	if variant >= int64(SerialText) && variant%2 == 1 {
+		return CellHeader{Type: SerialText, Size: (variant - 13) / 2}
+	}
+	if variant >= int64(SerialBlob) && variant%2 == 0 {
+		return CellHeader{Type: SerialBlob, Size: (variant - 12) / 2}
+	}
+	switch variant {
+	case int64(Serial48TwosComplement):
+		return CellHeader{Type: Serial48TwosComplement, Size: 6}
+	case int64(Serial64TwosComplement):
+		return CellHeader{Type: Serial64TwosComplement, Size: 8}
+	case int64(SerialFloat):
+		return CellHeader{Type: SerialFloat, Size: 8}
+	case int64(Serial0):
+		return CellHeader{Type: Serial0, Size: 0}
+	case int64(Serial1):
+		return CellHeader{Type: Serial1, Size: 0}
+	case int64(SerialInternal1):
+		return CellHeader{Type: SerialInternal1, Size: 0}
+	case int64(SerialInternal2):
+		return CellHeader{Type: SerialInternal2, Size: 0}
+	}
+	return CellHeader{Type: SerialType(variant), Size: variant}
+}
+
+// The type of the column with the length of blobs and text, as in
+// TEXT(12)
+func (c CellHeader) String() string {
+	if c.Type == SerialBlob || c.Type == SerialText {
+		return fmt.Sprintf("%s(%d)", c.Type, c.Size)
+	}
+	return c.Type.String()
+}
+
+// Serial types 10 and 11 are reserved for internal use and
+// should never appear in a well-formed database file.
+// They carry no payload so the column offsets are unaffected.
+func (c CellHeader) IsReserved() bool {
+	return c.Type == SerialInternal1 || c.Type == SerialInternal2
+}
+
+type Record struct {
+	Offset         int64
+	PageType       uint8
+	LeftPageNumber uint32
+	HeaderSize     uint64
+	PayloadSize    uint64
+	FirstOverflow  uint32
+	RowID          int64
+	ColumnMap      map[string]int
+	ColumnAffinity []ColumnAffinity
+	// the collation each column declares with COLLATE, lowercased, empty
+	// for BINARY
+	ColumnCollation []string
+	RowidColumn     int
+	// the table is declared WITHOUT ROWID, set with ColumnMap
+	WithoutRowid bool
+	Header       []CellHeader
+	Data         []byte
+	// encoding of text values, UTF-8 when 0
+	TextEncoding uint32
+	// offset in Data of the content of each column, summed up once
+	// when the header is parsed
+	offsets []int64
+	// what Header and offsets are decoded into for records of up to
+	// inlineColumns columns, so they take no allocations of their own
+	inlineHeader  [inlineColumns]CellHeader
+	inlineOffsets [inlineColumns]int64
+}
+
+// Columns of a record that are decoded without allocating
+const inlineColumns = 8
+
+// Decodes the serial types of a record header, without its size, into
+// Header and the offset of each column's content into offsets. Returns
+// the size of the content the header describes.
+func (c *Record) parseHeader(header []byte) int64 {
+	c.Header, c.offsets = c.inlineHeader[:0], c.inlineOffsets[:0]
+	size := int64(0)
+	for i := 0; i < len(header); {
+		variant, read := ReadVarint(header[i:])
+		i += read
+		h := NewCellHeader(variant)
+		c.Header = append(c.Header, h)
+		c.offsets = append(c.offsets, size)
+		size += h.Size
+	}
+	return size
+}
+
+func newCell(f io.ReadSeeker, p *Page, offset int64) (*Record, error) {
+	if offset == 0 {
+		if p.Header.CellContent <= 0 {
+			return nil, corruptPageError(p.Number(), "invalid cell offset 0")
+		}
+		offset = int64(p.Header.CellContent)
+	}
+	scratch := cellBufferPool.Get().(*[]byte)
+	defer cellBufferPool.Put(scratch)
+	buf, err := readCellBytes(f, p, p.Start()+offset, scratch)
+	if err != nil {
+		return nil, err
+	}
+	c := Record{Offset: offset, PageType: p.Header.PageType, TextEncoding: p.TextEncoding}
+	switch c.PageType {
+	case LeafTableType:
+		if err := parseLeafTableCell(buf, &c); err != nil {
+			return nil, err
+		}
+		break
+	case InteriorTableType:
+		if err := parseInteriorTableCell(buf, &c); err != nil {
+			return nil, err
+		}
+		break
+	case LeafIndexType:
+		if err := parseLeafIndexCell(buf, &c); err != nil {
+			return nil, err
+		}
+	case InteriorIndexType:
+		if err := parseInteriorIndexCell(buf, &c); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, corruptPageError(p.Number(), "unknown page type %d", p.Header.PageType)
+	}
+	return &c, nil
+}
+
+// Buffers cells are read into before their record is copied out, reused
+// as a scan reads every cell of every page
+var cellBufferPool = sync.Pool{New: func() any { return new([]byte) }}
+
+// Returns a slice of n bytes of the pooled buffer, growing it if needed
+func scratchBuffer(scratch *[]byte, n int) []byte {
+	if cap(*scratch) < n {
+		*scratch = make([]byte, n)
+	}
+	return (*scratch)[:n]
+}
+
+// Reads the cell starting at offset, which must lie on page p, as if it
+// were stored contiguously: payloads spilling onto overflow pages are
+// reassembled in place, followed by the first overflow page number.
+// Cells without overflow are read into scratch, which the result is only
+// valid as long as.
+func readCellBytes(f io.ReadSeeker, p *Page, offset int64, scratch *[]byte) ([]byte, error) {
+	end := p.Start() + p.PageSize
+	if offset >= end {
+		return nil, corruptPageError(p.Number(), "cell offset %d is outside the page", offset)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	// padded so a cell at the very end of the page can still be parsed
+	buf := scratchBuffer(scratch, int(end-offset+4))
+	clear(buf[end-offset:])
+	if _, err := io.ReadFull(f, buf[:end-offset]); err != nil {
+		return nil, err
+	}
+	prefix := 0
+	switch p.Header.PageType {
+	case InteriorTableType:
+		return buf, nil
+	case InteriorIndexType:
+		prefix = 4
+	}
+	payloadSize, read := ReadVarint(buf[prefix:])
+	prefix += read
+	if p.Header.PageType == LeafTableType {
+		_, read = ReadVarint(buf[prefix:])
+		prefix += read
+	}
+	isTable := p.Header.PageType == LeafTableType
+	local := localPayloadSize(int(payloadSize), p.Usable(), isTable)
+	if local >= int(payloadSize) {
+		return buf, nil
+	}
+	if prefix+local+4 > len(buf)-4 {
+		return nil, corruptPageError(p.Number(), "cell at offset %d overflows its page", offset)
+	}
+	firstOverflow := buf[prefix+local : prefix+local+4]
+	cell := make([]byte, 0, prefix+int(payloadSize)+4)
+	cell = append(cell, buf[:prefix+local]...)
+	next := binary.BigEndian.Uint32(firstOverflow)
+	pageBuffer := cellBufferPool.Get().(*[]byte)
+	defer cellBufferPool.Put(pageBuffer)
+	page := scratchBuffer(pageBuffer, int(p.PageSize))
+	for remaining := int(payloadSize) - local; remaining > 0; {
+		if next == 0 {
+			return nil, corruptPageError(p.Number(), "overflow chain of cell at offset %d is too short", offset)
+		}
+		if _, err := f.Seek(PageNumberToOffset(p.PageSize, int64(next)), io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(f, page); err != nil {
+			return nil, err
+		}
+		n := minInt(remaining, p.Usable()-4)
+		cell = append(cell, page[4:4+n]...)
+		remaining -= n
+		next = binary.BigEndian.Uint32(page)
+	}
+	return append(cell, firstOverflow...), nil
+}
+
+// Converts text stored in the given encoding to a UTF-8 string
+func decodeText(data []byte, encoding uint32) string {
+	if encoding != TextEncodingUTF16LE && encoding != TextEncodingUTF16BE {
+		return string(data)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if encoding == TextEncodingUTF16LE {
+			units[i] = binary.LittleEndian.Uint16(data[2*i:])
+		} else {
+			units[i] = binary.BigEndian.Uint16(data[2*i:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// Decodes a record payload into a cell so its
+// columns can be read with ReadDataFromHeaderIndex
+func NewRecordCell(rowID int64, payload []byte) (*Record, error) {
+	headerSize, read := ReadVarint(payload)
+	if read == 0 || headerSize < int64(read) || headerSize > int64(len(payload)) {
+		return nil, fmt.Errorf("invalid record header size %d in row %d", headerSize, rowID)
+	}
+	c := &Record{PageType: LeafTableType, RowID: rowID, ColumnMap: make(columnMap)}
+	c.parseHeader(payload[read:headerSize])
+	for i, h := range c.Header {
+		if h.Size < 0 || c.offsets[i]+h.Size > int64(len(payload))-headerSize {
+			return nil, fmt.Errorf("record of row %d is larger than its payload", rowID)
+		}
+	}
+	c.HeaderSize = uint64(headerSize)
+	c.PayloadSize = uint64(len(payload)) - uint64(headerSize)
+	c.Data = payload[headerSize:]
+	return c, nil
+}
+
+// Decodes the bytes of a record on their own, such as the payload of a
+// cell copied out of a WAL frame or a freed page. The columns are read
+// with Value, text as UTF-8 unless TextEncoding is set.
+// https://www.sqlite.org/fileformat.html#record_format
+func DecodeRecord(payload []byte) (*Record, error) {
+	return NewRecordCell(0, payload)
+}
+
+// Encodes values as the bytes of a record, the reverse of DecodeRecord.
+// Values are nil, integers, float64, string, []byte or bool, with text
+// written as UTF-8 and 0 and 1 stored in their serial type as schema
+// format 4 allows.
+func EncodeRecord(values []any) ([]byte, error) {
+	return recordSerializer{SchemaFormat: 4}.Encode(values)
+}
+
+// Value of column i, an int64, float64, string, []byte or nil. Columns
+// past the end of the record are nil, as they are for rows written
+// before ALTER TABLE ADD COLUMN.
+func (c *Record) Value(i int) (any, error) {
+	if i < 0 {
+		return nil, fmt.Errorf("invalid column index %d", i)
+	}
+	return c.ReadDataFromHeaderIndex(i)
+}
+
+// A column of a record, the varint holding its serial type in the
+// record header and the byte range of its content, both as offsets
+// into the payload
+type RecordColumn struct {
+	Type  VarintField
+	Start int
+	End   int
+}
+
+// Byte ranges of the parts of a record
+// https://www.sqlite.org/fileformat.html#record_format
+type RecordLayout struct {
+	HeaderSize VarintField
+	Columns    []RecordColumn
+}
+
+func DecodeRecordLayout(payload []byte) (RecordLayout, error) {
+	l := RecordLayout{}
+	headerSize, read := ReadVarint(payload)
+	if headerSize < int64(read) || headerSize > int64(len(payload)) {
+		return l, fmt.Errorf("invalid record header size %d", headerSize)
+	}
+	l.HeaderSize = VarintField{Value: headerSize, Start: 0, End: read}
+	offset, content := read, int(headerSize)
+	for offset < int(headerSize) {
+		v, read := ReadVarint(payload[offset:int(headerSize)])
+		size := int(NewCellHeader(v).Size)
+		if size < 0 || content+size > len(payload) {
+			return l, fmt.Errorf("column %d is larger than the payload", len(l.Columns))
+		}
+		l.Columns = append(l.Columns, RecordColumn{
+			Type:  VarintField{Value: v, Start: offset, End: offset + read},
+			Start: content,
+			End:   content + size,
+		})
+		offset += read
+		content += size
+	}
+	return l, nil
+}
+
+func (c *Record) ParseColumnMap() {
+	if len(c.ColumnMap) > 0 {
+		return
+	}
+	if c.ColumnMap == nil {
+		c.ColumnMap = make(columnMap)
+	}
+	start := c.HeaderOffsetFromN(len(c.Header) - 1)
+	end := start + c.Header[len(c.Header)-1].Size
+	data := decodeText(c.Data[start:end], c.TextEncoding)
+	columns := splitColumnDefinitions(data)
+	c.RowidColumn = -1
+	c.WithoutRowid = isWithoutRowid(data)
+	declaredTypes := []string{}
+	for i, column := range columns {
+		parts := strings.Split(strings.TrimSpace(column), " ")
+		name := strings.TrimSuffix(parts[0], ")")
+		// constraints may be written without a space, as in unique(a, b)
+		if isTableConstraint(strings.SplitN(name, "(", 2)[0]) {
+			c.parseTableConstraint(strings.Join(columns[i:], ","), declaredTypes)
+			break
+		}
+		typeIdx := 1
+		if strings.HasPrefix(name, "\"") {
+			for _, part := range parts[1:] {
+				name += " " + part
+				typeIdx++
+				if strings.HasSuffix(part, "\"") {
+					break
+				}
+			}
+		} else {
+			name = strings.ToLower(strings.TrimSpace(name))
+		}
+		name = CleanKeyString(name)
+		name = strings.Split(name, " ")[0]
+		c.ColumnMap[name] = i
+		declaredType := ""
+		if typeIdx < len(parts) {
+			declaredType = strings.TrimSuffix(parts[typeIdx], ")")
+		}
+		c.ColumnAffinity = append(c.ColumnAffinity, newColumnAffinity(declaredType))
+		c.ColumnCollation = append(c.ColumnCollation, declaredCollation(column))
+		declaredTypes = append(declaredTypes, declaredType)
+		// an INTEGER PRIMARY KEY column is an alias for the rowid
+		if strings.EqualFold(declaredType, "integer") &&
+			strings.Contains(strings.ToUpper(column), "PRIMARY KEY") &&
+			!strings.Contains(strings.ToUpper(column), "DESC") {
+			c.RowidColumn = i
+		}
+	}
+}
+
+// The collation a column definition names with COLLATE, lowercased,
+// empty for BINARY
+func declaredCollation(column string) string {
+	tokens := tokenizeSQL(column)
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].Depth == 0 && strings.EqualFold(tokens[i].Text, "collate") {
+			if name := strings.ToLower(dequoteIdentifier(tokens[i+1].Text)); name != "binary" {
+				return name
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// The collation of column idx, empty for BINARY
+func (c *Record) Collation(idx int) string {
+	if idx < 0 || idx >= len(c.ColumnCollation) {
+		return ""
+	}
+	return c.ColumnCollation[idx]
+}
+
+// Splits the body of a CREATE TABLE statement on top level commas,
+// so types like DECIMAL(10,2) and quoted names stay intact. Comments
+// are left out.
+func splitColumnDefinitions(sql string) []string {
+	start := strings.Index(sql, "(")
+	end := strings.LastIndex(sql, ")")
+	if start < 0 || end <= start {
+		return []string{}
+	}
+	body := sql[start+1 : end]
+	columns := []string{}
+	var column strings.Builder
+	depth := 0
+	var quote byte
+	for i := 0; i < len(body); i++ {
+		b := body[i]
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case strings.HasPrefix(body[i:], "--"):
+			if n := strings.IndexByte(body[i:], '\n'); n >= 0 {
+				i += n
+			} else {
+				i = len(body)
+			}
+			column.WriteByte(' ')
+			continue
+		case strings.HasPrefix(body[i:], "/*"):
+			if n := strings.Index(body[i+2:], "*/"); n >= 0 {
+				i += n + 3
+			} else {
+				i = len(body)
+			}
+			column.WriteByte(' ')
+			continue
+		case b == '"' || b == '\'' || b == '`':
+			quote = b
+		case b == '[':
+			quote = ']'
+		case b == '(':
+			depth++
+		case b == ')':
+			depth--
+		case b == ',' && depth == 0:
+			columns = append(columns, column.String())
+			column.Reset()
+			continue
+		}
+		column.WriteByte(b)
+	}
+	return append(columns, column.String())
+}
+
+// Table constraints follow the column definitions
+func isTableConstraint(word string) bool {
+	switch strings.ToLower(word) {
+	case "primary", "unique", "check", "foreign", "constraint":
+		return true
+	}
+	return false
+}
+
+// A single column PRIMARY KEY(col) table constraint on
+// an INTEGER column also makes that column a rowid alias
+func (c *Record) parseTableConstraint(constraints string, declaredTypes []string) {
+	upper := strings.ToUpper(constraints)
+	idx := strings.Index(upper, "PRIMARY KEY")
+	if idx < 0 {
+		return
+	}
+	matches := IndexKeyRegexp.FindStringSubmatch(constraints[idx:])
+	if len(matches) < 2 || strings.Contains(matches[1], ",") {
+		return
+	}
+	name := strings.Split(CleanKeyString(matches[1]), " ")[0]
+	if col, ok := c.ColumnMap[name]; ok && strings.EqualFold(declaredTypes[col], "integer") {
+		c.RowidColumn = col
+	}
+}
+
+// An INTEGER PRIMARY KEY column is stored as NULL in the record,
+// its value is the rowid of the cell
+func (c *Record) IsRowidAlias(name string) bool {
+	idx, ok := c.ColumnMap[name]
+	return ok && idx == c.RowidColumn
+}
+
+func (c *Record) ColumnCount() int {
+	return len(c.ColumnAffinity)
+}
+
+// Names of the columns in table order
+func (c *Record) ColumnNames() []string {
+	names := make([]string, c.ColumnCount())
+	for name, idx := range c.ColumnMap {
+		if idx < len(names) {
+			names[idx] = name
+		}
+	}
+	return names
+}
+
+// SQLite stores reals without a fractional part as integers
+// when the column has REAL affinity, so convert those back
+// using the affinity parsed from the schema cell.
+func (c *Record) ApplyAffinity(idx int, v any) any {
+	if idx >= len(c.ColumnAffinity) {
+		return v
+	}
+	if i, ok := v.(int64); ok && c.ColumnAffinity[idx] == AffinityReal {
+		return float64(i)
+	}
+	return v
+}
+
+func (c *Record) CellType() CellType {
+	dataLength := len(c.Data)
+	if dataLength <= 0 {
+		return CellTypeUnknown
+	}
+	if len(c.Header) < 1 ||
+		c.Header[0].Type != SerialText {
+		return CellTypeUnknown
+	}
+	d := c.Data[:c.Header[0].Size]
+	if c.TextEncoding > TextEncodingUTF8 {
+		d = []byte(decodeText(d, c.TextEncoding))
+	}
+	if bytes.Equal(d, TableTypeBytes) {
+		return CellTypeTable
+	} else if bytes.Equal(d, IndexTypeBytes) {
+		return CellTypeIndex
+	} else if bytes.Equal(d, ViewTypeBytes) {
+		return CellTypeView
+	} else if bytes.Equal(d, TriggerTypeBytes) {
+		return CellTypeTrigger
+	}
+	return CellTypeUnknown
+}
+
+func (c *Record) IsTable() bool {
+	return c.CellType() == CellTypeTable
+}
+
+func (c *Record) IsIndex() bool {
+	return c.CellType() == CellTypeIndex
+}
+
+// Gets the offset in bytes to the nth header position
+func (c *Record) HeaderOffsetFromN(n int) int64 {
+	if n >= len(c.Header) {
+		return 0
+	}
+	if len(c.offsets) == len(c.Header) {
+		return c.offsets[n]
+	}
+	var offset int64 = 0
+	for i := 0; i < n; i++ {
+		offset += c.Header[i].Size
+	}
+	return offset
+}
+
+func (c *Record) TableName() (string, error) {
+	if c.CellType() == CellTypeUnknown {
+		return "", fmt.Errorf("cannot get tablename: cell %d is unknown type", c.RowID)
+	}
+	offset := c.HeaderOffsetFromN(2)
+	return CleanKeyString(decodeText(c.Data[offset:offset+c.Header[2].Size], c.TextEncoding)), nil
+}
+
+// Name of the schema object, which for indexes differs from TableName
+func (c *Record) SchemaName() (string, error) {
+	if c.CellType() == CellTypeUnknown {
+		return "", fmt.Errorf("cannot get name: cell %d is unknown type", c.RowID)
+	}
+	offset := c.HeaderOffsetFromN(1)
+	return CleanKeyString(decodeText(c.Data[offset:offset+c.Header[1].Size], c.TextEncoding)), nil
+}
+
+// Name of the table an index is on and its indexed columns, joined by
+// commas, or "1" for the automatic indexes that have no CREATE INDEX
+func (c *Record) IndexCtx() (string, string, error) {
+	if !c.IsIndex() {
+		return "", "", fmt.Errorf("cannot get index ctx: cell %d is not index", c.RowID)
+	}
+	name, err := c.TableName()
+	if err != nil {
+		return "", "", err
+	}
+	key := "1"
+	sql, _ := c.ReadDataFromHeaderIndex(4)
+	// an index that does not parse still belongs to its table
+	if def, err := ParseIndexDefinition(FormatValue(sql)); sql != nil && err == nil {
+		terms := []string{}
+		for _, column := range def.Columns {
+			if column.Expr != "" {
+				terms = append(terms, CleanKeyString(column.Expr))
+			} else {
+				terms = append(terms, column.Name)
+			}
+		}
+		key = strings.Join(terms, ", ")
+	}
+	return name, key, nil
+}
+
+func (c *Record) RootPage() (int64, error) {
+	if c.PageType == InteriorTableType {
+		return 0, errors.New("incorrect table type")
+	}
+	dataLength := len(c.Data)
+	if dataLength <= 0 {
+		return 0, errors.New("cell contains no data")
+	}
+	if len(c.Header) < 4 ||
+		c.Header[0].Type != SerialText ||
+		c.Header[1].Type != SerialText ||
+		c.Header[2].Type != SerialText {
+		return 0, errors.New("unexpected header types")
+	}
+	val, err := c.ReadDataFromHeaderIndex(3)
+	if err != nil {
+		return 0, err
+	}
+	return val.(int64), nil
+}
+
+// leaf table starts with two variants, then a byte array
+// and then a 4-byte integer for overflow page ptr
+func parseLeafTableCell(buf []byte, c *Record) error {
+	var offset int64 = 0
+	// get payload length in bytes (which includes header size)
+	payloadLength, read := ReadVarint(buf)
+	offset += int64(read)
+	// get row id of cell
+	rowID, read := ReadVarint(buf[offset:])
+	offset += int64(read)
+	c.RowID = rowID
+	return parseCellRecord(buf, offset, payloadLength, c)
+}
+
+// interior table only contains the left child
+// page number and the row id of the cell
+func parseInteriorTableCell(buf []byte, c *Record) error {
+	c.LeftPageNumber = binary.BigEndian.Uint32(buf)
+	rowID, _ := ReadVarint(buf[4:])
+	c.RowID = rowID
+	return nil
+}
+
+func parseLeafIndexCell(buf []byte, c *Record) error {
+	// get payload length in bytes (which includes header size)
+	payloadLength, read := ReadVarint(buf)
+	return parseCellRecord(buf, int64(read), payloadLength, c)
+}
+
+// index interior contains left child ptr,
+// varint with payload size, then payload
+func parseInteriorIndexCell(buf []byte, c *Record) error {
+	c.LeftPageNumber = binary.BigEndian.Uint32(buf)
+	// get payload length in bytes (which includes header size)
+	payloadLength, read := ReadVarint(buf[4:])
+	return parseCellRecord(buf, 4+int64(read), payloadLength, c)
+}
+
+// Reads the record starting at offset, its header and a copy of its
+// content, which outlives buf, then the overflow page pointer after it
+func parseCellRecord(buf []byte, offset int64, payloadLength int64, c *Record) error {
+	// the size of the header, itself a varint, counts towards it
+	headerLength, read := ReadVarint(buf[offset:])
+	if read == 0 || headerLength < int64(read) || headerLength > payloadLength {
+		return io.EOF
+	}
+	c.HeaderSize = uint64(headerLength)
+	// set the actual payload size i.e without header length
+	c.PayloadSize = uint64(payloadLength) - c.HeaderSize
+	headerEnd := offset + headerLength
+	if headerEnd+int64(c.PayloadSize)+4 > int64(len(buf)) {
+		return io.EOF
+	}
+	c.parseHeader(buf[offset+int64(read) : headerEnd])
+	c.Data = make([]byte, c.PayloadSize)
+	offset = headerEnd + int64(copy(c.Data, buf[headerEnd:]))
+	c.FirstOverflow = binary.BigEndian.Uint32(buf[offset:])
+	return nil
+}
+
+func (c *Record) ReadDataFromHeaderIndex(headerIdx int) (any, error) {
+	// records written before ALTER TABLE ADD COLUMN lack the new columns
+	if headerIdx >= len(c.Header) {
+		return nil, nil
+	}
+	return c.readColumnAt(headerIdx, c.HeaderOffsetFromN(headerIdx))
+}
+
+// Reads the columns at the header indexes in columns into values
+func (c *Record) readColumns(columns []int, values []any) error {
+	for j, idx := range columns {
+		v, err := c.ReadDataFromHeaderIndex(idx)
+		if err != nil {
+			return err
+		}
+		values[j] = v
+	}
+	return nil
+}
+
+// Decodes the column at header index headerIdx, whose content starts
+// at offset start in Data
+func (c *Record) readColumnAt(headerIdx int, start int64) (any, error) {
+	h := c.Header[headerIdx]
+	end := start + h.Size
+	data := c.Data[start:end]
+	switch h.Type {
+	case 0:
+		return nil, nil
+	case 1:
+		return int64(int8(data[0])), nil
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(data))), nil
+	case 3:
+		var val int32
+		val |= int32(data[0]) << 16
+		val |= int32(data[1]) << 8
+		val |= int32(data[2])
+		// Check if it's negative and convert it accordingly
+		if val&(1<<23) != 0 {
+			val |= ^((1 << 24) - 1)
+		}
+		return int64(val), nil
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(data))), nil
+	case 5:
+		var val int64
+		val |= int64(data[0]) << 40
+		val |= int64(data[1]) << 32
+		val |= int64(data[2]) << 24
+		val |= int64(data[3]) << 16
+		val |= int64(data[4]) << 8
+		val |= int64(data[5])
+		// Check if it's negative and convert it accordingly
+		if val&(1<<47) != 0 {
+			val |= ^((1 << 48) - 1)
+		}
+		return val, nil
+	case 6:
+		return int64(binary.BigEndian.Uint64(data)), nil
+	case 7:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case 8:
+		return int64(0), nil
+	case 9:
+		return int64(1), nil
+	case 10, 11:
+		return nil, fmt.Errorf("reserved serial type %d in cell %d column %d", h.Type, c.RowID, headerIdx)
+	case 12:
+		return data, nil
+	case 13:
+		return decodeText(data, c.TextEncoding), nil
+	}
+	return 0, fmt.Errorf("unsupported format: %d", h.Type)
+}
+
+func (p *Record) String() string {
+	var w fieldWriter
+	switch p.PageType {
+	case LeafTableType:
+		w.int("CellOffset", p.Offset)
+		w.uint("FirstOverflow", uint64(p.FirstOverflow))
+		w.uint("HeaderSize", uint64(p.HeaderSize))
+		w.uint("PayloadSize", p.PayloadSize)
+		w.int("RowID", p.RowID)
+		if len(p.ColumnMap) > 0 {
+			w.str("ColumnMap", fmt.Sprint(p.ColumnMap))
+			w.header("Header", p.Header)
+		} else {
+			w.header("Header", p.Header)
+			w.str("Data", string(p.Data))
+		}
+	case LeafIndexType:
+		w.int("CellOffset", p.Offset)
+		w.uint("FirstOverflow", uint64(p.FirstOverflow))
+		w.uint("HeaderSize", uint64(p.HeaderSize))
+		w.uint("PayloadSize", p.PayloadSize)
+		w.header("Header", p.Header)
+		w.str("Data", string(p.Data))
+	case InteriorIndexType:
+		w.int("CellOffset", p.Offset)
+		w.uint("FirstOverflow", uint64(p.FirstOverflow))
+		w.uint("LeftPageNumber", uint64(p.LeftPageNumber))
+		w.uint("PayloadSize", p.PayloadSize)
+		w.header("Header", p.Header)
+		w.str("Data", string(p.Data))
+	case InteriorTableType:
+		w.int("CellOffset", p.Offset)
+		w.uint("LeftPageNumber", uint64(p.LeftPageNumber))
+		w.int("RowID", p.RowID)
+	}
+	return w.String()
+}
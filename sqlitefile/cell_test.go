@@ -0,0 +1,75 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestEncodeRecord(t *testing.T) {
+	values := []any{nil, int64(0), int64(1), int64(-129), int64(math.MaxInt64), 2.5, "text", []byte{0, 0xff}, []byte{}, ""}
+	payload, err := EncodeRecord(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := DecodeRecord(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Header) != len(values) {
+		t.Fatalf("decoded %d columns, encoded %d", len(r.Header), len(values))
+	}
+	for i, want := range values {
+		got, err := r.Value(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, ok := want.([]byte); ok {
+			if g, ok := got.([]byte); !ok || !bytes.Equal(g, b) {
+				t.Errorf("column %d = %#v, want %#v", i, got, want)
+			}
+		} else if got != want {
+			t.Errorf("column %d = %#v, want %#v", i, got, want)
+		}
+	}
+	if _, err := EncodeRecord([]any{struct{}{}}); err == nil {
+		t.Error("encoded a struct")
+	}
+}
+
+// Decoding a record and reading every column, for records whose header
+// fits the arrays on the Record and for wider ones
+func BenchmarkDecodeRecord(b *testing.B) {
+	for _, columns := range []int{2, 8, 20} {
+		values := make([]any, columns)
+		for i := range values {
+			switch i % 3 {
+			case 0:
+				values[i] = int64(i * 1000)
+			case 1:
+				values[i] = fmt.Sprintf("value %d", i)
+			default:
+				values[i] = float64(i) + 0.5
+			}
+		}
+		payload, err := EncodeRecord(values)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("%d columns", columns), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r, err := NewRecordCell(int64(i), payload)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for j := range values {
+					if _, err := r.Value(j); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// The kind of a change, with the values SQLite gives SQLITE_INSERT,
+// SQLITE_DELETE and SQLITE_UPDATE
+type ChangeOp byte
+
+const (
+	ChangeDelete ChangeOp = 9
+	ChangeInsert ChangeOp = 18
+	ChangeUpdate ChangeOp = 23
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeDelete:
+		return "DELETE"
+	case ChangeInsert:
+		return "INSERT"
+	case ChangeUpdate:
+		return "UPDATE"
+	}
+	return fmt.Sprintf("ChangeOp(%d)", byte(op))
+}
+
+// Stands in for a value a change does not record, such as the columns
+// an UPDATE leaves alone
+type Undefined struct{}
+
+func (Undefined) String() string {
+	return "undefined"
+}
+
+// The changes to one table in a changeset or patchset
+type ChangesetTable struct {
+	Name string
+	// whether each column is part of the primary key
+	PrimaryKey []bool
+	// patchsets leave out the old values except for the primary key
+	Patchset bool
+	Changes  []Change
+}
+
+// A row inserted, deleted or updated. Old holds the row before the
+// change and New the row after it, nil for an INSERT and a DELETE
+// respectively.
+type Change struct {
+	Op       ChangeOp
+	Indirect bool
+	Old      []any
+	New      []any
+}
+
+// Decodes a changeset or patchset blob as made by the session extension.
+// It is a series of tables, each a header followed by the changes made
+// to the table.
+// https://www.sqlite.org/sessionintro.html
+func DecodeChangeset(data []byte) ([]ChangesetTable, error) {
+	r := &changesetReader{data: data}
+	tables := []ChangesetTable{}
+	for r.pos < len(r.data) {
+		switch b := r.data[r.pos]; b {
+		case 'T', 'P':
+			t, err := r.readTable()
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, t)
+		default:
+			if len(tables) == 0 {
+				return nil, fmt.Errorf("changeset starts with 0x%02x instead of a table header", b)
+			}
+			t := &tables[len(tables)-1]
+			c, err := r.readChange(t)
+			if err != nil {
+				return nil, fmt.Errorf("change %d of %s: %w", len(t.Changes)+1, t.Name, err)
+			}
+			t.Changes = append(t.Changes, c)
+		}
+	}
+	return tables, nil
+}
+
+type changesetReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *changesetReader) errorf(format string, args ...any) error {
+	return fmt.Errorf("changeset offset %d: %s", r.pos, fmt.Sprintf(format, args...))
+}
+
+func (r *changesetReader) readByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, r.errorf("unexpected end")
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *changesetReader) readBytes(n int64) ([]byte, error) {
+	if n < 0 || n > int64(len(r.data)-r.pos) {
+		return nil, r.errorf("%d bytes past the end", n)
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *changesetReader) readVarint() (int64, error) {
+	v, n := ReadVarint(r.data[r.pos:])
+	if n == 0 {
+		return 0, r.errorf("unexpected end")
+	}
+	r.pos += n
+	return v, nil
+}
+
+// Reads a table header: 'T' or 'P' for a patchset, the number of
+// columns, a byte per column that is its position in the primary key or
+// 0, and the name of the table ending in a zero byte
+func (r *changesetReader) readTable() (ChangesetTable, error) {
+	t := ChangesetTable{Patchset: r.data[r.pos] == 'P', Changes: []Change{}}
+	r.pos++
+	n, err := r.readVarint()
+	if err != nil {
+		return t, err
+	}
+	pk, err := r.readBytes(n)
+	if err != nil {
+		return t, err
+	}
+	for _, b := range pk {
+		t.PrimaryKey = append(t.PrimaryKey, b != 0)
+	}
+	start := r.pos
+	for {
+		b, err := r.readByte()
+		if err != nil {
+			return t, r.errorf("table name is not terminated")
+		}
+		if b == 0 {
+			break
+		}
+	}
+	t.Name = string(r.data[start : r.pos-1])
+	return t, nil
+}
+
+// Reads a change: its kind, the indirect flag and the records it needs.
+// A changeset has the old row for a DELETE and both for an UPDATE, a
+// patchset only the primary key of the former and the new row of the
+// latter.
+func (r *changesetReader) readChange(t *ChangesetTable) (Change, error) {
+	var c Change
+	op, err := r.readByte()
+	if err != nil {
+		return c, err
+	}
+	c.Op = ChangeOp(op)
+	indirect, err := r.readByte()
+	if err != nil {
+		return c, err
+	}
+	c.Indirect = indirect != 0
+	switch c.Op {
+	case ChangeInsert:
+		c.New, err = r.readRecord(len(t.PrimaryKey), nil)
+	case ChangeDelete:
+		if t.Patchset {
+			c.Old, err = r.readRecord(len(t.PrimaryKey), t.PrimaryKey)
+		} else {
+			c.Old, err = r.readRecord(len(t.PrimaryKey), nil)
+		}
+	case ChangeUpdate:
+		if !t.Patchset {
+			if c.Old, err = r.readRecord(len(t.PrimaryKey), nil); err != nil {
+				return c, err
+			}
+		}
+		c.New, err = r.readRecord(len(t.PrimaryKey), nil)
+	default:
+		return c, r.errorf("unknown operation %d", op)
+	}
+	return c, err
+}
+
+// Reads a record of n values, each a type byte followed by the value:
+// 0 for an undefined value, 1 for an 8-byte integer, 2 for an 8-byte
+// real, 3 and 4 for text and a blob with a varint length, 5 for NULL.
+// When only is not nil, just the values of columns it is true for are
+// present.
+func (r *changesetReader) readRecord(n int, only []bool) ([]any, error) {
+	values := make([]any, n)
+	for i := range values {
+		if only != nil && !only[i] {
+			values[i] = Undefined{}
+			continue
+		}
+		kind, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 0:
+			values[i] = Undefined{}
+		case 1, 2:
+			b, err := r.readBytes(8)
+			if err != nil {
+				return nil, err
+			}
+			bits := binary.BigEndian.Uint64(b)
+			if kind == 1 {
+				values[i] = int64(bits)
+			} else {
+				values[i] = math.Float64frombits(bits)
+			}
+		case 3, 4:
+			size, err := r.readVarint()
+			if err != nil {
+				return nil, err
+			}
+			b, err := r.readBytes(size)
+			if err != nil {
+				return nil, err
+			}
+			if kind == 3 {
+				values[i] = string(b)
+			} else {
+				values[i] = b
+			}
+		case 5:
+			values[i] = nil
+		default:
+			return nil, r.errorf("unknown value type %d", kind)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,60 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+const (
+	DefaultPageSize     = 4096
+	SchemaFormatOffset  = 44
+	TextEncodingOffset  = 56
+	SqliteVersionOffset = 96
+	// the file format written here is that of sqlite 3.40.1
+	SqliteVersionNumber = 3040001
+	TextEncodingUTF8    = 1
+	TextEncodingUTF16LE = 2
+	TextEncodingUTF16BE = 3
+	LatestSchemaFormat  = 4
+)
+
+// Writes a new database consisting of the 100-byte header and an empty
+// sqlite_schema table leaf on page 1, as sqlite would after its first
+// write. An existing file is never overwritten.
+func Create(path string, pageSize int) error {
+	data := make([]byte, pageSize)
+	copy(data, DatabaseHeaderMagic)
+	// 65536 does not fit in the two bytes and is stored as 1
+	if pageSize == 65536 {
+		binary.BigEndian.PutUint16(data[16:], 1)
+	} else {
+		binary.BigEndian.PutUint16(data[16:], uint16(pageSize))
+	}
+	data[18] = 1
+	data[19] = 1
+	data[21] = MaxEmbeddedPayloadFraction
+	data[22] = MinEmbeddedPayloadFraction
+	data[23] = LeafPayloadFraction
+	binary.BigEndian.PutUint32(data[FileChangeCounterOffset:], 1)
+	binary.BigEndian.PutUint32(data[DatabaseSizeOffset:], 1)
+	binary.BigEndian.PutUint32(data[SchemaFormatOffset:], LatestSchemaFormat)
+	binary.BigEndian.PutUint32(data[TextEncodingOffset:], TextEncodingUTF8)
+	binary.BigEndian.PutUint32(data[VersionValidForOffset:], 1)
+	binary.BigEndian.PutUint32(data[SqliteVersionOffset:], SqliteVersionNumber)
+	root := RawPage{Number: 1, Data: data, Usable: pageSize}
+	root.Reset(LeafTableType)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
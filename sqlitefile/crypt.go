@@ -0,0 +1,82 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Returned when a database does not start with the sqlite header string
+// and looks like random data, as SQLCipher and SEE files do. They can be
+// read by opening them WithDecrypter.
+var ErrEncrypted = errors.New("database appears to be encrypted")
+
+// Decrypts the pages of an encrypted database as they are read, from the
+// database file and the WAL alike. Page 1 has to come out starting with
+// the sqlite header string, so the header can be parsed.
+type PageDecrypter interface {
+	// Size of the pages, which the header cannot tell before page 1 is
+	// decrypted
+	PageSize() int
+	// Decrypts page in place
+	DecryptPage(pageNumber int64, page []byte) error
+}
+
+// Reads the database through d. Writes are refused as they would not be
+// encrypted.
+func WithDecrypter(d PageDecrypter) Option {
+	return func(o *options) error {
+		if size := d.PageSize(); size < 512 || size > 65536 || size&(size-1) != 0 {
+			return fmt.Errorf("invalid page size for decryption: %d", size)
+		}
+		o.decrypter = d
+		o.readOnly = true
+		return nil
+	}
+}
+
+// A plain header starts with the header string and is mostly zero
+// bytes and small numbers, while ciphertext uses nearly every byte
+// value. 100 random bytes hold about 80 different ones.
+func looksEncrypted(header []byte) bool {
+	seen := map[byte]bool{}
+	for _, b := range header {
+		seen[b] = true
+	}
+	return len(seen) >= 64
+}
+
+// Reads whole pages from the WAL or the database file and decrypts them,
+// copying out the part buf asks for
+func (r *PageReader) readDecrypted(buf []byte, offset int64) (int, error) {
+	d := r.db.opts.decrypter
+	pageSize := int64(d.PageSize())
+	page := make([]byte, pageSize)
+	read := 0
+	for read < len(buf) {
+		pageNumber := offset/pageSize + 1
+		var n int
+		var ok bool
+		var err error
+		if r.db.Wal != nil {
+			n, ok, err = r.db.Wal.ReadPage(pageNumber, page, 0)
+		}
+		if !ok {
+			n, err = r.db.readAt(page, (pageNumber-1)*pageSize)
+		}
+		if n < len(page) {
+			// a page cut short cannot be decrypted
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return read, err
+		}
+		if err := d.DecryptPage(pageNumber, page); err != nil {
+			return read, fmt.Errorf("failed to decrypt page %d: %w", pageNumber, err)
+		}
+		n = copy(buf[read:], page[offset%pageSize:])
+		read += n
+		offset += int64(n)
+	}
+	return read, nil
+}
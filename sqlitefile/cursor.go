@@ -0,0 +1,597 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Walks the rows of a table b-tree in rowid order, either way. A new
+// cursor is not positioned on a row, First, Last or SeekRowid has to be
+// called before reading.
+//
+//	c, err := db.OpenCursor("t")
+//	for ok, err := c.First(); ok && err == nil; ok, err = c.Next() {
+//		v, err := c.Column(0)
+//	}
+type Cursor struct {
+	db     *Database
+	schema *Record
+	root   int64
+	// interior pages above the leaf and the child taken on each
+	path   []cursorStep
+	leaf   *RawPage
+	cell   int
+	valid  bool
+	record *Record
+}
+
+type cursorStep struct {
+	page  *RawPage
+	child int
+}
+
+// Opens a cursor over the rows of a table
+func (db *Database) OpenCursor(table string) (*Cursor, error) {
+	schema, ok := db.Tables[table]
+	if !ok {
+		return nil, TableNotFoundError(table)
+	}
+	// the rows of a WITHOUT ROWID table are the entries of an index
+	// b-tree, which has no rowids to walk or seek
+	if schema.WithoutRowid {
+		return nil, withoutRowidError("open a cursor on", table)
+	}
+	root, err := tableRootPage(table, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{db: db, schema: schema, root: root}, nil
+}
+
+// Moves to the row with the smallest rowid, returning false for an
+// empty table
+func (c *Cursor) First() (bool, error) {
+	c.path = c.path[:0]
+	if err := c.descend(c.root, false); err != nil {
+		return false, err
+	}
+	return c.settle()
+}
+
+// Moves to the row with the largest rowid, returning false for an
+// empty table
+func (c *Cursor) Last() (bool, error) {
+	c.path = c.path[:0]
+	if err := c.descend(c.root, true); err != nil {
+		return false, err
+	}
+	return c.settleBack()
+}
+
+// Moves to the next row, returning false after the last one
+func (c *Cursor) Next() (bool, error) {
+	if !c.valid {
+		return false, nil
+	}
+	c.cell++
+	return c.settle()
+}
+
+// Moves to the previous row, returning false before the first one
+func (c *Cursor) Prev() (bool, error) {
+	if !c.valid {
+		return false, nil
+	}
+	c.cell--
+	return c.settleBack()
+}
+
+// Moves to the row with the given rowid and reports whether it exists.
+// When it does not the cursor is left on the row with the next larger
+// rowid, if any, which Valid tells.
+func (c *Cursor) SeekRowid(rowid int64) (found bool, err error) {
+	span := c.db.startSpan("btree.seek", "root", c.root, "rowid", rowid)
+	defer func() { span.End(err) }()
+	c.path = c.path[:0]
+	page := c.root
+	for {
+		p, err := c.readPage(page)
+		if err != nil {
+			return false, err
+		}
+		if p.PageType() == LeafTableType {
+			c.leaf, c.cell, c.record = p, p.CellCount(), nil
+			for i := 0; i < p.CellCount(); i++ {
+				if p.CellRowID(i) >= rowid {
+					c.cell = i
+					break
+				}
+			}
+			break
+		}
+		if p.PageType() != InteriorTableType {
+			return false, corruptPageError(page, "not a table b-tree page")
+		}
+		child := p.CellCount()
+		for i := 0; i < p.CellCount(); i++ {
+			if rowid <= p.CellRowID(i) {
+				child = i
+				break
+			}
+		}
+		c.path = append(c.path, cursorStep{p, child})
+		page = int64(p.ChildPage(child))
+	}
+	if ok, err := c.settle(); !ok || err != nil {
+		return false, err
+	}
+	return c.Rowid() == rowid, nil
+}
+
+// Whether the cursor is on a row
+func (c *Cursor) Valid() bool {
+	return c.valid
+}
+
+// Rowid of the current row
+func (c *Cursor) Rowid() int64 {
+	if !c.valid {
+		return 0
+	}
+	return c.leaf.CellRowID(c.cell)
+}
+
+// Number of columns of the table
+func (c *Cursor) ColumnCount() int {
+	return c.schema.ColumnCount()
+}
+
+// Value of column i of the current row, converted with the affinity of
+// the column. An INTEGER PRIMARY KEY column reads as the rowid.
+func (c *Cursor) Column(i int) (any, error) {
+	if !c.valid {
+		return nil, errors.New("cursor is not on a row")
+	}
+	if i == c.schema.RowidColumn {
+		return c.Rowid(), nil
+	}
+	record, err := c.currentRecord()
+	if err != nil {
+		return nil, err
+	}
+	v, err := record.ReadDataFromHeaderIndex(i)
+	if err != nil {
+		return nil, err
+	}
+	return c.schema.ApplyAffinity(i, v), nil
+}
+
+// Decodes the record of the current row, once per row
+func (c *Cursor) currentRecord() (*Record, error) {
+	if c.record == nil {
+		payload, err := AssembleCellPayload(c.leaf, c.cell, c.readPage)
+		if err != nil {
+			return nil, err
+		}
+		if c.record, err = NewRecordCell(c.Rowid(), payload); err != nil {
+			return nil, err
+		}
+		c.db.cellsDecoded(c.leaf.Number, 1)
+		c.record.TextEncoding = c.db.TextEncoding
+	}
+	return c.record, nil
+}
+
+func (c *Cursor) readPage(n int64) (*RawPage, error) {
+	return ReadRawPage(c.db, n)
+}
+
+// Follows the left-most child pointers from page down to a leaf, or
+// the right-most ones to the last cell of a leaf when last is set
+func (c *Cursor) descend(page int64, last bool) error {
+	for {
+		p, err := c.readPage(page)
+		if err != nil {
+			return err
+		}
+		child := 0
+		if last {
+			child = p.CellCount()
+		}
+		switch p.PageType() {
+		case LeafTableType:
+			c.leaf, c.cell, c.record = p, 0, nil
+			if last {
+				c.cell = p.CellCount() - 1
+			}
+			return nil
+		case InteriorTableType:
+		default:
+			return corruptPageError(page, "not a table b-tree page")
+		}
+		c.path = append(c.path, cursorStep{p, child})
+		page = int64(p.ChildPage(child))
+	}
+}
+
+// Moves past the end of the current leaf onto the first cell of the
+// next leaf that has any, climbing back up the path as needed
+func (c *Cursor) settle() (bool, error) {
+	c.record = nil
+	for c.cell >= c.leaf.CellCount() {
+		for len(c.path) > 0 && c.path[len(c.path)-1].child >= c.path[len(c.path)-1].page.CellCount() {
+			c.path = c.path[:len(c.path)-1]
+		}
+		if len(c.path) == 0 {
+			c.valid = false
+			return false, nil
+		}
+		top := &c.path[len(c.path)-1]
+		top.child++
+		if err := c.descend(int64(top.page.ChildPage(top.child)), false); err != nil {
+			c.valid = false
+			return false, err
+		}
+	}
+	c.valid = true
+	return true, nil
+}
+
+// Moves before the start of the current leaf onto the last cell of the
+// previous leaf that has any, climbing back up the path as needed
+func (c *Cursor) settleBack() (bool, error) {
+	c.record = nil
+	for c.cell < 0 {
+		for len(c.path) > 0 && c.path[len(c.path)-1].child == 0 {
+			c.path = c.path[:len(c.path)-1]
+		}
+		if len(c.path) == 0 {
+			c.valid = false
+			return false, nil
+		}
+		top := &c.path[len(c.path)-1]
+		top.child--
+		if err := c.descend(int64(top.page.ChildPage(top.child)), true); err != nil {
+			c.valid = false
+			return false, err
+		}
+	}
+	c.valid = true
+	return true, nil
+}
+
+// Walks the entries of an index b-tree in key order, either way. Each entry holds
+// the values of the indexed columns and the rowid of the row they
+// belong to. Interior pages of an index hold entries as well, which
+// come between the entries of the children on either side of them.
+type IndexCursor struct {
+	db    *Database
+	table *Record
+	index *tableIndex
+	path  []cursorStep
+	leaf  *RawPage
+	cell  int
+	// on the entry of the interior page at the top of the path, the one
+	// following child path[len(path)-1].child
+	interior bool
+	valid    bool
+	key      []any
+	rowid    int64
+}
+
+// Opens a cursor over the entries of an index
+func (db *Database) OpenIndexCursor(index string) (*IndexCursor, error) {
+	name := CleanKeyString(index)
+	tableName := ""
+	for _, c := range db.Indicies {
+		if n, err := c.SchemaName(); err == nil && n == name {
+			tableName, _ = c.TableName()
+		}
+	}
+	if tableName == "" {
+		return nil, NotFoundError("no such index: %s", index)
+	}
+	table, ok := db.Tables[tableName]
+	if !ok {
+		return nil, TableNotFoundError(tableName)
+	}
+	indexes, err := loadTableIndexes(db, tableName, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, ix := range indexes {
+		if CleanKeyString(ix.Name) == name {
+			return &IndexCursor{db: db, table: table, index: ix}, nil
+		}
+	}
+	return nil, NotFoundError("no such index: %s", index)
+}
+
+// Entries of a UNIQUE index sharing a key, which sqlite would have
+// refused to write
+type DuplicateKey struct {
+	Key    []any
+	Rowids []int64
+}
+
+// Walks a UNIQUE index in key order looking for entries with the same
+// key. Keys holding a NULL never clash, as in sqlite. Entries out of
+// order, which would hide duplicates from the walk, are an error.
+func (db *Database) VerifyUniqueIndex(index string) ([]DuplicateKey, error) {
+	c, err := db.OpenIndexCursor(index)
+	if err != nil {
+		return nil, err
+	}
+	if !c.index.Unique {
+		return nil, fmt.Errorf("index %s is not UNIQUE", index)
+	}
+	duplicates := []DuplicateKey{}
+	var prev []any
+	var prevRowid int64
+	clashing := false
+	ok, err := c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		key, rowid := c.Entry()
+		order := 1
+		if prev != nil {
+			order = compareIndexKeys(key, prev, c.index.Desc)
+		}
+		switch {
+		case order < 0:
+			return duplicates, fmt.Errorf("index %s: entry of row %d is out of order after row %d", index, rowid, prevRowid)
+		case order > 0 || hasNull(key):
+			clashing = false
+		case clashing:
+			last := &duplicates[len(duplicates)-1]
+			last.Rowids = append(last.Rowids, rowid)
+		default:
+			clashing = true
+			duplicates = append(duplicates, DuplicateKey{Key: key, Rowids: []int64{prevRowid, rowid}})
+		}
+		prev, prevRowid = key, rowid
+	}
+	return duplicates, err
+}
+
+// Moves to the first entry, returning false for an empty index
+func (c *IndexCursor) First() (bool, error) {
+	c.path = c.path[:0]
+	if err := c.descend(c.index.Root, false); err != nil {
+		return false, err
+	}
+	return c.settle()
+}
+
+// Moves to the last entry, returning false for an empty index
+func (c *IndexCursor) Last() (bool, error) {
+	c.path = c.path[:0]
+	if err := c.descend(c.index.Root, true); err != nil {
+		return false, err
+	}
+	return c.settleBack()
+}
+
+// Moves to the next entry, returning false after the last one
+func (c *IndexCursor) Next() (bool, error) {
+	if !c.valid {
+		return false, nil
+	}
+	if c.interior {
+		top := &c.path[len(c.path)-1]
+		top.child++
+		if err := c.descend(int64(top.page.ChildPage(top.child)), false); err != nil {
+			c.valid = false
+			return false, err
+		}
+	} else {
+		c.cell++
+	}
+	return c.settle()
+}
+
+// Moves to the previous entry, returning false before the first one.
+// From an entry of an interior page that is the last entry of the
+// child before it.
+func (c *IndexCursor) Prev() (bool, error) {
+	if !c.valid {
+		return false, nil
+	}
+	if c.interior {
+		top := c.path[len(c.path)-1]
+		c.interior = false
+		if err := c.descend(int64(top.page.ChildPage(top.child)), true); err != nil {
+			c.valid = false
+			return false, err
+		}
+	} else {
+		c.cell--
+	}
+	return c.settleBack()
+}
+
+// Moves to the first entry whose key is greater than or equal to key,
+// comparing only as many columns as key has, so a prefix of the indexed
+// columns can be looked up. Returns false when there is no such entry.
+// Keys compare in index order: on a column declared DESC the entry found
+// holds the largest value not above key, and Next goes on to smaller ones.
+func (c *IndexCursor) SeekGE(key ...any) (found bool, err error) {
+	span := c.db.startSpan("btree.seek", "root", c.index.Root, "index", c.index.Name)
+	defer func() { span.End(err) }()
+	c.path = c.path[:0]
+	page := c.index.Root
+	for {
+		p, err := ReadRawPage(c.db, page)
+		if err != nil {
+			return false, err
+		}
+		if t := p.PageType(); t != LeafIndexType && t != InteriorIndexType {
+			return false, corruptPageError(page, "not an index b-tree page")
+		}
+		first := p.CellCount()
+		for i := 0; i < p.CellCount(); i++ {
+			entry, _, err := c.readEntry(p, i)
+			if err != nil {
+				return false, err
+			}
+			if c.compare(entry, key) >= 0 {
+				first = i
+				break
+			}
+		}
+		if p.PageType() == LeafIndexType {
+			c.leaf, c.cell, c.interior = p, first, false
+			return c.settle()
+		}
+		c.path = append(c.path, cursorStep{p, first})
+		page = int64(p.ChildPage(first))
+	}
+}
+
+// Like SeekGE, but takes the values of the columns the indexed terms
+// read rather than the key: indexed expressions are evaluated on them
+// first, so an index on lower(name) is looked up with a name.
+func (c *IndexCursor) SeekValues(values ...any) (bool, error) {
+	if len(values) > len(c.index.Columns) {
+		return false, fmt.Errorf("index %s has %d columns, not %d", c.index.Name, len(c.index.Columns), len(values))
+	}
+	key := make([]any, len(values))
+	for i, v := range values {
+		col := c.index.Columns[i]
+		if col >= 0 {
+			v = c.table.ApplyAffinity(col, v)
+		}
+		if e := c.index.Exprs[i]; e != nil {
+			var err error
+			if v, err = e.fn(v, e.args); err != nil {
+				return false, fmt.Errorf("index %s: %w", c.index.Name, err)
+			}
+		}
+		key[i] = v
+	}
+	return c.SeekGE(key...)
+}
+
+// Whether the cursor is on an entry
+func (c *IndexCursor) Valid() bool {
+	return c.valid
+}
+
+// Indexed values and rowid of the current entry
+func (c *IndexCursor) Entry() ([]any, int64) {
+	return c.key, c.rowid
+}
+
+// Compares the first len(key) values of an entry against key
+func (c *IndexCursor) compare(entry []any, key []any) int {
+	n := min(len(entry), len(key))
+	return compareIndexKeys(entry[:n], key[:n], c.index.Desc)
+}
+
+// Decodes entry i of an index page into its key and rowid
+func (c *IndexCursor) readEntry(p *RawPage, i int) ([]any, int64, error) {
+	payload, err := AssembleCellPayload(p, i, func(n int64) (*RawPage, error) { return ReadRawPage(c.db, n) })
+	if err != nil {
+		return nil, 0, err
+	}
+	record, err := NewRecordCell(0, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.db.cellsDecoded(p.Number, 1)
+	record.TextEncoding = c.db.TextEncoding
+	values, err := recordValues(record, len(record.Header))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(values) <= len(c.index.Columns) {
+		return nil, 0, corruptPageError(p.Number, "index entry %d has %d values", i, len(values))
+	}
+	key := values[:len(c.index.Columns)]
+	for k, col := range c.index.Columns {
+		if col >= 0 && c.index.Exprs[k] == nil {
+			key[k] = c.table.ApplyAffinity(col, key[k])
+		}
+	}
+	rowid, _ := values[len(values)-1].(int64)
+	return key, rowid, nil
+}
+
+// Follows the left-most child pointers from page down to a leaf, or
+// the right-most ones to the last entry of a leaf when last is set
+func (c *IndexCursor) descend(page int64, last bool) error {
+	for {
+		p, err := ReadRawPage(c.db, page)
+		if err != nil {
+			return err
+		}
+		child := 0
+		if last {
+			child = p.CellCount()
+		}
+		switch p.PageType() {
+		case LeafIndexType:
+			c.leaf, c.cell, c.interior = p, 0, false
+			if last {
+				c.cell = p.CellCount() - 1
+			}
+			return nil
+		case InteriorIndexType:
+		default:
+			return corruptPageError(page, "not an index b-tree page")
+		}
+		c.path = append(c.path, cursorStep{p, child})
+		page = int64(p.ChildPage(child))
+	}
+}
+
+// Moves past the end of the current leaf onto the entry of the first
+// interior page above it that has one left, and decodes the entry the
+// cursor ends up on
+func (c *IndexCursor) settle() (bool, error) {
+	if c.cell >= c.leaf.CellCount() {
+		c.interior = false
+		for len(c.path) > 0 && c.path[len(c.path)-1].child >= c.path[len(c.path)-1].page.CellCount() {
+			c.path = c.path[:len(c.path)-1]
+		}
+		if len(c.path) == 0 {
+			c.valid = false
+			return false, nil
+		}
+		c.interior = true
+	}
+	return c.decode()
+}
+
+// Moves before the start of the current leaf onto the entry of the
+// first interior page above it that has one before the child taken,
+// and decodes the entry the cursor ends up on
+func (c *IndexCursor) settleBack() (bool, error) {
+	if c.cell < 0 {
+		for len(c.path) > 0 && c.path[len(c.path)-1].child == 0 {
+			c.path = c.path[:len(c.path)-1]
+		}
+		if len(c.path) == 0 {
+			c.valid = false
+			return false, nil
+		}
+		c.path[len(c.path)-1].child--
+		c.interior = true
+	}
+	return c.decode()
+}
+
+// Decodes the entry the cursor is on
+func (c *IndexCursor) decode() (bool, error) {
+	p, i := c.leaf, c.cell
+	if c.interior {
+		top := c.path[len(c.path)-1]
+		p, i = top.page, top.child
+	}
+	var err error
+	if c.key, c.rowid, err = c.readEntry(p, i); err != nil {
+		c.valid = false
+		return false, err
+	}
+	c.valid = true
+	return true, nil
+}
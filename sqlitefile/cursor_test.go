@@ -0,0 +1,24 @@
+package sqlitefile
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOpenCursorWithoutRowid(t *testing.T) {
+	db, _ := sqlite3Database(t, `
+		CREATE TABLE w(a TEXT PRIMARY KEY, b) WITHOUT ROWID;
+		INSERT INTO w VALUES ('x', 1), ('y', 2);
+		CREATE TABLE r(a, b);
+		INSERT INTO r VALUES ('x', 1);`)
+	if _, err := db.OpenCursor("w"); !errors.Is(err, ErrWithoutRowid) {
+		t.Fatalf("OpenCursor(w) = %v, want ErrWithoutRowid", err)
+	}
+	c, err := db.OpenCursor("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.First(); !ok || err != nil {
+		t.Fatalf("First() = %v, %v", ok, err)
+	}
+}
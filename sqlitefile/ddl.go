@@ -0,0 +1,370 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+const SchemaRootPage = 1
+
+// sqlparser speaks the MySQL dialect and rejects much of sqlite's DDL,
+// such as untyped columns or AUTOINCREMENT, so DDL is recognized here.
+var CreateTableRegexp = regexp.MustCompile(
+	`(?is)^\s*create\s+table\s+(if\s+not\s+exists\s+)?("[^"]+"|\[[^\]]+\]|` + "`[^`]+`" + `|[^\s(]+)\s*\(`)
+
+// Creates a table by allocating an empty leaf page as its root and adding
+// its row to sqlite_schema. Like sqlite, the stored statement starts with
+// "CREATE TABLE" followed by the text from the table name onwards. The
+// root of a WITHOUT ROWID table is an index b-tree page, and every
+// UNIQUE and PRIMARY KEY constraint but the one of the key gets an empty
+// automatic index.
+func createTable(sql string, db *Database) error {
+	matches := CreateTableRegexp.FindStringSubmatchIndex(sql)
+	if matches == nil {
+		return errors.New("invalid CREATE TABLE statement")
+	}
+	ifNotExists := matches[2] >= 0
+	quotedName := sql[matches[4]:matches[5]]
+	name := dequoteIdentifier(quotedName)
+	if _, ok := db.Tables[CleanKeyString(name)]; ok {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("table %s already exists", name)
+	}
+	if strings.HasPrefix(strings.ToLower(name), "sqlite_") {
+		return fmt.Errorf("object name reserved for internal use: %s", name)
+	}
+	body := strings.TrimRight(strings.TrimSpace(sql[matches[4]:]), ";")
+	if len(splitColumnDefinitions(body)) == 0 {
+		return errors.New("CREATE TABLE requires at least one column")
+	}
+	// AUTOINCREMENT tables need sqlite_sequence, which is not maintained
+	if strings.Contains(strings.ToUpper(body), "AUTOINCREMENT") {
+		return errors.New("AUTOINCREMENT is not supported")
+	}
+	schema, err := newTableSchemaRecord(name, "CREATE TABLE "+body)
+	if err != nil {
+		return err
+	}
+	_, primaryKey, _ := parseTableDefinition(body)
+	if schema.WithoutRowid && len(primaryKey) == 0 {
+		return fmt.Errorf("PRIMARY KEY missing on table %s", name)
+	}
+	tx, err := beginWrite(db)
+	if err != nil {
+		return err
+	}
+	if err := tx.createTableTrees(name, schema, primaryKey); err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.schemaChanged = true
+	return tx.Commit()
+}
+
+// The schema record a table will have, to read its columns and
+// constraints before it is stored
+func newTableSchemaRecord(name string, sql string) (*Record, error) {
+	payload, err := EncodeRecord([]any{"table", name, name, int64(0), sql})
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewRecordCell(0, payload)
+	if err != nil {
+		return nil, err
+	}
+	c.ParseColumnMap()
+	return c, nil
+}
+
+// Allocates the root of a new table and of its automatic indexes and
+// adds their rows to sqlite_schema, numbering the indexes as sqlite
+// does. The key of a WITHOUT ROWID table is the table itself, whose
+// index number is skipped.
+func (tx *writeTxn) createTableTrees(name string, schema *Record, primaryKey []string) error {
+	pageType := uint8(LeafTableType)
+	if schema.WithoutRowid {
+		pageType = LeafIndexType
+	}
+	root, err := tx.allocatePage()
+	if err != nil {
+		return err
+	}
+	root.Reset(pageType)
+	sql, _ := schema.ReadDataFromHeaderIndex(4)
+	values := []any{"table", name, name, root.Number, sql}
+	if err := tx.insertTableRow(SchemaRootPage, "sqlite_schema", nil, values); err != nil {
+		return err
+	}
+	for i, columns := range automaticIndexColumns(schema) {
+		if schema.WithoutRowid && isPrimaryKey(columns, primaryKey) {
+			continue
+		}
+		root, err := tx.allocatePage()
+		if err != nil {
+			return err
+		}
+		root.Reset(LeafIndexType)
+		values := []any{"index", fmt.Sprintf("sqlite_autoindex_%s_%d", name, i+1), name, root.Number, nil}
+		if err := tx.insertTableRow(SchemaRootPage, "sqlite_schema", nil, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Whether the columns of an automatic index are those of the primary key
+func isPrimaryKey(columns []IndexColumn, primaryKey []string) bool {
+	if len(columns) != len(primaryKey) {
+		return false
+	}
+	for i, c := range columns {
+		if c.Name != CleanKeyString(primaryKey[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Strips sqlite identifier quoting while preserving case
+func dequoteIdentifier(name string) string {
+	if len(name) < 2 {
+		return name
+	}
+	switch name[0] {
+	case '"', '`':
+		if name[len(name)-1] == name[0] {
+			q := string(name[0])
+			return strings.ReplaceAll(name[1:len(name)-1], q+q, q)
+		}
+	case '[':
+		if name[len(name)-1] == ']' {
+			return name[1 : len(name)-1]
+		}
+	}
+	return name
+}
+
+// Drops the table together with its indexes and triggers. The schema
+// rows are deleted and every page of the b-trees, including overflow
+// pages, is moved to the freelist.
+func dropTable(stmt *sqlparser.DDL, db *Database) error {
+	name := CleanKeyString(stmt.Table.Name.String())
+	schema, ok := db.Tables[name]
+	if !ok {
+		if stmt.IfExists {
+			return nil
+		}
+		return TableNotFoundError(name)
+	}
+	if strings.HasPrefix(name, "sqlite_") {
+		return fmt.Errorf("table %s may not be dropped", name)
+	}
+	objects := append(db.TableIndicies(name), schema)
+	tx, err := beginWrite(db)
+	if err != nil {
+		return err
+	}
+	for _, c := range objects {
+		root, err := c.RootPage()
+		if err == nil && root > 0 {
+			err = tx.freeTree(root)
+		}
+		if err == nil {
+			err = tx.deleteTableRow(SchemaRootPage, c.RowID)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	// triggers left behind would make sqlite refuse the whole schema
+	triggers, err := tx.tableTriggers(name)
+	for _, rowID := range triggers {
+		if err == nil {
+			err = tx.deleteTableRow(SchemaRootPage, rowID)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.schemaChanged = true
+	return tx.Commit()
+}
+
+// Rowids of the sqlite_schema rows of the triggers on a table
+func (tx *writeTxn) tableTriggers(table string) ([]int64, error) {
+	rowIDs := []int64{}
+	err := tx.walkTableLeaves(SchemaRootPage, func(p *RawPage) error {
+		for i := 0; i < p.CellCount(); i++ {
+			c, err := tx.cellRecord(p, i)
+			if err != nil {
+				return err
+			}
+			kind, _ := c.ReadDataFromHeaderIndex(0)
+			tblName, _ := c.ReadDataFromHeaderIndex(2)
+			if name, ok := tblName.(string); kind == "trigger" && ok && CleanKeyString(name) == table {
+				rowIDs = append(rowIDs, c.RowID)
+			}
+		}
+		return nil
+	})
+	return rowIDs, err
+}
+
+// Recognizes CREATE INDEX statements, which ParseIndexDefinition takes
+// apart
+var CreateIndexRegexp = regexp.MustCompile(`(?is)^\s*create\s+(unique\s+)?index\s`)
+
+// An indexed column and whether it is sorted in descending order
+type IndexColumn struct {
+	// the column, cleaned as a key of ColumnMap, empty for an expression
+	Name string
+	// the indexed expression as written, for indexes on expressions
+	Expr string
+	// the collation named with COLLATE, empty for the default
+	Collation string
+	Desc      bool
+}
+
+// Creates an index by scanning the table for its keys, sorting them and
+// building the index b-tree bottom up, then registering it in
+// sqlite_schema. Partial and expression indexes are not supported.
+func createIndex(sql string, db *Database) error {
+	def, err := ParseIndexDefinition(sql)
+	if err != nil {
+		return err
+	}
+	tableName := CleanKeyString(def.Table)
+	body := strings.TrimRight(strings.TrimSpace(sql[def.nameStart:]), ";")
+	for _, c := range db.Indicies {
+		if existing, err := c.SchemaName(); err == nil && existing == CleanKeyString(def.Name) {
+			if def.IfNotExists {
+				return nil
+			}
+			return fmt.Errorf("index %s already exists", def.Name)
+		}
+	}
+	schema, ok := db.Tables[tableName]
+	if !ok {
+		return TableNotFoundError(tableName)
+	}
+	if def.Where != "" {
+		return errors.New("partial indexes are not supported")
+	}
+	if err := def.checkSupported(); err != nil {
+		return err
+	}
+	columns := def.Columns
+	tableRoot, err := schema.RootPage()
+	if err != nil {
+		return err
+	}
+	tx, err := beginWrite(db)
+	if err != nil {
+		return err
+	}
+	root, err := tx.createIndexTree(tableRoot, schema, columns, def.Unique, def.Name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	prefix := "CREATE INDEX "
+	if def.Unique {
+		prefix = "CREATE UNIQUE INDEX "
+	}
+	values := []any{"index", def.Name, def.Table, root, prefix + body}
+	if err := tx.insertTableRow(SchemaRootPage, "sqlite_schema", nil, values); err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.schemaChanged = true
+	return tx.Commit()
+}
+
+// Parses indexed columns of the form name [COLLATE BINARY] [ASC|DESC]
+func parseIndexColumnDefinitions(defs []string) ([]IndexColumn, error) {
+	columns := []IndexColumn{}
+	for _, def := range defs {
+		if strings.ContainsAny(def, "()+-*/|") {
+			return nil, errors.New("indexes on expressions are not supported")
+		}
+		parts := strings.Fields(def)
+		if len(parts) == 0 {
+			return nil, errors.New("invalid index column list")
+		}
+		col := IndexColumn{Name: CleanKeyString(parts[0])}
+		for i := 1; i < len(parts); i++ {
+			switch strings.ToLower(parts[i]) {
+			case "asc":
+			case "desc":
+				col.Desc = true
+			case "collate":
+				if i+1 >= len(parts) || !strings.EqualFold(parts[i+1], "binary") {
+					return nil, errors.New("only the BINARY collation is supported")
+				}
+				i++
+			default:
+				return nil, fmt.Errorf("unexpected %q in index column list", parts[i])
+			}
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// Collects the index entries of every row, sorts them and builds
+// the b-tree. UNIQUE indexes reject duplicate keys without NULLs.
+func (tx *writeTxn) createIndexTree(tableRoot int64, schema *Record, columns []IndexColumn, unique bool, name string) (int64, error) {
+	ix, err := newTableIndex(name, schema, columns, unique)
+	if err != nil {
+		return 0, err
+	}
+	entries := []indexEntry{}
+	err = tx.walkTableLeaves(tableRoot, func(p *RawPage) error {
+		for i := 0; i < p.CellCount(); i++ {
+			c, err := tx.cellRecord(p, i)
+			if err != nil {
+				return err
+			}
+			values, err := recordValues(c, schema.ColumnCount())
+			if err != nil {
+				return err
+			}
+			key := ix.Key(c.RowID, values)
+			payload, err := tx.encodeRecord(append(append([]any{}, key...), c.RowID))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, indexEntry{Key: key, RowID: c.RowID, Payload: payload})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sortIndexEntries(entries, ix.Desc)
+	if unique {
+		for i := 1; i < len(entries); i++ {
+			if compareIndexKeys(entries[i-1].Key, entries[i].Key, ix.Desc) == 0 && !hasNull(entries[i].Key) {
+				return 0, fmt.Errorf("UNIQUE constraint failed: index %s", name)
+			}
+		}
+	}
+	return tx.buildIndexTree(entries)
+}
+
+func hasNull(values []any) bool {
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
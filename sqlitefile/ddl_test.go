@@ -0,0 +1,72 @@
+package sqlitefile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Tables with automatic indexes and WITHOUT ROWID tables are created as
+// sqlite would, which its integrity check and writes to them tell
+func TestCreateTableIntegrity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "create.db")
+	if err := Create(path, 4096); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE a(x TEXT PRIMARY KEY, y UNIQUE, z, UNIQUE (z, y))",
+		"CREATE TABLE i(id INTEGER PRIMARY KEY, u UNIQUE)",
+		"CREATE TABLE w(b UNIQUE, a PRIMARY KEY, c, UNIQUE (c, b)) WITHOUT ROWID",
+		"INSERT INTO a VALUES ('one', 1, 'z'), ('two', 2, 'z')",
+		"INSERT INTO i(u) VALUES (10), (20)",
+	} {
+		if err := db.Exec(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	if err := db.Exec("INSERT INTO w VALUES (1, 2, 3)"); !errors.Is(err, ErrWithoutRowid) {
+		t.Errorf("writing to a WITHOUT ROWID table: %v, want ErrWithoutRowid", err)
+	}
+	if err := db.Exec("CREATE TABLE n(a, b) WITHOUT ROWID"); err == nil {
+		t.Error("created a WITHOUT ROWID table without a PRIMARY KEY")
+	}
+	db.Close()
+
+	want := "sqlite_autoindex_a_1|a\nsqlite_autoindex_a_2|a\nsqlite_autoindex_a_3|a\n" +
+		"sqlite_autoindex_i_1|i\nsqlite_autoindex_w_1|w\nsqlite_autoindex_w_3|w"
+	if got := sqlite3(t, path, "SELECT name, tbl_name FROM sqlite_schema WHERE type = 'index' ORDER BY name"); got != want {
+		t.Errorf("automatic indexes:\n%s\nwant:\n%s", got, want)
+	}
+	if got := sqlite3(t, path, "PRAGMA integrity_check"); got != "ok" {
+		t.Fatalf("integrity check: %s", got)
+	}
+	sqlite3(t, path, "INSERT INTO w VALUES (1, 2, 3), (4, 5, 6); INSERT INTO a VALUES ('three', 3, 'y')")
+	if got := sqlite3(t, path, "PRAGMA integrity_check"); got != "ok" {
+		t.Fatalf("integrity check after sqlite3 wrote to the tables: %s", got)
+	}
+}
+
+func TestDropTableTriggers(t *testing.T) {
+	db, path := sqlite3Database(t, `
+		CREATE TABLE t(a);
+		CREATE TABLE log(a);
+		CREATE INDEX t_a ON t(a);
+		CREATE TRIGGER t_insert AFTER INSERT ON t BEGIN INSERT INTO log VALUES (new.a); END;
+		CREATE TRIGGER "T_delete" AFTER DELETE ON "T" BEGIN INSERT INTO log VALUES (old.a); END;
+		CREATE TRIGGER log_insert AFTER INSERT ON log BEGIN SELECT 1; END;
+		INSERT INTO t VALUES (1), (2);`)
+	if err := db.Exec("DROP TABLE t"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if got := sqlite3(t, path, "SELECT type, name FROM sqlite_schema ORDER BY name"); got != "table|log\ntrigger|log_insert" {
+		t.Errorf("schema after DROP TABLE t:\n%s", got)
+	}
+	if got := sqlite3(t, path, "PRAGMA integrity_check"); got != "ok" {
+		t.Fatalf("integrity check: %s", got)
+	}
+}
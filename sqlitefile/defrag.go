@@ -0,0 +1,88 @@
+package sqlitefile
+
+import (
+	"fmt"
+)
+
+// The space scattered over a page before it was defragmented
+type PageFragmentation struct {
+	Page            int64
+	FreeblockBytes  int
+	Freeblocks      int
+	FragmentedBytes int
+}
+
+// Compacts the given b-tree page, or every b-tree page with freeblocks
+// or fragmented bytes when page is 0. Returns the space that was
+// scattered over each page before it was compacted.
+func (db *Database) Defragment(page int64) ([]PageFragmentation, error) {
+	roots := []int64{1}
+	for _, cells := range []RecordMap{db.Tables, db.Indicies} {
+		for _, c := range cells {
+			// views have no b-tree
+			if root, err := c.RootPage(); err == nil && root > 0 {
+				roots = append(roots, root)
+			}
+		}
+	}
+	tx, err := beginWrite(db)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	compacted := []PageFragmentation{}
+	for _, root := range roots {
+		err := tx.walkBtree(root, func(p *RawPage) error {
+			if page != 0 && p.Number != page {
+				return nil
+			}
+			found = true
+			blocks := p.Freeblocks()
+			if len(blocks) == 0 && p.FragmentedBytes() == 0 {
+				return nil
+			}
+			f := PageFragmentation{Page: p.Number, Freeblocks: len(blocks), FragmentedBytes: p.FragmentedBytes()}
+			for _, b := range blocks {
+				f.FreeblockBytes += b.Size
+			}
+			compacted = append(compacted, f)
+			p.Defragment()
+			tx.Write(p)
+			return nil
+		})
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if page != 0 && !found {
+		tx.Rollback()
+		return nil, fmt.Errorf("page %d is not a b-tree page", page)
+	}
+	return compacted, tx.Commit()
+}
+
+// Calls fn for every page of the table or index b-tree rooted at
+// pageNumber, parents before their children
+func (tx *writeTxn) walkBtree(pageNumber int64, fn func(p *RawPage) error) error {
+	p, err := tx.Page(pageNumber)
+	if err != nil {
+		return err
+	}
+	switch p.PageType() {
+	case LeafTableType, LeafIndexType:
+		return fn(p)
+	case InteriorTableType, InteriorIndexType:
+	default:
+		return fmt.Errorf("page %d is not a b-tree page", p.Number)
+	}
+	if err := fn(p); err != nil {
+		return err
+	}
+	for i := 0; i <= p.CellCount(); i++ {
+		if err := tx.walkBtree(int64(p.ChildPage(i)), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
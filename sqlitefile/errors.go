@@ -0,0 +1,88 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Matches the errors for tables, indexes and columns that do not exist
+var ErrNotFound = errors.New("not found")
+
+// Matches the errors for tables and columns that do not exist, along
+// with ErrNotFound
+var (
+	ErrTableNotFound  = errors.New("no such table")
+	ErrColumnNotFound = errors.New("no such column")
+)
+
+// Returned when a writer commits while a table is being read
+var ErrDatabaseChanged = errors.New("database changed during read")
+
+// Returned when reading the rows of a virtual table, which are kept by
+// its module rather than in a b-tree
+var ErrVirtualTable = errors.New("virtual table")
+
+// Returned when a table is read through a rowid or written to while it
+// is a WITHOUT ROWID table, whose rows are kept in an index b-tree by
+// their primary key
+var ErrWithoutRowid = errors.New("WITHOUT ROWID table")
+
+// Returned when reading a remote database from a server that sends the
+// whole file rather than the bytes asked for
+var ErrRangeNotSupported = errors.New("server does not support range requests")
+
+// Returned by a ForEachRow callback to stop early without an error
+var ErrStop = errors.New("stop iteration")
+
+type notFound struct {
+	msg string
+	// ErrTableNotFound or ErrColumnNotFound, if it is either
+	kind error
+}
+
+func (e *notFound) Error() string {
+	return e.msg
+}
+
+func (e *notFound) Is(target error) bool {
+	return target == ErrNotFound || (e.kind != nil && target == e.kind)
+}
+
+// Reports a missing table, index or column
+func NotFoundError(format string, args ...any) error {
+	return &notFound{fmt.Sprintf(format, args...), nil}
+}
+
+// Reports a table that does not exist
+func TableNotFoundError(name string) error {
+	return &notFound{"no such table: " + name, ErrTableNotFound}
+}
+
+// Reports a column that does not exist
+func columnNotFoundError(format string, args ...any) error {
+	return &notFound{fmt.Sprintf(format, args...), ErrColumnNotFound}
+}
+
+// A page that does not hold what the file format says it should. Cell
+// is the index of the cell at fault, or -1 when it is the page itself.
+type ErrCorruptPage struct {
+	Page   int64
+	Cell   int
+	Reason string
+}
+
+func (e *ErrCorruptPage) Error() string {
+	if e.Cell < 0 {
+		return fmt.Sprintf("corrupt page %d: %s", e.Page, e.Reason)
+	}
+	return fmt.Sprintf("corrupt page %d cell %d: %s", e.Page, e.Cell, e.Reason)
+}
+
+// Reports that a WITHOUT ROWID table cannot be used as asked
+func withoutRowidError(action string, table string) error {
+	return fmt.Errorf("cannot %s %w %s", action, ErrWithoutRowid, table)
+}
+
+func corruptPageError(page int64, format string, args ...any) error {
+	return &ErrCorruptPage{page, -1, fmt.Sprintf(format, args...)}
+}
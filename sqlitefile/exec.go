@@ -0,0 +1,45 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Returned by Exec for statements it does not recognize
+var ErrUnknownStatement = errors.New("unknown statement")
+
+// Executes a statement that changes the database: CREATE TABLE,
+// CREATE INDEX, ALTER TABLE, INSERT, DELETE or DROP TABLE. Queries are
+// run with Query instead.
+func (db *Database) Exec(sql string) (err error) {
+	span := db.startSpan("exec", "sql", sql)
+	defer func() { span.End(err) }()
+	switch {
+	case CreateTableRegexp.MatchString(sql):
+		return createTable(sql, db)
+	case CreateIndexRegexp.MatchString(sql):
+		return createIndex(sql, db)
+	case AlterTableRegexp.MatchString(sql):
+		return alterTable(sql, db)
+	}
+	stmt, err := sqlparser.Parse(rewriteInsertOr(sql))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnknownStatement, sql)
+	}
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		return errors.New("queries are run with Query")
+	case *sqlparser.Insert:
+		return execInsert(stmt, db)
+	case *sqlparser.Delete:
+		return execDelete(stmt, db)
+	case *sqlparser.DDL:
+		if stmt.Action != sqlparser.DropStr {
+			return errors.New("unsupported statement: " + sql)
+		}
+		return dropTable(stmt, db)
+	}
+	return errors.New("unsupported statement: " + sql)
+}
@@ -0,0 +1,467 @@
+package sqlitefile
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Whether the select list only holds literals, operators and function
+// calls, as a SELECT without a FROM clause does. The parser reads a
+// missing FROM clause as FROM dual.
+func isLiteralSelect(stmt *sqlparser.Select) bool {
+	if sqlparser.String(stmt.From) != "dual" || stmt.Where != nil || stmt.GroupBy != nil || stmt.Having != nil {
+		return false
+	}
+	literal := true
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node.(type) {
+		case *sqlparser.ColName, *sqlparser.StarExpr, *sqlparser.Subquery:
+			literal = false
+		}
+		return literal, nil
+	}, stmt.SelectExprs)
+	return literal
+}
+
+// Evaluates the select list of a query without a FROM clause into its
+// single row
+func selectLiterals(db *Database, q *queryContext) error {
+	values := make([]any, len(q.query.literals))
+	for i, e := range q.query.literals {
+		v, err := evalLiteral(db, e)
+		if err != nil {
+			return fmt.Errorf("%s: %w", q.query.Identifiers[i], err)
+		}
+		values[i] = v
+	}
+	q.count = 1
+	if q.emit != nil {
+		return q.emit(values)
+	}
+	q.rows = append(q.rows, values)
+	return nil
+}
+
+// Evaluates an expression of literals the way sqlite does. || reads as
+// OR, as the parser does not tell them apart.
+func evalLiteral(db *Database, e sqlparser.Expr) (any, error) {
+	switch e := e.(type) {
+	case *sqlparser.NullVal:
+		return nil, nil
+	case sqlparser.BoolVal:
+		return boolValue(bool(e)), nil
+	case *sqlparser.SQLVal:
+		return literalValue(e)
+	case *sqlparser.ParenExpr:
+		return evalLiteral(db, e.Expr)
+	case *sqlparser.UnaryExpr:
+		v, err := evalLiteral(db, e.Expr)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		switch e.Operator {
+		case sqlparser.UPlusStr:
+			return v, nil
+		case sqlparser.UMinusStr:
+			return arithmetic("-", int64(0), v), nil
+		case sqlparser.TildaStr:
+			return ^toInteger(v), nil
+		case sqlparser.BangStr:
+			return boolValue(!truthy(v)), nil
+		}
+	case *sqlparser.BinaryExpr:
+		l, err := evalLiteral(db, e.Left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := evalLiteral(db, e.Right)
+		if err != nil || l == nil || r == nil {
+			return nil, err
+		}
+		return arithmetic(e.Operator, l, r), nil
+	case *sqlparser.ComparisonExpr:
+		l, err := evalLiteral(db, e.Left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := evalLiteral(db, e.Right)
+		if err != nil || l == nil || r == nil {
+			return nil, err
+		}
+		c := compareValues(l, r)
+		switch e.Operator {
+		case sqlparser.EqualStr:
+			return boolValue(c == 0), nil
+		case sqlparser.NotEqualStr:
+			return boolValue(c != 0), nil
+		case sqlparser.LessThanStr:
+			return boolValue(c < 0), nil
+		case sqlparser.LessEqualStr:
+			return boolValue(c <= 0), nil
+		case sqlparser.GreaterThanStr:
+			return boolValue(c > 0), nil
+		case sqlparser.GreaterEqualStr:
+			return boolValue(c >= 0), nil
+		}
+	case *sqlparser.IsExpr:
+		v, err := evalLiteral(db, e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Operator {
+		case sqlparser.IsNullStr:
+			return boolValue(v == nil), nil
+		case sqlparser.IsNotNullStr:
+			return boolValue(v != nil), nil
+		case sqlparser.IsTrueStr:
+			return boolValue(v != nil && truthy(v)), nil
+		case sqlparser.IsNotTrueStr:
+			return boolValue(v == nil || !truthy(v)), nil
+		case sqlparser.IsFalseStr:
+			return boolValue(v != nil && !truthy(v)), nil
+		case sqlparser.IsNotFalseStr:
+			return boolValue(v == nil || truthy(v)), nil
+		}
+	case *sqlparser.NotExpr:
+		v, err := evalLiteral(db, e.Expr)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return boolValue(!truthy(v)), nil
+	case *sqlparser.AndExpr:
+		return evalLogical(db, e.Left, e.Right, false)
+	case *sqlparser.OrExpr:
+		return evalLogical(db, e.Left, e.Right, true)
+	case *sqlparser.FuncExpr:
+		if e.Distinct || !e.Qualifier.IsEmpty() {
+			break
+		}
+		args := make([]any, len(e.Exprs))
+		for i, arg := range e.Exprs {
+			aliased, ok := arg.(*sqlparser.AliasedExpr)
+			if !ok {
+				return nil, fmt.Errorf("cannot evaluate %s", sqlparser.String(e))
+			}
+			v, err := evalLiteral(db, aliased.Expr)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return callScalarFunction(db, e.Name.Lowered(), args)
+	}
+	return nil, fmt.Errorf("cannot evaluate %s", sqlparser.String(e))
+}
+
+// AND and OR with NULL standing for unknown: AND is false when either
+// side is, OR is true when either side is, and otherwise NULL is NULL
+func evalLogical(db *Database, left, right sqlparser.Expr, or bool) (any, error) {
+	l, err := evalLiteral(db, left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := evalLiteral(db, right)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case l != nil && truthy(l) == or, r != nil && truthy(r) == or:
+		return boolValue(or), nil
+	case l == nil || r == nil:
+		return nil, nil
+	}
+	return boolValue(!or), nil
+}
+
+func literalValue(v *sqlparser.SQLVal) (any, error) {
+	switch v.Type {
+	case sqlparser.StrVal:
+		return string(v.Val), nil
+	case sqlparser.IntVal, sqlparser.FloatVal:
+		return toNumber(string(v.Val)), nil
+	case sqlparser.HexVal:
+		return hex.DecodeString(string(v.Val))
+	case sqlparser.HexNum:
+		u, err := strconv.ParseUint(string(v.Val[2:]), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("hex literal too big: %s", v.Val)
+		}
+		return int64(u), nil
+	}
+	return nil, fmt.Errorf("cannot evaluate %s", sqlparser.String(v))
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Whether a value that is not NULL is true, which numbers other than
+// 0 are, text and blobs as the number they start with
+func truthy(v any) bool {
+	switch n := toNumber(v).(type) {
+	case int64:
+		return n != 0
+	case float64:
+		return n != 0
+	}
+	return false
+}
+
+// Converts a value to a number as sqlite does for arithmetic: text and
+// blobs read as the longest number they start with, or 0
+func toNumber(v any) any {
+	switch v := v.(type) {
+	case int64, float64:
+		return v
+	case []byte:
+		return toNumber(string(v))
+	case string:
+		s := strings.TrimSpace(v)
+		end, digits, isReal := 0, 0, false
+		if end < len(s) && (s[end] == '+' || s[end] == '-') {
+			end++
+		}
+		for ; end < len(s) && s[end] >= '0' && s[end] <= '9'; end++ {
+			digits++
+		}
+		if end < len(s) && s[end] == '.' {
+			isReal = true
+			for end++; end < len(s) && s[end] >= '0' && s[end] <= '9'; end++ {
+				digits++
+			}
+		}
+		if digits == 0 {
+			return int64(0)
+		}
+		if end < len(s) && (s[end] == 'e' || s[end] == 'E') {
+			exp := end + 1
+			if exp < len(s) && (s[exp] == '+' || s[exp] == '-') {
+				exp++
+			}
+			if exp < len(s) && s[exp] >= '0' && s[exp] <= '9' {
+				isReal = true
+				for end = exp; end < len(s) && s[end] >= '0' && s[end] <= '9'; end++ {
+				}
+			}
+		}
+		if !isReal {
+			if i, err := strconv.ParseInt(s[:end], 10, 64); err == nil {
+				return i
+			}
+		}
+		f, _ := strconv.ParseFloat(strings.TrimSuffix(s[:end], "."), 64)
+		return f
+	}
+	return int64(0)
+}
+
+func toInteger(v any) int64 {
+	switch n := toNumber(v).(type) {
+	case int64:
+		return n
+	case float64:
+		if n >= math.MaxInt64 {
+			return math.MaxInt64
+		} else if n <= math.MinInt64 {
+			return math.MinInt64
+		}
+		return int64(n)
+	}
+	return 0
+}
+
+// Applies a binary operator to two values that are not NULL. Integer
+// results that overflow become reals, division by zero is NULL.
+func arithmetic(op string, l, r any) any {
+	a, b := toNumber(l), toNumber(r)
+	switch op {
+	case sqlparser.BitAndStr:
+		return toInteger(a) & toInteger(b)
+	case sqlparser.BitOrStr:
+		return toInteger(a) | toInteger(b)
+	case sqlparser.ShiftLeftStr, sqlparser.ShiftRightStr:
+		x, n := toInteger(a), toInteger(b)
+		if op == sqlparser.ShiftRightStr {
+			n = -n
+		}
+		switch {
+		case n >= 64:
+			return int64(0)
+		case n <= -64 && x < 0:
+			return int64(-1)
+		case n <= -64:
+			return int64(0)
+		case n < 0:
+			return x >> -n
+		}
+		return x << n
+	case sqlparser.ModStr:
+		x, y := toInteger(a), toInteger(b)
+		var result int64
+		switch y {
+		case 0:
+			return nil
+		case -1:
+		default:
+			result = x % y
+		}
+		_, realA := a.(float64)
+		_, realB := b.(float64)
+		if realA || realB {
+			return float64(result)
+		}
+		return result
+	}
+	x, xInt := a.(int64)
+	y, yInt := b.(int64)
+	if xInt && yInt {
+		switch op {
+		case sqlparser.PlusStr:
+			if s := x + y; (s > x) == (y > 0) {
+				return s
+			}
+		case sqlparser.MinusStr:
+			if s := x - y; (s < x) == (y > 0) {
+				return s
+			}
+		case sqlparser.MultStr:
+			if p := x * y; x == 0 || (p/x == y && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64)) {
+				return p
+			}
+		case sqlparser.DivStr, sqlparser.IntDivStr:
+			if y == 0 {
+				return nil
+			}
+			if !(x == math.MinInt64 && y == -1) {
+				return x / y
+			}
+		}
+	}
+	fx, fy := toFloat(a), toFloat(b)
+	switch op {
+	case sqlparser.PlusStr:
+		return fx + fy
+	case sqlparser.MinusStr:
+		return fx - fy
+	case sqlparser.MultStr:
+		return fx * fy
+	case sqlparser.DivStr, sqlparser.IntDivStr:
+		if fy == 0 {
+			return nil
+		}
+		return fx / fy
+	}
+	return nil
+}
+
+func toFloat(n any) float64 {
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+	f, _ := n.(float64)
+	return f
+}
+
+// Calls one of the scalar functions that can be evaluated on literals
+func callScalarFunction(db *Database, name string, args []any) (any, error) {
+	arity := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("wrong number of arguments to function %s()", name)
+		}
+		return nil
+	}
+	switch name {
+	case "sqlite_version":
+		// the version of sqlite that last wrote the file
+		if err := arity(0); err != nil {
+			return nil, err
+		}
+		v := db.Header.SqliteVersion
+		return fmt.Sprintf("%d.%d.%d", v/1000000, v/1000%1000, v%1000), nil
+	case "typeof":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		switch args[0].(type) {
+		case nil:
+			return "null", nil
+		case int64:
+			return "integer", nil
+		case float64:
+			return "real", nil
+		case string:
+			return "text", nil
+		}
+		return "blob", nil
+	case "length":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case nil:
+			return nil, nil
+		case []byte:
+			return int64(len(v)), nil
+		}
+		return int64(utf8.RuneCountInString(FormatValue(args[0]))), nil
+	case "abs":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		switch v := toNumber(args[0]).(type) {
+		case int64:
+			if v == math.MinInt64 {
+				return nil, errors.New("integer overflow")
+			}
+			if v < 0 {
+				v = -v
+			}
+			return v, nil
+		case float64:
+			if args[0] == nil {
+				return nil, nil
+			}
+			return math.Abs(v), nil
+		}
+	case "hex":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		if b, ok := args[0].([]byte); ok {
+			return strings.ToUpper(hex.EncodeToString(b)), nil
+		}
+		return strings.ToUpper(hex.EncodeToString([]byte(FormatValue(args[0])))), nil
+	case "coalesce", "ifnull":
+		if len(args) < 2 || (name == "ifnull" && len(args) != 2) {
+			return nil, fmt.Errorf("wrong number of arguments to function %s()", name)
+		}
+		for _, v := range args {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	case "nullif":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		if args[0] != nil && args[1] != nil && compareValues(args[0], args[1]) == 0 {
+			return nil, nil
+		}
+		return args[0], nil
+	}
+	if fn := lookupFunction(name); fn != nil && len(args) > 0 {
+		return fn(args[0], args[1:])
+	}
+	return nil, fmt.Errorf("no such function: %s", name)
+}
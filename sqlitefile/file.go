@@ -0,0 +1,698 @@
+// Package sqlitefile reads and writes SQLite database files directly,
+// without going through the sqlite library.
+//
+// https://www.sqlite.org/fileformat.html
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	DatabaseHeaderMagic        = "SQLite format 3\000"
+	DatabaseHeaderSize         = 100
+	MaxEmbeddedPayloadFraction = 64
+	MinEmbeddedPayloadFraction = 32
+	LeafPayloadFraction        = 32
+)
+
+// The first 100 bytes of the database file comprise the database file header.
+// The database file header is divided into fields as shown by the table below.
+// All multibyte fields in the database file header are stored with the most significant byte first (big-endian).
+//
+// # Offset	Size	Description
+//
+//	0	    16	    The header string: "SQLite format 3\000"
+//
+//	16	    2	    The database page size in bytes. Must be a power of two between 512 and 32768 inclusive, or the value 1 representing a page size of 65536.
+//
+//	18	    1	    File format write version. 1 for legacy; 2 for WAL.
+//
+//	19	    1	    File format read version. 1 for legacy; 2 for WAL.
+//
+//	20	    1	    Bytes of unused "reserved" space at the end of each page. Usually 0.
+//
+//	21	    1	    Maximum embedded payload fraction. Must be 64.
+//	22	    1	    Minimum embedded payload fraction. Must be 32.
+//	23	    1	    Leaf payload fraction. Must be 32.
+//	24	    4	    File change counter.
+//	28	    4	    Size of the database file in pages. The "in-header database size".
+//	32	    4	    Page number of the first freelist trunk page.
+//	36	    4	    Total number of freelist pages.
+//	40	    4	    The schema cookie.
+//	44	    4	    The schema format number. Supported schema formats are 1, 2, 3, and 4.
+//	48	    4	    Default page cache size.
+//	52	    4	    The page number of the largest root b-tree page when in auto-vacuum or incremental-vacuum modes, or zero otherwise.
+//	56	    4	    The database text encoding. A value of 1 means UTF-8. A value of 2 means UTF-16le. A value of 3 means UTF-16be.
+//	60	    4	    The "user version" as read and set by the user_version pragma.
+//	64	    4	    True (non-zero) for incremental-vacuum mode. False (zero) otherwise.
+//	68	    4	    The "Application ID" set by PRAGMA application_id.
+//	72	    20	    Reserved for expansion. Must be zero.
+//	92	    4	    The version-valid-for number.
+//	96	    4	    SQLITE_VERSION_NUMBER
+type DatabaseHeader struct {
+	HeaderString               string `json:"header_string"`
+	PageSize                   uint16 `json:"page_size"`
+	WriteFileFormat            uint8  `json:"write_file_format"`
+	ReadFileFormat             uint8  `json:"read_file_format"`
+	ReservedPageSpace          uint8  `json:"reserved_page_space"`
+	MaxEmbeddedPayloadFraction uint8  `json:"max_embedded_payload_fraction"`
+	MinEmbeddedPayloadFraction uint8  `json:"min_embedded_payload_fraction"`
+	LeafPayloadFraction        uint8  `json:"leaf_payload_fraction"`
+	FileChangeCounter          uint32 `json:"file_change_counter"`
+	DatabasePageSize           uint32 `json:"database_page_size"`
+	FirstFreeListTrunk         uint32 `json:"first_free_list_trunk"`
+	NumberOfFreeListPages      uint32 `json:"number_of_free_list_pages"`
+	SchemaCookie               uint32 `json:"schema_cookie"`
+	SchemaFormat               uint32 `json:"schema_format"`
+	PageCacheSize              uint32 `json:"page_cache_size"`
+	LargestPageInVMode         uint32 `json:"largest_page_in_v_mode"`
+	TextEncoding               uint32 `json:"text_encoding"`
+	UserVersionPragma          uint32 `json:"user_version_pragma"`
+	IncrementalVMode           uint32 `json:"incremental_v_mode"`
+	ApplicationID              uint32 `json:"application_id"`
+	ReservedSpace              uint64 `json:"reserved_space"`
+	VersionValidfor            uint32 `json:"version_validfor"`
+	SqliteVersion              uint32 `json:"sqlite_version"`
+}
+
+// Takes an io.ReadSeeker and attempts to parse the first 100 bytes
+// as an sqlite 3 header. Return either a pointer to the created
+// header struct and a nil error, or a nil header pointer and an error
+func newDatabaseHeader(f io.ReadSeeker) (*DatabaseHeader, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	headerBuf := make([]byte, DatabaseHeaderSize)
+	if _, err := f.Read(headerBuf); err != nil {
+		return nil, err
+	}
+	h := DatabaseHeader{}
+	h.HeaderString = string(headerBuf[:16])
+	if h.HeaderString != DatabaseHeaderMagic {
+		if looksEncrypted(headerBuf) {
+			return nil, fmt.Errorf("%w, as with SQLCipher or SEE: the header string is missing", ErrEncrypted)
+		}
+		return nil, errors.New("database string is invalid: " + h.HeaderString)
+	}
+	if err := readBigEndianInt(headerBuf[16:18], &h.PageSize); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[18:19], &h.WriteFileFormat); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[19:20], &h.ReadFileFormat); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[20:21], &h.ReservedPageSpace); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[21:22], &h.MaxEmbeddedPayloadFraction); err != nil {
+		return nil, err
+	}
+	if h.MaxEmbeddedPayloadFraction != MaxEmbeddedPayloadFraction {
+		return nil, fmt.Errorf("Maximum embedded payload fraction must be %d", MaxEmbeddedPayloadFraction)
+	}
+	if err := readBigEndianInt(headerBuf[22:23], &h.MinEmbeddedPayloadFraction); err != nil {
+		return nil, err
+	}
+	if h.MinEmbeddedPayloadFraction != MinEmbeddedPayloadFraction {
+		return nil, fmt.Errorf("Minimum embedded payload fraction must be %d", MinEmbeddedPayloadFraction)
+	}
+	if err := readBigEndianInt(headerBuf[23:24], &h.LeafPayloadFraction); err != nil {
+		return nil, err
+	}
+	if h.LeafPayloadFraction != LeafPayloadFraction {
+		return nil, fmt.Errorf("Leaf payload fraction must be %d", LeafPayloadFraction)
+	}
+	if err := readBigEndianInt(headerBuf[24:28], &h.FileChangeCounter); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[28:32], &h.DatabasePageSize); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[32:36], &h.FirstFreeListTrunk); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[36:40], &h.NumberOfFreeListPages); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[40:44], &h.SchemaCookie); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[44:48], &h.SchemaFormat); err != nil {
+		return nil, err
+	}
+	// a database whose schema was never written, such as one that only
+	// had its user_version set, has 0 here and for the text encoding
+	if h.SchemaFormat > 4 {
+		return nil, errors.New("schema format must be between 0 and 4")
+	}
+	if err := readBigEndianInt(headerBuf[48:52], &h.PageCacheSize); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[52:56], &h.LargestPageInVMode); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[56:60], &h.TextEncoding); err != nil {
+		return nil, err
+	}
+	if h.TextEncoding > 3 {
+		return nil, errors.New("text encoding must be between 0 and 3")
+	}
+	if err := readBigEndianInt(headerBuf[60:64], &h.UserVersionPragma); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[64:68], &h.IncrementalVMode); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[68:72], &h.ApplicationID); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[72:92], &h.ReservedSpace); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[92:96], &h.VersionValidfor); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(headerBuf[96:100], &h.SqliteVersion); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Size of the pages in bytes. The header stores 65536, which does not
+// fit in its two bytes, as 1.
+func (d *DatabaseHeader) PageSizeBytes() int64 {
+	if d.PageSize == 1 {
+		return 65536
+	}
+	return int64(d.PageSize)
+}
+
+// The in-header database size is only considered valid if it is non-zero
+// and the file change counter matches the version-valid-for number.
+func (d *DatabaseHeader) HasValidDatabaseSize() bool {
+	return d.DatabasePageSize > 0 && d.FileChangeCounter == d.VersionValidfor
+}
+
+// Number of pages in the database, as committed to the WAL if there is
+// one. A stale in-header size is replaced by the size of the file.
+func (d *Database) PageCount() (int64, error) {
+	if d.Wal != nil && d.Wal.PageCount > 0 {
+		return d.Wal.PageCount, nil
+	}
+	if d.Header.HasValidDatabaseSize() {
+		return int64(d.Header.DatabasePageSize), nil
+	}
+	size, err := d.size()
+	if err != nil {
+		return 0, err
+	}
+	pageSize := d.Header.PageSizeBytes()
+	return size / pageSize, nil
+}
+
+// Compares the in-header database size against the actual length
+// of the file. A file shorter than the header claims is truncated and
+// an error is returned, while trailing bytes only produce a warning.
+func checkDatabaseSize(size int64, h *DatabaseHeader, logger *slog.Logger) error {
+	pageSize := h.PageSizeBytes()
+	if !h.HasValidDatabaseSize() {
+		if size%pageSize != 0 {
+			logger.Warn("file size is not a multiple of the page size", "size", size, "page_size", pageSize)
+		}
+		return nil
+	}
+	expected := int64(h.DatabasePageSize) * pageSize
+	if size < expected {
+		return fmt.Errorf("database file is truncated: header reports %d pages (%d bytes) but file is %d bytes",
+			h.DatabasePageSize, expected, size)
+	}
+	if size > expected {
+		logger.Warn("database file has trailing data", "bytes", size-expected, "last_page", h.DatabasePageSize)
+	}
+	return nil
+}
+
+func (d *DatabaseHeader) String() string {
+	var w fieldWriter
+	w.str("HeaderString", d.HeaderString)
+	w.uint("PageSize", uint64(d.PageSize))
+	w.uint("WriteFileFormat", uint64(d.WriteFileFormat))
+	w.uint("ReadFileFormat", uint64(d.ReadFileFormat))
+	w.uint("ReservedPageSpace", uint64(d.ReservedPageSpace))
+	w.uint("MaxEmbeddedPayloadFraction", uint64(d.MaxEmbeddedPayloadFraction))
+	w.uint("MinEmbeddedPayloadFraction", uint64(d.MinEmbeddedPayloadFraction))
+	w.uint("LeafPayloadFraction", uint64(d.LeafPayloadFraction))
+	w.uint("FileChangeCounter", uint64(d.FileChangeCounter))
+	w.uint("DatabasePageSize", uint64(d.DatabasePageSize))
+	w.uint("FirstFreeListTrunk", uint64(d.FirstFreeListTrunk))
+	w.uint("NumberOfFreeListPages", uint64(d.NumberOfFreeListPages))
+	w.uint("SchemaCookie", uint64(d.SchemaCookie))
+	w.uint("SchemaFormat", uint64(d.SchemaFormat))
+	w.uint("PageCacheSize", uint64(d.PageCacheSize))
+	w.uint("LargestPageInVMode", uint64(d.LargestPageInVMode))
+	w.uint("TextEncoding", uint64(d.TextEncoding))
+	w.uint("UserVersionPragma", uint64(d.UserVersionPragma))
+	w.uint("IncrementalVMode", uint64(d.IncrementalVMode))
+	w.uint("ApplicationID", uint64(d.ApplicationID))
+	w.uint("ReservedSpace", d.ReservedSpace)
+	w.uint("VersionValidfor", uint64(d.VersionValidfor))
+	w.uint("SqliteVersion", uint64(d.SqliteVersion))
+	return w.String()
+}
+
+type RecordMap map[string]*Record
+
+func (c RecordMap) String() string {
+	var buf strings.Builder
+	for k, v := range c {
+		buf.WriteString(
+			fmt.Sprintf("Key:%s%s\n%s\n", repeatStringDefault(3), k, v))
+	}
+	return buf.String()
+}
+
+// Contains a ptr to the file being parsed,
+// the sqlite header of that file and the root page
+// which is the first 8 or 12 bytes following the header.
+//
+// Table pages and index pages from sql_schema is saved as well.
+// Pages are read through Reader, which overlays committed WAL frames.
+// File is nil for databases opened with OpenReaderAt, OpenFS or WithVFS.
+type Database struct {
+	File     *os.File
+	Wal      *WalFile
+	Reader   *PageReader
+	Locked   bool
+	Writable bool
+	Header   *DatabaseHeader
+	RootPage *Page
+	Tables   RecordMap
+	Indicies RecordMap
+	// encoding text is decoded with, the one in the header unless
+	// overridden with WithTextEncoding
+	TextEncoding uint32
+	opts         options
+	logger       *slog.Logger
+	stats        Stats
+	// what pages are read from, File when it is set, and the name it
+	// was opened with, which the WAL and journal are found next to
+	src  VFSFile
+	name string
+	// tables added with RegisterTable
+	virtualTables map[string]VirtualTable
+	// pages of sqlite_schema decoded when the schema was last loaded,
+	// by page number
+	schemaPages map[int64]*Page
+	// leaf pages read in the background, set with WithReadAhead
+	readAhead *readAhead
+	// b-tree sizes counted by Analyze
+	analysis *analysis
+}
+
+// Opens the database at databasePath and reads its header, WAL and schema
+func Open(databasePath string, opts ...Option) (*Database, error) {
+	db, err := newDatabase(opts)
+	if err != nil {
+		return nil, err
+	}
+	if db.src, err = db.opts.vfs.Open(databasePath); err != nil {
+		return nil, err
+	}
+	if f, ok := db.src.(*osFile); ok {
+		db.File = f.File
+	}
+	db.name = databasePath
+	if db.opts.sharedLock {
+		if err := db.src.Lock(); err != nil {
+			db.src.Close()
+			return nil, err
+		}
+		db.Locked = true
+	}
+	// journals are inspected while holding the lock, as sqlite does
+	if err := checkJournals(db.opts.vfs, databasePath, db.opts.ignoreJournal, db.logger); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if db.Wal, err = db.openWal(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := db.load(databasePath); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func newDatabase(opts []Option) (*Database, error) {
+	o := options{logger: discardLogger, vfs: osVFS{}}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	db := &Database{
+		Tables:   make(RecordMap),
+		Indicies: make(RecordMap),
+		opts:     o,
+		logger:   o.logger}
+	db.Reader = &PageReader{db: db, cache: newPageCache(o.pageCache)}
+	db.readAhead = newReadAhead(o.readAhead)
+	return db, nil
+}
+
+// Reads the header and schema once the file and WAL are open
+func (db *Database) load(name string) error {
+	header, err := newDatabaseHeader(db.Reader)
+	if err != nil {
+		return err
+	}
+	db.setHeader(header)
+	// pages committed to the WAL may extend past the end of the file
+	if db.Wal == nil || db.Wal.PageCount == 0 {
+		size, err := db.size()
+		if err != nil {
+			return err
+		}
+		if err := checkDatabaseSize(size, header, db.logger); err != nil {
+			return err
+		}
+	}
+	rootPage, err := newPage(db.Reader, SchemaRootPage, header.PageSizeBytes(), header.ReservedPageSpace, db.TextEncoding)
+	if err != nil {
+		return err
+	}
+	db.RootPage = rootPage
+	db.schemaPages = map[int64]*Page{}
+	parseTablesAndIndices(db, db.RootPage)
+	db.logger.Debug("opened database", "path", name, "page_size", header.PageSizeBytes(),
+		"pages", header.DatabasePageSize, "tables", len(db.Tables), "indexes", len(db.Indicies), "wal", db.Wal != nil)
+	return nil
+}
+
+// Name the database was opened with, a path unless opened WithVFS
+func (db *Database) Name() string {
+	return db.name
+}
+
+// Length of the database file, without the WAL
+func (db *Database) size() (int64, error) {
+	return db.src.Size()
+}
+
+// Opens the WAL of the database, unless it is ignored
+func (db *Database) openWal() (*WalFile, error) {
+	if db.opts.ignoreWal || db.name == "" {
+		return nil, nil
+	}
+	return openWal(db.opts.vfs, db.name)
+}
+
+func (db *Database) setHeader(header *DatabaseHeader) {
+	db.Header = header
+	db.TextEncoding = header.TextEncoding
+	if db.opts.textEncoding != 0 {
+		db.TextEncoding = db.opts.textEncoding
+	}
+}
+
+// Reads the current file change counter directly from the file,
+// bypassing the header parsed at open and the page cache
+func (db *Database) ReadFileChangeCounter() (uint32, error) {
+	buf := make([]byte, 4)
+	if _, err := db.Reader.readThrough(buf, 24); err != nil {
+		return 0, err
+	}
+	var counter uint32
+	if err := readBigEndianInt(buf, &counter); err != nil {
+		return 0, err
+	}
+	return counter, nil
+}
+
+// Reopens the file for reading and writing, moving the shared lock
+// over to the new descriptor. Writers always hold at least a shared lock.
+func (db *Database) ensureWritable() error {
+	if db.Writable {
+		return nil
+	}
+	if db.opts.readOnly {
+		return ErrReadOnly
+	}
+	file, err := os.OpenFile(db.File.Name(), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := acquireSharedLock(file); err != nil {
+		file.Close()
+		return err
+	}
+	// closing the old descriptor drops its posix locks,
+	// which is fine now that the new one holds the lock
+	db.File.Close()
+	db.File = file
+	db.src = &osFile{file}
+	db.Locked = true
+	db.Writable = true
+	return nil
+}
+
+// Re-reads the WAL, header and schema after the database has been modified
+func (db *Database) Reload() error {
+	if db.Wal != nil {
+		db.Wal.Close()
+	}
+	db.Reader.cache.Clear()
+	db.readAhead.clear()
+	wal, err := db.openWal()
+	if err != nil {
+		return err
+	}
+	db.Wal = wal
+	header, err := newDatabaseHeader(db.Reader)
+	if err != nil {
+		return err
+	}
+	db.setHeader(header)
+	rootPage, err := newPage(db.Reader, SchemaRootPage, header.PageSizeBytes(), header.ReservedPageSpace, db.TextEncoding)
+	if err != nil {
+		return err
+	}
+	db.RootPage = rootPage
+	db.Tables = make(RecordMap)
+	db.Indicies = make(RecordMap)
+	db.schemaPages = map[int64]*Page{}
+	db.analysis = nil
+	parseTablesAndIndices(db, db.RootPage)
+	return nil
+}
+
+// Releases the shared lock, if held, and closes the file
+func (db *Database) Close() error {
+	if db.Wal != nil {
+		db.Wal.Close()
+	}
+	if db.Locked {
+		if err := db.src.Unlock(); err != nil {
+			db.src.Close()
+			return err
+		}
+		db.Locked = false
+	}
+	return db.src.Close()
+}
+
+// Returns the names of all tables, sorted
+func (db *Database) TableNames() []string {
+	s := []string{}
+	for k := range db.Tables {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
+
+// Returns the schema cells of all indexes on the table
+func (db *Database) TableIndicies(table string) []*Record {
+	indicies := []*Record{}
+	for _, c := range db.Indicies {
+		if name, _, err := c.IndexCtx(); err == nil && name == table {
+			indicies = append(indicies, c)
+		}
+	}
+	return indicies
+}
+
+func parseTablesAndIndices(db *Database, p *Page) {
+	db.schemaPages[p.Number()] = p
+	isLeaf := p.Header.PageType == LeafTableType
+	isInterior := p.Header.PageType == InteriorTableType
+	for _, c := range p.Cells {
+		if isLeaf {
+			t := c.CellType()
+			switch t {
+			case CellTypeTable:
+				if n, err := c.TableName(); err == nil {
+					c.ParseColumnMap()
+					db.Tables[n] = c
+				} else {
+					db.logger.Warn("failed to read table name", "rowid", c.RowID, "err", err)
+				}
+				break
+			case CellTypeIndex:
+				// keyed by index name, as a table can have several
+				// indexes on the same columns or several automatic ones
+				if table, _, err := c.IndexCtx(); err != nil {
+					db.logger.Warn("failed to parse index", "rowid", c.RowID, "err", err)
+				} else if name, err := c.SchemaName(); err == nil {
+					db.Indicies[fmt.Sprintf("%s-%s", table, name)] = c
+				} else {
+					db.logger.Warn("failed to read index name", "rowid", c.RowID, "err", err)
+				}
+				break
+			case CellTypeView, CellTypeTrigger:
+				// views and triggers have no b-tree to read
+			default:
+				db.logger.Warn("schema cell has unknown type", "rowid", c.RowID, "type", t)
+			}
+		} else if isInterior && c.LeftPageNumber > 0 {
+			if pn, err := NewPageFromNumber(db, int64(c.LeftPageNumber)); err == nil {
+				parseTablesAndIndices(db, pn)
+			} else {
+				db.logger.Warn("failed to read schema page", "page", c.LeftPageNumber, "err", err)
+			}
+		} else {
+			db.logger.Warn("unhandled schema page", "type", p.Header.PageType)
+		}
+	}
+	if isInterior && p.Header.RightMostPointer > 0 {
+		if pn, err := NewPageFromNumber(db, int64(p.Header.RightMostPointer)); err == nil {
+			parseTablesAndIndices(db, pn)
+		} else {
+			db.logger.Warn("failed to read schema page", "page", p.Header.RightMostPointer, "err", err)
+		}
+	}
+}
+
+// Decodes the page, or returns the copy decoded when the schema was
+// loaded for a page of sqlite_schema. Reloading the database drops the
+// copies, so they are only as current as Tables and Indicies.
+func (db *Database) schemaPage(pageNumber int64) (*Page, error) {
+	if p, ok := db.schemaPages[pageNumber]; ok {
+		return p, nil
+	}
+	return NewPageFromNumber(db, pageNumber)
+}
+
+func (d *Database) String() string {
+	var buf strings.Builder
+	buf.WriteString(
+		fmt.Sprintf("DATABASE HEADER\n%s\nROOT PAGE HEADER\n%s\n", d.Header, d.RootPage.Header))
+	if len(d.Tables) > 0 {
+		buf.WriteString(fmt.Sprintf("TABLES\n%s\n", d.Tables))
+	}
+	if len(d.Indicies) > 0 {
+		buf.WriteString(fmt.Sprintf("INDICIES\n%s\n", d.Indicies))
+	}
+	return buf.String()
+}
+
+// Reads the database as of its last commit. Pages with a committed
+// copy in the WAL are served from there, everything else comes from
+// the database file. Satisfies io.ReadSeeker and io.ReaderAt so the
+// parsers can use it in place of the file.
+type PageReader struct {
+	db     *Database
+	offset int64
+	cache  *pageCache
+}
+
+func (r *PageReader) ReadAt(buf []byte, offset int64) (int, error) {
+	if r.cache == nil || r.db.Header == nil {
+		return r.readThrough(buf, offset)
+	}
+	return r.cache.ReadAt(r, buf, offset)
+}
+
+// Reads from the WAL or the database file, bypassing the page cache
+func (r *PageReader) readThrough(buf []byte, offset int64) (n int, err error) {
+	if r.db.opts.tracer != nil {
+		span := r.db.startSpan("page.read", "offset", offset, "length", len(buf))
+		defer func() { span.End(err) }()
+	}
+	if r.db.opts.decrypter != nil {
+		n, err := r.readDecrypted(buf, offset)
+		r.db.bytesRead(n)
+		return n, err
+	}
+	wal := r.db.Wal
+	if wal == nil || len(wal.Frames) == 0 {
+		n, err := r.db.readAt(buf, offset)
+		r.db.bytesRead(n)
+		return n, err
+	}
+	pageSize := int64(wal.PageSize)
+	read := 0
+	for read < len(buf) {
+		pageNumber := offset/pageSize + 1
+		pageOffset := offset % pageSize
+		chunk := buf[read:minInt(len(buf), read+int(pageSize-pageOffset))]
+		n, ok, err := wal.ReadPage(pageNumber, chunk, pageOffset)
+		if !ok {
+			n, err = r.db.readAt(chunk, offset)
+		}
+		read += n
+		offset += int64(n)
+		if err != nil {
+			r.db.bytesRead(read)
+			return read, err
+		}
+	}
+	r.db.bytesRead(read)
+	return read, nil
+}
+
+func (db *Database) readAt(buf []byte, offset int64) (int, error) {
+	if db.readAhead != nil && db.Header != nil {
+		if n, ok := db.readAhead.read(buf, offset, db.Header.PageSizeBytes()); ok {
+			return n, nil
+		}
+	}
+	return db.src.ReadAt(buf, offset)
+}
+
+func (r *PageReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadAt(buf, r.offset)
+	r.offset += int64(n)
+	// like os.File, a short read only reports io.EOF on the next call
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *PageReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	default:
+		return 0, errors.New("unsupported seek whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative seek offset")
+	}
+	r.offset = offset
+	r.db.seeked(offset)
+	return offset, nil
+}
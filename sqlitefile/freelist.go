@@ -0,0 +1,156 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Header offsets of the freelist fields
+const (
+	FirstFreeListTrunkOffset    = 32
+	NumberOfFreeListPagesOffset = 36
+)
+
+// The freelist is a linked list of trunk pages, each holding the next
+// trunk page number, a leaf count and the page numbers of its leaves.
+//
+//	0	4	Next trunk page, zero for the last trunk
+//	4	4	Number of leaf page pointers L on this trunk
+//	8	4*L	Leaf page numbers
+//
+// sqlite never fills a trunk beyond usable/4 - 8 leaves, older
+// versions rejected trunks any fuller than that.
+func (tx *writeTxn) maxFreelistLeaves() uint32 {
+	return uint32(tx.usableSize/4 - 8)
+}
+
+// Adds page n to the freelist, as a leaf of the first trunk when it has
+// room and otherwise as the new first trunk.
+func (tx *writeTxn) freePage(n int64) error {
+	header, err := tx.Page(1)
+	if err != nil {
+		return err
+	}
+	trunk := binary.BigEndian.Uint32(header.Data[FirstFreeListTrunkOffset:])
+	count := binary.BigEndian.Uint32(header.Data[NumberOfFreeListPagesOffset:])
+	binary.BigEndian.PutUint32(header.Data[NumberOfFreeListPagesOffset:], count+1)
+	tx.Write(header)
+	if trunk != 0 {
+		tp, err := tx.Page(int64(trunk))
+		if err != nil {
+			return err
+		}
+		leaves := binary.BigEndian.Uint32(tp.Data[4:])
+		if leaves < tx.maxFreelistLeaves() {
+			binary.BigEndian.PutUint32(tp.Data[8+4*leaves:], uint32(n))
+			binary.BigEndian.PutUint32(tp.Data[4:], leaves+1)
+			tx.Write(tp)
+			return nil
+		}
+	}
+	p, err := tx.Page(n)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(p.Data, trunk)
+	binary.BigEndian.PutUint32(p.Data[4:], 0)
+	tx.Write(p)
+	binary.BigEndian.PutUint32(header.Data[FirstFreeListTrunkOffset:], uint32(n))
+	return nil
+}
+
+// Frees every page of an overflow chain
+func (tx *writeTxn) freeOverflowChain(first uint32) error {
+	for next := first; next != 0; {
+		p, err := tx.Page(int64(next))
+		if err != nil {
+			return err
+		}
+		following := binary.BigEndian.Uint32(p.Data)
+		if err := tx.freePage(p.Number); err != nil {
+			return err
+		}
+		next = following
+	}
+	return nil
+}
+
+// Frees every page of the b-tree rooted at pageNumber, children and
+// overflow chains first since freeing a page may overwrite its content
+func (tx *writeTxn) freeTree(pageNumber int64) error {
+	p, err := tx.Page(pageNumber)
+	if err != nil {
+		return err
+	}
+	children := []uint32{}
+	overflows := []uint32{}
+	for i := 0; i < p.CellCount(); i++ {
+		if !p.IsLeaf() {
+			children = append(children, p.CellLeftChild(i))
+		}
+		if _, _, overflow := p.CellPayload(i); overflow != 0 {
+			overflows = append(overflows, overflow)
+		}
+	}
+	if !p.IsLeaf() {
+		children = append(children, p.RightMostPointer())
+	}
+	for _, child := range children {
+		if err := tx.freeTree(int64(child)); err != nil {
+			return err
+		}
+	}
+	for _, overflow := range overflows {
+		if err := tx.freeOverflowChain(overflow); err != nil {
+			return err
+		}
+	}
+	return tx.freePage(pageNumber)
+}
+
+// Takes a page off the freelist, the last leaf of the first trunk or
+// the trunk itself once it has no leaves left. Returns nil when the
+// freelist is empty. The page is zeroed before it is handed out.
+func (tx *writeTxn) allocateFreePage() (*RawPage, error) {
+	header, err := tx.Page(1)
+	if err != nil {
+		return nil, err
+	}
+	trunk := binary.BigEndian.Uint32(header.Data[FirstFreeListTrunkOffset:])
+	count := binary.BigEndian.Uint32(header.Data[NumberOfFreeListPagesOffset:])
+	if trunk == 0 {
+		return nil, nil
+	}
+	tp, err := tx.Page(int64(trunk))
+	if err != nil {
+		return nil, err
+	}
+	n := int64(trunk)
+	leaves := binary.BigEndian.Uint32(tp.Data[4:])
+	if leaves > tx.maxFreelistLeaves() {
+		return nil, fmt.Errorf("freelist trunk page %d has %d leaves", trunk, leaves)
+	}
+	if leaves > 0 {
+		n = int64(binary.BigEndian.Uint32(tp.Data[8+4*(leaves-1):]))
+		binary.BigEndian.PutUint32(tp.Data[4:], leaves-1)
+		tx.Write(tp)
+	} else {
+		next := binary.BigEndian.Uint32(tp.Data)
+		binary.BigEndian.PutUint32(header.Data[FirstFreeListTrunkOffset:], next)
+	}
+	if n < 2 || n > tx.pageCount {
+		return nil, fmt.Errorf("freelist page %d is out of range", n)
+	}
+	if count > 0 {
+		count--
+	}
+	binary.BigEndian.PutUint32(header.Data[NumberOfFreeListPagesOffset:], count)
+	tx.Write(header)
+	p, err := tx.Page(n)
+	if err != nil {
+		return nil, err
+	}
+	copy(p.Data, make([]byte, len(p.Data)))
+	tx.Write(p)
+	return p, nil
+}
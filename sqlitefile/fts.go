@@ -0,0 +1,469 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A full-text search virtual table and the shadow tables its module
+// keeps the indexed text and the full-text index in
+// https://www.sqlite.org/fts3.html
+// https://www.sqlite.org/fts5.html
+type FTSTable struct {
+	Name string
+	// fts3, fts4 or fts5
+	Module  string
+	Columns []string
+	// the shadow tables that exist, in the order the module creates them
+	ShadowTables []string
+}
+
+// Suffixes of the shadow tables of each module
+var ftsShadowSuffixes = map[string][]string{
+	"fts3": {"content", "segments", "segdir", "docsize", "stat"},
+	"fts4": {"content", "segments", "segdir", "docsize", "stat"},
+	"fts5": {"data", "idx", "content", "docsize", "config"},
+}
+
+// Finds the full-text search tables of the database, sorted by name
+func (db *Database) FTSTables() ([]FTSTable, error) {
+	rows, err := ReadSchemaRows(db)
+	if err != nil {
+		return nil, err
+	}
+	tables := []FTSTable{}
+	for _, row := range rows {
+		t, ok := parseFTSTable(row)
+		if !ok {
+			continue
+		}
+		for _, suffix := range ftsShadowSuffixes[t.Module] {
+			if _, ok := db.Tables[CleanKeyString(t.Name+"_"+suffix)]; ok {
+				t.ShadowTables = append(t.ShadowTables, t.Name+"_"+suffix)
+			}
+		}
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables, nil
+}
+
+// Finds a full-text search table by name
+func (db *Database) FTSTable(name string) (FTSTable, error) {
+	tables, err := db.FTSTables()
+	if err != nil {
+		return FTSTable{}, err
+	}
+	for _, t := range tables {
+		if CleanKeyString(t.Name) == CleanKeyString(name) {
+			return t, nil
+		}
+	}
+	return FTSTable{}, NotFoundError("no such full-text table: %s", name)
+}
+
+// The full-text search table a shadow table belongs to, if it is one
+func (db *Database) FTSTableOf(shadow string) (FTSTable, bool) {
+	tables, err := db.FTSTables()
+	if err != nil {
+		return FTSTable{}, false
+	}
+	for _, t := range tables {
+		for _, s := range t.ShadowTables {
+			if CleanKeyString(s) == CleanKeyString(shadow) {
+				return t, true
+			}
+		}
+	}
+	return FTSTable{}, false
+}
+
+// Reads the module and columns of an FTS table. Arguments holding an =
+// are options such as tokenize=, not columns.
+func parseFTSTable(row SchemaRow) (FTSTable, bool) {
+	module, args, ok := parseVirtualTable(row)
+	if _, fts := ftsShadowSuffixes[module]; !ok || !fts {
+		return FTSTable{}, false
+	}
+	t := FTSTable{Name: row.Name, Module: module, Columns: []string{}}
+	for _, arg := range args {
+		fields := strings.Fields(arg)
+		if len(fields) == 0 || strings.Contains(arg, "=") {
+			continue
+		}
+		t.Columns = append(t.Columns, strings.Trim(fields[0], "\"'`[]"))
+	}
+	if len(t.Columns) == 0 {
+		t.Columns = append(t.Columns, "content")
+	}
+	return t, true
+}
+
+// Looks up the rowids of the rows of a full-text search table holding
+// term, like `table MATCH 'term'` with a single term. The full-text
+// index is decoded from the shadow tables. The term is only folded to
+// lower case, which matches what the default tokenizers of each module
+// store for ASCII text.
+func (db *Database) Match(table, term string) ([]int64, error) {
+	t, err := db.FTSTable(table)
+	if err != nil {
+		return nil, err
+	}
+	term = strings.ToLower(term)
+	// entries of newer segments replace those of older ones for the
+	// same rowid, deleted rows are recorded as entries too
+	rows := map[int64]bool{}
+	if t.Module == "fts5" {
+		err = matchFTS5(db, t.Name, term, rows)
+	} else {
+		err = matchFTS3(db, t.Name, term, rows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rowids := []int64{}
+	for rowid, ok := range rows {
+		if ok {
+			rowids = append(rowids, rowid)
+		}
+	}
+	sort.Slice(rowids, func(i, j int) bool { return rowids[i] < rowids[j] })
+	return rowids, nil
+}
+
+// A segment of an FTS3/4 index, a b-tree whose leaves are stored as
+// blocks in %_segments, or in root alone when it is small enough
+type fts3Segment struct {
+	level, idx int64
+	startBlock int64
+	leavesEnd  int64
+	root       []byte
+}
+
+// Scans the leaves of every segment, oldest first: those on higher
+// levels and, within a level, with a lower index
+// https://www.sqlite.org/fts3.html#data_structures
+func matchFTS3(db *Database, table, term string, rows map[int64]bool) error {
+	c, err := db.OpenCursor(table + "_segdir")
+	if err != nil {
+		return err
+	}
+	segments := []fts3Segment{}
+	for ok, err := c.First(); ok || err != nil; ok, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		s := fts3Segment{}
+		for i, v := range []*int64{&s.level, &s.idx, &s.startBlock, &s.leavesEnd} {
+			value, err := c.Column(i)
+			if err != nil {
+				return err
+			}
+			*v, _ = value.(int64)
+		}
+		root, err := c.Column(5)
+		if err != nil {
+			return err
+		}
+		s.root, _ = root.([]byte)
+		segments = append(segments, s)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].level != segments[j].level {
+			return segments[i].level > segments[j].level
+		}
+		return segments[i].idx < segments[j].idx
+	})
+	blocks, err := db.OpenCursor(table + "_segments")
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if s.startBlock == 0 {
+			if err := matchFTS3Leaf(s.root, term, rows); err != nil {
+				return err
+			}
+			continue
+		}
+		for b := s.startBlock; b <= s.leavesEnd; b++ {
+			found, err := blocks.SeekRowid(b)
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("%s_segments has no block %d", table, b)
+			}
+			v, err := blocks.Column(1)
+			if err != nil {
+				return err
+			}
+			data, _ := v.([]byte)
+			if err := matchFTS3Leaf(data, term, rows); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Reads the doclist of term from a leaf node: a 0 height varint, then
+// every term with the length of the prefix it shares with the one
+// before it, its suffix and its doclist. A doclist holds the docid
+// deltas of the rows with the term, each followed by a position list
+// ending in 0. An empty position list marks a deleted row.
+func matchFTS3Leaf(data []byte, term string, rows map[int64]bool) error {
+	height, i := readFTS3Varint(data)
+	if height != 0 {
+		return fmt.Errorf("full-text index leaf has height %d", height)
+	}
+	prev := []byte{}
+	for first := true; i < len(data); first = false {
+		prefix := int64(0)
+		if !first {
+			var n int
+			prefix, n = readFTS3Varint(data[i:])
+			i += n
+		}
+		suffix, n := readFTS3Varint(data[i:])
+		i += n
+		if prefix < 0 || prefix > int64(len(prev)) || suffix < 0 || int64(i)+suffix > int64(len(data)) {
+			return fmt.Errorf("corrupt full-text index leaf at offset %d", i)
+		}
+		current := append(prev[:prefix:prefix], data[i:i+int(suffix)]...)
+		i += int(suffix)
+		size, n := readFTS3Varint(data[i:])
+		i += n
+		if size < 0 || int64(i)+size > int64(len(data)) {
+			return fmt.Errorf("corrupt full-text doclist at offset %d", i)
+		}
+		if string(current) == term {
+			readFTS3Doclist(data[i:i+int(size)], rows)
+		}
+		i += int(size)
+		prev = current
+	}
+	return nil
+}
+
+func readFTS3Doclist(doclist []byte, rows map[int64]bool) {
+	docid := int64(0)
+	for i := 0; i < len(doclist); {
+		delta, n := readFTS3Varint(doclist[i:])
+		i += n
+		docid += delta
+		empty := true
+		for i < len(doclist) {
+			v, n := readFTS3Varint(doclist[i:])
+			i += n
+			if v == 0 {
+				break
+			}
+			empty = false
+			// a column number follows the 1 that starts its positions
+			if v == 1 {
+				_, n := readFTS3Varint(doclist[i:])
+				i += n
+			}
+		}
+		rows[docid] = !empty
+	}
+}
+
+// Decodes a varint of FTS3/4, which holds 7 bits in each byte with the
+// least significant first, continuing while the high bit is set
+func readFTS3Varint(buf []byte) (int64, int) {
+	var v uint64
+	for i, b := range buf {
+		if i == 10 {
+			break
+		}
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return int64(v), i + 1
+		}
+	}
+	return int64(v), min(len(buf), 10)
+}
+
+// FTS5 keeps its index as blobs in %_data. The structure record lists
+// the segments on each level, and the leaf pages of segment s are the
+// rows s<<37 + page number.
+// https://sqlite.org/src/file/ext/fts5/fts5_index.c
+const (
+	fts5StructureRowid = 10
+	fts5SegmentShift   = 37
+	// terms of the main index, not a prefix index, start with '0'
+	fts5MainPrefix = '0'
+)
+
+type fts5Segment struct {
+	id, first, last int64
+}
+
+// Scans the leaves of every segment, oldest first: those on higher
+// levels and, within a level, in the order the structure lists them
+func matchFTS5(db *Database, table, term string, rows map[int64]bool) error {
+	data, err := db.OpenCursor(table + "_data")
+	if err != nil {
+		return err
+	}
+	block := func(id int64) ([]byte, error) {
+		found, err := data.SeekRowid(id)
+		if err != nil || !found {
+			return nil, err
+		}
+		v, err := data.Column(1)
+		b, _ := v.([]byte)
+		return b, err
+	}
+	structure, err := block(fts5StructureRowid)
+	if err != nil {
+		return err
+	}
+	levels, err := readFTS5Structure(structure)
+	if err != nil {
+		return err
+	}
+	key := string(fts5MainPrefix) + term
+	for l := len(levels) - 1; l >= 0; l-- {
+		for _, s := range levels[l] {
+			if err := matchFTS5Segment(s, key, rows, block); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Decodes the structure record: a 4 byte cookie, the number of levels
+// and segments and a write counter, then for each level the number of segments being
+// merged and the segments, each as its id and first and last page.
+// Version 2 records, marked after the cookie, add five more varints to
+// each segment.
+func readFTS5Structure(data []byte) ([][]fts5Segment, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("full-text structure record of %d bytes", len(data))
+	}
+	i := 4
+	extra := 0
+	if len(data) >= 8 && binary.BigEndian.Uint32(data[4:]) == 0xff000001 {
+		i, extra = 8, 5
+	}
+	next := func() int64 {
+		v, n := ReadVarint(data[min(i, len(data)):])
+		i += n
+		return v
+	}
+	nLevel := next()
+	next() // total number of segments
+	next() // write counter
+	if nLevel < 0 || nLevel > 1024 {
+		return nil, fmt.Errorf("full-text structure record has %d levels", nLevel)
+	}
+	levels := make([][]fts5Segment, nLevel)
+	for l := range levels {
+		next() // segments being merged
+		nSeg := next()
+		for s := int64(0); s < nSeg && i < len(data); s++ {
+			levels[l] = append(levels[l], fts5Segment{next(), next(), next()})
+			for e := 0; e < extra; e++ {
+				next()
+			}
+		}
+	}
+	return levels, nil
+}
+
+// Reads the entries of key from the leaves of a segment. A leaf starts
+// with the offset of its first rowid, when a doclist carries on from
+// the page before, and the offset of its footer, which lists where each
+// term on the page starts. The first term on a page is stored whole,
+// the others share a prefix with the term before them. A doclist is
+// the first rowid, then the rowid deltas, each followed by the size of
+// its position list times two, plus one when it replaces the row, and
+// the position list. Position lists may run on to the next page.
+func matchFTS5Segment(s fts5Segment, key string, rows map[int64]bool, block func(int64) ([]byte, error)) error {
+	current := ""
+	for pgno := s.first; pgno <= s.last; pgno++ {
+		page, err := block(s.id<<fts5SegmentShift + pgno)
+		if err != nil {
+			return err
+		}
+		if len(page) < 4 {
+			continue
+		}
+		firstRowid := int(binary.BigEndian.Uint16(page))
+		footer := int(binary.BigEndian.Uint16(page[2:]))
+		if footer < 4 || footer > len(page) {
+			return fmt.Errorf("corrupt full-text leaf %d of segment %d", pgno, s.id)
+		}
+		terms := []int{}
+		for i, offset := footer, 0; i < len(page); {
+			delta, n := ReadVarint(page[i:])
+			i += n
+			offset += int(delta)
+			terms = append(terms, offset)
+		}
+		end := footer
+		if len(terms) > 0 {
+			end = terms[0]
+		}
+		if firstRowid != 0 && current == key && firstRowid < end {
+			readFTS5Doclist(page[firstRowid:end], rows)
+		}
+		prev := []byte{}
+		for k, offset := range terms {
+			if offset < 4 || offset >= footer {
+				return fmt.Errorf("corrupt full-text leaf %d of segment %d", pgno, s.id)
+			}
+			i := offset
+			prefix := int64(0)
+			if k > 0 {
+				var n int
+				prefix, n = ReadVarint(page[i:])
+				i += n
+			}
+			suffix, n := ReadVarint(page[i:])
+			i += n
+			if prefix < 0 || prefix > int64(len(prev)) || suffix < 0 || int64(i)+suffix > int64(footer) {
+				return fmt.Errorf("corrupt full-text leaf %d of segment %d", pgno, s.id)
+			}
+			prev = append(prev[:prefix:prefix], page[i:i+int(suffix)]...)
+			i += int(suffix)
+			current = string(prev)
+			end := footer
+			if k+1 < len(terms) {
+				end = terms[k+1]
+			}
+			if current == key && i < end {
+				readFTS5Doclist(page[i:end], rows)
+			}
+		}
+	}
+	return nil
+}
+
+func readFTS5Doclist(doclist []byte, rows map[int64]bool) {
+	rowid := int64(0)
+	for i, first := 0, true; i < len(doclist); first = false {
+		v, n := ReadVarint(doclist[i:])
+		i += n
+		if first {
+			rowid = v
+		} else {
+			rowid += v
+		}
+		if i >= len(doclist) {
+			rows[rowid] = true
+			return
+		}
+		size, n := ReadVarint(doclist[i:])
+		i += n
+		// the flag marks an entry replacing the row in older segments,
+		// one without positions deletes it
+		rows[rowid] = size>>1 > 0
+		i += int(size >> 1)
+	}
+}
@@ -0,0 +1,39 @@
+package sqlitefile
+
+import (
+	"errors"
+	"strings"
+)
+
+// Functions on text that can be called like the JSON functions, in the
+// select list of a query and in indexed expressions
+var textFunctions = map[string]func(v any, args []any) (any, error){
+	"lower": func(v any, args []any) (any, error) { return mapASCII(v, args, "lower", 'A', 'Z', 'a'-'A') },
+	"upper": func(v any, args []any) (any, error) { return mapASCII(v, args, "upper", 'a', 'z', 'A'-'a') },
+}
+
+// Looks up a function that takes a column as its first argument, nil
+// when there is no such function
+func lookupFunction(name string) func(v any, args []any) (any, error) {
+	if fn, ok := jsonFunctions[name]; ok {
+		return fn
+	}
+	return textFunctions[name]
+}
+
+// Changes the case of the ASCII letters in the text of v, leaving other
+// characters as they are like sqlite built without ICU does
+func mapASCII(v any, args []any, name string, from, to byte, shift int) (any, error) {
+	if len(args) > 0 {
+		return nil, errors.New(name + " takes a single argument")
+	}
+	if v == nil {
+		return nil, nil
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= rune(from) && r <= rune(to) {
+			return r + rune(shift)
+		}
+		return r
+	}, FormatValue(v)), nil
+}
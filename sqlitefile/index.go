@@ -0,0 +1,660 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// An index entry holds the indexed column values followed by the rowid
+type indexEntry struct {
+	Key     []any
+	RowID   int64
+	Payload []byte
+}
+
+// Orders values the way sqlite compares them in indexes with the
+// BINARY collation: NULL, then numbers, then text, then blobs.
+func compareValues(a, b any) int {
+	ra, rb := storageClassRank(a), storageClassRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			return compareInt64(a, b)
+		}
+		return compareFloat64(float64(a), b.(float64))
+	case float64:
+		if b, ok := b.(int64); ok {
+			return compareFloat64(a, float64(b))
+		}
+		return compareFloat64(a, b.(float64))
+	case string:
+		return bytes.Compare([]byte(a), []byte(b.(string)))
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	}
+	return 0
+}
+
+func storageClassRank(v any) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int64, float64:
+		return 1
+	case string:
+		return 2
+	}
+	return 3
+}
+
+func compareInt64(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Compares two index keys column by column, reversing
+// the order of columns declared DESC
+func compareIndexKeys(a, b []any, desc []bool) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		c := compareValues(a[i], b[i])
+		if i < len(desc) && desc[i] {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+func sortIndexEntries(entries []indexEntry, desc []bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		c := compareIndexKeys(entries[i].Key, entries[j].Key, desc)
+		if c == 0 {
+			return entries[i].RowID < entries[j].RowID
+		}
+		return c < 0
+	})
+}
+
+func indexLeafCell(payload []byte) []byte {
+	return AppendVarint([]byte{}, int64(len(payload)))
+}
+
+func indexInteriorCell(leftChild uint32, payload []byte) []byte {
+	return AppendVarint(leftChildPrefix(leftChild), int64(len(payload)))
+}
+
+// Builds an index b-tree bottom up from sorted entries and returns its
+// root page. Leaves are filled in order and whenever one is full the next
+// entry becomes the divider to the level above, as index b-trees keep
+// each entry exactly once. The levels above are built the same way from
+// the child pages and dividers until a single page remains.
+//
+// A page is closed one entry early when the divider would otherwise be
+// the last entry, so no page is ever left without cells. Overflow pages
+// are only written once the cells of a page are final.
+func (tx *writeTxn) buildIndexTree(entries []indexEntry) (int64, error) {
+	children := []uint32{}
+	dividers := [][]byte{}
+	for i := 0; i < len(entries) || len(children) == 0; {
+		leaf, err := tx.allocatePage()
+		if err != nil {
+			return 0, err
+		}
+		leaf.Reset(LeafIndexType)
+		overflows := [][]byte{}
+		for ; i < len(entries); i++ {
+			cell, overflow := tx.payloadCell(indexLeafCell(entries[i].Payload), entries[i].Payload, false)
+			if err := leaf.InsertCell(leaf.CellCount(), cell); err != nil {
+				break
+			}
+			overflows = append(overflows, overflow)
+		}
+		if leaf.CellCount() == 0 && len(entries) > 0 {
+			return 0, fmt.Errorf("index entry of %d bytes does not fit a page", len(entries[i].Payload))
+		}
+		if i < len(entries) {
+			if i == len(entries)-1 && leaf.CellCount() > 1 {
+				leaf.DropCell(leaf.CellCount() - 1)
+				overflows = overflows[:len(overflows)-1]
+				i--
+			}
+			dividers = append(dividers, entries[i].Payload)
+			i++
+		}
+		if err := tx.writePageOverflows(leaf, overflows); err != nil {
+			return 0, err
+		}
+		children = append(children, uint32(leaf.Number))
+	}
+	for len(children) > 1 {
+		nextChildren := []uint32{}
+		nextDividers := [][]byte{}
+		for j := 0; j < len(children); {
+			p, err := tx.allocatePage()
+			if err != nil {
+				return 0, err
+			}
+			p.Reset(InteriorIndexType)
+			overflows := [][]byte{}
+			for ; j < len(dividers); j++ {
+				cell, overflow := tx.payloadCell(indexInteriorCell(children[j], dividers[j]), dividers[j], false)
+				if err := p.InsertCell(p.CellCount(), cell); err != nil {
+					break
+				}
+				overflows = append(overflows, overflow)
+			}
+			if p.CellCount() == 0 {
+				return 0, fmt.Errorf("index entry of %d bytes does not fit a page", len(dividers[j]))
+			}
+			if j < len(dividers) && j == len(dividers)-1 && p.CellCount() > 1 {
+				p.DropCell(p.CellCount() - 1)
+				overflows = overflows[:len(overflows)-1]
+				j--
+			}
+			p.SetRightMostPointer(children[j])
+			if j < len(dividers) {
+				nextDividers = append(nextDividers, dividers[j])
+			}
+			j++
+			if err := tx.writePageOverflows(p, overflows); err != nil {
+				return 0, err
+			}
+			nextChildren = append(nextChildren, uint32(p.Number))
+		}
+		children, dividers = nextChildren, nextDividers
+	}
+	return int64(children[0]), nil
+}
+
+// Writes the overflow chains of the cells of p, overflows holding
+// the spilled part of each cell in order or nil if it has none
+func (tx *writeTxn) writePageOverflows(p *RawPage, overflows [][]byte) error {
+	for k, overflow := range overflows {
+		if overflow == nil {
+			continue
+		}
+		start := p.CellPointer(k)
+		cell := p.Data[start : start+p.CellSize(k)]
+		if err := tx.writeOverflow(cell, overflow); err != nil {
+			return err
+		}
+	}
+	tx.Write(p)
+	return nil
+}
+
+// An index as needed to keep it in sync with its table: the record
+// position of each indexed column, -1 standing for the rowid, and
+// whether each column is sorted in descending order. An indexed
+// expression has the call in Exprs and the column it reads in Columns.
+type tableIndex struct {
+	Name    string
+	Root    int64
+	Unique  bool
+	Columns []int
+	Desc    []bool
+	Exprs   []*funcCall
+	// the condition of a partial index, empty when every row is indexed
+	Where string
+	// what each column is named by in the constraints of a query: the
+	// column name or the expression as the parser writes it
+	terms []string
+}
+
+func newTableIndex(name string, schema *Record, columns []IndexColumn, unique bool) (*tableIndex, error) {
+	ix := &tableIndex{Name: name, Unique: unique}
+	for _, col := range columns {
+		var expr *funcCall
+		term := col.Name
+		if col.Expr != "" {
+			call, key, err := parseIndexExpression(col.Expr)
+			if err != nil {
+				return nil, err
+			}
+			expr, col.Name, term = &call, call.column, key
+		}
+		idx, ok := schema.ColumnMap[col.Name]
+		switch {
+		case ok && idx == schema.RowidColumn, !ok && col.Name == "rowid":
+			idx = -1
+		case !ok:
+			return nil, columnNotFoundError("no such column: %s", col.Name)
+		}
+		ix.Columns = append(ix.Columns, idx)
+		ix.Desc = append(ix.Desc, col.Desc)
+		ix.Exprs = append(ix.Exprs, expr)
+		ix.terms = append(ix.terms, term)
+	}
+	return ix, nil
+}
+
+// Reads an indexed expression that is a call of a function on a column
+// with literal arguments, such as lower(name), which is as far as
+// expressions can be evaluated. Also returns how the expression is named
+// among the constraints of a query.
+func parseIndexExpression(expr string) (funcCall, string, error) {
+	unsupported := fmt.Errorf("cannot evaluate indexed expression %s", expr)
+	stmt, err := sqlparser.Parse("SELECT " + expr + " FROM t")
+	if err != nil {
+		return funcCall{}, "", unsupported
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || len(sel.SelectExprs) != 1 {
+		return funcCall{}, "", unsupported
+	}
+	call, _, ok := sqlExprToFuncCall(sel.SelectExprs[0])
+	if !ok {
+		return funcCall{}, "", unsupported
+	}
+	return call, exprKey(sel.SelectExprs[0].(*sqlparser.AliasedExpr).Expr), nil
+}
+
+// Whether any of the indexed columns is an expression
+func (ix *tableIndex) hasExpressions() bool {
+	for _, e := range ix.Exprs {
+		if e != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// The indexed values of a row, without the trailing rowid
+func (ix *tableIndex) Key(rowID int64, values []any) []any {
+	key := make([]any, len(ix.Columns))
+	for i, col := range ix.Columns {
+		if col < 0 {
+			key[i] = rowID
+		} else if col < len(values) {
+			key[i] = values[col]
+		}
+	}
+	return key
+}
+
+// Reads the first n values of a record, values missing from
+// records written before ALTER TABLE ADD COLUMN are NULL
+func recordValues(c *Record, n int) ([]any, error) {
+	values := make([]any, n)
+	for i := range values {
+		v, err := c.ReadDataFromHeaderIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// Loads the indexes of a table from their schema rows. Indexes created
+// for UNIQUE and PRIMARY KEY constraints have no SQL of their own, their
+// columns are taken from the constraints in the CREATE TABLE statement.
+func loadTableIndexes(db *Database, tableName string, schema *Record) ([]*tableIndex, error) {
+	indexes := []*tableIndex{}
+	var automatic [][]IndexColumn
+	for _, c := range db.TableIndicies(tableName) {
+		name, err := c.SchemaName()
+		if err != nil {
+			return nil, err
+		}
+		root, err := c.RootPage()
+		if err != nil {
+			return nil, err
+		}
+		sql, _ := c.ReadDataFromHeaderIndex(4)
+		text, ok := sql.(string)
+		var columns []IndexColumn
+		unique, where := true, ""
+		if !ok {
+			if automatic == nil {
+				automatic = automaticIndexColumns(schema)
+			}
+			n := 0
+			fmt.Sscanf(name[strings.LastIndex(name, "_")+1:], "%d", &n)
+			if n < 1 || n > len(automatic) {
+				return nil, fmt.Errorf("cannot find the constraint behind index %s", name)
+			}
+			columns = automatic[n-1]
+		} else {
+			def, err := ParseIndexDefinition(text)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse schema of index %s: %w", name, err)
+			}
+			if err := def.checkCollations(); err != nil {
+				return nil, fmt.Errorf("index %s: %s", name, err)
+			}
+			unique, columns, where = def.Unique, def.Columns, def.Where
+		}
+		ix, err := newTableIndex(name, schema, columns, unique)
+		if err != nil {
+			return nil, err
+		}
+		// an index column takes the collation of its table column
+		for i, col := range ix.Columns {
+			if columns[i].Collation == "" && schema.Collation(col) != "" {
+				return nil, fmt.Errorf("index %s: only the BINARY collation is supported", name)
+			}
+		}
+		ix.Root, ix.Where = root, where
+		indexes = append(indexes, ix)
+	}
+	return indexes, nil
+}
+
+// Lists the columns of the indexes sqlite creates for the UNIQUE and
+// PRIMARY KEY constraints of a table, in the order it numbers them:
+// constraints in the order they appear, skipping a PRIMARY KEY that is
+// the rowid and any constraint covering the same columns as an earlier one.
+func automaticIndexColumns(schema *Record) [][]IndexColumn {
+	sql, _ := schema.ReadDataFromHeaderIndex(4)
+	text, _ := sql.(string)
+	result := [][]IndexColumn{}
+	add := func(columns []IndexColumn) {
+		if len(columns) == 1 && schema.IsRowidAlias(columns[0].Name) {
+			return
+		}
+		for _, existing := range result {
+			if len(existing) != len(columns) {
+				continue
+			}
+			// the sort order does not make an index different
+			same := true
+			for i := range existing {
+				same = same && existing[i].Name == columns[i].Name && existing[i].Collation == columns[i].Collation
+			}
+			if same {
+				return
+			}
+		}
+		result = append(result, columns)
+	}
+	for _, def := range splitColumnDefinitions(text) {
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+		upper := strings.ToUpper(strings.TrimSpace(def))
+		def = strings.TrimSpace(def)
+		if isTableConstraint(strings.SplitN(fields[0], "(", 2)[0]) {
+			if strings.EqualFold(fields[0], "constraint") && len(fields) > 2 {
+				start := strings.Index(def, fields[1]) + len(fields[1])
+				upper, def = strings.TrimSpace(upper[start:]), strings.TrimSpace(def[start:])
+			}
+			if !strings.HasPrefix(upper, "PRIMARY") && !strings.HasPrefix(upper, "UNIQUE") {
+				continue
+			}
+			matches := IndexKeyRegexp.FindStringSubmatch(def)
+			if len(matches) < 2 {
+				continue
+			}
+			columns, err := parseIndexColumnDefinitions(splitColumnDefinitions("(" + matches[1] + ")"))
+			if err == nil {
+				add(columns)
+			}
+			continue
+		}
+		name := CleanKeyString(fields[0])
+		upper = strings.Join(strings.Fields(upper), " ")
+		pk, uq := strings.Index(upper, "PRIMARY KEY"), strings.Index(upper, "UNIQUE")
+		pkColumn := []IndexColumn{{Name: name, Desc: strings.Contains(upper, "PRIMARY KEY DESC")}}
+		uqColumn := []IndexColumn{{Name: name}}
+		switch {
+		case pk >= 0 && uq >= 0 && uq < pk:
+			add(uqColumn)
+			add(pkColumn)
+		case pk >= 0:
+			add(pkColumn)
+			if uq >= 0 {
+				add(uqColumn)
+			}
+		case uq >= 0:
+			add(uqColumn)
+		}
+	}
+	return result
+}
+
+// Decodes every value of the ith cell of an index page, the rowid last
+func (tx *writeTxn) indexCellValues(p *RawPage, i int) ([]any, error) {
+	payload, err := tx.cellPayload(p, i)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewRecordCell(0, payload)
+	if err != nil {
+		return nil, err
+	}
+	return recordValues(c, len(c.Header))
+}
+
+// Descends the index b-tree looking for an entry matching key, comparing
+// only as many columns as key holds. Returns the page and position of
+// the entry, whether one was found and the interior pages passed.
+// Without a match the position is where key would be inserted into
+// the returned leaf.
+func (tx *writeTxn) seekIndex(root int64, key []any, desc []bool) (*RawPage, int, bool, []btreeStep, error) {
+	path := []btreeStep{}
+	p, err := tx.Page(root)
+	if err != nil {
+		return nil, 0, false, nil, err
+	}
+	for {
+		if t := p.PageType(); t != LeafIndexType && t != InteriorIndexType {
+			return nil, 0, false, nil, fmt.Errorf("page %d is not an index b-tree page", p.Number)
+		}
+		// binary search for the first cell not smaller than key
+		i, hi := 0, p.CellCount()
+		for i < hi {
+			mid := (i + hi) / 2
+			values, err := tx.indexCellValues(p, mid)
+			if err != nil {
+				return nil, 0, false, nil, err
+			}
+			if len(values) < len(key) {
+				return nil, 0, false, nil, fmt.Errorf("index entry on page %d has %d columns", p.Number, len(values))
+			}
+			c := compareIndexKeys(values[:len(key)], key, desc)
+			if c == 0 {
+				return p, mid, true, path, nil
+			}
+			if c < 0 {
+				i = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		if p.IsLeaf() {
+			return p, i, false, path, nil
+		}
+		path = append(path, btreeStep{p, i})
+		if p, err = tx.Page(int64(p.ChildPage(i))); err != nil {
+			return nil, 0, false, nil, err
+		}
+	}
+}
+
+// Looks up a row with the given key in a unique index,
+// returning its rowid if there is one
+func (tx *writeTxn) findIndexKey(ix *tableIndex, key []any) (int64, bool, error) {
+	p, i, found, _, err := tx.seekIndex(ix.Root, key, ix.Desc)
+	if err != nil || !found {
+		return 0, false, err
+	}
+	values, err := tx.indexCellValues(p, i)
+	if err != nil {
+		return 0, false, err
+	}
+	rowID, ok := values[len(values)-1].(int64)
+	if !ok {
+		return 0, false, fmt.Errorf("index %s entry has no rowid", ix.Name)
+	}
+	return rowID, true, nil
+}
+
+func (tx *writeTxn) insertIndexEntry(ix *tableIndex, rowID int64, values []any) error {
+	entry := append(ix.Key(rowID, values), rowID)
+	payload, err := tx.encodeRecord(entry)
+	if err != nil {
+		return err
+	}
+	leaf, i, found, path, err := tx.seekIndex(ix.Root, entry, ix.Desc)
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("index %s already has an entry for row %d", ix.Name, rowID)
+	}
+	cell, overflow := tx.payloadCell(indexLeafCell(payload), payload, false)
+	if overflow != nil {
+		if err := tx.writeOverflow(cell, overflow); err != nil {
+			return err
+		}
+	}
+	return tx.insertCell(path, leaf, i, cell)
+}
+
+// Removes the entry of a row from the index. An entry on an interior
+// page is replaced by its predecessor, the last entry of the right-most
+// leaf of its left subtree, so entries are only ever taken from leaves.
+func (tx *writeTxn) deleteIndexEntry(ix *tableIndex, rowID int64, values []any) error {
+	entry := append(ix.Key(rowID, values), rowID)
+	p, i, found, path, err := tx.seekIndex(ix.Root, entry, ix.Desc)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("index %s has no entry for row %d", ix.Name, rowID)
+	}
+	if _, _, overflow := p.CellPayload(i); overflow != 0 {
+		if err := tx.freeOverflowChain(overflow); err != nil {
+			return err
+		}
+	}
+	if p.IsLeaf() {
+		p.DropCell(i)
+		tx.Write(p)
+		if p.CellCount() == 0 && len(path) > 0 {
+			return tx.removeEmptyIndexLeaf(path, p)
+		}
+		return nil
+	}
+	leftChild := p.CellLeftChild(i)
+	leaf, err := tx.Page(int64(leftChild))
+	if err != nil {
+		return err
+	}
+	for !leaf.IsLeaf() {
+		if leaf, err = tx.Page(int64(leaf.RightMostPointer())); err != nil {
+			return err
+		}
+	}
+	last := leaf.CellCount() - 1
+	predecessor := leaf.Cell(last)
+	predecessorValues, err := tx.indexCellValues(leaf, last)
+	if err != nil {
+		return err
+	}
+	// the overflow chain moves along with the cell
+	leaf.DropCell(last)
+	tx.Write(leaf)
+	p.DropCell(i)
+	if err := tx.insertCell(path, p, i, append(leftChildPrefix(leftChild), predecessor...)); err != nil {
+		return err
+	}
+	if leaf.CellCount() > 0 {
+		return nil
+	}
+	// placing the predecessor may have split pages on the path,
+	// so the way down to the emptied leaf is looked up again
+	p, i, found, path, err = tx.seekIndex(ix.Root, predecessorValues, ix.Desc)
+	if err != nil {
+		return err
+	}
+	if !found || p.IsLeaf() {
+		return fmt.Errorf("index %s lost the entry of row %d", ix.Name, rowID)
+	}
+	path = append(path, btreeStep{p, i})
+	leaf, err = tx.Page(int64(p.CellLeftChild(i)))
+	for err == nil && !leaf.IsLeaf() {
+		path = append(path, btreeStep{leaf, leaf.CellCount()})
+		leaf, err = tx.Page(int64(leaf.RightMostPointer()))
+	}
+	if err != nil {
+		return err
+	}
+	return tx.removeEmptyIndexLeaf(path, leaf)
+}
+
+// Unlinks an empty leaf from an index b-tree. Unlike table b-trees the
+// divider next to the leaf is an entry of its own, so it is moved down
+// into the neighbouring subtree: to the front of its left-most leaf when
+// the divider is to the right of the empty leaf, or to the end of its
+// right-most leaf otherwise. A parent left without cells is then
+// replaced by its only child.
+func (tx *writeTxn) removeEmptyIndexLeaf(path []btreeStep, empty *RawPage) error {
+	step := path[len(path)-1]
+	parent := step.Page
+	steps := append([]btreeStep{}, path[:len(path)-1]...)
+	var divider []byte
+	leftMost := step.Child < parent.CellCount()
+	if leftMost {
+		divider = parent.Cell(step.Child)[4:]
+		parent.DropCell(step.Child)
+		steps = append(steps, btreeStep{parent, step.Child})
+	} else {
+		last := parent.CellCount() - 1
+		divider = parent.Cell(last)[4:]
+		parent.SetRightMostPointer(parent.CellLeftChild(last))
+		parent.DropCell(last)
+		steps = append(steps, btreeStep{parent, parent.CellCount()})
+	}
+	tx.Write(parent)
+	node, err := tx.Page(int64(parent.ChildPage(steps[len(steps)-1].Child)))
+	for err == nil && !node.IsLeaf() {
+		child := node.CellCount()
+		if leftMost {
+			child = 0
+		}
+		steps = append(steps, btreeStep{node, child})
+		node, err = tx.Page(int64(node.ChildPage(child)))
+	}
+	if err != nil {
+		return err
+	}
+	idx := node.CellCount()
+	if leftMost {
+		idx = 0
+	}
+	if err := tx.insertCell(steps, node, idx, divider); err != nil {
+		return err
+	}
+	if err := tx.freePage(empty.Number); err != nil {
+		return err
+	}
+	if parent.CellCount() > 0 {
+		return nil
+	}
+	return tx.replaceWithOnlyChild(path)
+}
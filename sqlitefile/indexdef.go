@@ -0,0 +1,223 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A CREATE INDEX statement taken apart
+type IndexDefinition struct {
+	// names of the index and its table, dequoted but in their case
+	Name        string
+	Table       string
+	Unique      bool
+	IfNotExists bool
+	Columns     []IndexColumn
+	// the condition of a partial index as written after WHERE, empty
+	// when every row is indexed
+	Where string
+	// byte offsets in the statement of the index name, after any schema,
+	// of the table name and of the parenthesis opening the columns
+	nameStart    int
+	tableStart   int
+	tableEnd     int
+	columnsStart int
+}
+
+// Parses a CREATE INDEX statement, of the form
+//
+//	CREATE [UNIQUE] INDEX [IF NOT EXISTS] [schema.]name
+//	ON table (column [COLLATE name] [ASC|DESC], ...) [WHERE expr]
+//
+// where each indexed column may be an expression instead
+func ParseIndexDefinition(sql string) (*IndexDefinition, error) {
+	tokens := tokenizeSQL(sql)
+	for len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	invalid := errors.New("invalid CREATE INDEX statement")
+	d := &IndexDefinition{}
+	i := 0
+	keyword := func(words ...string) bool {
+		if i+len(words) > len(tokens) {
+			return false
+		}
+		for j, w := range words {
+			if !strings.EqualFold(tokens[i+j].Text, w) {
+				return false
+			}
+		}
+		i += len(words)
+		return true
+	}
+	// a name may be qualified with its schema, which is dropped
+	name := func() (sqlToken, bool) {
+		if i+2 < len(tokens) && tokens[i+1].Text == "." {
+			i += 2
+		}
+		if i >= len(tokens) || !tokens[i].IsIdentifier() {
+			return sqlToken{}, false
+		}
+		i++
+		return tokens[i-1], true
+	}
+	if !keyword("create") {
+		return nil, invalid
+	}
+	d.Unique = keyword("unique")
+	if !keyword("index") {
+		return nil, invalid
+	}
+	d.IfNotExists = keyword("if", "not", "exists")
+	index, ok := name()
+	if !ok || !keyword("on") {
+		return nil, invalid
+	}
+	table, ok := name()
+	if !ok || i >= len(tokens) || tokens[i].Text != "(" {
+		return nil, invalid
+	}
+	d.Name, d.Table = dequoteIdentifier(index.Text), dequoteIdentifier(table.Text)
+	d.nameStart, d.tableStart, d.tableEnd, d.columnsStart = index.Start, table.Start, table.End, tokens[i].Start
+	depth := tokens[i].Depth
+	i++
+	term := []sqlToken{}
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.Text == "," && t.Depth == depth+1 || t.Text == ")" && t.Depth == depth {
+			column, err := parseIndexTerm(sql, term)
+			if err != nil {
+				return nil, err
+			}
+			d.Columns = append(d.Columns, column)
+			term = term[:0]
+			if t.Text == ")" {
+				break
+			}
+			continue
+		}
+		term = append(term, t)
+	}
+	if i == len(tokens) {
+		return nil, invalid
+	}
+	i++
+	if keyword("where") {
+		if i == len(tokens) {
+			return nil, invalid
+		}
+		d.Where = strings.TrimSpace(sql[tokens[i].Start:tokens[len(tokens)-1].End])
+	} else if i < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q after the indexed columns", tokens[i].Text)
+	}
+	return d, nil
+}
+
+// Parses one indexed column: a column name or an expression, followed
+// by an optional collation and sort order
+func parseIndexTerm(sql string, term []sqlToken) (IndexColumn, error) {
+	column := IndexColumn{}
+	if n := len(term); n > 0 {
+		switch strings.ToLower(term[n-1].Text) {
+		case "desc":
+			column.Desc = true
+			term = term[:n-1]
+		case "asc":
+			term = term[:n-1]
+		}
+	}
+	if n := len(term); n > 2 && strings.EqualFold(term[n-2].Text, "collate") {
+		column.Collation = dequoteIdentifier(term[n-1].Text)
+		term = term[:n-2]
+	}
+	switch {
+	case len(term) == 0:
+		return column, errors.New("invalid index column list")
+	case len(term) == 1 && term[0].IsIdentifier():
+		column.Name = CleanKeyString(dequoteIdentifier(term[0].Text))
+	default:
+		column.Expr = sql[term[0].Start:term[len(term)-1].End]
+	}
+	return column, nil
+}
+
+// Refuses indexed columns that cannot be kept in sync with their
+// table: expressions and collations other than BINARY
+func (d *IndexDefinition) checkSupported() error {
+	for _, c := range d.Columns {
+		if c.Expr != "" {
+			return errors.New("indexes on expressions are not supported")
+		}
+	}
+	return d.checkCollations()
+}
+
+// Refuses collations other than BINARY, the only one keys are compared
+// with
+func (d *IndexDefinition) checkCollations() error {
+	for _, c := range d.Columns {
+		if c.Collation != "" && !strings.EqualFold(c.Collation, "binary") {
+			return errors.New("only the BINARY collation is supported")
+		}
+	}
+	return nil
+}
+
+// Whether every row matching the equality constraints of a query, as in
+// SelectCtx.Constraint, satisfies the condition of a partial index, so
+// the index holds all of them. The condition is only understood as terms
+// joined by AND, each either column = literal with the value the query
+// compares the column to, or column IS NOT NULL for a column the query
+// compares to a value. Anything else is taken as not implied.
+func impliesIndexCondition(constraint map[string]string, where string) bool {
+	if where == "" {
+		return true
+	}
+	tokens := tokenizeSQL(where)
+	term := []sqlToken{}
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && !(tokens[i].Depth == 0 && strings.EqualFold(tokens[i].Text, "and")) {
+			term = append(term, tokens[i])
+			continue
+		}
+		if !impliesIndexTerm(constraint, where, term) {
+			return false
+		}
+		term = term[:0]
+	}
+	return true
+}
+
+func impliesIndexTerm(constraint map[string]string, where string, term []sqlToken) bool {
+	for len(term) > 2 && term[0].Text == "(" && term[len(term)-1].Text == ")" && term[len(term)-1].Depth == term[0].Depth {
+		term = term[1 : len(term)-1]
+	}
+	if len(term) == 0 {
+		return false
+	}
+	if len(term) == 4 && term[0].IsIdentifier() &&
+		strings.EqualFold(term[1].Text, "is") && strings.EqualFold(term[2].Text, "not") && strings.EqualFold(term[3].Text, "null") {
+		v, ok := constraint[CleanKeyString(dequoteIdentifier(term[0].Text))]
+		return ok && v != "null"
+	}
+	if len(term) < 3 || term[1].Text != "=" {
+		return false
+	}
+	// = may be written ==
+	column, value := term[0], term[2:]
+	if value[0].Text == "=" {
+		value = value[1:]
+	}
+	if len(value) == 0 || !column.IsIdentifier() {
+		return false
+	}
+	for _, t := range value {
+		if t.IsIdentifier() {
+			return false
+		}
+	}
+	literal := CleanKeyString(where[value[0].Start:value[len(value)-1].End])
+	v, ok := constraint[CleanKeyString(dequoteIdentifier(column.Text))]
+	return ok && literal != "null" && v == literal
+}
@@ -0,0 +1,334 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// A join of two tables on a column of each being equal, where either
+// table can be one of the database or one added with RegisterTable:
+//
+//	SELECT ... FROM a [LEFT] JOIN b ON a.x = b.y
+//	SELECT ... FROM a [LEFT] JOIN b USING (x)
+//
+// The select list and the WHERE clause name the columns of either table
+// as table.column, or by their name alone where only one table has it.
+type joinClause struct {
+	left, right joinTable
+	// the join is a LEFT JOIN, keeping the left rows nothing matches
+	outer bool
+}
+
+type joinTable struct {
+	name string
+	// the name the query refers to the table by, its alias if it has one
+	alias string
+	// the column compared with the other table
+	on string
+}
+
+// Reads a FROM clause that joins two tables, or returns nil for any
+// other FROM clause
+func sqlFromToJoin(from sqlparser.TableExprs) (*joinClause, error) {
+	if len(from) != 1 {
+		return nil, nil
+	}
+	expr, ok := from[0].(*sqlparser.JoinTableExpr)
+	if !ok {
+		return nil, nil
+	}
+	if expr.Join != sqlparser.JoinStr && expr.Join != sqlparser.LeftJoinStr {
+		return nil, fmt.Errorf("unsupported join: %s, only JOIN and LEFT JOIN are", expr.Join)
+	}
+	j := &joinClause{outer: expr.Join == sqlparser.LeftJoinStr}
+	var err error
+	if j.left, err = sqlTableToJoinTable(expr.LeftExpr); err != nil {
+		return nil, err
+	}
+	if j.right, err = sqlTableToJoinTable(expr.RightExpr); err != nil {
+		return nil, err
+	}
+	if j.left.alias == j.right.alias {
+		return nil, fmt.Errorf("ambiguous table name: %s, give one of the tables an alias", j.left.alias)
+	}
+	if using := expr.Condition.Using; len(using) == 1 {
+		j.left.on = CleanKeyString(using[0].String())
+		j.right.on = j.left.on
+		return j, nil
+	}
+	on, ok := expr.Condition.On.(*sqlparser.ComparisonExpr)
+	if ok && on.Operator == sqlparser.EqualStr {
+		l, lok := on.Left.(*sqlparser.ColName)
+		r, rok := on.Right.(*sqlparser.ColName)
+		if lok && rok {
+			lq, rq := CleanKeyString(l.Qualifier.Name.String()), CleanKeyString(r.Qualifier.Name.String())
+			if lq == j.right.alias && rq == j.left.alias {
+				l, r = r, l
+				lq, rq = rq, lq
+			}
+			if lq == j.left.alias && rq == j.right.alias {
+				j.left.on, j.right.on = CleanKeyString(l.Name.String()), CleanKeyString(r.Name.String())
+				return j, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported join condition: %s, only ON a.x = b.y and USING (x) are",
+		strings.TrimSpace(sqlparser.String(expr.Condition)))
+}
+
+func sqlTableToJoinTable(expr sqlparser.TableExpr) (joinTable, error) {
+	aliased, ok := expr.(*sqlparser.AliasedTableExpr)
+	if ok {
+		if name, ok := aliased.Expr.(sqlparser.TableName); ok {
+			t := joinTable{name: CleanKeyString(name.Name.String())}
+			t.alias = t.name
+			if !aliased.As.IsEmpty() {
+				t.alias = CleanKeyString(aliased.As.String())
+			}
+			return t, nil
+		}
+	}
+	return joinTable{}, fmt.Errorf("unsupported join of %s, only two tables can be joined", sqlparser.String(expr))
+}
+
+// The columns of a table of the database or a registered one
+func (d *Database) tableColumns(name string) ([]string, error) {
+	if t, ok := d.virtualTables[name]; ok {
+		columns := []string{}
+		for _, c := range t.Columns() {
+			columns = append(columns, CleanKeyString(c))
+		}
+		return columns, nil
+	}
+	if schema, ok := d.tableSchema(name); ok {
+		return schema.ColumnNames(), nil
+	}
+	return nil, TableNotFoundError(name)
+}
+
+// Where each column of the result of a join comes from: the table, 0 for
+// the left and 1 for the right, and the column
+type joinColumn struct {
+	table  int
+	column string
+}
+
+// Finds the table and column of every name in the select list, with *
+// standing for the columns of both tables and table.* for those of one,
+// and of the constraints of the WHERE clause
+func (j *joinClause) resolve(d *Database, s SelectCtx) ([]joinColumn, map[string]joinColumn, error) {
+	tables := []joinTable{j.left, j.right}
+	columns := [2][]string{}
+	for i, t := range tables {
+		var err error
+		if columns[i], err = d.tableColumns(t.name); err != nil {
+			return nil, nil, err
+		}
+		if !slices.Contains(columns[i], t.on) {
+			return nil, nil, columnNotFoundError("no such column: %s.%s", t.alias, t.on)
+		}
+	}
+	column := func(name string) (joinColumn, error) {
+		if qualifier, col, ok := strings.Cut(name, "."); ok {
+			for i, t := range tables {
+				if t.alias == qualifier && slices.Contains(columns[i], col) {
+					return joinColumn{i, col}, nil
+				}
+			}
+			return joinColumn{}, columnNotFoundError("no such column: %s", name)
+		}
+		found := []joinColumn{}
+		for i := range tables {
+			if slices.Contains(columns[i], name) {
+				found = append(found, joinColumn{i, name})
+			}
+		}
+		switch {
+		case len(found) == 0:
+			return joinColumn{}, columnNotFoundError("no such column: %s", name)
+		// USING makes the column one, taken from the left table
+		case len(found) == 2 && name == j.left.on && name == j.right.on:
+			return found[0], nil
+		case len(found) == 2:
+			return joinColumn{}, fmt.Errorf("ambiguous column name: %s", name)
+		}
+		return found[0], nil
+	}
+	result := []joinColumn{}
+	for _, name := range s.Identifiers {
+		if s.IsCount {
+			break
+		}
+		if name == "*" || strings.HasSuffix(name, ".*") {
+			for i, t := range tables {
+				if name == "*" || name == t.alias+".*" {
+					for _, c := range columns[i] {
+						result = append(result, joinColumn{i, c})
+					}
+				}
+			}
+			continue
+		}
+		c, err := column(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, c)
+	}
+	where := map[string]joinColumn{}
+	for k := range s.Constraint {
+		c, err := column(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		where[k] = c
+	}
+	return result, where, nil
+}
+
+// Names of the columns of the result of a join
+func (d *Database) joinColumnNames(s SelectCtx) []string {
+	if s.IsCount {
+		return []string{CountIdent}
+	}
+	columns, _, err := s.join.resolve(d, s)
+	if err != nil {
+		return s.Identifiers
+	}
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.column
+	}
+	return names
+}
+
+// Runs a join by reading the right table into a hash table on its join
+// column and then looking up every row of the left table in it, so each
+// table is read once. The constraints of the WHERE clause are compared
+// by the query on the table whose column they name, which may use its
+// indexes. Rows come in the order of the left table.
+func selectJoin(d *Database, s SelectCtx, emit func(values []any) error) (int, error) {
+	j := s.join
+	if s.OrderBy != "" {
+		return 0, fmt.Errorf("cannot ORDER BY %s in a join", s.OrderBy)
+	}
+	columns, where, err := j.resolve(d, s)
+	if err != nil {
+		return 0, err
+	}
+	tables := []joinTable{j.left, j.right}
+	// each table is queried for its join column followed by the columns
+	// of the result it has
+	queries := [2]SelectCtx{}
+	positions := make([]int, len(columns))
+	for i, t := range tables {
+		queries[i] = SelectCtx{Tables: []string{t.name}, Identifiers: []string{t.on}, Constraint: map[string]string{}, equals: map[string]any{}}
+	}
+	for i, c := range columns {
+		queries[c.table].Identifiers = append(queries[c.table].Identifiers, c.column)
+		positions[i] = len(queries[c.table].Identifiers) - 1
+	}
+	for k, c := range where {
+		queries[c.table].Constraint[c.column] = s.Constraint[k]
+		queries[c.table].equals[c.column] = s.equals[k]
+	}
+	la, ra := joinAffinity(d, j.left), joinAffinity(d, j.right)
+	lconv, rconv := joinKeyAffinity(la, ra), joinKeyAffinity(ra, la)
+	matches := map[any][][]any{}
+	_, err = SelectTable(d, queries[1], j.right.name, func(values []any) error {
+		if key, ok := joinKey(applyColumnAffinity(rconv, values[0])); ok {
+			matches[key] = append(matches[key], values)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	output := func(left, right []any) error {
+		if s.Limit > 0 && count >= s.Limit {
+			return ErrStop
+		}
+		count++
+		if s.IsCount {
+			return nil
+		}
+		row := make([]any, len(columns))
+		for i, c := range columns {
+			switch {
+			case c.table == 0:
+				row[i] = left[positions[i]]
+			case right != nil:
+				row[i] = right[positions[i]]
+			}
+		}
+		return emit(row)
+	}
+	_, err = SelectTable(d, queries[0], j.left.name, func(values []any) error {
+		key, ok := joinKey(applyColumnAffinity(lconv, values[0]))
+		rows := matches[key]
+		if !ok {
+			rows = nil
+		}
+		for _, right := range rows {
+			if err := output(values, right); err != nil {
+				return err
+			}
+		}
+		// the NULLs of a missing right row match no constraint on them
+		if len(rows) == 0 && j.outer && len(queries[1].Constraint) == 0 {
+			return output(values, nil)
+		}
+		return nil
+	}, nil)
+	if errors.Is(err, ErrStop) {
+		err = nil
+	}
+	return count, err
+}
+
+// Affinity of the join column of a table, which registered tables do not
+// have and is reported as BLOB, the affinity that converts nothing
+func joinAffinity(d *Database, t joinTable) ColumnAffinity {
+	schema, ok := d.tableSchema(t.name)
+	if !ok {
+		return AffinityBlob
+	}
+	return schema.ColumnAffinity[schema.ColumnMap[t.on]]
+}
+
+// The affinity values of a join column are converted with before they
+// are compared with those of the other, as applyComparisonAffinity does
+// for a pair of values
+func joinKeyAffinity(own, other ColumnAffinity) ColumnAffinity {
+	switch {
+	case isNumericAffinity(other) && !isNumericAffinity(own):
+		return AffinityNumeric
+	case other == AffinityText && own == AffinityBlob:
+		return AffinityText
+	}
+	return AffinityBlob
+}
+
+// Blobs as hash keys, kept apart from text with the same bytes
+type blobKey string
+
+// A value as a key of the hash table of a join, where integers and reals
+// that are equal are the same key. NULL equals nothing and has no key.
+func joinKey(v any) (any, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, false
+	case float64:
+		if i := int64(v); float64(i) == v {
+			return i, true
+		}
+	case []byte:
+		return blobKey(v), true
+	}
+	return v, true
+}
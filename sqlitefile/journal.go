@@ -0,0 +1,181 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	JournalSuffix      = "-journal"
+	WalSuffix          = "-wal"
+	JournalHeaderMagic = "\xd9\xd5\x05\xf9\x20\xa1\x63\xd7"
+)
+
+// Describes the companion files found next to a database.
+//
+// A hot journal is a rollback journal left behind by a writer that
+// did not finish its transaction, meaning the database file may contain
+// partially written pages until the journal is rolled back.
+// If the journal belongs to a multi-database transaction,
+// SuperJournal holds the name of the super-journal it points to.
+//
+// The WAL is not a journal in this sense, its committed frames are
+// read through openWal.
+type journalState struct {
+	HotJournal   bool
+	SuperJournal string
+}
+
+func detectJournals(vfs VFS, databasePath string) (*journalState, error) {
+	js := &journalState{}
+	f, err := vfs.Open(databasePath + JournalSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return js, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(JournalHeaderMagic))
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		// empty or short journals are never hot
+		return js, nil
+	}
+	// journal_mode=PERSIST zeroes the header instead of deleting the file
+	if string(magic) != JournalHeaderMagic {
+		return js, nil
+	}
+	js.HotJournal = true
+	name, err := readSuperJournalName(f)
+	if err != nil {
+		return nil, err
+	}
+	js.SuperJournal = name
+	return js, nil
+}
+
+// A journal that is part of a multi-database transaction ends with
+// the super-journal record:
+//
+//	4 bytes locking page number, N bytes name, 4 bytes N,
+//	4 bytes checksum, 8 bytes journal magic
+func readSuperJournalName(f VFSFile) (string, error) {
+	size, err := f.Size()
+	if err != nil {
+		return "", err
+	}
+	const trailerSize = 16
+	if size < trailerSize+int64(len(JournalHeaderMagic)) {
+		return "", nil
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := f.ReadAt(trailer, size-trailerSize); err != nil {
+		return "", err
+	}
+	if !bytes.Equal(trailer[8:], []byte(JournalHeaderMagic)) {
+		return "", nil
+	}
+	nameLength := int64(binary.BigEndian.Uint32(trailer[:4]))
+	nameOffset := size - trailerSize - nameLength
+	if nameLength <= 0 || nameOffset < 0 {
+		return "", nil
+	}
+	name := make([]byte, nameLength)
+	if _, err := f.ReadAt(name, nameOffset); err != nil {
+		return "", err
+	}
+	return string(name), nil
+}
+
+// Surfaces the journal state of the database. A hot journal means
+// the file may be inconsistent, so an error is returned unless
+// ignoreJournal is set. A hot journal whose super-journal no longer
+// exists belongs to a committed transaction and is only reported.
+func checkJournals(vfs VFS, databasePath string, ignoreJournal bool, logger *slog.Logger) error {
+	js, err := detectJournals(vfs, databasePath)
+	if err != nil {
+		return err
+	}
+	if !js.HotJournal {
+		return nil
+	}
+	if js.SuperJournal != "" {
+		f, err := vfs.Open(js.SuperJournal)
+		if errors.Is(err, fs.ErrNotExist) {
+			logger.Warn("stale journal, its super-journal is gone",
+				"journal", databasePath+JournalSuffix, "super_journal", js.SuperJournal)
+			return nil
+		} else if err == nil {
+			f.Close()
+		}
+	}
+	msg := fmt.Sprintf("hot journal %s%s found, a write was interrupted or is in progress",
+		databasePath, JournalSuffix)
+	if js.SuperJournal != "" {
+		msg += fmt.Sprintf(" (super-journal %s)", js.SuperJournal)
+	}
+	if ignoreJournal {
+		logger.Warn(msg)
+		return nil
+	}
+	return errors.New(msg + ", pass -j to read anyway")
+}
+
+// Size of the journal header, sqlite pads it to the sector size
+const JournalSectorSize = 512
+
+// Writes a rollback journal in the format sqlite expects, holding the
+// original content of every page about to be overwritten. If the commit
+// is interrupted, sqlite finds the hot journal and restores the pages.
+//
+//	Header: magic, record count, checksum nonce, initial database size
+//	in pages, sector size and page size, padded to the sector size.
+//	Records: 4 byte page number, page data, 4 byte checksum.
+func writeRollbackJournal(path string, pageSize int, pageCount int64, pages map[int64][]byte) error {
+	pageNumbers := []int64{}
+	for n := range pages {
+		pageNumbers = append(pageNumbers, n)
+	}
+	sort.Slice(pageNumbers, func(i, j int) bool { return pageNumbers[i] < pageNumbers[j] })
+	nonce := uint32(time.Now().UnixNano())
+	buf := make([]byte, JournalSectorSize, JournalSectorSize+len(pages)*(pageSize+8))
+	copy(buf, JournalHeaderMagic)
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(pages)))
+	binary.BigEndian.PutUint32(buf[12:], nonce)
+	binary.BigEndian.PutUint32(buf[16:], uint32(pageCount))
+	binary.BigEndian.PutUint32(buf[20:], JournalSectorSize)
+	binary.BigEndian.PutUint32(buf[24:], uint32(pageSize))
+	for _, n := range pageNumbers {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+		buf = append(buf, pages[n]...)
+		buf = binary.BigEndian.AppendUint32(buf, journalChecksum(nonce, pages[n]))
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sqlite only samples every 200th byte of the page, starting from the end
+func journalChecksum(nonce uint32, data []byte) uint32 {
+	checksum := nonce
+	for i := len(data) - 200; i > 0; i -= 200 {
+		checksum += uint32(data[i])
+	}
+	return checksum
+}
@@ -0,0 +1,242 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Functions of the JSON1 extension that can be called in the select
+// list of a query, on a column and literal arguments
+// https://www.sqlite.org/json1.html
+var jsonFunctions = map[string]func(doc any, args []any) (any, error){
+	"json_extract":      jsonExtract,
+	"json_type":         jsonType,
+	"json_array_length": jsonArrayLength,
+}
+
+var errMalformedJSON = errors.New("malformed JSON")
+
+// json_extract(X, P1, P2, ...) returns the SQL value at the path, or a
+// JSON array of the values at each path when given more than one
+func jsonExtract(doc any, args []any) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("json_extract needs a path")
+	}
+	if len(args) == 1 {
+		raw, err := jsonLookup(doc, args[0])
+		if raw == nil || err != nil {
+			return nil, err
+		}
+		return jsonToSQL(raw)
+	}
+	if doc == nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, path := range args {
+		raw, err := jsonLookup(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if raw == nil {
+			raw = json.RawMessage("null")
+		}
+		if err := json.Compact(&buf, raw); err != nil {
+			return nil, errMalformedJSON
+		}
+	}
+	buf.WriteByte(']')
+	return buf.String(), nil
+}
+
+// json_type(X[, P]) returns the type of the value at the path: null,
+// true, false, integer, real, text, array or object
+func jsonType(doc any, args []any) (any, error) {
+	raw, err := jsonLookupOptional(doc, args)
+	if raw == nil || err != nil {
+		return nil, err
+	}
+	switch raw[0] {
+	case 'n':
+		return "null", nil
+	case 't':
+		return "true", nil
+	case 'f':
+		return "false", nil
+	case '"':
+		return "text", nil
+	case '[':
+		return "array", nil
+	case '{':
+		return "object", nil
+	}
+	if isJSONInteger(raw) {
+		return "integer", nil
+	}
+	return "real", nil
+}
+
+// json_array_length(X[, P]) returns the number of elements of the array
+// at the path, 0 when it is not an array
+func jsonArrayLength(doc any, args []any) (any, error) {
+	raw, err := jsonLookupOptional(doc, args)
+	if raw == nil || err != nil {
+		return nil, err
+	}
+	if raw[0] != '[' {
+		return int64(0), nil
+	}
+	var elements []json.RawMessage
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		return nil, errMalformedJSON
+	}
+	return int64(len(elements)), nil
+}
+
+func jsonLookupOptional(doc any, args []any) (json.RawMessage, error) {
+	if len(args) > 1 {
+		return nil, errors.New("too many arguments")
+	}
+	if len(args) == 0 {
+		return jsonLookup(doc, "$")
+	}
+	return jsonLookup(doc, args[0])
+}
+
+// Finds the value at a path such as $.a."b c"[2][#-1] in doc. Returns
+// nil when there is no such value and an error for a NULL or malformed
+// document.
+func jsonLookup(doc any, path any) (json.RawMessage, error) {
+	var raw json.RawMessage
+	switch v := doc.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		raw = json.RawMessage(v)
+	case []byte:
+		raw = json.RawMessage(v)
+	default:
+		raw = json.RawMessage(FormatValue(v))
+	}
+	raw = bytes.TrimSpace(raw)
+	if !json.Valid(raw) {
+		return nil, errMalformedJSON
+	}
+	p, ok := path.(string)
+	if !ok || !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("bad JSON path: %v", path)
+	}
+	for p = p[1:]; p != ""; {
+		switch {
+		case p[0] == '.':
+			key, rest, err := jsonPathKey(p[1:])
+			if err != nil {
+				return nil, fmt.Errorf("bad JSON path: %v", path)
+			}
+			var object map[string]json.RawMessage
+			if raw[0] != '{' || json.Unmarshal(raw, &object) != nil {
+				return nil, nil
+			}
+			if raw, ok = object[key]; !ok {
+				return nil, nil
+			}
+			p = rest
+		case p[0] == '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("bad JSON path: %v", path)
+			}
+			var elements []json.RawMessage
+			if raw[0] != '[' || json.Unmarshal(raw, &elements) != nil {
+				return nil, nil
+			}
+			index, fromEnd := p[1:end], false
+			if strings.HasPrefix(index, "#-") {
+				index, fromEnd = index[2:], true
+			}
+			n, err := strconv.Atoi(index)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("bad JSON path: %v", path)
+			}
+			if fromEnd {
+				n = len(elements) - n
+			}
+			if n < 0 || n >= len(elements) {
+				return nil, nil
+			}
+			raw = elements[n]
+			p = p[end+1:]
+		default:
+			return nil, fmt.Errorf("bad JSON path: %v", path)
+		}
+	}
+	return raw, nil
+}
+
+// Reads an object key from the start of a path, either quoted or up to
+// the next . or [
+func jsonPathKey(p string) (string, string, error) {
+	if strings.HasPrefix(p, "\"") {
+		end := strings.IndexByte(p[1:], '"')
+		if end < 0 {
+			return "", "", errors.New("unterminated key")
+		}
+		return p[1 : end+1], p[end+2:], nil
+	}
+	end := strings.IndexAny(p, ".[")
+	if end < 0 {
+		end = len(p)
+	}
+	if end == 0 {
+		return "", "", errors.New("empty key")
+	}
+	return p[:end], p[end:], nil
+}
+
+// Converts a JSON value to the SQL value json_extract returns: NULL,
+// 1 or 0 for true and false, an integer, a real, the text of a string,
+// and the minified JSON of arrays and objects
+func jsonToSQL(raw json.RawMessage) (any, error) {
+	switch raw[0] {
+	case 'n':
+		return nil, nil
+	case 't':
+		return int64(1), nil
+	case 'f':
+		return int64(0), nil
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errMalformedJSON
+		}
+		return s, nil
+	case '[', '{':
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, raw); err != nil {
+			return nil, errMalformedJSON
+		}
+		return buf.String(), nil
+	}
+	if isJSONInteger(raw) {
+		if i, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return nil, errMalformedJSON
+	}
+	return f, nil
+}
+
+func isJSONInteger(raw json.RawMessage) bool {
+	return !bytes.ContainsAny(raw, ".eE")
+}
@@ -0,0 +1,137 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Creates a database with table t(id INTEGER PRIMARY KEY, data BLOB) and
+// grows it to pageCount pages with a hole, so the pages written next get
+// large numbers without writing the ones before them
+func sparseDatabase(t *testing.T, pageSize int, pageCount int64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sparse.db")
+	if err := Create(path, pageSize); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE t(id INTEGER PRIMARY KEY, data BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := os.Truncate(path, pageCount*int64(pageSize)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header := make([]byte, 100)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint32(header[DatabaseSizeOffset:], uint32(pageCount))
+	if _, err := f.WriteAt(header, 0); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSparseDatabase(t *testing.T) {
+	cases := []struct {
+		name     string
+		pageSize int
+		// pages in the file before the row is inserted
+		pageCount int64
+	}{
+		// the overflow chain runs across the page of the pending byte
+		{"lock byte page 4KiB", 4096, PendingByteOffset/4096 - 2},
+		{"lock byte page 64KiB", 65536, PendingByteOffset/65536 - 1},
+		// offsets past 4GB, which 32 bits do not hold
+		{"past 4GB", 65536, 70000},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := sparseDatabase(t, c.pageSize, c.pageCount)
+			db, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if n, err := db.PageCount(); err != nil || n != c.pageCount {
+				t.Fatalf("PageCount() = %d, %v, want %d", n, err, c.pageCount)
+			}
+			data := make([]byte, 4*c.pageSize)
+			for i := range data {
+				data[i] = byte(i * 7)
+			}
+			if err := db.Exec("INSERT INTO t(data) VALUES (x'" + hexString(data) + "')"); err != nil {
+				t.Fatal(err)
+			}
+
+			lockPage := PendingByteOffset/int64(c.pageSize) + 1
+			uses, err := MapPages(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			overflow := []int64{}
+			for n, use := range uses {
+				if use.Kind == PageOverflow {
+					overflow = append(overflow, n)
+				}
+				if n == lockPage && use.Kind != PageLockByte {
+					t.Errorf("the lock byte page %d is used as %s", n, use.Kind)
+				}
+			}
+			if len(overflow) == 0 {
+				t.Fatal("the row has no overflow pages")
+			}
+			for _, n := range overflow {
+				if n <= c.pageCount {
+					t.Errorf("overflow page %d is not past the %d pages the file had", n, c.pageCount)
+				}
+				if got, want := PageNumberToOffset(int64(c.pageSize), n), (n-1)*int64(c.pageSize); got != want {
+					t.Errorf("PageNumberToOffset(%d, %d) = %d, want %d", c.pageSize, n, got, want)
+				}
+				p, err := ReadRawPage(db, n)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.Number != n || int64(len(p.Data)) != int64(c.pageSize) {
+					t.Errorf("ReadRawPage(%d) read page %d of %d bytes", n, p.Number, len(p.Data))
+				}
+			}
+
+			rows, err := db.Query("SELECT data FROM t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []byte
+			if !rows.Next() {
+				t.Fatalf("no row: %v", rows.Err())
+			}
+			if err := rows.Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("read %d bytes back, not the %d written", len(got), len(data))
+			}
+		})
+	}
+}
+
+func hexString(b []byte) string {
+	const digits = "0123456789abcdef"
+	s := make([]byte, 2*len(b))
+	for i, c := range b {
+		s[2*i], s[2*i+1] = digits[c>>4], digits[c&0xf]
+	}
+	return string(s)
+}
@@ -0,0 +1,36 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package sqlitefile
+
+import (
+	"errors"
+	"os"
+)
+
+func acquireSharedLock(f *os.File) error {
+	return errors.New("shared lock mode is not supported on this platform")
+}
+
+func releaseSharedLock(f *os.File) error {
+	return nil
+}
+
+func acquireReservedLock(f *os.File) error {
+	return errors.New("writing is not supported on this platform")
+}
+
+func acquireExclusiveLock(f *os.File) error {
+	return errors.New("writing is not supported on this platform")
+}
+
+func releaseWriteLock(f *os.File) error {
+	return nil
+}
+
+func acquireWalWriteLock(databasePath string) (*os.File, error) {
+	return nil, errors.New("writing is not supported on this platform")
+}
+
+func releaseWalWriteLock(shm *os.File) error {
+	return nil
+}
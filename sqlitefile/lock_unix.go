@@ -0,0 +1,141 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package sqlitefile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Byte ranges used by SQLite's unix VFS for POSIX advisory locks.
+// They live at the 1GB mark of the file and are never read or written.
+// https://www.sqlite.org/lockingv3.html
+const (
+	PendingByte     = 0x40000000
+	ReservedByte    = PendingByte + 1
+	SharedFirstByte = PendingByte + 2
+	SharedSize      = 510
+	lockRetries     = 50
+	lockRetryDelay  = 10 * time.Millisecond
+)
+
+func fcntlLock(f *os.File, lockType int16, start int64, length int64) error {
+	lk := syscall.Flock_t{
+		Type:   lockType,
+		Whence: io.SeekStart,
+		Start:  start,
+		Len:    length,
+	}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+}
+
+// Acquires a SHARED lock the same way SQLite does: a read lock is taken
+// on the pending byte, which fails while a writer is waiting for or holds
+// an exclusive lock, then on the shared range, after which the pending
+// byte is released again. Busy locks are retried for a short while.
+func acquireSharedLock(f *os.File) error {
+	var err error
+	for i := 0; i < lockRetries; i++ {
+		if err = fcntlLock(f, syscall.F_RDLCK, PendingByte, 1); err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EAGAIN) && !errors.Is(err, syscall.EACCES) {
+			return err
+		}
+		time.Sleep(lockRetryDelay)
+	}
+	if err != nil {
+		return errors.New("database is locked")
+	}
+	err = fcntlLock(f, syscall.F_RDLCK, SharedFirstByte, SharedSize)
+	if unlockErr := fcntlLock(f, syscall.F_UNLCK, PendingByte, 1); unlockErr != nil && err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+func releaseSharedLock(f *os.File) error {
+	return fcntlLock(f, syscall.F_UNLCK, SharedFirstByte, SharedSize)
+}
+
+// Escalates a SHARED lock to RESERVED, signalling the intent to write.
+// Only one connection can hold RESERVED at a time, readers are unaffected.
+func acquireReservedLock(f *os.File) error {
+	if err := fcntlLock(f, syscall.F_WRLCK, ReservedByte, 1); err != nil {
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES) {
+			return errors.New("database is locked")
+		}
+		return err
+	}
+	return nil
+}
+
+// Escalates a RESERVED lock to EXCLUSIVE. The pending byte is taken first
+// so no new readers can start, then the shared range is upgraded once
+// all existing readers have released their shared locks.
+func acquireExclusiveLock(f *os.File) error {
+	if err := fcntlLock(f, syscall.F_WRLCK, PendingByte, 1); err != nil {
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES) {
+			return errors.New("database is locked")
+		}
+		return err
+	}
+	var err error
+	for i := 0; i < lockRetries; i++ {
+		if err = fcntlLock(f, syscall.F_WRLCK, SharedFirstByte, SharedSize); err == nil {
+			return nil
+		}
+		if !errors.Is(err, syscall.EAGAIN) && !errors.Is(err, syscall.EACCES) {
+			return err
+		}
+		time.Sleep(lockRetryDelay)
+	}
+	return errors.New("database is locked")
+}
+
+// Drops a RESERVED or EXCLUSIVE lock back down to SHARED
+func releaseWriteLock(f *os.File) error {
+	if err := fcntlLock(f, syscall.F_RDLCK, SharedFirstByte, SharedSize); err != nil {
+		return err
+	}
+	return fcntlLock(f, syscall.F_UNLCK, PendingByte, 2)
+}
+
+// Offset of the lock bytes in the shm file of a WAL database. The
+// first byte is the WAL write lock, held by the single WAL writer.
+const WalIndexLockOffset = 120
+
+// Opens the shm file of a WAL database, if present, and takes the WAL
+// write lock on it. A nil file is returned when no connection has the
+// database open in WAL mode.
+func acquireWalWriteLock(databasePath string) (*os.File, error) {
+	shm, err := os.OpenFile(databasePath+WalIndexSuffix, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i := 0; i < lockRetries; i++ {
+		if err = fcntlLock(shm, syscall.F_WRLCK, WalIndexLockOffset, 1); err == nil {
+			return shm, nil
+		}
+		if !errors.Is(err, syscall.EAGAIN) && !errors.Is(err, syscall.EACCES) {
+			shm.Close()
+			return nil, err
+		}
+		time.Sleep(lockRetryDelay)
+	}
+	shm.Close()
+	return nil, errors.New("database is locked")
+}
+
+func releaseWalWriteLock(shm *os.File) error {
+	if shm == nil {
+		return nil
+	}
+	defer shm.Close()
+	return fcntlLock(shm, syscall.F_UNLCK, WalIndexLockOffset, 1)
+}
@@ -0,0 +1,10 @@
+package sqlitefile
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Diagnostics such as schema cells that fail to parse are dropped
+// unless a logger is given with WithLogger
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
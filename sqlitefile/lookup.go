@@ -0,0 +1,143 @@
+package sqlitefile
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// How an indexed expression is named among the constraints of a query,
+// the way the expression is written out by the parser
+func exprKey(e sqlparser.Expr) string {
+	return CleanKeyString(sqlparser.String(e))
+}
+
+// The key that looks up the leading index columns the constraints give
+// a value for, converting values with the affinity of their column as
+// sqlite does. Expressions have no affinity and are looked up with
+// the value as written.
+func (ix *tableIndex) lookupKey(schema *Record, equals map[string]any) []any {
+	key := []any{}
+	for i, col := range ix.Columns {
+		v, ok := equals[ix.terms[i]]
+		if !ok || v == nil || (col < 0 && ix.Exprs[i] == nil) {
+			break
+		}
+		if ix.Exprs[i] == nil {
+			v = applyColumnAffinity(schema.ColumnAffinity[col], v)
+		}
+		key = append(key, v)
+	}
+	return key
+}
+
+// Whether every row the constraints of a query match is in the index,
+// which leaves out only the rows of a partial index whose condition the
+// constraints do not imply
+func (ix *tableIndex) serves(constraint map[string]string) bool {
+	return impliesIndexCondition(constraint, ix.Where)
+}
+
+// Runs the query through an index when all of its constraints are
+// equalities an index can look up, reading only the rows the index
+// lists for them. Returns false when no index serves the query, which
+// is then scanned. Values are looked up as sqlite compares them, the
+// way a scan compares them too.
+func selectByIndex(d *Database, q *queryContext, root int64) (bool, error) {
+	rowids, ok, err := indexedRowids(d, q)
+	if !ok || err != nil {
+		return ok, err
+	}
+	rows := &Cursor{db: d, schema: q.rootCell, root: root}
+	for _, rowid := range rowids {
+		if q.query.Limit > 0 && q.count >= q.query.Limit {
+			break
+		}
+		if err := readIndexedRow(rows, rowid, q); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Rowids of the rows an index lists for the constraints of the query,
+// in the order the query reads them, marking the constraints the index
+// compared as served. Returns false when no index serves the query.
+func indexedRowids(d *Database, q *queryContext) ([]int64, bool, error) {
+	// the indexes of a WITHOUT ROWID table list primary keys, not rowids
+	if len(q.query.Constraint) == 0 || q.rootCell.WithoutRowid {
+		return nil, false, nil
+	}
+	for k := range q.query.Constraint {
+		if _, ok := q.query.equals[k]; !ok {
+			return nil, false, nil
+		}
+	}
+	// indexes that cannot be read, such as those with other collations
+	// than BINARY, leave the query to a scan
+	indexes, err := loadTableIndexes(d, q.tableName, q.rootCell)
+	if err != nil {
+		return nil, false, nil
+	}
+	var best *tableIndex
+	var key []any
+	for _, ix := range indexes {
+		if !ix.serves(q.query.Constraint) {
+			continue
+		}
+		if k := ix.lookupKey(q.rootCell, q.query.equals); len(k) > len(key) {
+			best, key = ix, k
+		}
+	}
+	if best == nil {
+		return nil, false, nil
+	}
+	span := d.startSpan("select.index", "table", q.tableName, "index", best.Name)
+	rowids, err := indexRowids(d, q.rootCell, best, key)
+	span.End(err)
+	if err != nil {
+		return nil, true, err
+	}
+	slices.Sort(rowids)
+	if q.query.Descending {
+		slices.Reverse(rowids)
+	}
+	// the looked up terms are compared by the index, the rest by the row
+	q.served = map[string]bool{}
+	for _, term := range best.terms[:len(key)] {
+		q.served[term] = true
+	}
+	return rowids, true, nil
+}
+
+// Reads a row an index lists and passes it to the query
+func readIndexedRow(rows *Cursor, rowid int64, q *queryContext) error {
+	found, err := rows.SeekRowid(rowid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("an index of table %s lists row %d, which the table does not have", q.tableName, rowid)
+	}
+	c, err := rows.currentRecord()
+	if err != nil {
+		return err
+	}
+	return handleQueryRow(c, q)
+}
+
+// Rowids of the index entries that start with key
+func indexRowids(d *Database, table *Record, ix *tableIndex, key []any) ([]int64, error) {
+	c := &IndexCursor{db: d, table: table, index: ix}
+	rowids := []int64{}
+	ok, err := c.SeekGE(key...)
+	for ; ok && err == nil; ok, err = c.Next() {
+		entry, rowid := c.Entry()
+		if c.compare(entry, key) != 0 {
+			break
+		}
+		rowids = append(rowids, rowid)
+	}
+	return rowids, err
+}
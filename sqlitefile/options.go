@@ -0,0 +1,133 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Returned when writing to a database opened with WithReadOnly or
+// WithoutWal
+var ErrReadOnly = errors.New("database is opened read-only")
+
+// Configures how Open reads a database
+type Option func(*options) error
+
+type options struct {
+	sharedLock    bool
+	ignoreJournal bool
+	readOnly      bool
+	ignoreWal     bool
+	pageCache     int
+	readAhead     int
+	textEncoding  uint32
+	logger        *slog.Logger
+	hooks         []StatsHook
+	tracer        Tracer
+	decrypter     PageDecrypter
+	vfs           VFS
+}
+
+// Holds a shared lock on the database while it is open, so sqlite
+// connections cannot commit to it
+func WithSharedLock() Option {
+	return func(o *options) error {
+		o.sharedLock = true
+		return nil
+	}
+}
+
+// Reads the database even when a hot journal needs to be rolled back,
+// which may show a half written transaction
+func WithIgnoreJournal() Option {
+	return func(o *options) error {
+		o.ignoreJournal = true
+		return nil
+	}
+}
+
+// Refuses every write with ErrReadOnly
+func WithReadOnly() Option {
+	return func(o *options) error {
+		o.readOnly = true
+		return nil
+	}
+}
+
+// Reads the database file alone, leaving out the transactions committed
+// to the WAL since its last checkpoint. Writes are refused as they would
+// be based on an old version of the database.
+func WithoutWal() Option {
+	return func(o *options) error {
+		o.ignoreWal = true
+		o.readOnly = true
+		return nil
+	}
+}
+
+// Keeps up to pages recently read pages in memory. The cache is dropped
+// whenever the database is reloaded, as after a write.
+func WithPageCache(pages int) Option {
+	return func(o *options) error {
+		if pages < 0 {
+			return fmt.Errorf("invalid page cache size: %d", pages)
+		}
+		o.pageCache = pages
+		return nil
+	}
+}
+
+// Reads up to pages leaf pages ahead of a table scan in the background,
+// which helps most when pages come over the network through WithVFS.
+// The VFS file must then allow concurrent reads.
+func WithReadAhead(pages int) Option {
+	return func(o *options) error {
+		if pages < 0 {
+			return fmt.Errorf("invalid read-ahead size: %d", pages)
+		}
+		o.readAhead = pages
+		return nil
+	}
+}
+
+// Decodes text as the given encoding, one of TextEncodingUTF8,
+// TextEncodingUTF16LE and TextEncodingUTF16BE, instead of the one in
+// the database header
+func WithTextEncoding(encoding uint32) Option {
+	return func(o *options) error {
+		if encoding < TextEncodingUTF8 || encoding > TextEncodingUTF16BE {
+			return fmt.Errorf("invalid text encoding: %d", encoding)
+		}
+		o.textEncoding = encoding
+		return nil
+	}
+}
+
+// Sends the diagnostics about the database, such as schema cells that
+// fail to parse or stale journals, to l. They are dropped by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) error {
+		if l == nil {
+			l = discardLogger
+		}
+		o.logger = l
+		return nil
+	}
+}
+
+// Passes the events counted in Stats on to h as well. The option can be
+// given more than once to add several hooks.
+func WithStatsHook(h StatsHook) Option {
+	return func(o *options) error {
+		o.hooks = append(o.hooks, h)
+		return nil
+	}
+}
+
+// Traces statements, b-tree seeks and page reads with t
+func WithTracer(t Tracer) Option {
+	return func(o *options) error {
+		o.tracer = t
+		return nil
+	}
+}
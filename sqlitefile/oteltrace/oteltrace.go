@@ -0,0 +1,90 @@
+// Package oteltrace reports the spans of a sqlitefile.Database to
+// OpenTelemetry:
+//
+//	db, err := sqlitefile.Open(path, sqlitefile.WithTracer(oteltrace.New(ctx, otel.Tracer("sqlitefile"))))
+//
+// Statements, b-tree seeks and page reads become spans of their own,
+// each a child of the span that was open when it started, under the
+// span of ctx. A page read of a remote database, an HTTP range request,
+// thus shows up below the seek and the statement that needed it.
+package oteltrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A sqlitefile.Tracer starting OpenTelemetry spans
+type Tracer struct {
+	tracer trace.Tracer
+	mu     sync.Mutex
+	// the context of the open spans, innermost last, below that of the
+	// span New was given
+	stack []context.Context
+}
+
+// Creates a tracer whose spans are children of the span of ctx, if any
+func New(ctx context.Context, t trace.Tracer) *Tracer {
+	return &Tracer{tracer: t, stack: []context.Context{ctx}}
+}
+
+type span struct {
+	t     *Tracer
+	span  trace.Span
+	depth int
+}
+
+func (t *Tracer) Start(name string, attrs ...any) sqlitefile.Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ctx, s := t.tracer.Start(t.stack[len(t.stack)-1], name, trace.WithAttributes(attributes(attrs)...))
+	t.stack = append(t.stack, ctx)
+	return &span{t: t, span: s, depth: len(t.stack) - 1}
+}
+
+// Ends the span, recording err unless it only stopped the work early,
+// and closes any span started under it that was left open
+func (s *span) End(err error) {
+	if err != nil && !errors.Is(err, sqlitefile.ErrStop) && !errors.Is(err, io.EOF) {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	if s.depth < len(s.t.stack) {
+		s.t.stack = s.t.stack[:s.depth]
+	}
+}
+
+// Converts alternating keys and values to attributes, values of other
+// types than those OpenTelemetry has as text
+func attributes(attrs []any) []attribute.KeyValue {
+	kv := make([]attribute.KeyValue, 0, len(attrs)/2)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		key := fmt.Sprint(attrs[i])
+		switch v := attrs[i+1].(type) {
+		case string:
+			kv = append(kv, attribute.String(key, v))
+		case int:
+			kv = append(kv, attribute.Int(key, v))
+		case int64:
+			kv = append(kv, attribute.Int64(key, v))
+		case float64:
+			kv = append(kv, attribute.Float64(key, v))
+		case bool:
+			kv = append(kv, attribute.Bool(key, v))
+		default:
+			kv = append(kv, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+	return kv
+}
@@ -0,0 +1,99 @@
+package oteltrace
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "t.db")
+	if err := sqlitefile.Create(path, 4096); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlitefile.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{"CREATE TABLE t(a, b)", "INSERT INTO t VALUES (1, 'one')", "INSERT INTO t VALUES (2, 'two')"} {
+		if err := db.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, root := provider.Tracer("test").Start(context.Background(), "root")
+	db, err = sqlitefile.Open(path, sqlitefile.WithTracer(New(ctx, provider.Tracer("sqlitefile"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT b FROM t WHERE a = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Query("SELECT b FROM nope"); err == nil {
+		t.Fatal("queried a missing table")
+	}
+	root.End()
+
+	spans := recorder.Ended()
+	byID := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range spans {
+		byID[s.SpanContext().SpanID().String()] = s
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s is not in the trace of the root span", s.Name())
+		}
+	}
+	parent := func(s sdktrace.ReadOnlySpan) string {
+		if p, ok := byID[s.Parent().SpanID().String()]; ok {
+			return p.Name()
+		}
+		return ""
+	}
+	selects, reads := 0, 0
+	for _, s := range spans {
+		switch s.Name() {
+		case "select":
+			selects++
+			if parent(s) != "root" {
+				t.Errorf("select is under %q, not root", parent(s))
+			}
+			if attrs := s.Attributes(); len(attrs) != 1 || attrs[0].Key != "table" || attrs[0].Value.AsString() != "t" {
+				t.Errorf("select has attributes %v", attrs)
+			}
+		case "page.read":
+			// pages the query reads are below its span, those read when
+			// the database was opened below the root
+			if p := parent(s); p == "select" {
+				reads++
+			} else if p != "root" {
+				t.Errorf("page.read is under %q", p)
+			}
+		}
+	}
+	if selects != 1 || reads == 0 {
+		t.Fatalf("%d select spans with %d page reads below them", selects, reads)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	kv := attributes([]any{"table", "t", "root", int64(2), "length", 4096, "odd"})
+	if len(kv) != 3 {
+		t.Fatalf("%d attributes, want 3", len(kv))
+	}
+	if kv[0].Value.AsString() != "t" || kv[1].Value.AsInt64() != 2 || kv[2].Value.AsInt64() != 4096 {
+		t.Errorf("attributes = %v", kv)
+	}
+}
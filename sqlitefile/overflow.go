@@ -0,0 +1,38 @@
+package sqlitefile
+
+import "encoding/binary"
+
+// Builds a cell from its header, everything before the payload, and the
+// payload. When the payload exceeds the local limit only its prefix is
+// kept in the cell, followed by a placeholder for the first overflow page
+// number, and the remainder is returned to be written by writeOverflow.
+func (tx *writeTxn) payloadCell(header []byte, payload []byte, isTable bool) ([]byte, []byte) {
+	local := localPayloadSize(len(payload), tx.usableSize, isTable)
+	cell := append(append([]byte{}, header...), payload[:local]...)
+	if local == len(payload) {
+		return cell, nil
+	}
+	return append(cell, 0, 0, 0, 0), payload[local:]
+}
+
+// Stores data on a chain of newly allocated overflow pages, each holding
+// the next page number followed by up to usable size - 4 bytes, and
+// points the cell at the first page of the chain.
+func (tx *writeTxn) writeOverflow(cell []byte, data []byte) error {
+	var prev *RawPage
+	for len(data) > 0 {
+		p, err := tx.allocatePage()
+		if err != nil {
+			return err
+		}
+		n := copy(p.Data[4:tx.usableSize], data)
+		data = data[n:]
+		if prev == nil {
+			binary.BigEndian.PutUint32(cell[len(cell)-4:], uint32(p.Number))
+		} else {
+			binary.BigEndian.PutUint32(prev.Data, uint32(p.Number))
+		}
+		prev = p
+	}
+	return nil
+}
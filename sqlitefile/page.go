@@ -0,0 +1,161 @@
+package sqlitefile
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	DefaultPageHeaderSize    = 8
+	InteriorPageHeaderOffset = 4
+	InteriorIndexType        = 2
+	InteriorTableType        = 5
+	LeafIndexType            = 10
+	LeafTableType            = 13
+)
+
+type PageHeader struct {
+	PageType            uint8  `json:"page_type"`
+	FirstFreeBlock      uint16 `json:"first_free_block"`
+	CellCount           uint16 `json:"cell_count"`
+	CellContent         uint16 `json:"cell_content"`
+	FragmentedFreeBytes uint8  `json:"fragmented_free_bytes"`
+	RightMostPointer    uint32 `json:"right_most_pointer"`
+}
+
+func newPageHeader(f io.ReadSeeker, offset int64) (*PageHeader, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, DefaultPageHeaderSize)
+	if _, err := f.Read(buf); err != nil {
+		return nil, err
+	}
+	p := PageHeader{}
+	if err := readBigEndianInt(buf[:1], &p.PageType); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(buf[1:3], &p.FirstFreeBlock); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(buf[3:5], &p.CellCount); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(buf[5:7], &p.CellContent); err != nil {
+		return nil, err
+	}
+	if err := readBigEndianInt(buf[7:8], &p.FragmentedFreeBytes); err != nil {
+		return nil, err
+	}
+	if p.PageType == InteriorTableType {
+		extBuf := make([]byte, InteriorPageHeaderOffset)
+		if _, err := f.Read(extBuf); err != nil {
+			return nil, err
+		}
+		if err := readBigEndianInt(extBuf, &p.RightMostPointer); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+func (p *PageHeader) String() string {
+	var w fieldWriter
+	w.uint("PageType", uint64(p.PageType))
+	w.uint("FirstFreeBlock", uint64(p.FirstFreeBlock))
+	w.uint("CellCount", uint64(p.CellCount))
+	w.uint("CellContent", uint64(p.CellContent))
+	w.uint("FragmentedFreeBytes", uint64(p.FragmentedFreeBytes))
+	w.uint("RightMostPointer", uint64(p.RightMostPointer))
+	return w.String()
+}
+
+type Page struct {
+	// offset of the b-tree header in the file
+	Offset        int64
+	PageSize      int64
+	ReservedSpace uint8
+	Header        *PageHeader
+	Cells         []*Record
+	// encoding the text in the cells is decoded with
+	TextEncoding uint32
+	number       int64
+}
+
+// Offset of the b-tree header within a page, which on page 1 follows
+// the database header
+func pageHeaderOffset(pageNumber int64) int64 {
+	if pageNumber == 1 {
+		return DatabaseHeaderSize
+	}
+	return 0
+}
+
+func newPage(f io.ReadSeeker, number int64, pageSize int64, reservedSpace uint8, encoding uint32) (*Page, error) {
+	offset := PageNumberToOffset(pageSize, number) + pageHeaderOffset(number)
+	header, err := newPageHeader(f, offset)
+	if err != nil {
+		return nil, err
+	}
+	p := Page{Header: header, PageSize: pageSize, ReservedSpace: reservedSpace, Offset: offset, TextEncoding: encoding, number: number}
+	cellPtrBuf := make([]byte, p.Header.CellCount*2)
+	if _, err := f.Read(cellPtrBuf); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(p.Header.CellCount); i++ {
+		var cellPtr uint16
+		if err := readBigEndianInt(cellPtrBuf[i*2:i*2+2], &cellPtr); err != nil {
+			return nil, err
+		}
+		c, err := newCell(f, &p, int64(cellPtr))
+		if err != nil {
+			var corrupt *ErrCorruptPage
+			if errors.As(err, &corrupt) && corrupt.Cell < 0 {
+				corrupt.Cell = i
+			}
+			return nil, err
+		}
+		p.Cells = append(p.Cells, c)
+	}
+	return &p, nil
+}
+
+func NewPageFromNumber(d *Database, pageNumber int64) (*Page, error) {
+	d.pageRead(pageNumber)
+	p, err := newPage(d.Reader, pageNumber, d.Header.PageSizeBytes(), d.Header.ReservedPageSpace, d.TextEncoding)
+	if err != nil {
+		return nil, err
+	}
+	d.cellsDecoded(pageNumber, len(p.Cells))
+	return p, nil
+}
+
+// Offset of the start of the page, which cell pointers are relative to.
+// On page 1 it is the start of the database header.
+func (p *Page) Start() int64 {
+	return PageNumberToOffset(p.PageSize, p.number)
+}
+
+// Number of the page in the database file
+func (p *Page) Number() int64 {
+	return p.number
+}
+
+func (p *Page) Usable() int {
+	return int(p.PageSize) - int(p.ReservedSpace)
+}
+
+func (p *Page) String() string {
+	var w fieldWriter
+	w.int("Page Offset", p.Offset)
+	w.WriteString(p.Header.String())
+	w.WriteByte('\n')
+	for i, c := range p.Cells {
+		w.int("Cell", int64(i+1))
+		w.WriteString(c.String())
+		w.WriteByte('\n')
+	}
+	return w.String()
+}
+
+// 7569408
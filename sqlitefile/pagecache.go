@@ -0,0 +1,79 @@
+package sqlitefile
+
+import "container/list"
+
+// Keeps the most recently read pages in memory, as read through the
+// WAL, dropping the least recently used page once it is full
+type pageCache struct {
+	size  int
+	pages map[int64]*list.Element
+	lru   *list.List
+}
+
+type cachedPage struct {
+	number int64
+	data   []byte
+}
+
+// Returns nil, which caches nothing, for a size of 0
+func newPageCache(size int) *pageCache {
+	if size <= 0 {
+		return nil
+	}
+	return &pageCache{size: size, pages: map[int64]*list.Element{}, lru: list.New()}
+}
+
+// Reads through the cache, loading the pages buf covers that are not
+// in it yet. Reads that end up short, past the end of the database,
+// go to the reader without being cached.
+func (c *pageCache) ReadAt(r *PageReader, buf []byte, offset int64) (int, error) {
+	pageSize := r.db.Header.PageSizeBytes()
+	read := 0
+	for read < len(buf) {
+		number := offset/pageSize + 1
+		data, err := c.page(r, number, pageSize)
+		if err != nil {
+			return read, err
+		}
+		if data == nil {
+			n, err := r.readThrough(buf[read:], offset)
+			return read + n, err
+		}
+		n := copy(buf[read:], data[offset%pageSize:])
+		read += n
+		offset += int64(n)
+	}
+	return read, nil
+}
+
+func (c *pageCache) page(r *PageReader, number, pageSize int64) ([]byte, error) {
+	if e, ok := c.pages[number]; ok {
+		c.lru.MoveToFront(e)
+		r.db.cacheLookup(number, true)
+		return e.Value.(*cachedPage).data, nil
+	}
+	r.db.cacheLookup(number, false)
+	data := make([]byte, pageSize)
+	n, err := r.readThrough(data, (number-1)*pageSize)
+	if n < len(data) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c.pages[number] = c.lru.PushFront(&cachedPage{number, data})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.pages, oldest.Value.(*cachedPage).number)
+	}
+	return data, nil
+}
+
+// Drops every cached page
+func (c *pageCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.pages = map[int64]*list.Element{}
+	c.lru.Init()
+}
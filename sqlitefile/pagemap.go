@@ -0,0 +1,153 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// What a page of the database file is used for
+type PageKind int
+
+const (
+	PageUnused PageKind = iota
+	PageBtree
+	PageOverflow
+	PageFreelistTrunk
+	PageFreelistLeaf
+	PagePtrmap
+	PageLockByte
+)
+
+func (k PageKind) String() string {
+	switch k {
+	case PageBtree:
+		return "b-tree"
+	case PageOverflow:
+		return "overflow"
+	case PageFreelistTrunk:
+		return "freelist trunk"
+	case PageFreelistLeaf:
+		return "freelist leaf"
+	case PagePtrmap:
+		return "pointer map"
+	case PageLockByte:
+		return "lock-byte"
+	}
+	return "unused"
+}
+
+// The use of a page, the b-tree it belongs to and the page
+// pointing to it, which is 0 for roots and the first trunk
+type PageUse struct {
+	Kind   PageKind
+	Owner  string
+	Parent int64
+}
+
+// Offset of the byte range sqlite locks, which lies on a page
+// that is never used once a database grows past 1GB
+const PendingByteOffset = 1 << 30
+
+// Works out the use of every page by following the freelist and
+// every b-tree with its overflow chains from the roots in sqlite_schema.
+// Pages reached twice are reported as an error.
+func MapPages(db *Database) (map[int64]PageUse, error) {
+	pageCount, err := db.PageCount()
+	if err != nil {
+		return nil, err
+	}
+	uses := map[int64]PageUse{}
+	mark := func(n int64, use PageUse) error {
+		if n < 1 || n > pageCount {
+			return fmt.Errorf("page %d referenced by page %d is out of range", n, use.Parent)
+		}
+		if existing, ok := uses[n]; ok {
+			return fmt.Errorf("page %d is used as %s of %s and as %s of %s",
+				n, existing.Kind, existing.Owner, use.Kind, use.Owner)
+		}
+		uses[n] = use
+		return nil
+	}
+	pageSize := db.Header.PageSizeBytes()
+	if lockPage := PendingByteOffset/pageSize + 1; lockPage <= pageCount {
+		uses[lockPage] = PageUse{Kind: PageLockByte}
+	}
+	if db.Header.LargestPageInVMode != 0 {
+		// every ptrmap page covers the pages up to the next one
+		usable := pageSize - int64(db.Header.ReservedPageSpace)
+		for n := int64(2); n <= pageCount; n += usable/5 + 1 {
+			uses[n] = PageUse{Kind: PagePtrmap}
+		}
+	}
+	trunk, parent := int64(db.Header.FirstFreeListTrunk), int64(0)
+	for trunk != 0 {
+		if err := mark(trunk, PageUse{PageFreelistTrunk, "freelist", parent}); err != nil {
+			return nil, err
+		}
+		p, err := ReadRawPage(db, trunk)
+		if err != nil {
+			return nil, err
+		}
+		count := int(binary.BigEndian.Uint32(p.Data[4:]))
+		for i := 0; i < count && 8+4*i+4 <= len(p.Data); i++ {
+			leaf := int64(binary.BigEndian.Uint32(p.Data[8+4*i:]))
+			if err := mark(leaf, PageUse{PageFreelistLeaf, "freelist", trunk}); err != nil {
+				return nil, err
+			}
+		}
+		trunk, parent = int64(binary.BigEndian.Uint32(p.Data)), trunk
+	}
+	schema, err := ReadSchemaRows(db)
+	if err != nil {
+		return nil, err
+	}
+	roots := []SchemaRow{{Name: "sqlite_schema", RootPage: SchemaRootPage}}
+	for _, row := range schema {
+		if row.RootPage > 0 {
+			roots = append(roots, row)
+		}
+	}
+	var walk func(n, parent int64, owner string) error
+	walk = func(n, parent int64, owner string) error {
+		if err := mark(n, PageUse{PageBtree, owner, parent}); err != nil {
+			return err
+		}
+		p, err := ReadRawPage(db, n)
+		if err != nil {
+			return err
+		}
+		if _, ok := PageTypeNames[p.PageType()]; !ok {
+			return fmt.Errorf("page %d of %s has invalid page type %d", n, owner, p.PageType())
+		}
+		for i := 0; i < p.CellCount(); i++ {
+			if p.PageType() != InteriorTableType {
+				_, _, overflow := p.CellPayload(i)
+				for prev := n; overflow != 0; {
+					if err := mark(int64(overflow), PageUse{PageOverflow, owner, prev}); err != nil {
+						return err
+					}
+					op, err := ReadRawPage(db, int64(overflow))
+					if err != nil {
+						return err
+					}
+					prev, overflow = int64(overflow), binary.BigEndian.Uint32(op.Data)
+				}
+			}
+			if !p.IsLeaf() {
+				if err := walk(int64(p.CellLeftChild(i)), n, owner); err != nil {
+					return err
+				}
+			}
+		}
+		if !p.IsLeaf() {
+			return walk(int64(p.RightMostPointer()), n, owner)
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := walk(root.RootPage, 0, root.Name); err != nil {
+			return nil, err
+		}
+	}
+	return uses, nil
+}
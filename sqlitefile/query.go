@@ -0,0 +1,814 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+const (
+	CountIdent = "count(*)"
+	// number of pages visited between file change counter checks
+	SnapshotCheckInterval = 64
+)
+
+type SelectCtx struct {
+	Tables      []string
+	Identifiers []string
+	Constraint  map[string]string
+	IsCount     bool
+	Limit       int
+	// the ORDER BY term, which can only be the rowid as rows are read
+	// in b-tree order, and whether it is descending
+	OrderBy    string
+	Descending bool
+	// function calls in the select list, by their index in Identifiers
+	calls map[int]funcCall
+	// the select list of a query without a FROM clause, evaluated
+	// instead of reading a table
+	literals []sqlparser.Expr
+	// the values of the constraints compared with =, as written, which
+	// rows are compared to and an index looks up
+	equals map[string]any
+	// the two tables of a FROM clause that joins them
+	join *joinClause
+	// a WHERE clause that cannot be evaluated, reported when the query
+	// runs rather than matching rows it was not meant to
+	err error
+}
+
+// A call of one of the JSON or text functions on a column with literal
+// arguments
+type funcCall struct {
+	fn     func(doc any, args []any) (any, error)
+	column string
+	args   []any
+}
+
+type queryContext struct {
+	query         SelectCtx
+	tableName     string
+	rootCell      *Record
+	count         int
+	indexedID     map[int]bool
+	hasIndicies   bool
+	rows          [][]any
+	changeCounter uint32
+	pagesRead     int
+	// receives the rows as they are read instead of collecting them
+	emit func(values []any) error
+	// called for every page read
+	visit func(depth, children int)
+	// the columns the query reads in record order, the first
+	// filterColumns of them constrained, where each is found in values,
+	// and the values of the row being read
+	columns       []int
+	filterColumns int
+	positions     map[int]int
+	values        []any
+	// constraints already compared by the index the rows are read through
+	served map[string]bool
+}
+
+func NewSelectCtx(stmt *sqlparser.Select) SelectCtx {
+	if isLiteralSelect(stmt) {
+		s := SelectCtx{Tables: []string{"dual"}, Limit: sqlLimitToInt(stmt.Limit)}
+		for _, expr := range stmt.SelectExprs {
+			aliased, ok := expr.(*sqlparser.AliasedExpr)
+			if !ok {
+				break
+			}
+			name := sqlparser.String(aliased.Expr)
+			if !aliased.As.IsEmpty() {
+				name = aliased.As.String()
+			}
+			s.Identifiers = append(s.Identifiers, name)
+			s.literals = append(s.literals, aliased.Expr)
+		}
+		return s
+	}
+	idents := []string{}
+	calls := map[int]funcCall{}
+	for _, expr := range stmt.SelectExprs {
+		if call, name, ok := sqlExprToFuncCall(expr); ok {
+			calls[len(idents)] = call
+			idents = append(idents, name)
+			continue
+		}
+		idents = append(idents, sqlNodeToTrimmedString(expr)...)
+	}
+	s := SelectCtx{
+		Tables:      sqlNodeToTrimmedString(stmt.From),
+		Identifiers: idents,
+		IsCount:     len(idents) > 0 && idents[0] == CountIdent,
+		Limit:       sqlLimitToInt(stmt.Limit),
+		calls:       calls,
+	}
+	s.Constraint, s.equals, s.err = sqlWhereToConstraint(stmt.Where, false)
+	if join, err := sqlFromToJoin(stmt.From); err != nil || join != nil {
+		// the columns of a join are qualified by the table they are in
+		s.join = join
+		if join != nil {
+			s.Tables = []string{join.left.name}
+			s.Constraint, s.equals, s.err = sqlWhereToConstraint(stmt.Where, true)
+		}
+		if s.err == nil && len(calls) > 0 {
+			s.err = errors.New("functions in the select list of a join are not supported")
+		}
+		if err != nil {
+			s.err = err
+		}
+	}
+	if len(stmt.OrderBy) > 0 {
+		// anything but a single column is kept as written, to be refused
+		terms := make([]string, len(stmt.OrderBy))
+		for i, o := range stmt.OrderBy {
+			terms[i] = sqlparser.String(o.Expr)
+		}
+		s.OrderBy = strings.Join(terms, ", ")
+		if col, ok := stmt.OrderBy[0].Expr.(*sqlparser.ColName); ok && len(stmt.OrderBy) == 1 {
+			s.OrderBy = CleanKeyString(col.Name.String())
+		}
+		s.Descending = stmt.OrderBy[0].Direction == sqlparser.DescScr
+	}
+	return s
+}
+
+// Names of the columns of the rows a query returns from table, which
+// are those of the table in its place wherever the select list has *
+func (d *Database) ResultColumns(s SelectCtx, table string) []string {
+	switch {
+	case s.IsCount:
+		return []string{CountIdent}
+	case s.isLiteral():
+		return s.Identifiers
+	case s.join != nil:
+		return d.joinColumnNames(s)
+	}
+	if t, ok := d.virtualTables[table]; ok {
+		return s.expandStar(t.Columns()).Identifiers
+	}
+	if c, ok := d.tableSchema(table); ok {
+		return s.expandStar(c.ColumnNames()).Identifiers
+	}
+	return s.Identifiers
+}
+
+// Replaces * in the select list with the given columns, moving the
+// function calls after it along
+func (s SelectCtx) expandStar(columns []string) SelectCtx {
+	if s.IsCount || !slices.Contains(s.Identifiers, "*") {
+		return s
+	}
+	idents := []string{}
+	calls := map[int]funcCall{}
+	for i, k := range s.Identifiers {
+		if call, ok := s.calls[i]; ok {
+			calls[len(idents)] = call
+		}
+		if k == "*" {
+			for _, c := range columns {
+				idents = append(idents, CleanKeyString(c))
+			}
+			continue
+		}
+		idents = append(idents, k)
+	}
+	s.Identifiers, s.calls = idents, calls
+	return s
+}
+
+// Whether the query has no FROM clause, so its one row is evaluated
+// from the select list
+func (s SelectCtx) isLiteral() bool {
+	return s.literals != nil
+}
+
+// Whether the rows of a table in b-tree order are in the order the
+// query asks for, which is when it orders by nothing or the rowid
+func (s SelectCtx) inRowidOrder(schema *Record) bool {
+	switch s.OrderBy {
+	case "":
+		return true
+	case "rowid", "_rowid_", "oid":
+		_, shadowed := schema.ColumnMap[s.OrderBy]
+		return !shadowed || schema.IsRowidAlias(s.OrderBy)
+	}
+	return schema.IsRowidAlias(s.OrderBy)
+}
+
+// Recognizes a call such as json_extract(data, '$.a') AS a, returning
+// the call and the name of its result column, the alias if there is one
+func sqlExprToFuncCall(expr sqlparser.SelectExpr) (funcCall, string, bool) {
+	aliased, ok := expr.(*sqlparser.AliasedExpr)
+	if !ok {
+		return funcCall{}, "", false
+	}
+	f, ok := aliased.Expr.(*sqlparser.FuncExpr)
+	if !ok || f.Distinct || len(f.Exprs) == 0 {
+		return funcCall{}, "", false
+	}
+	call := funcCall{fn: lookupFunction(f.Name.Lowered())}
+	if call.fn == nil {
+		return funcCall{}, "", false
+	}
+	for i, e := range f.Exprs {
+		arg, ok := e.(*sqlparser.AliasedExpr)
+		if !ok {
+			return funcCall{}, "", false
+		}
+		if i == 0 {
+			col, ok := arg.Expr.(*sqlparser.ColName)
+			if !ok {
+				return funcCall{}, "", false
+			}
+			call.column = CleanKeyString(col.Name.String())
+			continue
+		}
+		v, ok := sqlValToValue(arg.Expr)
+		if !ok {
+			return funcCall{}, "", false
+		}
+		call.args = append(call.args, v)
+	}
+	name := sqlparser.String(f)
+	if !aliased.As.IsEmpty() {
+		name = aliased.As.String()
+	}
+	return call, name, true
+}
+
+func sqlValToValue(e sqlparser.Expr) (any, bool) {
+	if _, ok := e.(*sqlparser.NullVal); ok {
+		return nil, true
+	}
+	v, ok := e.(*sqlparser.SQLVal)
+	if !ok {
+		return nil, false
+	}
+	switch v.Type {
+	case sqlparser.StrVal:
+		return string(v.Val), true
+	case sqlparser.IntVal:
+		i, err := strconv.ParseInt(string(v.Val), 10, 64)
+		return i, err == nil
+	case sqlparser.FloatVal:
+		f, err := strconv.ParseFloat(string(v.Val), 64)
+		return f, err == nil
+	}
+	return nil, false
+}
+
+func newQueryContext(s SelectCtx, tableName string) *queryContext {
+	rows := [][]any{}
+	indexedID := map[int]bool{}
+	return &queryContext{query: s, tableName: tableName, indexedID: indexedID, rows: rows}
+}
+
+// Works out the columns the constraints and the select list read, so
+// only those are decoded from each row. The constrained columns come
+// first, the others are only decoded for rows that match.
+func (q *queryContext) project() {
+	q.columns = q.columns[:0]
+	q.positions = map[int]int{}
+	add := func(k string) {
+		idx, ok := q.rootCell.ColumnMap[k]
+		if _, seen := q.positions[idx]; ok && !seen {
+			q.positions[idx] = 0
+			q.columns = append(q.columns, idx)
+		}
+	}
+	for k := range q.query.Constraint {
+		add(k)
+	}
+	sort.Ints(q.columns)
+	q.filterColumns = len(q.columns)
+	if !q.query.IsCount {
+		for i, k := range q.query.Identifiers {
+			if call, ok := q.query.calls[i]; ok {
+				k = call.column
+			}
+			add(k)
+		}
+	}
+	sort.Ints(q.columns[q.filterColumns:])
+	for i, idx := range q.columns {
+		q.positions[idx] = i
+	}
+	q.values = make([]any, len(q.columns))
+}
+
+// Decodes the constrained columns of the row, or the rest of the
+// columns the query reads once the row matched
+func (q *queryContext) readColumns(c *Record, matched bool) error {
+	if matched {
+		return c.readColumns(q.columns[q.filterColumns:], q.values[q.filterColumns:])
+	}
+	return c.readColumns(q.columns[:q.filterColumns], q.values[:q.filterColumns])
+}
+
+// Value of column k of the row read into values, false when the table
+// has no such column
+func (q *queryContext) column(k string, c *Record) (any, bool) {
+	idx, ok := q.rootCell.ColumnMap[k]
+	if !ok {
+		return nil, false
+	}
+	value := q.rootCell.ApplyAffinity(idx, q.values[q.positions[idx]])
+	if value == nil && q.rootCell.IsRowidAlias(k) {
+		value = c.RowID
+	}
+	return value, true
+}
+
+// Runs the query against one of its tables. Every matching row is
+// passed to emit, unless the query counts rows. visit, when not nil, is
+// called for every page read with its depth in the b-tree and number of
+// children, which is 0 for leaf pages. Returns the number of matches.
+func SelectTable(d *Database, s SelectCtx, table string, emit func(values []any) error, visit func(depth, children int)) (count int, err error) {
+	span := d.startSpan("select", "table", table)
+	defer func() { span.End(err) }()
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.join != nil {
+		return selectJoin(d, s, emit)
+	}
+	q := newQueryContext(s, table)
+	q.emit = emit
+	q.visit = visit
+	if s.isLiteral() {
+		if err := selectLiterals(d, q); err != nil {
+			return 0, err
+		}
+		return q.count, nil
+	}
+	if t, ok := d.virtualTables[table]; ok {
+		if s.OrderBy != "" {
+			return 0, fmt.Errorf("cannot ORDER BY on table %s, its rows have no order", table)
+		}
+		q.query = s.expandStar(t.Columns())
+		if err := selectVirtualTable(t, q); err != nil {
+			return 0, err
+		}
+		return q.count, nil
+	}
+	pageNumber, err := q.openTable(d)
+	if err != nil {
+		return 0, err
+	}
+	if q.rootCell.WithoutRowid && !(q.query.IsCount && len(q.query.Constraint) == 0) {
+		if err := selectWithoutRowid(d, q, pageNumber); err != nil {
+			return 0, err
+		}
+		return q.count, nil
+	}
+	if ok, err := selectByIndex(d, q, pageNumber); err != nil {
+		return 0, err
+	} else if ok {
+		if err := checkSnapshot(d, q); err != nil {
+			return 0, err
+		}
+		return q.count, nil
+	}
+	// counting every row only needs the cell counts of the leaves
+	if q.query.IsCount && len(q.query.Constraint) == 0 {
+		n, err := countTableRows(d, pageNumber, map[int64]bool{}, 0, visit)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkSnapshot(d, q); err != nil {
+			return 0, err
+		}
+		if q.query.Limit > 0 {
+			n = min(n, int64(q.query.Limit))
+		}
+		return int(n), nil
+	}
+	page, err := NewPageFromNumber(d, pageNumber)
+	if err != nil {
+		return 0, err
+	}
+	if err := queryTable(d, page, q, 0); err != nil {
+		return 0, err
+	}
+	if err := checkSnapshot(d, q); err != nil {
+		return 0, err
+	}
+	return q.count, nil
+}
+
+// Sets the query up to read a stored table and returns its root page
+func (q *queryContext) openTable(d *Database) (int64, error) {
+	rootCell, ok := d.tableSchema(q.tableName)
+	if !ok {
+		return 0, TableNotFoundError(q.tableName)
+	}
+	s := q.query
+	q.query = s.expandStar(rootCell.ColumnNames())
+	if rootCell.WithoutRowid && s.OrderBy != "" {
+		return 0, withoutRowidError("ORDER BY "+s.OrderBy+" on", q.tableName)
+	}
+	if !s.inRowidOrder(rootCell) {
+		return 0, fmt.Errorf("cannot ORDER BY %s, only by the rowid", s.OrderBy)
+	}
+	q.rootCell = rootCell
+	q.project()
+	pageNumber, err := tableRootPage(q.tableName, rootCell)
+	if errors.Is(err, ErrVirtualTable) {
+		return 0, err
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to find root page number for cell %d", rootCell.RowID)
+	}
+	q.changeCounter, err = d.ReadFileChangeCounter()
+	return pageNumber, err
+}
+
+func queryTable(db *Database, p *Page, q *queryContext, depth int) error {
+	if q.rows == nil {
+		q.rows = [][]any{}
+	}
+	q.pagesRead++
+	if q.visit != nil && p.Header.PageType == InteriorTableType {
+		q.visit(depth, len(p.Cells)+1)
+	} else if q.visit != nil {
+		q.visit(depth, 0)
+	}
+	if q.pagesRead%SnapshotCheckInterval == 0 {
+		if err := checkSnapshot(db, q); err != nil {
+			return err
+		}
+	}
+	isInterior := p.Header.PageType == InteriorTableType
+	if !isInterior && p.Header.PageType == LeafTableType {
+		if err := handleQueryLeaf(p, q); err != nil {
+			return err
+		}
+	} else if !isInterior {
+		return corruptPageError(p.Number(), "not a table b-tree page")
+	} else if isInterior {
+		children := childPages(p)
+		if q.query.Descending {
+			slices.Reverse(children)
+		}
+		for i, child := range children {
+			pn, err := NewPageFromNumber(db, child)
+			if err != nil {
+				return err
+			}
+			if pn.Header.PageType == LeafTableType {
+				db.readLeavesAhead(children, i+1)
+			}
+			if err = queryTable(db, pn, q, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Runs the query against the rows of a WITHOUT ROWID table, which come
+// in primary key order
+func selectWithoutRowid(d *Database, q *queryContext, root int64) error {
+	limit := errors.New("limit reached")
+	err := walkWithoutRowidRows(d, q.rootCell, root, func(c *Record) error {
+		if q.query.Limit > 0 && q.count >= q.query.Limit {
+			return limit
+		}
+		return handleQueryRow(c, q)
+	})
+	if err != nil && err != limit {
+		return err
+	}
+	return checkSnapshot(d, q)
+}
+
+// Calls fn for every row of a WITHOUT ROWID table in primary key order.
+// The entries of the index b-tree holding the rows start with the
+// primary key columns, each row is passed on with its columns put back
+// in table order and rowid 0, as a record like those of other tables.
+func walkWithoutRowidRows(db *Database, schema *Record, root int64, fn func(c *Record) error) error {
+	sql, _ := schema.ReadDataFromHeaderIndex(4)
+	text, _ := sql.(string)
+	columns, primaryKey, _ := parseTableDefinition(text)
+	positions := make([]int, len(columns))
+	next := len(primaryKey)
+	for i, c := range columns {
+		if c.PrimaryKey > 0 {
+			positions[i] = c.PrimaryKey - 1
+		} else {
+			positions[i] = next
+			next++
+		}
+	}
+	row := make([]any, len(columns))
+	return WalkIndexCells(db, root, func(values []any) error {
+		for i, p := range positions {
+			if p >= len(values) {
+				return fmt.Errorf("row of WITHOUT ROWID table has %d values, not %d", len(values), len(columns))
+			}
+			row[i] = values[p]
+		}
+		payload, err := EncodeRecord(row)
+		if err != nil {
+			return err
+		}
+		c, err := NewRecordCell(0, payload)
+		if err != nil {
+			return err
+		}
+		return fn(c)
+	})
+}
+
+// Root page of a table, which virtual tables do not have
+func tableRootPage(name string, schema *Record) (int64, error) {
+	root, err := schema.RootPage()
+	if err == nil && root == 0 {
+		err = fmt.Errorf("%w: %s", ErrVirtualTable, name)
+	}
+	return root, err
+}
+
+// Counts the rows of a table without decoding them, or takes the count
+// from Analyze when the database did not change since
+func (db *Database) CountRows(table string) (int64, error) {
+	schema, ok := db.Tables[table]
+	if !ok {
+		return 0, TableNotFoundError(table)
+	}
+	for _, s := range db.Analysis() {
+		if !s.Index && CleanKeyString(s.Name) == table {
+			return s.Rows, nil
+		}
+	}
+	root, err := tableRootPage(table, schema)
+	if err != nil {
+		return 0, err
+	}
+	return countTableRows(db, root, map[int64]bool{}, 0, nil)
+}
+
+// Calls fn for every row of a table in rowid order. Its columns are
+// read from rec with ReadDataFromHeaderIndex, an INTEGER PRIMARY KEY
+// column reads as NULL and takes the value of rowid. The rows of a
+// WITHOUT ROWID table come in primary key order with rowid 0. The walk stops at
+// the first error fn returns, which is passed on unless it is ErrStop.
+func (db *Database) ForEachRow(table string, fn func(rowid int64, rec *Record) error) error {
+	schema, ok := db.Tables[table]
+	if !ok {
+		return TableNotFoundError(table)
+	}
+	root, err := tableRootPage(table, schema)
+	if err != nil {
+		return err
+	}
+	walk := WalkTableCells
+	if schema.WithoutRowid {
+		walk = func(db *Database, root int64, fn func(c *Record) error) error {
+			return walkWithoutRowidRows(db, schema, root, fn)
+		}
+	}
+	err = walk(db, root, func(c *Record) error {
+		return fn(c.RowID, c)
+	})
+	if errors.Is(err, ErrStop) {
+		return nil
+	}
+	return err
+}
+
+// Counts the rows of a table b-tree by adding up the cell counts of its
+// leaf pages, without decoding any cell. The rows of a WITHOUT ROWID
+// table are the entries of an index b-tree, whose interior pages hold
+// entries as well. visit, when not nil, is called for every page as
+// SelectTable calls it.
+func countTableRows(db *Database, pageNumber int64, seen map[int64]bool, depth int, visit func(depth, children int)) (int64, error) {
+	if seen[pageNumber] {
+		return 0, corruptPageError(pageNumber, "referenced more than once")
+	}
+	seen[pageNumber] = true
+	p, err := ReadRawPage(db, pageNumber)
+	if err != nil {
+		return 0, err
+	}
+	switch p.PageType() {
+	case LeafTableType, LeafIndexType:
+		if visit != nil {
+			visit(depth, 0)
+		}
+		return int64(p.CellCount()), nil
+	case InteriorTableType, InteriorIndexType:
+		if visit != nil {
+			visit(depth, p.CellCount()+1)
+		}
+		total := int64(0)
+		if p.PageType() == InteriorIndexType {
+			total = int64(p.CellCount())
+		}
+		for i := 0; i <= p.CellCount(); i++ {
+			n, err := countTableRows(db, int64(p.ChildPage(i)), seen, depth+1, visit)
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+		return total, nil
+	}
+	return 0, corruptPageError(pageNumber, "not a b-tree page")
+}
+
+// Compares the file change counter against the value recorded when
+// the query started, so a writer committing mid-scan aborts the query
+// instead of silently returning rows from two different versions.
+func checkSnapshot(db *Database, q *queryContext) error {
+	counter, err := db.ReadFileChangeCounter()
+	if err != nil {
+		return err
+	}
+	if counter != q.changeCounter {
+		return fmt.Errorf("%w of table %q (change counter %d -> %d)",
+			ErrDatabaseChanged, q.tableName, q.changeCounter, counter)
+	}
+	return nil
+}
+
+func handleQueryLeaf(p *Page, q *queryContext) error {
+	for i := range p.Cells {
+		if q.query.Limit > 0 && q.count >= q.query.Limit {
+			return nil
+		}
+		c := p.Cells[i]
+		if q.query.Descending {
+			c = p.Cells[len(p.Cells)-1-i]
+		}
+		if err := handleQueryRow(c, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks a row against the constraints and passes it on when it matches
+func handleQueryRow(c *Record, q *queryContext) error {
+	if err := q.readColumns(c, false); err != nil {
+		return err
+	}
+	ok, err := handleQueryConstraint(c, q)
+	if err != nil || !ok {
+		return err
+	}
+	if err := q.readColumns(c, true); err != nil {
+		return err
+	}
+	values, err := handleQueryIdentifers(c, q)
+	if err != nil {
+		return err
+	}
+	switch {
+	case q.query.IsCount:
+	case q.emit != nil:
+		if err := q.emit(values); err != nil {
+			return err
+		}
+	default:
+		q.rows = append(q.rows, values)
+	}
+	q.count++
+	return nil
+}
+
+func handleQueryConstraint(c *Record, q *queryContext) (bool, error) {
+	for k := range q.query.Constraint {
+		if q.served[k] {
+			continue
+		}
+		value, ok := q.column(k, c)
+		if !ok {
+			return false, columnNotFoundError(
+				"constraint %q not found on table %q cell %d", k, q.tableName, c.RowID)
+		}
+		idx := q.rootCell.ColumnMap[k]
+		affinity := AffinityBlob
+		if idx < len(q.rootCell.ColumnAffinity) {
+			affinity = q.rootCell.ColumnAffinity[idx]
+		}
+		if !constraintEquals(value, affinity, q.rootCell.Collation(idx), q.query.equals[k]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func handleQueryIdentifers(c *Record, q *queryContext) ([]any, error) {
+	values := []any{}
+	if q.query.IsCount {
+		return values, nil
+	}
+	for i, k := range q.query.Identifiers {
+		call, isCall := q.query.calls[i]
+		if isCall {
+			k = call.column
+		}
+		value, ok := q.column(k, c)
+		if !ok {
+			return values, columnNotFoundError(
+				"%q not found on table %q cell %d", k, q.tableName, c.RowID)
+		}
+		if isCall {
+			v, err := call.fn(value, call.args)
+			if err != nil {
+				return values, fmt.Errorf("%s on table %q cell %d: %w", q.query.Identifiers[i], q.tableName, c.RowID, err)
+			}
+			value = v
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Reads a WHERE clause of terms column = value joined by AND into the
+// lowercased text of the values, as the condition of a partial index is
+// matched against them, and the values themselves, which rows are
+// compared to and an index looks up. Both are keyed by the
+// column name, qualified by its table as written when qualified is set,
+// or by the expression for terms such as lower(name) = 'x'. Other
+// clauses are refused.
+func sqlWhereToConstraint(w *sqlparser.Where, qualified bool) (map[string]string, map[string]any, error) {
+	if w == nil {
+		return nil, nil, nil
+	}
+	constraint, equals := map[string]string{}, map[string]any{}
+	var walk func(e sqlparser.Expr) error
+	walk = func(e sqlparser.Expr) error {
+		switch e := e.(type) {
+		case *sqlparser.AndExpr:
+			if err := walk(e.Left); err != nil {
+				return err
+			}
+			return walk(e.Right)
+		case *sqlparser.ParenExpr:
+			return walk(e.Expr)
+		case *sqlparser.ComparisonExpr:
+			if e.Operator != sqlparser.EqualStr {
+				break
+			}
+			term, literal := e.Left, e.Right
+			if _, ok := term.(*sqlparser.SQLVal); ok {
+				term, literal = literal, term
+			}
+			v, err := sqlExprToValue(literal)
+			if err != nil {
+				break
+			}
+			var key string
+			switch term := term.(type) {
+			case *sqlparser.ColName:
+				key = CleanKeyString(term.Name.String())
+				if qualified && !term.Qualifier.IsEmpty() {
+					key = CleanKeyString(term.Qualifier.Name.String()) + "." + key
+				}
+			case *sqlparser.FuncExpr:
+				key = exprKey(term)
+			default:
+				return fmt.Errorf("unsupported WHERE: %s", sqlparser.String(e))
+			}
+			constraint[key] = CleanKeyString(sqlparser.String(literal))
+			equals[key] = v
+			return nil
+		}
+		return fmt.Errorf("unsupported WHERE: %s", sqlparser.String(e))
+	}
+	if err := walk(w.Expr); err != nil {
+		return nil, nil, err
+	}
+	return constraint, equals, nil
+}
+
+func sqlLimitToInt(l *sqlparser.Limit) int {
+	if l == nil {
+		return 0
+	}
+	return sqlNodeToInt(l.Rowcount)
+}
+
+func sqlNodeToInt(n sqlparser.SQLNode) int {
+	buf := sqlparser.NewTrackedBuffer(nil)
+	n.Format(buf)
+	i, err := strconv.Atoi(buf.String())
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+func sqlNodeToTrimmedString(n sqlparser.SQLNode) []string {
+	buf := sqlparser.NewTrackedBuffer(nil)
+	n.Format(buf)
+	return strings.Split(strings.ToLower(strings.ReplaceAll(buf.String(), " ", "")), ",")
+}
@@ -0,0 +1,198 @@
+package sqlitefile
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Creates a database with table t(id INTEGER PRIMARY KEY, name TEXT,
+// score REAL) holding n rows
+func benchDatabase(b *testing.B, n int) *Database {
+	b.Helper()
+	path := filepath.Join(b.TempDir(), "bench.db")
+	if err := Create(path, 4096); err != nil {
+		b.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	if err := db.Exec("CREATE TABLE t(id INTEGER PRIMARY KEY, name TEXT, score REAL)"); err != nil {
+		b.Fatal(err)
+	}
+	for start := 0; start < n; start += 500 {
+		rows := []string{}
+		for i := start; i < min(start+500, n); i++ {
+			rows = append(rows, fmt.Sprintf("('name%d', %d.5)", i, i%100))
+		}
+		if err := db.Exec("INSERT INTO t(name, score) VALUES " + strings.Join(rows, ", ")); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return db
+}
+
+func benchSelect(b *testing.B, sql string) SelectCtx {
+	b.Helper()
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return NewSelectCtx(stmt.(*sqlparser.Select))
+}
+
+// A full scan through SelectTable, which the CLI runs queries with
+func BenchmarkSelectTable(b *testing.B) {
+	const n = 20000
+	db := benchDatabase(b, n)
+	s := benchSelect(b, "SELECT id, name, score FROM t")
+	emit := func(values []any) error { return nil }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count, err := SelectTable(db, s, "t", emit, nil)
+		if err != nil || count != n {
+			b.Fatalf("read %d rows: %v", count, err)
+		}
+	}
+	b.ReportMetric(float64(b.N*n)/b.Elapsed().Seconds(), "rows/s")
+}
+
+// A full scan read a row at a time through Rows
+func BenchmarkRowsScan(b *testing.B) {
+	const n = 20000
+	db := benchDatabase(b, n)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("SELECT id, name, score FROM t")
+		if err != nil {
+			b.Fatal(err)
+		}
+		var id int64
+		var name string
+		var score float64
+		count := 0
+		for rows.Next() {
+			if err := rows.Scan(&id, &name, &score); err != nil {
+				b.Fatal(err)
+			}
+			count++
+		}
+		if rows.Err() != nil || count != n {
+			b.Fatalf("read %d rows: %v", count, rows.Err())
+		}
+	}
+	b.ReportMetric(float64(b.N*n)/b.Elapsed().Seconds(), "rows/s")
+}
+
+// Rows of a WITHOUT ROWID table come from its index b-tree in primary
+// key order, the same through Query, SelectTable and ForEachRow
+func TestQueryWithoutRowid(t *testing.T) {
+	db, path := sqlite3Database(t, `
+		CREATE TABLE w(n INTEGER, pad TEXT, k TEXT, PRIMARY KEY (k)) WITHOUT ROWID;
+		WITH RECURSIVE c(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM c WHERE i < 2000)
+		INSERT INTO w SELECT i, printf('%050d', i), 'k' || i FROM c;`)
+	want := sqlite3(t, path, "SELECT n, k FROM w")
+	lines := []string{}
+	rows, err := db.Query("SELECT n, k FROM w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var n int64
+		var k string
+		if err := rows.Scan(&n, &k); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, fmt.Sprintf("%d|%s", n, k))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(lines, "\n"); got != want {
+		t.Fatalf("Query read %d rows unlike sqlite3", len(lines))
+	}
+
+	selects := []struct {
+		sql   string
+		count int
+		err   string
+	}{
+		{"SELECT n FROM w WHERE k = 'k1234'", 1, ""},
+		{"SELECT n FROM w WHERE n = 7", 1, ""},
+		{"SELECT n FROM w LIMIT 10", 10, ""},
+		{"SELECT count(*) FROM w", 2000, ""},
+		{"SELECT n FROM w ORDER BY n", 0, "cannot ORDER BY n on WITHOUT ROWID table w"},
+	}
+	for _, s := range selects {
+		stmt, err := sqlparser.Parse(s.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := SelectTable(db, NewSelectCtx(stmt.(*sqlparser.Select)), "w", func([]any) error { return nil }, nil)
+		switch {
+		case s.err != "" && (err == nil || err.Error() != s.err):
+			t.Errorf("%s: error %v, want %s", s.sql, err, s.err)
+		case s.err == "" && (err != nil || count != s.count):
+			t.Errorf("%s: %d rows, %v, want %d", s.sql, count, err, s.count)
+		}
+	}
+
+	n := 0
+	err = db.ForEachRow("w", func(rowid int64, rec *Record) error {
+		if k, _ := rec.ReadDataFromHeaderIndex(2); n == 0 && k != "k1" {
+			t.Errorf("first row has key %v, not k1", k)
+		}
+		n++
+		return nil
+	})
+	if err != nil || n != 2000 {
+		t.Fatalf("ForEachRow read %d rows: %v", n, err)
+	}
+}
+
+// An index lookup and a scan find the same rows as sqlite3: values are
+// compared with the affinity of the column and its collation, BINARY
+// unless it declares another
+func TestQueryConstraintComparison(t *testing.T) {
+	db, path := sqlite3Database(t, `
+		CREATE TABLE s(a TEXT, b TEXT COLLATE NOCASE, c INTEGER);
+		INSERT INTO s VALUES ('foo', 'foo', 1), ('Foo', 'FOO', 2), ('FOO', 'bar', 3), ('x', 'Foo', 10);
+		CREATE TABLE i(a TEXT, b TEXT COLLATE NOCASE, c INTEGER);
+		INSERT INTO i SELECT * FROM s;
+		CREATE INDEX i_a ON i(a);
+		CREATE INDEX i_b ON i(b);
+		CREATE INDEX i_c ON i(c);`)
+	for _, table := range []string{"s", "i"} {
+		for _, where := range []string{"a = 'foo'", "a = 'FOO'", "b = 'foo'", "c = '1'", "c = 10", "a = 1"} {
+			sql := fmt.Sprintf("SELECT c FROM %s WHERE %s", table, where)
+			rows, err := db.Query(sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for rows.Next() {
+				var c int64
+				if err := rows.Scan(&c); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, fmt.Sprint(c))
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			want := strings.Fields(sqlite3(t, path, sql+" ORDER BY CAST(c AS TEXT)"))
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("%s: %v, want %v", sql, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,499 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Every cell takes up at least 4 bytes so its space
+// can become a freeblock once the cell is deleted
+const MinCellSize = 4
+
+// sqlite defragments a page rather than let the fragmented
+// bytes counter in the page header go beyond this
+const MaxFragmentedBytes = 60
+
+var errPageFull = errors.New("page is full")
+
+var PageTypeNames = map[uint8]string{
+	InteriorIndexType: "interior index",
+	InteriorTableType: "interior table",
+	LeafIndexType:     "leaf index",
+	LeafTableType:     "leaf table",
+}
+
+// Reads page n as raw bytes, with committed WAL frames applied
+func ReadRawPage(db *Database, n int64) (*RawPage, error) {
+	pageCount, err := db.PageCount()
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > pageCount {
+		return nil, fmt.Errorf("page %d out of range, the database has %d pages", n, pageCount)
+	}
+	db.pageRead(n)
+	pageSize := int(db.Header.PageSizeBytes())
+	data := make([]byte, pageSize)
+	if _, err := db.Reader.ReadAt(data, PageNumberToOffset(int64(pageSize), n)); err != nil {
+		return nil, err
+	}
+	return &RawPage{Number: n, Data: data, Usable: pageSize - int(db.Header.ReservedPageSpace)}, nil
+}
+
+// Decodes the record of cell i of a leaf table or index page,
+// following its overflow chain through the database file
+func ReadCellValues(db *Database, p *RawPage, i int) ([]any, error) {
+	payload, err := AssembleCellPayload(p, i, func(n int64) (*RawPage, error) { return ReadRawPage(db, n) })
+	if err != nil {
+		return nil, err
+	}
+	record, err := NewRecordCell(0, payload)
+	if err != nil {
+		return nil, err
+	}
+	db.cellsDecoded(p.Number, 1)
+	record.TextEncoding = db.TextEncoding
+	return recordValues(record, len(record.Header))
+}
+
+// A b-tree page held in memory as raw bytes so it can be modified
+// and written back. All offsets are relative to the start of the page,
+// the b-tree header of page 1 follows the 100 byte database header.
+//
+// Usable is the page size minus the reserved bytes at the end of each page.
+type RawPage struct {
+	Number int64
+	Data   []byte
+	Usable int
+}
+
+func (p *RawPage) HeaderOffset() int {
+	return int(pageHeaderOffset(p.Number))
+}
+
+func (p *RawPage) PageType() uint8 {
+	return p.Data[p.HeaderOffset()]
+}
+
+func (p *RawPage) IsLeaf() bool {
+	t := p.PageType()
+	return t == LeafTableType || t == LeafIndexType
+}
+
+func (p *RawPage) HeaderSize() int {
+	if p.IsLeaf() {
+		return DefaultPageHeaderSize
+	}
+	return DefaultPageHeaderSize + InteriorPageHeaderOffset
+}
+
+func (p *RawPage) u16(offset int) int {
+	return int(binary.BigEndian.Uint16(p.Data[offset:]))
+}
+
+func (p *RawPage) putU16(offset int, v int) {
+	binary.BigEndian.PutUint16(p.Data[offset:], uint16(v))
+}
+
+func (p *RawPage) FirstFreeblock() int {
+	return p.u16(p.HeaderOffset() + 1)
+}
+
+func (p *RawPage) SetFirstFreeblock(offset int) {
+	p.putU16(p.HeaderOffset()+1, offset)
+}
+
+func (p *RawPage) CellCount() int {
+	return p.u16(p.HeaderOffset() + 3)
+}
+
+func (p *RawPage) SetCellCount(n int) {
+	p.putU16(p.HeaderOffset()+3, n)
+}
+
+// A stored value of zero means 65536
+func (p *RawPage) CellContentStart() int {
+	v := p.u16(p.HeaderOffset() + 5)
+	if v == 0 {
+		return 65536
+	}
+	return v
+}
+
+func (p *RawPage) SetCellContentStart(offset int) {
+	p.putU16(p.HeaderOffset()+5, offset)
+}
+
+func (p *RawPage) FragmentedBytes() int {
+	return int(p.Data[p.HeaderOffset()+7])
+}
+
+func (p *RawPage) SetFragmentedBytes(n int) {
+	p.Data[p.HeaderOffset()+7] = byte(n)
+}
+
+func (p *RawPage) RightMostPointer() uint32 {
+	return binary.BigEndian.Uint32(p.Data[p.HeaderOffset()+8:])
+}
+
+func (p *RawPage) SetRightMostPointer(n uint32) {
+	binary.BigEndian.PutUint32(p.Data[p.HeaderOffset()+8:], n)
+}
+
+func (p *RawPage) CellPointerOffset(i int) int {
+	return p.HeaderOffset() + p.HeaderSize() + i*2
+}
+
+func (p *RawPage) CellPointer(i int) int {
+	return p.u16(p.CellPointerOffset(i))
+}
+
+func (p *RawPage) SetCellPointer(i int, offset int) {
+	p.putU16(p.CellPointerOffset(i), offset)
+}
+
+// Unallocated space between the end of the cell pointer array
+// and the start of the cell content area
+func (p *RawPage) GapSize() int {
+	return p.CellContentStart() - p.CellPointerOffset(p.CellCount())
+}
+
+// Left child page number of the ith cell of an interior page
+func (p *RawPage) CellLeftChild(i int) uint32 {
+	return binary.BigEndian.Uint32(p.Data[p.CellPointer(i):])
+}
+
+// Page number of the ith child of an interior page,
+// the cell count addresses the right-most pointer
+func (p *RawPage) ChildPage(i int) uint32 {
+	if i == p.CellCount() {
+		return p.RightMostPointer()
+	}
+	return p.CellLeftChild(i)
+}
+
+func (p *RawPage) SetChildPage(i int, n uint32) {
+	if i == p.CellCount() {
+		p.SetRightMostPointer(n)
+		return
+	}
+	binary.BigEndian.PutUint32(p.Data[p.CellPointer(i):], n)
+}
+
+// A varint of a cell, its value and the byte range it occupies on the page
+type VarintField struct {
+	Value int64
+	Start int
+	End   int
+}
+
+// Byte ranges of the parts of a cell within its page. Interior pages
+// start their cells with the left child pointer, table pages store the
+// rowid and all but interior table pages carry a payload, of which the
+// part beyond Local bytes lives in a chain of overflow pages.
+type CellLayout struct {
+	Start        int
+	End          int
+	LeftChild    uint32
+	PayloadSize  VarintField
+	RowID        VarintField
+	PayloadStart int
+	Local        int
+	Overflow     uint32
+}
+
+// Decodes the layout of the ith cell
+// https://www.sqlite.org/fileformat.html#b_tree_pages
+func (p *RawPage) CellLayout(i int) CellLayout {
+	l := CellLayout{Start: p.CellPointer(i)}
+	offset := l.Start
+	pageType := p.PageType()
+	varint := func() VarintField {
+		v, read := ReadVarint(p.Data[offset:])
+		f := VarintField{Value: v, Start: offset, End: offset + read}
+		offset += read
+		return f
+	}
+	if pageType == InteriorTableType || pageType == InteriorIndexType {
+		l.LeftChild = binary.BigEndian.Uint32(p.Data[offset:])
+		offset += 4
+	}
+	if pageType != InteriorTableType {
+		l.PayloadSize = varint()
+	}
+	if pageType == LeafTableType || pageType == InteriorTableType {
+		l.RowID = varint()
+	}
+	l.PayloadStart = offset
+	if pageType != InteriorTableType {
+		payloadSize := int(l.PayloadSize.Value)
+		l.Local = localPayloadSize(payloadSize, p.Usable, pageType == LeafTableType)
+		offset += l.Local
+		if l.Local < payloadSize {
+			l.Overflow = binary.BigEndian.Uint32(p.Data[offset:])
+			offset += 4
+		}
+	}
+	l.End = offset
+	return l
+}
+
+// Rowid of the ith cell of a table page
+func (p *RawPage) CellRowID(i int) int64 {
+	return p.CellLayout(i).RowID.Value
+}
+
+// Number of payload bytes stored on the page itself, the remainder
+// spills into a chain of overflow pages
+// https://www.sqlite.org/fileformat.html#cell_payload
+func localPayloadSize(payloadSize int, usable int, isTable bool) int {
+	maxLocal := usable - MaxLocalPayloadOffset
+	if !isTable {
+		maxLocal = ((usable-12)*64/255 - 23)
+	}
+	if payloadSize <= maxLocal {
+		return payloadSize
+	}
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (payloadSize-minLocal)%(usable-4)
+	if local <= maxLocal {
+		return local
+	}
+	return minLocal
+}
+
+// Returns the payload size, the locally stored payload bytes
+// and the first overflow page of the ith cell
+func (p *RawPage) CellPayload(i int) (int, []byte, uint32) {
+	if p.PageType() == InteriorTableType {
+		return 0, nil, 0
+	}
+	l := p.CellLayout(i)
+	return int(l.PayloadSize.Value), p.Data[l.PayloadStart : l.PayloadStart+l.Local], l.Overflow
+}
+
+// Number of bytes the ith cell occupies in the cell content area
+func (p *RawPage) CellSize(i int) int {
+	l := p.CellLayout(i)
+	return maxInt(l.End-l.Start, MinCellSize)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Claims size bytes for a new cell, first from the freeblock list and
+// then from the unallocated gap, always leaving room for the new cell
+// pointer. When the free space is enough but too scattered the page is
+// defragmented first. Returns errPageFull when the page cannot hold
+// the cell.
+func (p *RawPage) allocateSpace(size int) (int, error) {
+	if p.FreeSpace() < size+2 {
+		return 0, errPageFull
+	}
+	if p.GapSize() >= 2 {
+		if offset, ok := p.allocateFromFreeblocks(size); ok {
+			return offset, nil
+		}
+	}
+	if p.GapSize() < size+2 {
+		p.Defragment()
+	}
+	offset := p.CellContentStart() - size
+	p.SetCellContentStart(offset)
+	return offset, nil
+}
+
+// First fit search of the freeblock list. The cell is taken from the end
+// of the block, leftovers smaller than a freeblock header become
+// fragmented bytes, unless that would push their total past the limit.
+func (p *RawPage) allocateFromFreeblocks(size int) (int, bool) {
+	prev := p.HeaderOffset() + 1
+	block := p.FirstFreeblock()
+	for block != 0 {
+		next := p.u16(block)
+		blockSize := p.u16(block + 2)
+		if blockSize >= size {
+			leftover := blockSize - size
+			if leftover < MinCellSize {
+				if p.FragmentedBytes()+leftover > MaxFragmentedBytes {
+					return 0, false
+				}
+				p.putU16(prev, next)
+				p.SetFragmentedBytes(p.FragmentedBytes() + leftover)
+				return block, true
+			}
+			p.putU16(block+2, leftover)
+			return block + leftover, true
+		}
+		prev = block
+		block = next
+	}
+	return 0, false
+}
+
+// Bytes available for new cells and their pointers: the unallocated
+// gap, the freeblocks and the fragmented bytes
+func (p *RawPage) FreeSpace() int {
+	free := p.GapSize() + p.FragmentedBytes()
+	for _, b := range p.Freeblocks() {
+		free += b.Size
+	}
+	return free
+}
+
+// Compacts the cell content area by moving all cells to the end of the
+// page, in cell pointer order, so the freeblocks and fragmented bytes
+// become part of the unallocated gap. The cell pointers are updated.
+func (p *RawPage) Defragment() {
+	cells := p.Cells()
+	content := p.Usable
+	for i, c := range cells {
+		content -= maxInt(len(c), MinCellSize)
+		copy(p.Data[content:], c)
+		p.SetCellPointer(i, content)
+	}
+	// clear what is left of the old content area
+	gap := p.CellPointerOffset(len(cells))
+	copy(p.Data[gap:content], make([]byte, content-gap))
+	p.SetCellContentStart(content)
+	p.SetFirstFreeblock(0)
+	p.SetFragmentedBytes(0)
+}
+
+type Freeblock struct {
+	Offset int
+	Size   int
+}
+
+// Walks the freeblock list, which sqlite keeps sorted by offset
+func (p *RawPage) Freeblocks() []Freeblock {
+	blocks := []Freeblock{}
+	for block := p.FirstFreeblock(); block != 0 && block+4 <= len(p.Data); block = p.u16(block) {
+		blocks = append(blocks, Freeblock{Offset: block, Size: p.u16(block + 2)})
+		if len(blocks) > len(p.Data)/4 {
+			break
+		}
+	}
+	return blocks
+}
+
+func (p *RawPage) setFreeblocks(blocks []Freeblock) {
+	prev := p.HeaderOffset() + 1
+	for _, b := range blocks {
+		p.putU16(prev, b.Offset)
+		p.putU16(b.Offset+2, b.Size)
+		prev = b.Offset
+	}
+	p.putU16(prev, 0)
+}
+
+// Returns size bytes at offset to the page. The space is added to the
+// freeblock list and merged with adjacent freeblocks, absorbing any
+// fragmented bytes in between. A freeblock at the start of the cell
+// content area is given back to the unallocated gap.
+func (p *RawPage) freeSpace(offset int, size int) {
+	blocks := p.Freeblocks()
+	idx := sort.Search(len(blocks), func(i int) bool { return blocks[i].Offset > offset })
+	blocks = append(blocks[:idx], append([]Freeblock{{offset, size}}, blocks[idx:]...)...)
+	fragments := p.FragmentedBytes()
+	merged := []Freeblock{}
+	for _, b := range blocks {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if gap := b.Offset - (last.Offset + last.Size); gap <= 3 {
+				fragments -= gap
+				last.Size = b.Offset + b.Size - last.Offset
+				continue
+			}
+		}
+		merged = append(merged, b)
+	}
+	if len(merged) > 0 && merged[0].Offset == p.CellContentStart() {
+		p.SetCellContentStart(merged[0].Offset + merged[0].Size)
+		merged = merged[1:]
+	}
+	p.SetFragmentedBytes(maxInt(fragments, 0))
+	p.setFreeblocks(merged)
+}
+
+// Copy of the ith cell
+func (p *RawPage) Cell(i int) []byte {
+	offset := p.CellPointer(i)
+	return append([]byte{}, p.Data[offset:offset+p.CellSize(i)]...)
+}
+
+// Copies of all cells on the page in order
+func (p *RawPage) Cells() [][]byte {
+	cells := make([][]byte, p.CellCount())
+	for i := range cells {
+		cells[i] = p.Cell(i)
+	}
+	return cells
+}
+
+// Turns the page into an empty page of the given type.
+// The database header on page 1 is left untouched.
+func (p *RawPage) Reset(pageType uint8) {
+	hdr := p.HeaderOffset()
+	for i := hdr; i < len(p.Data); i++ {
+		p.Data[i] = 0
+	}
+	p.Data[hdr] = pageType
+	p.SetCellContentStart(p.Usable)
+}
+
+// Fills an empty page with the cells in order
+func (p *RawPage) SetCells(cells [][]byte) error {
+	for i, c := range cells {
+		if err := p.InsertCell(i, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the ith cell, freeing its space and closing the gap
+// it leaves in the cell pointer array
+func (p *RawPage) DropCell(i int) {
+	count := p.CellCount()
+	offset := p.CellPointer(i)
+	size := p.CellSize(i)
+	start := p.CellPointerOffset(i)
+	end := p.CellPointerOffset(count)
+	copy(p.Data[start:end-2], p.Data[start+2:end])
+	p.SetCellCount(count - 1)
+	p.freeSpace(offset, size)
+}
+
+// Inserts the cell as the ith cell on the page, shifting
+// the pointers of all following cells one slot to the right
+func (p *RawPage) InsertCell(i int, cell []byte) error {
+	count := p.CellCount()
+	if i < 0 || i > count {
+		return fmt.Errorf("cell index %d out of range on page %d", i, p.Number)
+	}
+	offset, err := p.allocateSpace(maxInt(len(cell), MinCellSize))
+	if err != nil {
+		return err
+	}
+	copy(p.Data[offset:], cell)
+	start := p.CellPointerOffset(i)
+	end := p.CellPointerOffset(count)
+	copy(p.Data[start+2:end+2], p.Data[start:end])
+	p.SetCellCount(count + 1)
+	p.SetCellPointer(i, offset)
+	return nil
+}
@@ -0,0 +1,109 @@
+package sqlitefile
+
+import "sync"
+
+// Reads the leaf pages a scan is about to get to in the background, so
+// waiting on the disk or network overlaps with decoding the leaves
+// before them. Only pages of the database file are read ahead, pages
+// in the WAL are read as they are reached.
+type readAhead struct {
+	sync.Mutex
+	size  int
+	pages map[int64]*prefetchedPage
+}
+
+type prefetchedPage struct {
+	done chan struct{}
+	data []byte
+	n    int
+}
+
+// Returns nil, which reads nothing ahead, for a size of 0
+func newReadAhead(size int) *readAhead {
+	if size <= 0 {
+		return nil
+	}
+	return &readAhead{size: size, pages: map[int64]*prefetchedPage{}}
+}
+
+// Starts reading the pages that are not read yet, dropping the pages
+// read earlier that are not among them
+func (r *readAhead) fetch(db *Database, pages []int64) {
+	pageSize := db.Header.PageSizeBytes()
+	r.Lock()
+	defer r.Unlock()
+	keep := make(map[int64]*prefetchedPage, len(pages))
+	for _, number := range pages {
+		if p, ok := r.pages[number]; ok {
+			keep[number] = p
+			continue
+		}
+		if db.Wal != nil {
+			if _, ok := db.Wal.Frames[number]; ok {
+				continue
+			}
+		}
+		p := &prefetchedPage{done: make(chan struct{}), data: make([]byte, pageSize)}
+		keep[number] = p
+		go func(offset int64) {
+			p.n, _ = db.src.ReadAt(p.data, offset)
+			close(p.done)
+		}((number - 1) * pageSize)
+	}
+	r.pages = keep
+}
+
+// Copies into buf from a page read ahead, when buf lies within one that
+// was read in full. Anything else, failed reads included, is left to
+// the file.
+func (r *readAhead) read(buf []byte, offset, pageSize int64) (int, bool) {
+	number := offset/pageSize + 1
+	if offset+int64(len(buf)) > number*pageSize {
+		return 0, false
+	}
+	r.Lock()
+	p, ok := r.pages[number]
+	r.Unlock()
+	if !ok {
+		return 0, false
+	}
+	<-p.done
+	if int64(p.n) < pageSize {
+		return 0, false
+	}
+	return copy(buf, p.data[offset-(number-1)*pageSize:]), true
+}
+
+// Drops the pages read ahead, which may have changed since
+func (r *readAhead) clear() {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	r.pages = map[int64]*prefetchedPage{}
+	r.Unlock()
+}
+
+// Reads ahead the siblings after child i of an interior table page.
+// Called once child i is known to be a leaf, as then all of them are.
+func (db *Database) readLeavesAhead(children []int64, i int) {
+	if db.readAhead == nil {
+		return
+	}
+	db.readAhead.fetch(db, children[i:min(len(children), i+1+db.readAhead.size)])
+}
+
+// Left pointers of the cells of an interior table page followed by its
+// right-most pointer, in key order
+func childPages(p *Page) []int64 {
+	children := make([]int64, 0, len(p.Cells)+1)
+	for _, c := range p.Cells {
+		if c.LeftPageNumber > 0 {
+			children = append(children, int64(c.LeftPageNumber))
+		}
+	}
+	if p.Header.RightMostPointer > 0 {
+		children = append(children, int64(p.Header.RightMostPointer))
+	}
+	return children
+}
@@ -0,0 +1,146 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Serializes Go values into the sqlite record format, the inverse of
+// ReadDataFromHeaderIndex. Databases with schema format 4 store the
+// integers 0 and 1 as serial types 8 and 9, which have no content.
+// https://www.sqlite.org/fileformat.html#record_format
+type recordSerializer struct {
+	SchemaFormat uint32
+}
+
+// Converts a typed Go value to one of the types a record can hold:
+// nil, int64, float64, string or []byte. Booleans are stored as 0 or 1.
+func normalizeValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, int64, float64, string, []byte:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d overflows int64", v)
+		}
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d overflows int64", v)
+		}
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	return nil, fmt.Errorf("cannot store value of type %T", v)
+}
+
+// Returns the serial type and content size used to store v,
+// picking the smallest integer width that can hold the value
+func (s recordSerializer) SerialType(v any) (int64, int, error) {
+	v, err := normalizeValue(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return int64(SerialNull), 0, nil
+	case int64:
+		switch {
+		case s.SchemaFormat >= 4 && v == 0:
+			return int64(Serial0), 0, nil
+		case s.SchemaFormat >= 4 && v == 1:
+			return int64(Serial1), 0, nil
+		case v >= math.MinInt8 && v <= math.MaxInt8:
+			return int64(Serial8TwosComplement), 1, nil
+		case v >= math.MinInt16 && v <= math.MaxInt16:
+			return int64(Serial16TwosComplement), 2, nil
+		case v >= -(1<<23) && v < 1<<23:
+			return int64(Serial24TwosComplement), 3, nil
+		case v >= math.MinInt32 && v <= math.MaxInt32:
+			return int64(Serial32TwosComplement), 4, nil
+		case v >= -(1<<47) && v < 1<<47:
+			return int64(Serial48TwosComplement), 6, nil
+		}
+		return int64(Serial64TwosComplement), 8, nil
+	case float64:
+		return int64(SerialFloat), 8, nil
+	case string:
+		return int64(len(v))*2 + int64(SerialText), len(v), nil
+	case []byte:
+		return int64(len(v))*2 + int64(SerialBlob), len(v), nil
+	}
+	return 0, 0, fmt.Errorf("cannot store value of type %T", v)
+}
+
+// Produces the record header, holding its own size and one serial type
+// varint per value, and the body with the content of each value in order.
+func (s recordSerializer) Serialize(values []any) ([]byte, []byte, error) {
+	serials := []byte{}
+	body := []byte{}
+	for _, v := range values {
+		serial, size, err := s.SerialType(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		serials = AppendVarint(serials, serial)
+		if size == 0 {
+			continue
+		}
+		switch v, _ := normalizeValue(v); v := v.(type) {
+		case int64:
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], uint64(v))
+			body = append(body, b[8-size:]...)
+		case float64:
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			body = append(body, v...)
+		case []byte:
+			body = append(body, v...)
+		}
+	}
+	// the header size varint counts itself
+	headerSize := int64(len(serials) + 1)
+	for headerSize != int64(len(serials)+VarintLen(headerSize)) {
+		headerSize = int64(len(serials) + VarintLen(headerSize))
+	}
+	header := make([]byte, 0, headerSize)
+	header = AppendVarint(header, headerSize)
+	return append(header, serials...), body, nil
+}
+
+// Encodes values as a complete record, header followed by body
+func (s recordSerializer) Encode(values []any) ([]byte, error) {
+	header, body, err := s.Serialize(values)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+// Encodes values for the database being written, using
+// the serial types its schema format allows
+func (tx *writeTxn) encodeRecord(values []any) ([]byte, error) {
+	return recordSerializer{SchemaFormat: tx.db.Header.SchemaFormat}.Encode(values)
+}
@@ -0,0 +1,322 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"sort"
+	"unicode/utf8"
+)
+
+// A record carved out of free space
+type RecoveredRecord struct {
+	Page   int64
+	Offset int
+	Source string
+	Table  string
+	RowID  int64
+	// false when the rowid was overwritten
+	HasRowID bool
+	Values   []any
+	// bytes taken up by the record
+	Length int
+}
+
+// Tables records are matched against, by column count
+type recoveryTable struct {
+	Name   string
+	Schema *Record
+}
+
+// Searches the free space of the database for rows of the given tables
+// that were deleted but not yet overwritten.
+//
+// Leaf table pages are searched in their freeblocks and the unallocated
+// gap, and pages on the freelist are decoded as leaf table pages when they
+// still look like one or searched byte by byte otherwise. A record is
+// recognized by a header that describes exactly as many columns as a
+// table has and content that fits the space it was found in. Deleting a
+// cell overwrites its first four bytes with the freeblock header, which
+// usually takes the payload size, the rowid and the start of the record
+// header with it. Those records are rebuilt when the lost part can be
+// worked out from what is left, but their rowid is gone. Rows that still
+// exist in their table are left out.
+func (db *Database) Recover(names []string) ([]RecoveredRecord, error) {
+	tables := []recoveryTable{}
+	for _, name := range names {
+		schema, ok := db.Tables[name]
+		if !ok {
+			return nil, TableNotFoundError(name)
+		}
+		tables = append(tables, recoveryTable{name, schema})
+	}
+	uses, err := MapPages(db)
+	if err != nil {
+		return nil, err
+	}
+	pageCount, err := db.PageCount()
+	if err != nil {
+		return nil, err
+	}
+	records := []RecoveredRecord{}
+	for n := int64(1); n <= pageCount; n++ {
+		use := uses[n]
+		candidates := tables
+		switch use.Kind {
+		case PageBtree:
+			// free space of a b-tree only holds rows of its own table
+			candidates = nil
+			for _, t := range tables {
+				if t.Name == use.Owner {
+					candidates = append(candidates, t)
+				}
+			}
+		case PageFreelistTrunk, PageFreelistLeaf, PageUnused:
+		default:
+			continue
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		p, err := ReadRawPage(db, n)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, carvePage(p, use, candidates)...)
+	}
+	return withoutLiveRows(db, records)
+}
+
+// Carves the records out of a page. Pages that are in use are only
+// searched in their free space, free pages that still hold a leaf table
+// page have their cells decoded as well.
+func carvePage(p *RawPage, use PageUse, tables []recoveryTable) []RecoveredRecord {
+	records := []RecoveredRecord{}
+	if use.Kind != PageBtree {
+		if p.PageType() != LeafTableType || !looksLikeBtreePage(p) {
+			start := 0
+			if use.Kind == PageFreelistTrunk {
+				// skip the next trunk, the leaf count and the leaf numbers
+				start = int(min(8+4*int64(binary.BigEndian.Uint32(p.Data[4:])), int64(p.Usable)))
+			}
+			return carveRegion(p, start, p.Usable, "free page", tables)
+		}
+		for i := 0; i < p.CellCount(); i++ {
+			if r, ok := decodeFreedCell(p, i, tables); ok {
+				records = append(records, r)
+			}
+		}
+	} else if p.PageType() != LeafTableType {
+		return nil
+	}
+	for _, b := range p.Freeblocks() {
+		end := minInt(b.Offset+b.Size, p.Usable)
+		if r, ok := carveFreeblockHead(p, b.Offset, end, tables); ok {
+			records = append(records, r)
+			records = append(records, carveRegion(p, r.Offset+r.Length, end, "freeblock", tables)...)
+			continue
+		}
+		records = append(records, carveRegion(p, b.Offset+4, end, "freeblock", tables)...)
+	}
+	gapStart := p.CellPointerOffset(p.CellCount())
+	records = append(records, carveRegion(p, gapStart, p.CellContentStart(), "unallocated", tables)...)
+	sort.Slice(records, func(i, j int) bool { return records[i].Offset < records[j].Offset })
+	return records
+}
+
+// Whether the cell pointers of a page that was freed still make sense
+func looksLikeBtreePage(p *RawPage) bool {
+	pointers := p.CellPointerOffset(p.CellCount())
+	if pointers > p.Usable || p.CellContentStart() < pointers || p.CellContentStart() > p.Usable {
+		return false
+	}
+	for i := 0; i < p.CellCount(); i++ {
+		if at := p.CellPointer(i); at < p.CellContentStart() || at >= p.Usable {
+			return false
+		}
+	}
+	return true
+}
+
+// Decodes cell i of a freed leaf table page. Cells spilling into overflow
+// pages are skipped as their chain has been freed along with the page.
+func decodeFreedCell(p *RawPage, i int, tables []recoveryTable) (r RecoveredRecord, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	l := p.CellLayout(i)
+	if l.Overflow != 0 || l.End > p.Usable {
+		return r, false
+	}
+	payload := p.Data[l.PayloadStart:l.End]
+	for _, t := range tables {
+		if values, length, ok := decodeCarvedRecord(payload, t.Schema); ok {
+			return RecoveredRecord{p.Number, l.Start, "freed page", t.Name, l.RowID.Value, true, values, length}, true
+		}
+	}
+	return r, false
+}
+
+// Searches data[start:end] of a page byte by byte for intact records. The
+// rowid is recovered when the payload size and rowid varints in front of
+// a record are intact as well.
+func carveRegion(p *RawPage, start, end int, source string, tables []recoveryTable) []RecoveredRecord {
+	records := []RecoveredRecord{}
+	for offset := start; offset < end; offset++ {
+		for _, t := range tables {
+			values, length, ok := decodeCarvedRecord(p.Data[offset:end], t.Schema)
+			if !ok {
+				continue
+			}
+			r := RecoveredRecord{Page: p.Number, Offset: offset, Source: source, Table: t.Name, Values: values, Length: length}
+			r.RowID, r.HasRowID = rowIDInFront(p.Data[start:offset], length)
+			records = append(records, r)
+			offset += length - 1
+			break
+		}
+	}
+	return records
+}
+
+// Looks for a payload size varint equal to the length of the record
+// followed by a rowid varint right at the end of data
+func rowIDInFront(data []byte, length int) (int64, bool) {
+	for rowIDSize := 1; rowIDSize <= 9 && rowIDSize < len(data); rowIDSize++ {
+		rowID, read := ReadVarint(data[len(data)-rowIDSize:])
+		if read != rowIDSize || rowID < 1 {
+			continue
+		}
+		for sizeLen := 1; sizeLen <= 9 && sizeLen+rowIDSize <= len(data); sizeLen++ {
+			size, read := ReadVarint(data[len(data)-rowIDSize-sizeLen:])
+			if read == sizeLen && size == int64(length) {
+				return rowID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Rebuilds a deleted cell at the start of a freeblock, whose first four
+// bytes were overwritten. When the payload size and rowid took three
+// bytes only the header size is lost, which follows from the serial
+// types. When they took two bytes the serial type of the first column
+// is lost as well, which is only known for a rowid alias stored as NULL.
+func carveFreeblockHead(p *RawPage, start, end int, tables []recoveryTable) (RecoveredRecord, bool) {
+	for _, t := range tables {
+		n := t.Schema.ColumnCount()
+		for lead := 3; lead >= 2; lead-- {
+			lost := []byte{}
+			if lead == 2 {
+				if t.Schema.RowidColumn != 0 {
+					continue
+				}
+				lost = []byte{0}
+			}
+			rest, ok := readSerialTypes(p.Data[start+4:end], n-len(lost))
+			if !ok {
+				continue
+			}
+			header := append([]byte{byte(1 + len(lost) + len(rest))}, lost...)
+			header = append(header, rest...)
+			if header[0] >= 0x80 {
+				continue
+			}
+			record := append(header, p.Data[start+4+len(rest):end]...)
+			values, length, ok := decodeCarvedRecord(record, t.Schema)
+			if !ok {
+				continue
+			}
+			// the record starts with the lost header size byte
+			return RecoveredRecord{p.Number, start + lead, "freeblock", t.Name, 0, false, values, length}, true
+		}
+	}
+	return RecoveredRecord{}, false
+}
+
+// Reads the bytes of n serial type varints
+func readSerialTypes(data []byte, n int) ([]byte, bool) {
+	offset := 0
+	for i := 0; i < n; i++ {
+		if offset >= len(data) {
+			return nil, false
+		}
+		_, read := ReadVarint(data[offset:])
+		offset += read
+	}
+	return data[:offset], true
+}
+
+// Decodes the record at the start of data when it looks like a row of
+// the table: a header with a valid serial type for every column, NULL
+// for a rowid alias, no numbers in TEXT columns, valid UTF-8 text,
+// content that fits in data and at least one column that is not empty.
+// Returns the values and the length of the record.
+func decodeCarvedRecord(data []byte, schema *Record) ([]any, int, bool) {
+	n := schema.ColumnCount()
+	if len(data) == 0 || data[0] < 2 {
+		return nil, 0, false
+	}
+	l, err := DecodeRecordLayout(data)
+	if err != nil || len(l.Columns) != n || l.HeaderSize.End != 1 {
+		return nil, 0, false
+	}
+	for i, c := range l.Columns {
+		switch t := c.Type.Value; {
+		case t == 10 || t == 11:
+			return nil, 0, false
+		case i == schema.RowidColumn && t != 0:
+			return nil, 0, false
+		case t >= 1 && t <= 9 && schema.ColumnAffinity[i] == AffinityText:
+			return nil, 0, false
+		case t >= 13 && t%2 == 1 && !utf8.Valid(data[c.Start:c.End]):
+			return nil, 0, false
+		}
+	}
+	// zeroed space reads as a record of NULLs
+	if l.Columns[n-1].End == int(l.HeaderSize.Value) {
+		return nil, 0, false
+	}
+	length := l.Columns[n-1].End
+	record, err := NewRecordCell(0, data[:length])
+	if err != nil {
+		return nil, 0, false
+	}
+	values, err := recordValues(record, n)
+	if err != nil {
+		return nil, 0, false
+	}
+	return values, length, true
+}
+
+// Drops recovered records identical to a row that still exists, as left
+// behind in the unallocated gap when sqlite moves cells around
+func withoutLiveRows(db *Database, records []RecoveredRecord) ([]RecoveredRecord, error) {
+	live := map[string]map[string]bool{}
+	kept := []RecoveredRecord{}
+	for _, r := range records {
+		rows, ok := live[r.Table]
+		if !ok {
+			rows = map[string]bool{}
+			root, err := db.Tables[r.Table].RootPage()
+			if err != nil {
+				return nil, err
+			}
+			err = WalkTableCells(db, root, func(c *Record) error {
+				values, err := recordValues(c, len(c.Header))
+				if err != nil {
+					return err
+				}
+				rows[FormatValueTuple(values)] = true
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			live[r.Table] = rows
+		}
+		if !rows[FormatValueTuple(r.Values)] {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,416 @@
+package sqlitefile
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of RemoteVFS. Reading a chunk that is not cached fetches the
+// chunks after it in parallel, as b-tree pages written together, such as
+// the leaves of a table filled in rowid order, tend to sit next to each
+// other in the file.
+const (
+	RemoteChunkSize   = 64 * 1024
+	RemotePrefetch    = 4
+	RemoteRetries     = 3
+	RemoteCacheChunks = 256
+)
+
+// Reads databases over HTTP with range requests, so a database in object
+// storage can be explored without downloading it. Files are read in
+// chunks of ChunkSize bytes, keeping the last CacheChunks in memory.
+// Requests failing with a network error, a 5xx status or 429 are tried
+// again Retries times, backing off between attempts.
+//
+// Names are resolved to URLs by the VFS, so the WAL and journal are
+// looked for next to the database, as name-wal and name-journal.
+type RemoteVFS struct {
+	Client      *http.Client
+	ChunkSize   int64
+	Prefetch    int
+	Retries     int
+	CacheChunks int
+	resolve     func(name string) (string, error)
+	sign        func(r *http.Request) error
+}
+
+// Reads http and https URLs as they are
+func NewHTTPVFS() *RemoteVFS {
+	return newRemoteVFS(func(name string) (string, error) {
+		u, err := url.Parse(name)
+		if err != nil {
+			return "", err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", fmt.Errorf("not an http URL: %s", name)
+		}
+		return name, nil
+	}, nil)
+}
+
+// Where and as whom S3 objects are read. Without an access key requests
+// are sent unsigned, which public buckets allow.
+type S3Config struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// an S3 compatible service to use instead of AWS, such as MinIO or
+	// the XML API of GCS, addressed with the bucket in the path
+	Endpoint string
+}
+
+// Reads s3://bucket/key names from S3, signing requests with
+// Signature Version 4
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+func NewS3VFS(c S3Config) *RemoteVFS {
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	resolve := func(name string) (string, error) {
+		bucket, key, err := splitBucketURL(name, "s3")
+		if err != nil {
+			return "", err
+		}
+		if c.Endpoint != "" {
+			return strings.TrimSuffix(c.Endpoint, "/") + "/" + uriEncode(bucket, false) + "/" + uriEncode(key, true), nil
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, c.Region, uriEncode(key, true)), nil
+	}
+	var sign func(r *http.Request) error
+	if c.AccessKeyID != "" {
+		sign = func(r *http.Request) error {
+			signV4(r, c, time.Now().UTC())
+			return nil
+		}
+	}
+	return newRemoteVFS(resolve, sign)
+}
+
+// Where and as whom GCS objects are read. Without a token requests are
+// sent anonymously, which public buckets allow.
+type GCSConfig struct {
+	// an OAuth 2.0 access token, as printed by
+	// gcloud auth print-access-token
+	Token    string
+	Endpoint string
+}
+
+// Reads gs://bucket/object names from Google Cloud Storage through its
+// XML API, which takes range requests like S3 does. Buckets can also be
+// read with HMAC keys by pointing NewS3VFS at storage.googleapis.com.
+func NewGCSVFS(c GCSConfig) *RemoteVFS {
+	if c.Endpoint == "" {
+		c.Endpoint = "https://storage.googleapis.com"
+	}
+	resolve := func(name string) (string, error) {
+		bucket, key, err := splitBucketURL(name, "gs")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(c.Endpoint, "/") + "/" + uriEncode(bucket, false) + "/" + uriEncode(key, true), nil
+	}
+	var sign func(r *http.Request) error
+	if c.Token != "" {
+		sign = func(r *http.Request) error {
+			r.Header.Set("Authorization", "Bearer "+c.Token)
+			return nil
+		}
+	}
+	return newRemoteVFS(resolve, sign)
+}
+
+func newRemoteVFS(resolve func(string) (string, error), sign func(*http.Request) error) *RemoteVFS {
+	return &RemoteVFS{
+		Client:      http.DefaultClient,
+		ChunkSize:   RemoteChunkSize,
+		Prefetch:    RemotePrefetch,
+		Retries:     RemoteRetries,
+		CacheChunks: RemoteCacheChunks,
+		resolve:     resolve,
+		sign:        sign,
+	}
+}
+
+// Splits scheme://bucket/key
+func splitBucketURL(name, scheme string) (string, string, error) {
+	rest, ok := strings.CutPrefix(name, scheme+"://")
+	if !ok {
+		return "", "", fmt.Errorf("not an %s URL: %s", scheme, name)
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("%s URL needs a bucket and a key: %s", scheme, name)
+	}
+	return bucket, key, nil
+}
+
+// Looks up the size of the file with a HEAD request. A server saying it
+// does not serve ranges fails here, one that sends the whole file for a
+// range request on the first read.
+func (v *RemoteVFS) Open(name string) (VFSFile, error) {
+	u, err := v.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &remoteFile{vfs: v, name: name, url: u, chunks: map[int64]*remoteChunk{}}
+	res, err := f.do(http.MethodHead, "")
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New(res.Status)}
+	}
+	if res.ContentLength < 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("server did not send the size of the file")}
+	}
+	if res.Header.Get("Accept-Ranges") == "none" {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrRangeNotSupported}
+	}
+	f.size = res.ContentLength
+	return f, nil
+}
+
+type remoteFile struct {
+	vfs  *RemoteVFS
+	name string
+	url  string
+	size int64
+	// guards the chunks, as Lock and Unlock are the VFSFile locks
+	mu     sync.Mutex
+	chunks map[int64]*remoteChunk
+	// chunk numbers in the order they were fetched, oldest first
+	fetched []int64
+}
+
+// A chunk being fetched, which is done once done is closed
+type remoteChunk struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func (f *remoteFile) ReadAt(buf []byte, offset int64) (int, error) {
+	chunkSize := f.vfs.ChunkSize
+	read := 0
+	for read < len(buf) {
+		if offset >= f.size {
+			return read, io.EOF
+		}
+		n := offset / chunkSize
+		c := f.chunk(n, true)
+		<-c.done
+		if c.err != nil {
+			// drop it, so the next read tries again
+			f.mu.Lock()
+			if f.chunks[n] == c {
+				delete(f.chunks, n)
+			}
+			f.mu.Unlock()
+			return read, c.err
+		}
+		copied := copy(buf[read:], c.data[offset-n*chunkSize:])
+		read += copied
+		offset += int64(copied)
+	}
+	return read, nil
+}
+
+// Returns chunk n, starting to fetch it when it is not cached. A chunk
+// that was not cached has the Prefetch chunks after it fetched as well.
+func (f *remoteFile) chunk(n int64, prefetch bool) *remoteChunk {
+	f.mu.Lock()
+	c, ok := f.chunks[n]
+	if !ok {
+		c = &remoteChunk{done: make(chan struct{})}
+		f.chunks[n] = c
+		f.fetched = append(f.fetched, n)
+		f.evict()
+		go f.fetch(n, c)
+	}
+	f.mu.Unlock()
+	if !ok && prefetch {
+		for i := int64(1); i <= int64(f.vfs.Prefetch) && (n+i)*f.vfs.ChunkSize < f.size; i++ {
+			f.chunk(n+i, false)
+		}
+	}
+	return c
+}
+
+// Drops the oldest chunks beyond CacheChunks. Chunks being read keep
+// their data, they are only no longer found.
+func (f *remoteFile) evict() {
+	for len(f.fetched) > max(f.vfs.CacheChunks, f.vfs.Prefetch+1) {
+		delete(f.chunks, f.fetched[0])
+		f.fetched = f.fetched[1:]
+	}
+}
+
+func (f *remoteFile) fetch(n int64, c *remoteChunk) {
+	defer close(c.done)
+	start := n * f.vfs.ChunkSize
+	end := min(start+f.vfs.ChunkSize, f.size) - 1
+	res, err := f.do(http.MethodGet, fmt.Sprintf("bytes=%d-%d", start, end))
+	if err != nil {
+		c.err = err
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		c.err = &fs.PathError{Op: "read", Path: f.name, Err: ErrRangeNotSupported}
+		return
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		c.err = fmt.Errorf("failed to read bytes %d-%d of %s: %s", start, end, f.name, res.Status)
+		return
+	}
+	c.data = make([]byte, end-start+1)
+	if _, err := io.ReadFull(res.Body, c.data); err != nil {
+		c.err = fmt.Errorf("failed to read bytes %d-%d of %s: %w", start, end, f.name, err)
+	}
+}
+
+// Sends a request for the file, trying again on errors that may pass
+func (f *remoteFile) do(method, byteRange string) (*http.Response, error) {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, f.url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+		}
+		if f.vfs.sign != nil {
+			if err := f.vfs.sign(req); err != nil {
+				return nil, err
+			}
+		}
+		res, err := f.vfs.Client.Do(req)
+		retry := err != nil || res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+		if !retry || attempt >= f.vfs.Retries {
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (f *remoteFile) Size() (int64, error) {
+	return f.size, nil
+}
+
+func (f *remoteFile) Close() error {
+	return nil
+}
+
+func (f *remoteFile) Lock() error {
+	return errors.New("remote databases cannot be locked")
+}
+
+func (f *remoteFile) Unlock() error {
+	return nil
+}
+
+// Signs r with AWS Signature Version 4 as of now. Bodies are never sent,
+// so the payload hash is that of an empty one.
+func signV4(r *http.Request, c S3Config, now time.Time) {
+	const algorithm = "AWS4-HMAC-SHA256"
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex("")
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	headers := map[string]string{"host": r.URL.Host}
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, uriEncode(key, false)+"="+uriEncode(value, false))
+		}
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+	stringToSign := algorithm + "\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	for _, part := range []string{c.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Percent-encodes all but the unreserved characters, as signing expects,
+// keeping slashes of object keys
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
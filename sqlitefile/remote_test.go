@@ -0,0 +1,54 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRemoteRangeRequests(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 16*1024)
+	ranges := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "a.db", time.Time{}, bytes.NewReader(data))
+	}))
+	defer ranges.Close()
+	// sends the whole file whatever the request asks for
+	whole := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}))
+	defer whole.Close()
+	none := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "none")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}))
+	defer none.Close()
+
+	f, err := NewHTTPVFS().Open(ranges.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if _, err := f.ReadAt(buf, 70000); err != nil || !bytes.Equal(buf, data[70000:70100]) {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+	f.Close()
+
+	f, err = NewHTTPVFS().Open(whole.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadAt(buf, 0); !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("read from a server ignoring ranges: %v", err)
+	}
+	f.Close()
+
+	if _, err := NewHTTPVFS().Open(none.URL); !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("opened on a server without ranges: %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// The result of a query, read row by row with Next and Scan like the
+// rows of database/sql. The rows of a stored table are read from its
+// b-tree as Next asks for them, while counts, joins, queries without
+// FROM and registered tables are read whole when Next gets to them.
+type Rows struct {
+	db     *Database
+	query  SelectCtx
+	tables []string
+	// the table being read a row at a time
+	scan *tableScan
+	// the rows left of a table read whole
+	rows   [][]any
+	row    []any
+	err    error
+	closed bool
+}
+
+// A query on a stored table read a row at a time, from the rows an
+// index lists for it or else from a cursor over the whole table
+type tableScan struct {
+	db     *Database
+	q      *queryContext
+	cursor *Cursor
+	// the rows left to read when an index serves the query
+	rowids  []int64
+	indexed bool
+	started bool
+	done    bool
+	// rows read, to check the file change counter every so often
+	read    int
+	pending [][]any
+	// the span of the scan, open until its last row is read or the rows
+	// are closed
+	span Span
+}
+
+// Runs a SELECT and returns its rows
+func (db *Database) Query(sql string) (*Rows, error) {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStatement, sql)
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, errors.New("not a query: " + sql)
+	}
+	s := NewSelectCtx(sel)
+	if s.err != nil {
+		return nil, s.err
+	}
+	tables := s.Tables
+	if s.join != nil {
+		tables = []string{s.join.left.name, s.join.right.name}
+	}
+	for _, t := range tables {
+		if s.isLiteral() {
+			break
+		}
+		if _, err := db.tableColumns(t); err != nil {
+			return nil, err
+		}
+	}
+	return &Rows{db: db, query: s, tables: s.Tables}, nil
+}
+
+// Names of the columns of the result
+func (r *Rows) Columns() []string {
+	if len(r.query.Tables) == 0 {
+		return r.query.Identifiers
+	}
+	return r.db.ResultColumns(r.query, r.query.Tables[0])
+}
+
+// Moves to the next row, returning false once there are no more rows
+// or reading them failed, which Err tells apart
+func (r *Rows) Next() bool {
+	for {
+		switch {
+		case r.closed || r.err != nil:
+			r.row = nil
+			return false
+		case r.scan != nil:
+			if r.row, r.err = r.scan.next(); r.row != nil {
+				return true
+			}
+			r.scan = nil
+		case len(r.rows) > 0:
+			r.row, r.rows = r.rows[0], r.rows[1:]
+			return true
+		case len(r.tables) == 0:
+			r.row = nil
+			return false
+		default:
+			r.err = r.openTable(r.tables[0])
+			r.tables = r.tables[1:]
+		}
+	}
+}
+
+func (r *Rows) openTable(table string) error {
+	scan, err := newTableScan(r.db, r.query, table)
+	if err != nil || scan != nil {
+		r.scan = scan
+		return err
+	}
+	return r.readTable(table)
+}
+
+func (r *Rows) readTable(table string) error {
+	emit := func(values []any) error {
+		r.rows = append(r.rows, values)
+		return nil
+	}
+	count, err := SelectTable(r.db, r.query, table, emit, nil)
+	if err != nil {
+		r.rows = nil
+		return err
+	}
+	if r.query.IsCount {
+		r.rows = append(r.rows, []any{int64(count)})
+	}
+	return nil
+}
+
+// Copies the columns of the current row into dest, which takes a
+// pointer for every column. Values are converted to *int64, *int,
+// *float64, *bool, *string and *[]byte as sqlite would, *any takes
+// them as they are.
+func (r *Rows) Scan(dest ...any) error {
+	if r.row == nil {
+		return errors.New("Scan called without a row, call Next first")
+	}
+	if len(dest) != len(r.row) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(r.row), len(dest))
+	}
+	for i, v := range r.row {
+		if err := scanValue(v, dest[i]); err != nil {
+			return fmt.Errorf("column %d (%s): %w", i, r.Columns()[i], err)
+		}
+	}
+	return nil
+}
+
+// The error that stopped Next, if any
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Drops the rows not read yet
+func (r *Rows) Close() error {
+	r.closed = true
+	if r.scan != nil {
+		r.scan.end(nil)
+	}
+	r.scan, r.rows, r.row = nil, nil, nil
+	return nil
+}
+
+// Prepares to read a stored table a row at a time. Returns nil for the
+// queries that are read whole: counts, joins, queries without FROM and
+// those on registered or WITHOUT ROWID tables.
+func newTableScan(d *Database, s SelectCtx, table string) (*tableScan, error) {
+	if _, ok := d.virtualTables[table]; ok || s.isLiteral() || s.IsCount || s.join != nil {
+		return nil, nil
+	}
+	if schema, ok := d.tableSchema(table); ok && schema.WithoutRowid {
+		return nil, nil
+	}
+	span := d.startSpan("select", "table", table)
+	q := newQueryContext(s, table)
+	root, err := q.openTable(d)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+	t := &tableScan{db: d, q: q, cursor: &Cursor{db: d, schema: q.rootCell, root: root}, span: span}
+	q.emit = func(values []any) error {
+		t.pending = append(t.pending, values)
+		return nil
+	}
+	if t.rowids, t.indexed, err = indexedRowids(d, q); err != nil {
+		t.end(err)
+	}
+	return t, err
+}
+
+// Reads up to the next row that matches, returning nil after the last
+func (t *tableScan) next() ([]any, error) {
+	for len(t.pending) == 0 {
+		if t.done {
+			t.end(nil)
+			return nil, nil
+		}
+		if err := t.step(); err != nil {
+			t.end(err)
+			return nil, err
+		}
+	}
+	row := t.pending[0]
+	t.pending = t.pending[1:]
+	return row, nil
+}
+
+func (t *tableScan) end(err error) {
+	if t.span != nil {
+		t.span.End(err)
+		t.span = nil
+	}
+}
+
+// Reads one row, which may not match
+func (t *tableScan) step() error {
+	q := t.q
+	t.read++
+	if t.read%SnapshotCheckInterval == 0 {
+		if err := checkSnapshot(t.db, q); err != nil {
+			return err
+		}
+	}
+	if q.query.Limit > 0 && q.count >= q.query.Limit {
+		t.done = true
+		return checkSnapshot(t.db, q)
+	}
+	if t.indexed {
+		if len(t.rowids) == 0 {
+			t.done = true
+			return checkSnapshot(t.db, q)
+		}
+		rowid := t.rowids[0]
+		t.rowids = t.rowids[1:]
+		return readIndexedRow(t.cursor, rowid, q)
+	}
+	var ok bool
+	var err error
+	switch {
+	case !t.started && q.query.Descending:
+		ok, err = t.cursor.Last()
+	case !t.started:
+		ok, err = t.cursor.First()
+	case q.query.Descending:
+		ok, err = t.cursor.Prev()
+	default:
+		ok, err = t.cursor.Next()
+	}
+	t.started = true
+	if err != nil {
+		return err
+	}
+	if !ok {
+		t.done = true
+		return checkSnapshot(t.db, q)
+	}
+	c, err := t.cursor.currentRecord()
+	if err != nil {
+		return err
+	}
+	return handleQueryRow(c, q)
+}
+
+func scanValue(v any, dest any) error {
+	switch d := dest.(type) {
+	case *any:
+		*d = v
+		return nil
+	case *string:
+		if v == nil {
+			return errors.New("cannot scan NULL into *string")
+		}
+		*d = FormatValue(v)
+		return nil
+	case *[]byte:
+		switch v := v.(type) {
+		case nil:
+			*d = nil
+		case []byte:
+			*d = append([]byte(nil), v...)
+		default:
+			*d = []byte(FormatValue(v))
+		}
+		return nil
+	case *int64:
+		n, err := scanInt(v)
+		*d = n
+		return err
+	case *int:
+		n, err := scanInt(v)
+		*d = int(n)
+		return err
+	case *bool:
+		n, err := scanInt(v)
+		*d = n != 0
+		return err
+	case *float64:
+		switch v := v.(type) {
+		case float64:
+			*d = v
+		case int64:
+			*d = float64(v)
+		case string, []byte:
+			f, err := strconv.ParseFloat(FormatValue(v), 64)
+			if err != nil {
+				return fmt.Errorf("cannot scan %q into *float64", v)
+			}
+			*d = f
+		default:
+			return fmt.Errorf("cannot scan %T into *float64", v)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported Scan destination %T", dest)
+}
+
+func scanInt(v any) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, fmt.Errorf("cannot scan %s into an integer", formatReal(v))
+		}
+		return int64(v), nil
+	case string, []byte:
+		n, err := strconv.ParseInt(FormatValue(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot scan %q into an integer", v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("cannot scan %T into an integer", v)
+}
@@ -0,0 +1,187 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// An R*Tree virtual table, a spatial index of boxes kept as a tree of
+// fixed size nodes in the %_node shadow table
+// https://www.sqlite.org/rtree.html
+type RTreeTable struct {
+	Name string
+	// rtree_i32 tables store 32-bit integer coordinates instead of
+	// 32-bit floats
+	Integer bool
+	// the id column, then the minimum and maximum of each dimension
+	Columns    []string
+	Dimensions int
+	// auxiliary columns, kept in the %_rowid shadow table
+	Aux          []string
+	ShadowTables []string
+}
+
+// A box stored in an R*Tree, its minimum and maximum coordinate for
+// each dimension in turn
+type RTreeEntry struct {
+	Rowid  int64
+	Coords []float64
+}
+
+// Finds the R*Tree tables of the database, sorted by name
+func (db *Database) RTreeTables() ([]RTreeTable, error) {
+	rows, err := ReadSchemaRows(db)
+	if err != nil {
+		return nil, err
+	}
+	tables := []RTreeTable{}
+	for _, row := range rows {
+		module, args, ok := parseVirtualTable(row)
+		if !ok || (module != "rtree" && module != "rtree_i32") {
+			continue
+		}
+		t := RTreeTable{Name: row.Name, Integer: module == "rtree_i32", Columns: []string{}, Aux: []string{}}
+		for _, arg := range args {
+			name := strings.Trim(strings.Fields(arg)[0], "\"'`[]")
+			if strings.HasPrefix(name, "+") {
+				t.Aux = append(t.Aux, strings.TrimPrefix(name, "+"))
+			} else {
+				t.Columns = append(t.Columns, name)
+			}
+		}
+		t.Dimensions = (len(t.Columns) - 1) / 2
+		for _, suffix := range []string{"node", "parent", "rowid"} {
+			if _, ok := db.Tables[CleanKeyString(t.Name+"_"+suffix)]; ok {
+				t.ShadowTables = append(t.ShadowTables, t.Name+"_"+suffix)
+			}
+		}
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables, nil
+}
+
+// Finds an R*Tree table by name
+func (db *Database) RTreeTable(name string) (RTreeTable, error) {
+	tables, err := db.RTreeTables()
+	if err != nil {
+		return RTreeTable{}, err
+	}
+	for _, t := range tables {
+		if CleanKeyString(t.Name) == CleanKeyString(name) {
+			return t, nil
+		}
+	}
+	return RTreeTable{}, NotFoundError("no such r-tree table: %s", name)
+}
+
+// Returns the boxes of an R*Tree table that overlap box, given as the
+// minimum and maximum of each dimension in turn, sorted by rowid.
+// Dimensions box leaves out are not constrained, so a nil box returns
+// every entry. Only the subtrees whose bounding box overlaps are read.
+func (db *Database) RTreeSearch(table string, box []float64) ([]RTreeEntry, error) {
+	t, err := db.RTreeTable(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(box)%2 != 0 || len(box) > 2*t.Dimensions {
+		return nil, fmt.Errorf("%s has %d dimensions, a box needs a minimum and maximum for each", t.Name, t.Dimensions)
+	}
+	nodes, err := db.OpenCursor(t.Name + "_node")
+	if err != nil {
+		return nil, err
+	}
+	r := &rtreeReader{nodes: nodes, table: t, box: box, seen: map[int64]bool{}}
+	// the root is node 1, its first two bytes hold the depth of the tree
+	root, err := r.node(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(root) < 2 {
+		return nil, fmt.Errorf("%s_node has a root of %d bytes", t.Name, len(root))
+	}
+	entries := []RTreeEntry{}
+	if err := r.search(root, int(binary.BigEndian.Uint16(root)), &entries); err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Rowid < entries[j].Rowid })
+	return entries, nil
+}
+
+type rtreeReader struct {
+	nodes *Cursor
+	table RTreeTable
+	box   []float64
+	// guards against a corrupt tree pointing back up
+	seen map[int64]bool
+}
+
+func (r *rtreeReader) node(n int64) ([]byte, error) {
+	if r.seen[n] {
+		return nil, fmt.Errorf("%s_node %d is referenced twice", r.table.Name, n)
+	}
+	r.seen[n] = true
+	found, err := r.nodes.SeekRowid(n)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, NotFoundError("%s_node has no node %d", r.table.Name, n)
+	}
+	v, err := r.nodes.Column(1)
+	data, _ := v.([]byte)
+	return data, err
+}
+
+// Reads a node: the depth or 0 in two bytes, the number of entries in
+// two more, then the entries. Each is a rowid, or the number of a child
+// node above the leaves, followed by the coordinates in four bytes each.
+func (r *rtreeReader) search(data []byte, depth int, entries *[]RTreeEntry) error {
+	if len(data) < 4 {
+		return fmt.Errorf("%s_node has a node of %d bytes", r.table.Name, len(data))
+	}
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	size := 8 + 8*r.table.Dimensions
+	if 4+count*size > len(data) {
+		return fmt.Errorf("%s_node has %d entries in %d bytes", r.table.Name, count, len(data))
+	}
+	for i := 0; i < count; i++ {
+		entry := data[4+i*size : 4+(i+1)*size]
+		e := RTreeEntry{Rowid: int64(binary.BigEndian.Uint64(entry)), Coords: make([]float64, 2*r.table.Dimensions)}
+		for c := range e.Coords {
+			bits := binary.BigEndian.Uint32(entry[8+4*c:])
+			if r.table.Integer {
+				e.Coords[c] = float64(int32(bits))
+			} else {
+				e.Coords[c] = float64(math.Float32frombits(bits))
+			}
+		}
+		if !r.overlaps(e.Coords) {
+			continue
+		}
+		if depth == 0 {
+			*entries = append(*entries, e)
+			continue
+		}
+		child, err := r.node(e.Rowid)
+		if err != nil {
+			return err
+		}
+		if err := r.search(child, depth-1, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *rtreeReader) overlaps(coords []float64) bool {
+	for i := 0; i+1 < len(r.box); i += 2 {
+		if coords[i] > r.box[i+1] || coords[i+1] < r.box[i] {
+			return false
+		}
+	}
+	return true
+}
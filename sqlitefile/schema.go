@@ -0,0 +1,353 @@
+package sqlitefile
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A row of sqlite_schema
+type SchemaRow struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	TableName string `json:"tbl_name"`
+	RootPage  int64  `json:"rootpage"`
+	SQL       string `json:"sql"`
+}
+
+// How sqlite_schema describes itself. The table on page 1 has no row
+// of its own, so its entry is made up from this.
+const schemaTableSQL = "CREATE TABLE sqlite_schema(type text, name text, tbl_name text, rootpage integer, sql text)"
+
+// The schema cell of a table, or of sqlite_schema when queried by that
+// name or its older one, sqlite_master
+func (db *Database) tableSchema(name string) (*Record, bool) {
+	if c, ok := db.Tables[name]; ok {
+		return c, true
+	}
+	if name != "sqlite_schema" && name != "sqlite_master" {
+		return nil, false
+	}
+	payload, err := recordSerializer{SchemaFormat: 4}.Encode([]any{"table", name, name, int64(SchemaRootPage), schemaTableSQL})
+	if err != nil {
+		return nil, false
+	}
+	c, err := NewRecordCell(0, payload)
+	if err != nil {
+		return nil, false
+	}
+	c.ParseColumnMap()
+	return c, true
+}
+
+// Splits CREATE VIRTUAL TABLE name USING module(args) into the name of
+// the module, in lower case, and its arguments
+func parseVirtualTable(row SchemaRow) (string, []string, bool) {
+	if row.Type != "table" || row.RootPage != 0 {
+		return "", nil, false
+	}
+	tokens := tokenizeSQL(row.SQL)
+	for i := 0; i+1 < len(tokens); i++ {
+		if !strings.EqualFold(tokens[i].Text, "using") {
+			continue
+		}
+		module := strings.ToLower(tokens[i+1].Text)
+		args := []string{}
+		if rest := row.SQL[tokens[i+1].End:]; strings.Contains(rest, "(") {
+			for _, arg := range splitColumnDefinitions(rest) {
+				if arg = strings.TrimSpace(arg); arg != "" {
+					args = append(args, arg)
+				}
+			}
+		}
+		return module, args, true
+	}
+	return "", nil, false
+}
+
+// Reads sqlite_schema in rowid order, which is the order
+// the objects were created in
+func ReadSchemaRows(db *Database) ([]SchemaRow, error) {
+	rows := []SchemaRow{}
+	err := WalkTableCells(db, SchemaRootPage, func(c *Record) error {
+		row := SchemaRow{}
+		fields := []*string{&row.Type, &row.Name, &row.TableName, nil, &row.SQL}
+		for i, field := range fields {
+			v, err := c.ReadDataFromHeaderIndex(i)
+			if err != nil {
+				return err
+			}
+			if field != nil {
+				*field, _ = v.(string)
+			} else {
+				row.RootPage, _ = v.(int64)
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+// Calls fn for every cell of the table b-tree rooted at pageNumber in
+// rowid order, reading through the database file rather than a write
+// transaction
+func WalkTableCells(db *Database, pageNumber int64, fn func(c *Record) error) error {
+	p, err := db.schemaPage(pageNumber)
+	if err != nil {
+		return err
+	}
+	switch p.Header.PageType {
+	case LeafTableType:
+		for _, c := range p.Cells {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	case InteriorTableType:
+		for _, c := range p.Cells {
+			if err := WalkTableCells(db, int64(c.LeftPageNumber), fn); err != nil {
+				return err
+			}
+		}
+		return WalkTableCells(db, int64(p.Header.RightMostPointer), fn)
+	}
+	return fmt.Errorf("page %d is not a table b-tree page", pageNumber)
+}
+
+// Calls fn with the values of every entry of the index b-tree rooted at
+// pageNumber in key order. Interior pages hold entries as well, which
+// come between those of the children on either side of them. The
+// entries of a WITHOUT ROWID table hold its primary key columns in key
+// order followed by the other columns in table order.
+func WalkIndexCells(db *Database, pageNumber int64, fn func(values []any) error) error {
+	p, err := ReadRawPage(db, pageNumber)
+	if err != nil {
+		return err
+	}
+	entry := func(i int) error {
+		payload, err := AssembleCellPayload(p, i, func(n int64) (*RawPage, error) { return ReadRawPage(db, n) })
+		if err != nil {
+			return err
+		}
+		record, err := NewRecordCell(0, payload)
+		if err != nil {
+			return err
+		}
+		record.TextEncoding = db.TextEncoding
+		values, err := recordValues(record, len(record.Header))
+		if err != nil {
+			return err
+		}
+		return fn(values)
+	}
+	switch p.PageType() {
+	case LeafIndexType:
+		for i := 0; i < p.CellCount(); i++ {
+			if err := entry(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	case InteriorIndexType:
+		for i := 0; i < p.CellCount(); i++ {
+			if err := WalkIndexCells(db, int64(p.ChildPage(i)), fn); err != nil {
+				return err
+			}
+			if err := entry(i); err != nil {
+				return err
+			}
+		}
+		return WalkIndexCells(db, int64(p.ChildPage(p.CellCount())), fn)
+	}
+	return fmt.Errorf("page %d is not an index b-tree page", pageNumber)
+}
+
+// A table as declared in its CREATE TABLE statement
+type TableSchema struct {
+	Name     string
+	SQL      string
+	RootPage int64
+	Columns  []ColumnSchema
+	// names of the primary key columns in key order, empty when the
+	// rowid is the key
+	PrimaryKey   []string
+	WithoutRowid bool
+	Indexes      []IndexSchema
+}
+
+// A column of a table
+type ColumnSchema struct {
+	Name string
+	// the declared type as written, empty when the column has none
+	Type     string
+	Affinity ColumnAffinity
+	NotNull  bool
+	// position in the primary key starting at 1, 0 when not part of it
+	PrimaryKey int
+	// an INTEGER PRIMARY KEY column, which holds the rowid
+	RowidAlias bool
+}
+
+// An index on a table
+type IndexSchema struct {
+	Name     string
+	SQL      string
+	RootPage int64
+	Unique   bool
+	// created by sqlite for a UNIQUE or PRIMARY KEY constraint, which
+	// has no CREATE INDEX statement to take its columns from
+	Auto bool
+	// the indexed columns and expressions
+	Columns []IndexColumn
+	// the condition of a partial index, empty when every row is indexed
+	Where string
+}
+
+// Whether the index holds every row a query with the given equality
+// constraints, as in SelectCtx.Constraint, can match. Only partial
+// indexes whose condition the constraints do not imply leave rows out.
+func (s IndexSchema) Serves(constraint map[string]string) bool {
+	return impliesIndexCondition(constraint, s.Where)
+}
+
+// Describes the columns, primary key and indexes of a table
+func (db *Database) Schema(table string) (*TableSchema, error) {
+	name := CleanKeyString(table)
+	record, ok := db.Tables[name]
+	if !ok {
+		return nil, TableNotFoundError(table)
+	}
+	rows, err := ReadSchemaRows(db)
+	if err != nil {
+		return nil, err
+	}
+	s := &TableSchema{}
+	for _, row := range rows {
+		switch {
+		case row.Type == "table" && CleanKeyString(row.Name) == name:
+			s.Name, s.SQL, s.RootPage = row.Name, row.SQL, row.RootPage
+		case row.Type == "index" && CleanKeyString(row.TableName) == name:
+			s.Indexes = append(s.Indexes, newIndexSchema(row))
+		}
+	}
+	s.Columns, s.PrimaryKey, s.WithoutRowid = parseTableDefinition(s.SQL)
+	for i := range s.Columns {
+		s.Columns[i].RowidAlias = i == record.RowidColumn
+	}
+	return s, nil
+}
+
+func newIndexSchema(row SchemaRow) IndexSchema {
+	s := IndexSchema{Name: row.Name, SQL: row.SQL, RootPage: row.RootPage}
+	if row.SQL == "" {
+		s.Unique, s.Auto = true, true
+		return s
+	}
+	def, err := ParseIndexDefinition(row.SQL)
+	if err != nil {
+		return s
+	}
+	s.Unique, s.Columns, s.Where = def.Unique, def.Columns, def.Where
+	return s
+}
+
+// Words that end the declared type of a column and start its constraints
+var columnConstraintWords = map[string]bool{
+	"constraint": true, "primary": true, "not": true, "null": true, "unique": true,
+	"check": true, "default": true, "collate": true, "references": true,
+	"generated": true, "as": true,
+}
+
+// Reads the columns of a CREATE TABLE statement along with the names of
+// the primary key columns, from either a column or a table constraint,
+// and whether the table is WITHOUT ROWID
+func parseTableDefinition(sql string) ([]ColumnSchema, []string, bool) {
+	columns := []ColumnSchema{}
+	primaryKey := []string{}
+	for _, def := range splitColumnDefinitions(sql) {
+		tokens := tokenizeSQL(def)
+		if len(tokens) == 0 {
+			continue
+		}
+		if isTableConstraint(tokens[0].Text) {
+			if names := tableConstraintPrimaryKey(tokens); names != nil {
+				primaryKey = names
+			}
+			continue
+		}
+		col := ColumnSchema{Name: dequoteIdentifier(tokens[0].Text)}
+		typeEnd := 1
+		for typeEnd < len(tokens) && (tokens[typeEnd].Depth > 0 || tokens[typeEnd].Text == "(" ||
+			tokens[typeEnd].Text == ")" || !columnConstraintWords[strings.ToLower(tokens[typeEnd].Text)]) {
+			typeEnd++
+		}
+		if typeEnd > 1 {
+			col.Type = def[tokens[1].Start:tokens[typeEnd-1].End]
+		}
+		col.Affinity = newColumnAffinity(col.Type)
+		for i := typeEnd; i+1 < len(tokens); i++ {
+			switch first, second := strings.ToLower(tokens[i].Text), strings.ToLower(tokens[i+1].Text); {
+			case first == "not" && second == "null":
+				col.NotNull = true
+			case first == "primary" && second == "key":
+				primaryKey = []string{col.Name}
+			}
+		}
+		columns = append(columns, col)
+	}
+	for i, name := range primaryKey {
+		for j := range columns {
+			if strings.EqualFold(columns[j].Name, name) {
+				columns[j].PrimaryKey = i + 1
+			}
+		}
+	}
+	return columns, primaryKey, isWithoutRowid(sql)
+}
+
+// Whether a CREATE TABLE statement ends with WITHOUT ROWID, which may
+// come before or after STRICT
+func isWithoutRowid(sql string) bool {
+	end := strings.LastIndex(sql, ")")
+	if end < 0 {
+		return false
+	}
+	options := strings.FieldsFunc(strings.ToLower(sql[end+1:]), func(r rune) bool {
+		return r == ',' || r == ';' || unicode.IsSpace(r)
+	})
+	for i := 0; i+1 < len(options); i++ {
+		if options[i] == "without" && options[i+1] == "rowid" {
+			return true
+		}
+	}
+	return false
+}
+
+// The column names of a PRIMARY KEY table constraint, nil for any
+// other constraint
+func tableConstraintPrimaryKey(tokens []sqlToken) []string {
+	for i := 0; i+1 < len(tokens); i++ {
+		if !strings.EqualFold(tokens[i].Text, "primary") || !strings.EqualFold(tokens[i+1].Text, "key") {
+			continue
+		}
+		names := []string{}
+		depth := tokens[i].Depth
+		expectName := true
+		for _, t := range tokens[i+2:] {
+			switch {
+			case t.Text == "(" && t.Depth == depth:
+			case t.Text == ")" && t.Depth == depth:
+				return names
+			case t.Text == ",":
+				expectName = true
+			case expectName && t.Depth == depth+1 && t.IsIdentifier():
+				names = append(names, dequoteIdentifier(t.Text))
+				expectName = false
+			}
+		}
+		return names
+	}
+	return nil
+}
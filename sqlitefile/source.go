@@ -0,0 +1,46 @@
+package sqlitefile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// Opens a database of size bytes read from r, such as one held in
+// memory. There is no file next to it to find a WAL or journal in, so
+// only what has been checkpointed into r is seen, and writes return
+// ErrReadOnly. Close closes r if it is an io.Closer.
+func OpenReaderAt(r io.ReaderAt, size int64, opts ...Option) (*Database, error) {
+	return openReaderAt(r, size, "reader", opts)
+}
+
+func openReaderAt(r io.ReaderAt, size int64, name string, opts []Option) (*Database, error) {
+	db, err := newDatabase(opts)
+	if err != nil {
+		return nil, err
+	}
+	if db.opts.sharedLock {
+		return nil, errors.New("databases not opened from a file cannot be locked")
+	}
+	db.opts.readOnly = true
+	db.src = &readerAtFile{r, size, nil}
+	if c, ok := r.(io.Closer); ok {
+		db.src.(*readerAtFile).closer = c
+	}
+	if err := db.load(name); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Opens the database called name in fsys, such as an embed.FS holding a
+// reference database, along with the WAL next to it if there is one.
+// Files that cannot be read at an offset are read into memory first.
+//
+//	//go:embed testdata/chinook.db
+//	var files embed.FS
+//
+//	db, err := sqlitefile.OpenFS(files, "testdata/chinook.db")
+func OpenFS(fsys fs.FS, name string, opts ...Option) (*Database, error) {
+	return Open(name, append(opts, WithVFS(fsVFS{fsys}))...)
+}
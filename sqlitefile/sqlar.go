@@ -0,0 +1,114 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Name of the table an SQLite archive keeps its files in
+// https://www.sqlite.org/sqlar.html
+const SQLARTable = "sqlar"
+
+// A file of an SQLite archive. Mode is the unix st_mode of the file.
+// Data holds the content compressed with zlib when that made it
+// smaller than Size, Content returns it as is.
+type SQLARFile struct {
+	Name  string    `json:"name"`
+	Mode  int64     `json:"mode"`
+	Mtime time.Time `json:"mtime"`
+	Size  int64     `json:"size"`
+	Data  []byte    `json:"-"`
+}
+
+// Unix file type bits of an sqlar mode column
+const (
+	sqlarTypeMask = 0o170000
+	sqlarDir      = 0o040000
+	sqlarSymlink  = 0o120000
+)
+
+// Reads the files of the sqlar table in rowid order, which is the order
+// they were added in
+func (db *Database) SQLARFiles() ([]SQLARFile, error) {
+	schema, ok := db.Tables[SQLARTable]
+	if !ok {
+		return nil, NotFoundError("no sqlar table")
+	}
+	columns := map[string]int{}
+	for _, name := range []string{"name", "mode", "mtime", "sz", "data"} {
+		idx, ok := schema.ColumnMap[name]
+		if !ok {
+			return nil, fmt.Errorf("sqlar table has no %s column", name)
+		}
+		columns[name] = idx
+	}
+	c, err := db.OpenCursor(SQLARTable)
+	if err != nil {
+		return nil, err
+	}
+	files := []SQLARFile{}
+	ok, err = c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		values := map[string]any{}
+		for name, idx := range columns {
+			if values[name], err = c.Column(idx); err != nil {
+				return nil, err
+			}
+		}
+		f := SQLARFile{Name: FormatValue(values["name"])}
+		f.Mode, _ = values["mode"].(int64)
+		mtime, _ := values["mtime"].(int64)
+		f.Mtime = time.Unix(mtime, 0).UTC()
+		f.Size, _ = values["sz"].(int64)
+		switch data := values["data"].(type) {
+		case []byte:
+			f.Data = data
+		case string:
+			f.Data = []byte(data)
+		}
+		files = append(files, f)
+	}
+	return files, err
+}
+
+// The permissions and type of the file
+func (f SQLARFile) FileMode() fs.FileMode {
+	m := fs.FileMode(f.Mode & 0o777)
+	switch f.Mode & sqlarTypeMask {
+	case sqlarDir:
+		m |= fs.ModeDir
+	case sqlarSymlink:
+		m |= fs.ModeSymlink
+	}
+	return m
+}
+
+// Whether Data is compressed, which is the case when it is shorter
+// than the file. Symbolic links hold their target uncompressed.
+func (f SQLARFile) Compressed() bool {
+	return f.Mode&sqlarTypeMask != sqlarSymlink && int64(len(f.Data)) < f.Size
+}
+
+// The content of the file, or the target of a symbolic link
+func (f SQLARFile) Content() ([]byte, error) {
+	if !f.Compressed() {
+		return f.Data, nil
+	}
+	r, err := zlib.NewReader(bytes.NewReader(f.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	defer r.Close()
+	content, err := io.ReadAll(io.LimitReader(r, f.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	if int64(len(content)) != f.Size {
+		return nil, fmt.Errorf("%s: uncompressed to %d bytes, expected %d", f.Name, len(content), f.Size)
+	}
+	return content, nil
+}
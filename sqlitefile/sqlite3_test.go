@@ -0,0 +1,35 @@
+package sqlitefile
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs sql with the sqlite3 shell on the database at path and returns
+// what it printed, skipping the test where sqlite3 is not installed
+func sqlite3(t *testing.T, path string, sql string) string {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	out, err := exec.Command("sqlite3", path, sql).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 %s: %v\n%s", sql, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Creates a database with sqlite3 and opens it, returning its path too
+func sqlite3Database(t *testing.T, sql string) (*Database, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqlite3(t, path, sql)
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
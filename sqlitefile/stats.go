@@ -0,0 +1,81 @@
+package sqlitefile
+
+// Counts the work done reading a database since it was opened or the
+// counters were last reset
+type Stats struct {
+	// pages read by the b-tree code, whether or not they were cached
+	PagesRead int64
+	// pages found in and missing from the page cache of WithPageCache
+	CacheHits   int64
+	CacheMisses int64
+	// records decoded from the cells of b-tree pages
+	CellsDecoded int64
+	// bytes read from the database file and WAL
+	BytesRead int64
+	// times the position of the page reader was moved
+	Seeks int64
+}
+
+// Receives the events counted in Stats as they happen, so they can be
+// forwarded to a metrics library. Set with WithStatsHook.
+type StatsHook interface {
+	OnPageRead(page int64)
+	OnCacheHit(page int64)
+	OnCacheMiss(page int64)
+	OnCellsDecoded(page int64, cells int)
+	OnBytesRead(n int)
+	OnSeek(offset int64)
+}
+
+// Counters of the database, as of now
+func (db *Database) Stats() Stats {
+	return db.stats
+}
+
+// Sets every counter back to 0
+func (db *Database) ResetStats() {
+	db.stats = Stats{}
+}
+
+func (db *Database) pageRead(page int64) {
+	db.stats.PagesRead++
+	for _, h := range db.opts.hooks {
+		h.OnPageRead(page)
+	}
+}
+
+func (db *Database) cacheLookup(page int64, hit bool) {
+	if hit {
+		db.stats.CacheHits++
+	} else {
+		db.stats.CacheMisses++
+	}
+	for _, h := range db.opts.hooks {
+		if hit {
+			h.OnCacheHit(page)
+		} else {
+			h.OnCacheMiss(page)
+		}
+	}
+}
+
+func (db *Database) cellsDecoded(page int64, cells int) {
+	db.stats.CellsDecoded += int64(cells)
+	for _, h := range db.opts.hooks {
+		h.OnCellsDecoded(page, cells)
+	}
+}
+
+func (db *Database) bytesRead(n int) {
+	db.stats.BytesRead += int64(n)
+	for _, h := range db.opts.hooks {
+		h.OnBytesRead(n)
+	}
+}
+
+func (db *Database) seeked(offset int64) {
+	db.stats.Seeks++
+	for _, h := range db.opts.hooks {
+		h.OnSeek(offset)
+	}
+}
@@ -0,0 +1,28 @@
+package sqlitefile
+
+// Starts spans around statements, b-tree seeks and page reads, set with
+// WithTracer. The oteltrace package makes them OpenTelemetry spans,
+// and adapters for other tracing libraries keep those out of this
+// package's dependencies the same way. Spans are ended in the reverse
+// order they are started, so an adapter can make each span a child of
+// the last one still open.
+type Tracer interface {
+	// attrs are alternating keys and values, as with slog
+	Start(name string, attrs ...any) Span
+}
+
+// Ends a span started by a Tracer, with the error the work failed with
+type Span interface {
+	End(err error)
+}
+
+type noSpan struct{}
+
+func (noSpan) End(error) {}
+
+func (db *Database) startSpan(name string, attrs ...any) Span {
+	if db.opts.tracer == nil {
+		return noSpan{}
+	}
+	return db.opts.tracer.Start(name, attrs...)
+}
@@ -0,0 +1,261 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Header offsets updated when a write transaction commits
+const (
+	FileChangeCounterOffset = 24
+	DatabaseSizeOffset      = 28
+	SchemaCookieOffset      = 40
+	VersionValidForOffset   = 92
+)
+
+// A write transaction buffers modified pages in memory and writes them
+// back on Commit. Pages are loaded through Page and must be passed
+// to Write once modified. The original content of every page is kept
+// so a rollback journal can be written before the file is touched.
+// In WAL mode the pages are appended to the WAL instead and shm
+// holds the WAL write lock, if another connection has the WAL open.
+type writeTxn struct {
+	db            *Database
+	wal           bool
+	shm           *os.File
+	pageSize      int
+	usableSize    int
+	pageCount     int64
+	origPageCount int64
+	pages         map[int64]*RawPage
+	originals     map[int64][]byte
+	dirty         map[int64]bool
+	schemaChanged bool
+}
+
+// Starts a write transaction by reopening the database for writing
+// and escalating to a RESERVED lock, so other sqlite connections
+// can keep reading but not start writing until Commit or Rollback.
+// WAL databases take the WAL write lock instead.
+func beginWrite(db *Database) (*writeTxn, error) {
+	if db.Header.WriteFileFormat != 1 && db.Header.WriteFileFormat != 2 {
+		return nil, fmt.Errorf("unsupported file format write version %d", db.Header.WriteFileFormat)
+	}
+	wal := db.Header.WriteFileFormat == 2
+	// auto-vacuum databases need pointer map pages kept up to date
+	if db.Header.LargestPageInVMode != 0 {
+		return nil, errors.New("writing to auto-vacuum databases is not supported")
+	}
+	// sqlite sets the schema format and text encoding as it creates
+	// the first schema object, which is not done here
+	if db.Header.SchemaFormat == 0 || db.TextEncoding == 0 {
+		return nil, errors.New("writing to a database without a schema is not supported")
+	}
+	if db.TextEncoding != TextEncodingUTF8 {
+		return nil, errors.New("writing to UTF-16 databases is not supported")
+	}
+	if err := db.ensureWritable(); err != nil {
+		return nil, err
+	}
+	js, err := detectJournals(db.opts.vfs, db.File.Name())
+	if err != nil {
+		return nil, err
+	}
+	if js.HotJournal {
+		return nil, errors.New("cannot write while a hot journal exists")
+	}
+	tx := &writeTxn{db: db, wal: wal}
+	if wal {
+		if tx.shm, err = acquireWalWriteLock(db.File.Name()); err != nil {
+			return nil, err
+		}
+		// another writer may have committed since the database was opened
+		if err := db.Reload(); err != nil {
+			releaseWalWriteLock(tx.shm)
+			return nil, err
+		}
+	} else if err := acquireReservedLock(db.File); err != nil {
+		return nil, err
+	}
+	pageSize := int(db.Header.PageSizeBytes())
+	pageCount, err := db.PageCount()
+	if err != nil {
+		tx.releaseLock()
+		return nil, err
+	}
+	tx.pageSize = pageSize
+	tx.usableSize = pageSize - int(db.Header.ReservedPageSpace)
+	tx.pageCount = pageCount
+	tx.origPageCount = pageCount
+	tx.pages = map[int64]*RawPage{}
+	tx.originals = map[int64][]byte{}
+	tx.dirty = map[int64]bool{}
+	return tx, nil
+}
+
+func (tx *writeTxn) releaseLock() error {
+	if tx.wal {
+		return releaseWalWriteLock(tx.shm)
+	}
+	return releaseWriteLock(tx.db.File)
+}
+
+func (tx *writeTxn) Page(n int64) (*RawPage, error) {
+	if p, ok := tx.pages[n]; ok {
+		return p, nil
+	}
+	if n < 1 || n > tx.pageCount {
+		return nil, errors.New("page number out of range")
+	}
+	data := make([]byte, tx.pageSize)
+	if _, err := tx.db.Reader.ReadAt(data, PageNumberToOffset(int64(tx.pageSize), n)); err != nil {
+		return nil, err
+	}
+	original := make([]byte, tx.pageSize)
+	copy(original, data)
+	tx.originals[n] = original
+	p := &RawPage{Number: n, Data: data, Usable: tx.usableSize}
+	tx.pages[n] = p
+	return p, nil
+}
+
+// Returns a zeroed page, reusing a page from the freelist when there
+// is one and otherwise appending to the database. The page holding the
+// pending byte is used for locking and never allocated.
+func (tx *writeTxn) allocatePage() (*RawPage, error) {
+	if p, err := tx.allocateFreePage(); p != nil || err != nil {
+		return p, err
+	}
+	tx.pageCount++
+	if PageNumberToOffset(int64(tx.pageSize), tx.pageCount) == PendingByteOffset {
+		tx.pageCount++
+	}
+	p := &RawPage{Number: tx.pageCount, Data: make([]byte, tx.pageSize), Usable: tx.usableSize}
+	tx.pages[p.Number] = p
+	tx.Write(p)
+	return p, nil
+}
+
+func (tx *writeTxn) Write(p *RawPage) {
+	tx.dirty[p.Number] = true
+}
+
+// Bumps the change counters in the database header, writes the rollback
+// journal, escalates to an EXCLUSIVE lock and writes all modified pages.
+// The journal is deleted once the pages are safely on disk, which is
+// the point the transaction commits. WAL databases commit in commitWal.
+func (tx *writeTxn) Commit() error {
+	if len(tx.dirty) == 0 {
+		return tx.Rollback()
+	}
+	if err := tx.updateHeader(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if tx.wal {
+		return tx.commitWal()
+	}
+	journalPath := tx.db.File.Name() + JournalSuffix
+	if err := writeRollbackJournal(journalPath, tx.pageSize, tx.origPageCount, tx.journalPages()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := acquireExclusiveLock(tx.db.File); err != nil {
+		os.Remove(journalPath)
+		tx.Rollback()
+		return err
+	}
+	pageNumbers := tx.dirtyPageNumbers()
+	tx.db.logger.Debug("committing", "pages", len(pageNumbers), "journal", journalPath)
+	for _, n := range pageNumbers {
+		offset := PageNumberToOffset(int64(tx.pageSize), n)
+		if _, err := tx.db.File.WriteAt(tx.pages[n].Data, offset); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.db.File.Sync(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := os.Remove(journalPath); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := releaseWriteLock(tx.db.File); err != nil {
+		return err
+	}
+	return tx.db.Reload()
+}
+
+// Appends the modified pages to the WAL, ending with a commit record.
+// Readers see the transaction as soon as the frames are synced.
+func (tx *writeTxn) commitWal() error {
+	pages := map[int64][]byte{}
+	for n := range tx.dirty {
+		pages[n] = tx.pages[n].Data
+	}
+	tx.db.logger.Debug("committing to the WAL", "pages", len(pages))
+	if err := writeWalFrames(tx.db.File.Name(), tx.pageSize, tx.pageCount, tx.dirtyPageNumbers(), pages); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := invalidateWalIndex(tx.shm); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := releaseWalWriteLock(tx.shm); err != nil {
+		return err
+	}
+	return tx.db.Reload()
+}
+
+// Abandons the transaction. Nothing is written before Commit,
+// so dropping the write lock is all that is needed.
+func (tx *writeTxn) Rollback() error {
+	tx.pages = map[int64]*RawPage{}
+	tx.dirty = map[int64]bool{}
+	return tx.releaseLock()
+}
+
+func (tx *writeTxn) updateHeader() error {
+	p, err := tx.Page(1)
+	if err != nil {
+		return err
+	}
+	counter := binary.BigEndian.Uint32(p.Data[FileChangeCounterOffset:]) + 1
+	binary.BigEndian.PutUint32(p.Data[FileChangeCounterOffset:], counter)
+	binary.BigEndian.PutUint32(p.Data[VersionValidForOffset:], counter)
+	binary.BigEndian.PutUint32(p.Data[DatabaseSizeOffset:], uint32(tx.pageCount))
+	if tx.schemaChanged {
+		cookie := binary.BigEndian.Uint32(p.Data[SchemaCookieOffset:]) + 1
+		binary.BigEndian.PutUint32(p.Data[SchemaCookieOffset:], cookie)
+	}
+	tx.Write(p)
+	return nil
+}
+
+func (tx *writeTxn) dirtyPageNumbers() []int64 {
+	pageNumbers := []int64{}
+	for n := range tx.dirty {
+		pageNumbers = append(pageNumbers, n)
+	}
+	sort.Slice(pageNumbers, func(i, j int) bool { return pageNumbers[i] < pageNumbers[j] })
+	return pageNumbers
+}
+
+// Original images of the modified pages that existed before the
+// transaction started. Pages appended to the file need no journal
+// entry as rolling back truncates the file to its original size.
+func (tx *writeTxn) journalPages() map[int64][]byte {
+	pages := map[int64][]byte{}
+	for n := range tx.dirty {
+		if n <= tx.origPageCount {
+			pages[n] = tx.originals[n]
+		}
+	}
+	return pages
+}
@@ -0,0 +1,188 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	LeniantCleanKeyRegexp = regexp.MustCompile("\\[|\\]")
+	CleanKeyRegexp        = regexp.MustCompile("\"|'|\\[|\\]")
+)
+
+func CleanKeyString(key string) string {
+	k := CleanKeyRegexp.ReplaceAllString(key, "")
+	return strings.TrimSpace(strings.ToLower(k))
+}
+
+func leniantCleanKeyString(key string) string {
+	k := LeniantCleanKeyRegexp.ReplaceAllString(key, "")
+	return strings.ToLower(k)
+}
+
+func readBigEndianInt(b []byte, out any) error {
+	return binary.Read(bytes.NewReader(b), binary.BigEndian, out)
+}
+
+func repeatString(availableSpace int, occupiedSpace int, sym string) string {
+	diff := availableSpace - occupiedSpace
+	if diff > 0 {
+		return strings.Repeat(sym, diff)
+	}
+	return sym
+}
+
+func repeatStringDefault(occupiedSpace int) string {
+	diff := 32 - occupiedSpace
+	if diff > 0 {
+		return strings.Repeat(" ", diff)
+	}
+	return " "
+}
+
+// Writes the fields of a structure one per line, each name padded to
+// the width repeatStringDefault gives it. Used in place of reflection for
+// the headers and cells printed while debugging, of which there can be
+// many.
+type fieldWriter struct {
+	strings.Builder
+}
+
+const fieldPadding = "                                "
+
+func (w *fieldWriter) key(key string) {
+	w.WriteString(key)
+	w.WriteByte(':')
+	if n := len(fieldPadding) - len(key); n > 0 {
+		w.WriteString(fieldPadding[:n])
+	} else {
+		w.WriteByte(' ')
+	}
+}
+
+func (w *fieldWriter) uint(key string, v uint64) {
+	w.key(key)
+	w.WriteString(strconv.FormatUint(v, 10))
+	w.WriteByte('\n')
+}
+
+func (w *fieldWriter) int(key string, v int64) {
+	w.key(key)
+	w.WriteString(strconv.FormatInt(v, 10))
+	w.WriteByte('\n')
+}
+
+func (w *fieldWriter) str(key string, v string) {
+	w.key(key)
+	w.WriteString(v)
+	w.WriteByte('\n')
+}
+
+func (w *fieldWriter) header(key string, h []CellHeader) {
+	w.key(key)
+	w.WriteByte('[')
+	for i, c := range h {
+		if i > 0 {
+			w.WriteByte(' ')
+		}
+		w.WriteString(c.Type.String())
+		if c.Type == SerialBlob || c.Type == SerialText {
+			w.WriteByte('(')
+			w.WriteString(strconv.FormatInt(c.Size, 10))
+			w.WriteByte(')')
+		}
+	}
+	w.WriteString("]\n")
+}
+
+func PageNumberToOffset(pageSize int64, pageNumber int64) int64 {
+	return pageSize * (pageNumber - 1)
+}
+
+func offsetToPageNumber(pageSize int64, offset int64) int64 {
+	return (offset / pageSize) + 1
+}
+
+// Decodes the sqlite varint at the start of buf, returning its value
+// and length in bytes. A varint is 1 to 9 bytes long, big-endian, with
+// 7 bits from each byte that has its high bit set and from the byte
+// ending it, except for a 9th byte, which contributes all 8 of its
+// bits. The length is 0 for an empty buf and a varint cut short by the
+// end of buf is decoded from the bytes there are.
+// https://www.sqlite.org/fileformat.html#varint
+func ReadVarint(buf []byte) (int64, int) {
+	var varint int64 = 0
+	var read int = 0
+	for i, b := range buf {
+		bb := int64(b)
+		read += 1
+		if i == 8 {
+			varint = (varint << 8) | bb
+			break
+		} else {
+			varint = (varint << 7) | (bb & 0x7f)
+			if bb < 0x80 {
+				break
+			}
+		}
+	}
+	return varint, read
+}
+
+// Encodes v as a big-endian sqlite varint and appends it to buf.
+// Values needing more than 56 bits use the 9 byte form where
+// the last byte contributes all 8 of its bits. Negative values always
+// take 9 bytes.
+func AppendVarint(buf []byte, v int64) []byte {
+	u := uint64(v)
+	if u>>56 != 0 {
+		var b [9]byte
+		b[8] = byte(u)
+		u >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(u&0x7f) | 0x80
+			u >>= 7
+		}
+		return append(buf, b[:]...)
+	}
+	var b [8]byte
+	n := 0
+	for {
+		b[n] = byte(u&0x7f) | 0x80
+		n++
+		u >>= 7
+		if u == 0 {
+			break
+		}
+	}
+	b[0] &= 0x7f
+	for i := n - 1; i >= 0; i-- {
+		buf = append(buf, b[i])
+	}
+	return buf
+}
+
+// Encodes v as a sqlite varint into buf and returns the number of bytes
+// written. Panics if buf is shorter than VarintLen(v), as
+// binary.PutUvarint does.
+func PutVarint(buf []byte, v int64) int {
+	var b [9]byte
+	enc := AppendVarint(b[:0], v)
+	return copy(buf[:len(enc)], enc)
+}
+
+// Number of bytes the varint encoding of v takes, 1 to 9
+func VarintLen(v int64) int {
+	u := uint64(v)
+	if u>>56 != 0 {
+		return 9
+	}
+	n := 1
+	for u >>= 7; u != 0; u >>= 7 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,83 @@
+package sqlitefile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Formats a decoded column value the way the sqlite3 shell does.
+// Integers are printed in full and reals always carry a decimal
+// point, using 15 significant digits like sqlite's "%!.15g".
+func FormatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatReal(v)
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func formatReal(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return ""
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	s := strconv.FormatFloat(f, 'g', 15, 64)
+	mantissa, exponent, found := strings.Cut(s, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	if found {
+		return mantissa + "e" + exponent
+	}
+	return mantissa
+}
+
+// Formats a value as an SQL literal that reads back as the same value
+func FormatSQLValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NULL"
+		case math.IsInf(v, 1):
+			return "1e999"
+		case math.IsInf(v, -1):
+			return "-1e999"
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []byte:
+		return fmt.Sprintf("X'%X'", v)
+	}
+	return FormatValue(v)
+}
+
+// Formats values as a parenthesized list of SQL literals
+func FormatValueTuple(values []any) string {
+	formatted := make([]string, len(values))
+	for j, v := range values {
+		formatted[j] = FormatSQLValue(v)
+	}
+	return "(" + strings.Join(formatted, ", ") + ")"
+}
@@ -0,0 +1,69 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func FuzzReadVarint(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x7f})
+	f.Add([]byte{0x81, 0x00})
+	f.Add([]byte{0x80, 0x80, 0x01})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	f.Add([]byte{0x81, 0x81})
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		v, n := ReadVarint(buf)
+		if n > len(buf) || n > 9 || (n == 0) != (len(buf) == 0) {
+			t.Fatalf("ReadVarint(%x) read %d bytes", buf, n)
+		}
+		// a varint cut short by the end of buf has nothing to compare
+		if n == 0 || (n < 9 && buf[n-1] >= 0x80) {
+			return
+		}
+		enc := AppendVarint(nil, v)
+		if got, m := ReadVarint(enc); got != v || m != len(enc) {
+			t.Fatalf("%d encodes to %x, which reads as %d in %d bytes", v, enc, got, m)
+		}
+		// leading 0x80 bytes only pad the value, anything else is how
+		// AppendVarint writes it
+		if buf[0] != 0x80 && !bytes.Equal(enc, buf[:n]) {
+			t.Fatalf("ReadVarint(%x) = %d, which encodes to %x", buf[:n], v, enc)
+		}
+	})
+}
+
+func FuzzVarintRoundTrip(f *testing.F) {
+	// the smallest and largest value of every length up to 8 bytes,
+	// then values that take 9
+	for n := 1; n <= 8; n++ {
+		f.Add(int64(1) << (7 * (n - 1)))
+		f.Add(int64(1)<<(7*n) - 1)
+	}
+	f.Add(int64(0))
+	f.Add(int64(1) << 56)
+	f.Add(int64(math.MaxInt64))
+	f.Add(int64(-1))
+	f.Add(int64(math.MinInt64))
+	f.Fuzz(func(t *testing.T, v int64) {
+		buf := make([]byte, 9)
+		n := PutVarint(buf, v)
+		if n != VarintLen(v) || n < 1 || n > 9 {
+			t.Fatalf("PutVarint(%d) wrote %d bytes, VarintLen says %d", v, n, VarintLen(v))
+		}
+		if v < 0 && n != 9 {
+			t.Fatalf("negative %d took %d bytes, not 9", v, n)
+		}
+		if !bytes.Equal(buf[:n], AppendVarint(nil, v)) {
+			t.Fatalf("PutVarint(%d) wrote %x, AppendVarint %x", v, buf[:n], AppendVarint(nil, v))
+		}
+		// bytes after the varint are not read
+		got, m := ReadVarint(append(buf[:n:n], 0xff, 0xff))
+		if got != v || m != n {
+			t.Fatalf("%d encodes to %x, which reads as %d in %d bytes", v, buf[:n], got, m)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package sqlitefile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Where the files of a database are read from, modelled on the VFS of
+// sqlite. The database, its WAL and its journal are opened by name
+// through it, so a database can be read out of a compressed container,
+// a device image or blobs fetched over the network.
+// https://www.sqlite.org/vfs.html
+type VFS interface {
+	// Opens a file for reading. A file that does not exist is reported
+	// with an error matching fs.ErrNotExist, which is expected for the
+	// WAL and journal.
+	Open(name string) (VFSFile, error)
+}
+
+// A file opened by a VFS. Reads are at byte offsets rather than by page,
+// as the header, WAL frames and journal records are not page aligned.
+type VFSFile interface {
+	io.ReaderAt
+	io.Closer
+	Size() (int64, error)
+	// Takes and releases a shared lock keeping writers out, as asked
+	// for with WithSharedLock
+	Lock() error
+	Unlock() error
+}
+
+// Reads the database through v instead of the local file system.
+// Writes are refused, they are only made to local files.
+func WithVFS(v VFS) Option {
+	return func(o *options) error {
+		o.vfs = v
+		o.readOnly = true
+		return nil
+	}
+}
+
+// The local file system, used unless WithVFS says otherwise
+type osVFS struct{}
+
+func (osVFS) Open(name string) (VFSFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &osFile{f}, nil
+}
+
+type osFile struct {
+	*os.File
+}
+
+func (f *osFile) Size() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (f *osFile) Lock() error {
+	return acquireSharedLock(f.File)
+}
+
+func (f *osFile) Unlock() error {
+	return releaseSharedLock(f.File)
+}
+
+// Opens the files of an fs.FS. Files that cannot be read at an offset
+// are read into memory.
+type fsVFS struct {
+	fsys fs.FS
+}
+
+func (v fsVFS) Open(name string) (VFSFile, error) {
+	f, err := v.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	if r, ok := f.(io.ReaderAt); ok {
+		return &readerAtFile{r, info.Size(), f}, nil
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &readerAtFile{bytes.NewReader(data), info.Size(), nil}, nil
+}
+
+// A file read from an io.ReaderAt of a known size, which has nothing to
+// lock
+type readerAtFile struct {
+	io.ReaderAt
+	size   int64
+	closer io.Closer
+}
+
+func (f *readerAtFile) Size() (int64, error) {
+	return f.size, nil
+}
+
+func (f *readerAtFile) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+func (f *readerAtFile) Lock() error {
+	return errors.New("databases not opened from a file cannot be locked")
+}
+
+func (f *readerAtFile) Unlock() error {
+	return nil
+}
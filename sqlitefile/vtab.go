@@ -0,0 +1,112 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A table whose rows come from Go rather than the database file, queried
+// by the name it is registered with like the tables of the database
+type VirtualTable interface {
+	Columns() []string
+	// Calls fn with the values of every row in column order, stopping
+	// at the first error fn returns, which is ErrStop once the query has
+	// the rows it needs. Integers, floats and booleans are converted to
+	// int64 and float64 as they would be stored.
+	Scan(fn func(values []any) error) error
+}
+
+// Makes t queryable as name, which must not be the name of a table of
+// the database
+func (db *Database) RegisterTable(name string, t VirtualTable) error {
+	key := CleanKeyString(name)
+	if _, ok := db.Tables[key]; ok {
+		return fmt.Errorf("table %s already exists", name)
+	}
+	if db.virtualTables == nil {
+		db.virtualTables = map[string]VirtualTable{}
+	}
+	db.virtualTables[key] = t
+	return nil
+}
+
+// Removes a table added with RegisterTable
+func (db *Database) UnregisterTable(name string) {
+	delete(db.virtualTables, CleanKeyString(name))
+}
+
+// Runs the query against the rows of a registered table, comparing the
+// constraints and applying the functions of the select list as for the
+// tables of the database
+func selectVirtualTable(t VirtualTable, q *queryContext) error {
+	columns := map[string]int{}
+	for i, name := range t.Columns() {
+		columns[CleanKeyString(name)] = i
+	}
+	column := func(k string, row int) (int, error) {
+		idx, ok := columns[k]
+		if !ok {
+			return 0, columnNotFoundError("%q not found on table %q row %d", k, q.tableName, row)
+		}
+		return idx, nil
+	}
+	row := 0
+	err := t.Scan(func(values []any) error {
+		row++
+		if q.query.Limit > 0 && q.count >= q.query.Limit {
+			return ErrStop
+		}
+		if len(values) != len(columns) {
+			return fmt.Errorf("table %q row %d has %d values for %d columns", q.tableName, row, len(values), len(columns))
+		}
+		for i, v := range values {
+			value, err := normalizeValue(v)
+			if err != nil {
+				return fmt.Errorf("table %q row %d: %w", q.tableName, row, err)
+			}
+			values[i] = value
+		}
+		for k := range q.query.Constraint {
+			idx, err := column(k, row)
+			if err != nil {
+				return err
+			}
+			if !constraintEquals(values[idx], AffinityBlob, "", q.query.equals[k]) {
+				return nil
+			}
+		}
+		result := []any{}
+		if !q.query.IsCount {
+			for i, k := range q.query.Identifiers {
+				call, isCall := q.query.calls[i]
+				if isCall {
+					k = call.column
+				}
+				idx, err := column(k, row)
+				if err != nil {
+					return err
+				}
+				value := values[idx]
+				if isCall {
+					if value, err = call.fn(value, call.args); err != nil {
+						return fmt.Errorf("%s on table %q row %d: %w", q.query.Identifiers[i], q.tableName, row, err)
+					}
+				}
+				result = append(result, value)
+			}
+		}
+		q.count++
+		if q.query.IsCount {
+			return nil
+		}
+		if q.emit != nil {
+			return q.emit(result)
+		}
+		q.rows = append(q.rows, result)
+		return nil
+	})
+	if errors.Is(err, ErrStop) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,296 @@
+package sqlitefile
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// The WAL file starts with a 32-byte header followed by frames, each a
+// 24-byte frame header and one page of data. All fields are big-endian.
+//
+// # Offset	Size	Description (WAL header)
+//
+//	0	    4	    Magic number. 0x377f0682 or 0x377f0683
+//	4	    4	    File format version. Currently 3007000.
+//	8	    4	    Database page size.
+//	12	    4	    Checkpoint sequence number
+//	16	    4	    Salt-1: random integer incremented with each checkpoint
+//	20	    4	    Salt-2: a different random number for each checkpoint
+//	24	    4	    Checksum-1: First part of a checksum on the first 24 bytes of header
+//	28	    4	    Checksum-2: Second part of the checksum on the first 24 bytes of header
+//
+// # Offset	Size	Description (frame header)
+//
+//	0	    4	    Page number
+//	4	    4	    For commit records, the size of the database file in pages after the commit. For all other records, zero.
+//	8	    4	    Salt-1 copied from the WAL header
+//	12	    4	    Salt-2 copied from the WAL header
+//	16	    4	    Checksum-1: Cumulative checksum up through and including this page
+//	20	    4	    Checksum-2: Second half of the cumulative checksum.
+//
+// https://www.sqlite.org/fileformat.html#the_write_ahead_log
+const (
+	WalHeaderSize      = 32
+	WalFrameHeaderSize = 24
+	WalMagicLittle     = 0x377f0682
+	WalMagicBig        = 0x377f0683
+	WalFormatVersion   = 3007000
+	WalIndexSuffix     = "-shm"
+	// the wal-index starts with two copies of its 48-byte header
+	WalIndexHeaderSize = 96
+)
+
+// The committed state of a WAL file. Frames maps page numbers to the
+// offset of the newest committed copy of the page data, and End is the
+// offset just past the last committed frame, where the next
+// transaction is appended. Frames after End belong to an unfinished
+// transaction or an older checkpoint generation and are ignored.
+type WalFile struct {
+	PageSize          int
+	BigEndianChecksum bool
+	CheckpointSeq     uint32
+	Salt1             uint32
+	Salt2             uint32
+	Checksum1         uint32
+	Checksum2         uint32
+	PageCount         int64
+	End               int64
+	Frames            map[int64]int64
+	File              VFSFile
+}
+
+// Computes the WAL checksum of data, continuing from s1 and s2.
+// The words are read in the byte order selected by the magic number.
+func walChecksum(bigEndian bool, data []byte, s1, s2 uint32) (uint32, uint32) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	for i := 0; i+8 <= len(data); i += 8 {
+		s1 += order.Uint32(data[i:]) + s2
+		s2 += order.Uint32(data[i+4:]) + s1
+	}
+	return s1, s2
+}
+
+// Opens and validates the WAL of the database, returning nil if there
+// is none or its header is invalid, which sqlite treats the same way.
+// Frames are only accepted while the salts match and the cumulative
+// checksum holds, and only up to the last commit record.
+func openWal(vfs VFS, databasePath string) (*WalFile, error) {
+	w, err := openWalHeader(vfs, databasePath)
+	if w == nil || err != nil {
+		return nil, err
+	}
+	for {
+		c, ok := w.readCommit(w.End)
+		if !ok {
+			return w, nil
+		}
+		w.apply(c)
+	}
+}
+
+// Opens the WAL and validates its header, without reading any frames
+func openWalHeader(vfs VFS, databasePath string) (*WalFile, error) {
+	f, err := vfs.Open(databasePath + WalSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	header := make([]byte, WalHeaderSize)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		f.Close()
+		return nil, nil
+	}
+	magic := binary.BigEndian.Uint32(header)
+	pageSize := int(binary.BigEndian.Uint32(header[8:]))
+	if (magic != WalMagicLittle && magic != WalMagicBig) ||
+		binary.BigEndian.Uint32(header[4:]) != WalFormatVersion ||
+		pageSize < 512 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		f.Close()
+		return nil, nil
+	}
+	w := &WalFile{
+		PageSize:          pageSize,
+		BigEndianChecksum: magic == WalMagicBig,
+		CheckpointSeq:     binary.BigEndian.Uint32(header[12:]),
+		Salt1:             binary.BigEndian.Uint32(header[16:]),
+		Salt2:             binary.BigEndian.Uint32(header[20:]),
+		End:               WalHeaderSize,
+		Frames:            map[int64]int64{},
+		File:              f,
+	}
+	s1, s2 := walChecksum(w.BigEndianChecksum, header[:24], 0, 0)
+	if s1 != binary.BigEndian.Uint32(header[24:]) || s2 != binary.BigEndian.Uint32(header[28:]) {
+		f.Close()
+		return nil, nil
+	}
+	w.Checksum1, w.Checksum2 = s1, s2
+	return w, nil
+}
+
+// A transaction in the WAL: the offsets of the pages it wrote, the size
+// of the database after it, and the end and checksums of its commit frame
+type walCommit struct {
+	Start     int64
+	End       int64
+	Frames    map[int64]int64
+	PageCount int64
+	Checksum1 uint32
+	Checksum2 uint32
+}
+
+// Reads the transaction whose frames start at offset, continuing the
+// cumulative checksum of the last committed frame. Returns false when
+// there is no complete, valid transaction there.
+func (w *WalFile) readCommit(offset int64) (walCommit, bool) {
+	c := walCommit{Start: offset, Frames: map[int64]int64{}}
+	s1, s2 := w.Checksum1, w.Checksum2
+	frame := make([]byte, WalFrameHeaderSize+w.PageSize)
+	for ; ; offset += int64(len(frame)) {
+		if _, err := w.File.ReadAt(frame, offset); err != nil {
+			return c, false
+		}
+		pageNumber := int64(binary.BigEndian.Uint32(frame))
+		if pageNumber == 0 ||
+			binary.BigEndian.Uint32(frame[8:]) != w.Salt1 ||
+			binary.BigEndian.Uint32(frame[12:]) != w.Salt2 {
+			return c, false
+		}
+		s1, s2 = walChecksum(w.BigEndianChecksum, frame[:8], s1, s2)
+		s1, s2 = walChecksum(w.BigEndianChecksum, frame[WalFrameHeaderSize:], s1, s2)
+		if s1 != binary.BigEndian.Uint32(frame[16:]) || s2 != binary.BigEndian.Uint32(frame[20:]) {
+			return c, false
+		}
+		c.Frames[pageNumber] = offset + WalFrameHeaderSize
+		if commitSize := binary.BigEndian.Uint32(frame[4:]); commitSize > 0 {
+			c.PageCount = int64(commitSize)
+			c.End = offset + int64(len(frame))
+			c.Checksum1, c.Checksum2 = s1, s2
+			return c, true
+		}
+	}
+}
+
+// Moves the committed state of the WAL past the transaction
+func (w *WalFile) apply(c walCommit) {
+	for n, o := range c.Frames {
+		w.Frames[n] = o
+	}
+	w.PageCount = c.PageCount
+	w.End = c.End
+	w.Checksum1, w.Checksum2 = c.Checksum1, c.Checksum2
+}
+
+// Reads the newest committed copy of the page from the WAL.
+// Returns false if the page is not in the WAL.
+func (w *WalFile) ReadPage(pageNumber int64, buf []byte, offset int64) (int, bool, error) {
+	frameOffset, ok := w.Frames[pageNumber]
+	if !ok {
+		return 0, false, nil
+	}
+	n, err := w.File.ReadAt(buf, frameOffset+offset)
+	return n, true, err
+}
+
+func (w *WalFile) Close() error {
+	return w.File.Close()
+}
+
+// Creates an empty WAL header with fresh salts, used when the
+// database has no valid WAL to append to.
+func newWalHeader(pageSize int) (*WalFile, []byte, error) {
+	salts := make([]byte, 8)
+	if _, err := rand.Read(salts); err != nil {
+		return nil, nil, err
+	}
+	header := make([]byte, WalHeaderSize)
+	binary.BigEndian.PutUint32(header, WalMagicBig)
+	binary.BigEndian.PutUint32(header[4:], WalFormatVersion)
+	binary.BigEndian.PutUint32(header[8:], uint32(pageSize))
+	copy(header[16:], salts)
+	w := &WalFile{
+		PageSize:          pageSize,
+		BigEndianChecksum: true,
+		Salt1:             binary.BigEndian.Uint32(salts),
+		Salt2:             binary.BigEndian.Uint32(salts[4:]),
+		End:               WalHeaderSize,
+		Frames:            map[int64]int64{},
+	}
+	w.Checksum1, w.Checksum2 = walChecksum(true, header[:24], 0, 0)
+	binary.BigEndian.PutUint32(header[24:], w.Checksum1)
+	binary.BigEndian.PutUint32(header[28:], w.Checksum2)
+	return w, header, nil
+}
+
+// Appends the pages as frames after the last committed frame of the
+// WAL, the final frame being the commit record carrying the new
+// database size. The transaction commits once the frames are synced.
+// The database file itself is left untouched until a checkpoint.
+func writeWalFrames(databasePath string, pageSize int, pageCount int64, pageNumbers []int64, pages map[int64][]byte) error {
+	w, err := openWal(osVFS{}, databasePath)
+	if err != nil {
+		return err
+	}
+	var header []byte
+	if w == nil {
+		if w, header, err = newWalHeader(pageSize); err != nil {
+			return err
+		}
+	} else {
+		w.Close()
+		if w.PageSize != pageSize {
+			return errors.New("WAL page size does not match the database")
+		}
+	}
+	f, err := os.OpenFile(databasePath+WalSuffix, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := []byte{}
+	if header != nil {
+		buf = append(buf, header...)
+	}
+	s1, s2 := w.Checksum1, w.Checksum2
+	for i, n := range pageNumbers {
+		frame := make([]byte, WalFrameHeaderSize, WalFrameHeaderSize+pageSize)
+		binary.BigEndian.PutUint32(frame, uint32(n))
+		if i == len(pageNumbers)-1 {
+			binary.BigEndian.PutUint32(frame[4:], uint32(pageCount))
+		}
+		binary.BigEndian.PutUint32(frame[8:], w.Salt1)
+		binary.BigEndian.PutUint32(frame[12:], w.Salt2)
+		s1, s2 = walChecksum(w.BigEndianChecksum, frame[:8], s1, s2)
+		s1, s2 = walChecksum(w.BigEndianChecksum, pages[n], s1, s2)
+		binary.BigEndian.PutUint32(frame[16:], s1)
+		binary.BigEndian.PutUint32(frame[20:], s2)
+		buf = append(append(buf, frame...), pages[n]...)
+	}
+	offset := w.End
+	if header != nil {
+		offset = 0
+	}
+	if _, err := f.WriteAt(buf, offset); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Zeroes the wal-index header in the shm file, if there is one, so
+// sqlite connections rebuild the index from the WAL and pick up the
+// appended frames instead of trusting their stale copy.
+func invalidateWalIndex(shm *os.File) error {
+	if shm == nil {
+		return nil
+	}
+	if _, err := shm.WriteAt(make([]byte, WalIndexHeaderSize), 0); err != nil {
+		return err
+	}
+	return nil
+}
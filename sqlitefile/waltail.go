@@ -0,0 +1,450 @@
+package sqlitefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Follows the WAL of a database as other connections commit to it and
+// turns each transaction into the rows it changed, by comparing the
+// table leaf pages it wrote with their copies before it. Nothing is
+// copied or locked, so a checkpoint that runs while the tail is behind
+// can hand it pages that are newer than the commit being read.
+//
+// Rows of WITHOUT ROWID tables, which are stored in index b-trees, and
+// changes that only rewrite overflow pages are not seen.
+type WalTail struct {
+	db *Database
+	// the WAL as of the last transaction read, nil while there is none
+	wal    *WalFile
+	tables []tailTable
+	cookie uint32
+}
+
+// sqlite gives up on b-trees deeper than this, which keeps a corrupt
+// page from sending a lookup around in circles
+const maxBtreeDepth = 20
+
+// A rowid table of the schema as of a transaction
+type tailTable struct {
+	name   string
+	root   int64
+	schema *Record
+}
+
+// A transaction read from the WAL
+type WalCommit struct {
+	// offset of its first frame in the WAL and the salt of the WAL,
+	// which changes when the WAL is restarted
+	Offset    int64       `json:"offset"`
+	Salt1     uint32      `json:"salt1"`
+	Pages     []int64     `json:"pages"`
+	PageCount int64       `json:"page_count"`
+	Changes   []RowChange `json:"changes"`
+}
+
+// A row inserted, updated or deleted by a transaction. Before is nil for
+// an insert and After for a delete.
+type RowChange struct {
+	Table   string   `json:"table"`
+	Op      ChangeOp `json:"op"`
+	Rowid   int64    `json:"rowid"`
+	Columns []string `json:"columns"`
+	Before  []any    `json:"before"`
+	After   []any    `json:"after"`
+}
+
+func (op ChangeOp) MarshalText() ([]byte, error) {
+	return []byte(op.String()), nil
+}
+
+// Starts following the WAL from its last committed frame, so only
+// transactions committed from now on are read
+func (db *Database) TailWal() (*WalTail, error) {
+	if db.name == "" || db.opts.ignoreWal {
+		return nil, errors.New("the WAL of the database is not read")
+	}
+	wal, err := openWal(db.opts.vfs, db.name)
+	if err != nil {
+		return nil, err
+	}
+	t := &WalTail{db: db, wal: wal}
+	if err := t.readSchema(t.wal); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reads the next transaction committed to the WAL, returning nil when
+// there is none yet. When the WAL was restarted after a checkpoint, or
+// created, reading continues from its start.
+func (t *WalTail) Next() (*WalCommit, error) {
+	if t.wal != nil {
+		if c, ok := t.wal.readCommit(t.wal.End); ok {
+			return t.commit(c)
+		}
+	}
+	wal, err := openWalHeader(t.db.opts.vfs, t.db.name)
+	if err != nil {
+		return nil, err
+	}
+	if wal != nil && t.wal != nil && wal.Salt1 == t.wal.Salt1 && wal.Salt2 == t.wal.Salt2 {
+		wal.Close()
+		return nil, nil
+	}
+	// all frames of the old WAL were checkpointed before it was reset or
+	// removed, so the database file holds the state it ended with
+	if t.wal != nil {
+		t.wal.Close()
+	}
+	t.wal = wal
+	if wal == nil {
+		return nil, nil
+	}
+	// transactions checkpointed before they were read may have changed
+	// the schema
+	if err := t.readSchema(wal); err != nil {
+		return nil, err
+	}
+	if c, ok := wal.readCommit(wal.End); ok {
+		return t.commit(c)
+	}
+	return nil, nil
+}
+
+func (t *WalTail) Close() error {
+	if t.wal == nil {
+		return nil
+	}
+	return t.wal.Close()
+}
+
+// Compares the table leaf pages written by c with the versions before
+// it, then moves the tail past it
+func (t *WalTail) commit(c walCommit) (*WalCommit, error) {
+	commit := &WalCommit{Offset: c.Start, Salt1: t.wal.Salt1, PageCount: c.PageCount, Changes: []RowChange{}}
+	for n := range c.Frames {
+		commit.Pages = append(commit.Pages, n)
+	}
+	sortPageNumbers(commit.Pages)
+	next := *t.wal
+	next.Frames = make(map[int64]int64, len(t.wal.Frames)+len(c.Frames))
+	for n, o := range t.wal.Frames {
+		next.Frames[n] = o
+	}
+	next.apply(c)
+	pages := map[int64]bool{}
+	for _, wal := range []*WalFile{t.wal, &next} {
+		if err := t.addChildPages(wal, commit.Pages, pages); err != nil {
+			return nil, err
+		}
+	}
+	read := make([]int64, 0, len(pages))
+	for n := range pages {
+		read = append(read, n)
+	}
+	sortPageNumbers(read)
+	before, err := t.readRows(t.wal, read)
+	if err != nil {
+		return nil, err
+	}
+	oldTables := t.tables
+	t.wal = &next
+	if _, ok := c.Frames[1]; ok {
+		if err := t.readSchema(t.wal); err != nil {
+			return nil, err
+		}
+	}
+	after, err := t.readRows(t.wal, read)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	tables := make([]string, 0, len(names))
+	for name := range names {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		columns := tableColumns(t.tables, table)
+		if columns == nil {
+			columns = tableColumns(oldTables, table)
+		}
+		commit.Changes = append(commit.Changes, diffRows(table, columns, before[table], after[table])...)
+	}
+	return commit, nil
+}
+
+// Adds the written pages and the children of those that are interior
+// table pages as of wal. A page merged away when the b-tree is balanced
+// is not written again, its rows are found through its parent, which is.
+func (t *WalTail) addChildPages(wal *WalFile, written []int64, pages map[int64]bool) error {
+	for _, n := range written {
+		pages[n] = true
+		p, err := t.readPage(wal, n)
+		if err != nil {
+			return err
+		}
+		if p == nil || p.PageType() != InteriorTableType {
+			continue
+		}
+		for i := 0; i <= p.CellCount(); i++ {
+			pages[int64(p.ChildPage(i))] = true
+		}
+	}
+	return nil
+}
+
+func sortPageNumbers(pages []int64) {
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] })
+}
+
+func tableColumns(tables []tailTable, name string) []string {
+	for _, table := range tables {
+		if table.name == name {
+			return table.schema.ColumnNames()
+		}
+	}
+	return nil
+}
+
+// Pairs up the rows by rowid. Rows that only moved to another page, as
+// they do when a page splits, compare equal and are left out.
+func diffRows(table string, columns []string, before, after map[int64][]any) []RowChange {
+	rowids := []int64{}
+	for rowid := range before {
+		rowids = append(rowids, rowid)
+	}
+	for rowid := range after {
+		if _, ok := before[rowid]; !ok {
+			rowids = append(rowids, rowid)
+		}
+	}
+	sort.Slice(rowids, func(i, j int) bool { return rowids[i] < rowids[j] })
+	changes := []RowChange{}
+	for _, rowid := range rowids {
+		old, hadOld := before[rowid]
+		new, hasNew := after[rowid]
+		change := RowChange{Table: table, Rowid: rowid, Columns: columns, Before: old, After: new}
+		switch {
+		case !hasNew:
+			change.Op = ChangeDelete
+		case !hadOld:
+			change.Op = ChangeInsert
+		case !reflect.DeepEqual(old, new):
+			change.Op = ChangeUpdate
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// Reads page n as it is in the database file with the frames of wal
+// applied, returning nil when the page is beyond the end of the database
+func (t *WalTail) readPage(wal *WalFile, n int64) (*RawPage, error) {
+	pageSize := int(t.db.Header.PageSizeBytes())
+	data := make([]byte, pageSize)
+	var err error
+	ok := false
+	if wal != nil {
+		if wal.PageCount > 0 && n > wal.PageCount {
+			return nil, nil
+		}
+		_, ok, err = wal.ReadPage(n, data, 0)
+	}
+	if !ok {
+		var read int
+		read, err = t.db.readAt(data, PageNumberToOffset(int64(pageSize), n))
+		if read < pageSize && (err == nil || errors.Is(err, io.EOF)) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d := t.db.opts.decrypter; d != nil {
+		if err := d.DecryptPage(n, data); err != nil {
+			return nil, fmt.Errorf("failed to decrypt page %d: %w", n, err)
+		}
+	}
+	return &RawPage{Number: n, Data: data, Usable: pageSize - int(t.db.Header.ReservedPageSpace)}, nil
+}
+
+// Reads the rows on those of the pages that are table leaves, by table
+// and rowid, as of wal
+func (t *WalTail) readRows(wal *WalFile, pages []int64) (map[string]map[int64][]any, error) {
+	rows := map[string]map[int64][]any{}
+	readPage := func(n int64) (*RawPage, error) {
+		p, err := t.readPage(wal, n)
+		if p == nil && err == nil {
+			err = fmt.Errorf("page %d is beyond the end of the database", n)
+		}
+		return p, err
+	}
+	for _, n := range pages {
+		p, err := t.readPage(wal, n)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil || p.PageType() != LeafTableType {
+			continue
+		}
+		table, err := t.owner(wal, p)
+		if err != nil {
+			return nil, err
+		}
+		if table == nil {
+			continue
+		}
+		if rows[table.name] == nil {
+			rows[table.name] = map[int64][]any{}
+		}
+		for i := 0; i < p.CellCount(); i++ {
+			payload, err := AssembleCellPayload(p, i, readPage)
+			if err != nil {
+				return nil, err
+			}
+			rowid := p.CellRowID(i)
+			record, err := NewRecordCell(rowid, payload)
+			if err != nil {
+				return nil, err
+			}
+			record.TextEncoding = t.db.TextEncoding
+			values, err := recordValues(record, len(record.Header))
+			if err != nil {
+				return nil, err
+			}
+			for j, v := range values {
+				if j == table.schema.RowidColumn {
+					v = rowid
+				}
+				values[j] = table.schema.ApplyAffinity(j, v)
+			}
+			rows[table.name][rowid] = values
+		}
+	}
+	return rows, nil
+}
+
+// Finds the table a leaf page belongs to by looking up the rowid of its
+// first cell in each table, as a page that is no longer part of a table,
+// such as one on the freelist, still looks like a leaf. Returns nil for
+// sqlite_schema and pages of no table.
+func (t *WalTail) owner(wal *WalFile, p *RawPage) (*tailTable, error) {
+	for i := range t.tables {
+		table := &t.tables[i]
+		if table.root == p.Number {
+			return table, nil
+		}
+		if p.CellCount() == 0 {
+			continue
+		}
+		rowid := p.CellRowID(0)
+		n := table.root
+		for depth := 0; n != p.Number && depth < maxBtreeDepth; depth++ {
+			page, err := t.readPage(wal, n)
+			if err != nil {
+				return nil, err
+			}
+			if page == nil || page.PageType() != InteriorTableType {
+				break
+			}
+			child := page.CellCount()
+			for j := 0; j < page.CellCount(); j++ {
+				if rowid <= page.CellRowID(j) {
+					child = j
+					break
+				}
+			}
+			n = int64(page.ChildPage(child))
+		}
+		if n == p.Number {
+			return table, nil
+		}
+	}
+	return nil, nil
+}
+
+// Reads the rowid tables of sqlite_schema as of wal, when the schema
+// cookie says they changed
+func (t *WalTail) readSchema(wal *WalFile) error {
+	p, err := t.readPage(wal, 1)
+	if err != nil || p == nil {
+		return err
+	}
+	cookie := uint32(p.Data[40])<<24 | uint32(p.Data[41])<<16 | uint32(p.Data[42])<<8 | uint32(p.Data[43])
+	if t.tables != nil && cookie == t.cookie {
+		return nil
+	}
+	tables := []tailTable{}
+	readPage := func(n int64) (*RawPage, error) {
+		p, err := t.readPage(wal, n)
+		if p == nil && err == nil {
+			err = fmt.Errorf("page %d is beyond the end of the database", n)
+		}
+		return p, err
+	}
+	var walk func(p *RawPage, depth int) error
+	walk = func(p *RawPage, depth int) error {
+		if depth > maxBtreeDepth {
+			return fmt.Errorf("sqlite_schema is deeper than %d pages", maxBtreeDepth)
+		}
+		switch p.PageType() {
+		case InteriorTableType:
+			for i := 0; i <= p.CellCount(); i++ {
+				child, err := readPage(int64(p.ChildPage(i)))
+				if err != nil {
+					return err
+				}
+				if err := walk(child, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		case LeafTableType:
+			for i := 0; i < p.CellCount(); i++ {
+				payload, err := AssembleCellPayload(p, i, readPage)
+				if err != nil {
+					return err
+				}
+				c, err := NewRecordCell(p.CellRowID(i), payload)
+				if err != nil {
+					return err
+				}
+				c.TextEncoding = t.db.TextEncoding
+				if c.CellType() != CellTypeTable {
+					continue
+				}
+				name, err := c.TableName()
+				if err != nil {
+					return err
+				}
+				root, err := c.RootPage()
+				if err != nil || root == 0 {
+					continue
+				}
+				c.ParseColumnMap()
+				tables = append(tables, tailTable{name: name, root: root, schema: c})
+			}
+			return nil
+		}
+		return fmt.Errorf("page %d is not a table b-tree page", p.Number)
+	}
+	if err := walk(p, 0); err != nil {
+		return err
+	}
+	t.tables, t.cookie = tables, cookie
+	return nil
+}
@@ -0,0 +1,248 @@
+package sqlitefile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// A WHERE clause checked against the columns of a table, for the
+// statements that change rows, which take more than the equalities of
+// SelectCtx.Constraint. Values are compared exactly, with the column
+// affinities sqlite applies, and a row matches only where the clause
+// is true, not NULL.
+type rowFilter struct {
+	schema *Record
+	expr   sqlparser.Expr
+}
+
+// Checks that every part of the clause can be evaluated. Supported are
+// AND, OR, NOT, IS [NOT] NULL and the comparisons = != < <= > >= between
+// columns and literals. Anything else is refused rather than guessed at.
+func newRowFilter(w *sqlparser.Where, schema *Record) (*rowFilter, error) {
+	f := &rowFilter{schema: schema}
+	if w == nil {
+		return f, nil
+	}
+	if err := f.check(w.Expr); err != nil {
+		return nil, err
+	}
+	f.expr = w.Expr
+	return f, nil
+}
+
+func (f *rowFilter) check(e sqlparser.Expr) error {
+	switch e := e.(type) {
+	case *sqlparser.AndExpr:
+		if err := f.check(e.Left); err != nil {
+			return err
+		}
+		return f.check(e.Right)
+	case *sqlparser.OrExpr:
+		if err := f.check(e.Left); err != nil {
+			return err
+		}
+		return f.check(e.Right)
+	case *sqlparser.NotExpr:
+		return f.check(e.Expr)
+	case *sqlparser.ParenExpr:
+		return f.check(e.Expr)
+	case *sqlparser.IsExpr:
+		if e.Operator == sqlparser.IsNullStr || e.Operator == sqlparser.IsNotNullStr {
+			return f.checkOperand(e.Expr)
+		}
+	case *sqlparser.ComparisonExpr:
+		switch e.Operator {
+		case sqlparser.EqualStr, sqlparser.NotEqualStr, sqlparser.LessThanStr,
+			sqlparser.LessEqualStr, sqlparser.GreaterThanStr, sqlparser.GreaterEqualStr:
+			if err := f.checkOperand(e.Left); err != nil {
+				return err
+			}
+			return f.checkOperand(e.Right)
+		}
+	}
+	return fmt.Errorf("unsupported WHERE: %s", sqlparser.String(e))
+}
+
+func (f *rowFilter) checkOperand(e sqlparser.Expr) error {
+	if col, ok := e.(*sqlparser.ColName); ok {
+		if _, ok := f.column(col); !ok {
+			return fmt.Errorf("no such column: %s", sqlparser.String(col))
+		}
+		return nil
+	}
+	if _, err := sqlExprToValue(e); err != nil {
+		return fmt.Errorf("unsupported WHERE: %s", sqlparser.String(e))
+	}
+	return nil
+}
+
+// Index of the column a name refers to, or -1 for the rowid when no
+// column shadows rowid, oid or _rowid_
+func (f *rowFilter) column(col *sqlparser.ColName) (int, bool) {
+	name := CleanKeyString(col.Name.String())
+	if idx, ok := f.schema.ColumnMap[name]; ok {
+		return idx, true
+	}
+	switch name {
+	case "rowid", "oid", "_rowid_":
+		return -1, true
+	}
+	return 0, false
+}
+
+// Whether the row, whose columns are read from c, satisfies the clause
+func (f *rowFilter) match(c *Record) (bool, error) {
+	if f.expr == nil {
+		return true, nil
+	}
+	v, err := f.eval(f.expr, c)
+	return v != nil && truthy(v), err
+}
+
+// Evaluates to 1, 0 or nil for NULL
+func (f *rowFilter) eval(e sqlparser.Expr, c *Record) (any, error) {
+	switch e := e.(type) {
+	case *sqlparser.ParenExpr:
+		return f.eval(e.Expr, c)
+	case *sqlparser.NotExpr:
+		v, err := f.eval(e.Expr, c)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return boolValue(!truthy(v)), nil
+	case *sqlparser.AndExpr:
+		return f.logical(e.Left, e.Right, false, c)
+	case *sqlparser.OrExpr:
+		return f.logical(e.Left, e.Right, true, c)
+	case *sqlparser.IsExpr:
+		v, _, err := f.operand(e.Expr, c)
+		if err != nil {
+			return nil, err
+		}
+		return boolValue((v == nil) == (e.Operator == sqlparser.IsNullStr)), nil
+	case *sqlparser.ComparisonExpr:
+		l, la, err := f.operand(e.Left, c)
+		if err != nil {
+			return nil, err
+		}
+		r, ra, err := f.operand(e.Right, c)
+		if err != nil || l == nil || r == nil {
+			return nil, err
+		}
+		l, r = applyComparisonAffinity(l, la, r, ra)
+		cmp := compareValues(l, r)
+		switch e.Operator {
+		case sqlparser.EqualStr:
+			return boolValue(cmp == 0), nil
+		case sqlparser.NotEqualStr:
+			return boolValue(cmp != 0), nil
+		case sqlparser.LessThanStr:
+			return boolValue(cmp < 0), nil
+		case sqlparser.LessEqualStr:
+			return boolValue(cmp <= 0), nil
+		case sqlparser.GreaterThanStr:
+			return boolValue(cmp > 0), nil
+		case sqlparser.GreaterEqualStr:
+			return boolValue(cmp >= 0), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported WHERE: %s", sqlparser.String(e))
+}
+
+// AND and OR with NULL standing for unknown, as in evalLogical
+func (f *rowFilter) logical(left, right sqlparser.Expr, or bool, c *Record) (any, error) {
+	l, err := f.eval(left, c)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.eval(right, c)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case l != nil && truthy(l) == or, r != nil && truthy(r) == or:
+		return boolValue(or), nil
+	case l == nil || r == nil:
+		return nil, nil
+	}
+	return boolValue(!or), nil
+}
+
+// Value of a column or literal and its affinity, which literals do not
+// have and is reported as BLOB, the affinity that converts nothing
+func (f *rowFilter) operand(e sqlparser.Expr, c *Record) (any, ColumnAffinity, error) {
+	col, ok := e.(*sqlparser.ColName)
+	if !ok {
+		v, err := sqlExprToValue(e)
+		return v, AffinityBlob, err
+	}
+	idx, _ := f.column(col)
+	if idx < 0 {
+		return c.RowID, AffinityInteger, nil
+	}
+	v, err := c.Value(idx)
+	if err != nil {
+		return nil, AffinityBlob, err
+	}
+	if v == nil && idx == f.schema.RowidColumn {
+		v = c.RowID
+	}
+	return f.schema.ApplyAffinity(idx, v), f.schema.ColumnAffinity[idx], nil
+}
+
+// Converts the operands of a comparison as sqlite does: when one side
+// has a numeric affinity the other is read as a number if it looks like
+// one, otherwise when one side has TEXT affinity the other becomes text
+// https://www.sqlite.org/datatype3.html#type_conversions_prior_to_comparison
+func applyComparisonAffinity(l any, la ColumnAffinity, r any, ra ColumnAffinity) (any, any) {
+	switch {
+	case isNumericAffinity(la) && !isNumericAffinity(ra):
+		r = applyColumnAffinity(AffinityNumeric, r)
+	case isNumericAffinity(ra) && !isNumericAffinity(la):
+		l = applyColumnAffinity(AffinityNumeric, l)
+	case la == AffinityText && ra == AffinityBlob:
+		r = applyColumnAffinity(AffinityText, r)
+	case ra == AffinityText && la == AffinityBlob:
+		l = applyColumnAffinity(AffinityText, l)
+	}
+	return l, r
+}
+
+func isNumericAffinity(a ColumnAffinity) bool {
+	return a == AffinityInteger || a == AffinityReal || a == AffinityNumeric
+}
+
+// Whether a column value equals the value a query compares it to, as
+// sqlite compares them and an index looks them up: with the affinity of
+// the column applied to the value and the collation of the column,
+// BINARY unless it declares NOCASE or RTRIM. NULL equals nothing.
+func constraintEquals(value any, affinity ColumnAffinity, collation string, literal any) bool {
+	if value == nil || literal == nil {
+		return false
+	}
+	value, literal = applyComparisonAffinity(value, affinity, literal, AffinityBlob)
+	a, aText := value.(string)
+	b, bText := literal.(string)
+	if !aText || !bText {
+		return compareValues(value, literal) == 0
+	}
+	switch collation {
+	case "nocase":
+		return asciiLower(a) == asciiLower(b)
+	case "rtrim":
+		return strings.TrimRight(a, " ") == strings.TrimRight(b, " ")
+	}
+	return a == b
+}
+
+// Lowercases the ASCII letters of s only, as the NOCASE collation does
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,751 @@
+package sqlitefile
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Table leaf cells larger than the usable size minus this
+// amount spill into overflow pages
+const MaxLocalPayloadOffset = 35
+
+// What to do when a row collides with an existing row on its rowid
+// or the key of a UNIQUE index
+type ConflictAction int
+
+const (
+	ConflictAbort ConflictAction = iota
+	// the existing rows are deleted before the new row is inserted
+	ConflictReplace
+	// the new row is silently skipped
+	ConflictIgnore
+)
+
+// Rewrites the sqlite INSERT OR <action> forms into the MySQL
+// syntax understood by the parser, REPLACE INTO and INSERT IGNORE
+var InsertOrRegexp = regexp.MustCompile("(?i)^\\s*insert\\s+or\\s+(replace|ignore|abort)\\s+into\\b")
+
+func rewriteInsertOr(sql string) string {
+	m := InsertOrRegexp.FindStringSubmatchIndex(sql)
+	if m == nil {
+		return sql
+	}
+	switch strings.ToLower(sql[m[2]:m[3]]) {
+	case "replace":
+		return "replace into" + sql[m[1]:]
+	case "ignore":
+		return "insert ignore into" + sql[m[1]:]
+	}
+	return "insert into" + sql[m[1]:]
+}
+
+func execInsert(stmt *sqlparser.Insert, db *Database) error {
+	t, err := newTableTarget(db, CleanKeyString(stmt.Table.Name.String()))
+	if err != nil {
+		return err
+	}
+	if len(stmt.OnDup) > 0 {
+		return errors.New("ON DUPLICATE KEY UPDATE is not supported")
+	}
+	action := ConflictAbort
+	if stmt.Action == sqlparser.ReplaceStr {
+		action = ConflictReplace
+	} else if stmt.Ignore != "" {
+		action = ConflictIgnore
+	}
+	rows, ok := stmt.Rows.(sqlparser.Values)
+	if !ok {
+		return errors.New("only INSERT ... VALUES is supported")
+	}
+	columns, err := insertColumnIndices(stmt.Columns, t.Schema)
+	if err != nil {
+		return err
+	}
+	tx, err := beginWrite(db)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		rowID, values, err := insertRowValues(row, columns, t.Schema)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.insertRow(t, rowID, values, action); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Inserts many rows in a single transaction, so the journal or WAL is
+// written and synced once instead of per row. Each row holds a value for
+// every column in table order, the value of an INTEGER PRIMARY KEY column
+// is used as rowid unless it is nil. Rows without a rowid get increasing
+// rowids, so they are appended to the right-most leaf, which is split by
+// moving its full content to a new left sibling.
+func BulkInsert(db *Database, table string, rows [][]any) error {
+	t, err := newTableTarget(db, CleanKeyString(table))
+	if err != nil {
+		return err
+	}
+	tx, err := beginWrite(db)
+	if err != nil {
+		return err
+	}
+	maxRowID, err := tx.maxRowID(t.Root)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i, row := range rows {
+		rowID, values, err := bulkRowValues(row, t.Schema)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("row %d: %s", i, err)
+		}
+		if rowID == nil {
+			if maxRowID == math.MaxInt64 {
+				tx.Rollback()
+				return errors.New("database or disk is full: rowid space exhausted")
+			}
+			next := maxRowID + 1
+			rowID = &next
+		}
+		if *rowID > maxRowID {
+			maxRowID = *rowID
+		}
+		if err := tx.insertRow(t, rowID, values, ConflictAbort); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("row %d: %s", i, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Converts a row of Go values to record values with column affinity
+// applied, taking out the rowid alias column
+func bulkRowValues(row []any, schema *Record) (*int64, []any, error) {
+	if len(row) != schema.ColumnCount() {
+		return nil, nil, fmt.Errorf("%d values for %d columns", len(row), schema.ColumnCount())
+	}
+	var rowID *int64
+	values := make([]any, len(row))
+	for i, v := range row {
+		v, err := normalizeValue(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i != schema.RowidColumn {
+			values[i] = applyColumnAffinity(schema.ColumnAffinity[i], v)
+			continue
+		}
+		if v == nil {
+			continue
+		}
+		id, ok := applyColumnAffinity(AffinityInteger, v).(int64)
+		if !ok {
+			return nil, nil, errors.New("datatype mismatch: rowid must be an integer")
+		}
+		rowID = &id
+	}
+	return rowID, values, nil
+}
+
+// A table being written to together with the indexes
+// that have to be kept in sync with it
+type tableTarget struct {
+	Name    string
+	Root    int64
+	Schema  *Record
+	Indexes []*tableIndex
+}
+
+func newTableTarget(db *Database, name string) (*tableTarget, error) {
+	schema, ok := db.Tables[name]
+	if !ok {
+		return nil, TableNotFoundError(name)
+	}
+	if schema.WithoutRowid {
+		return nil, withoutRowidError("write to", name)
+	}
+	root, err := schema.RootPage()
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := loadTableIndexes(db, name, schema)
+	if err != nil {
+		return nil, err
+	}
+	for _, ix := range indexes {
+		switch {
+		case ix.Where != "":
+			return nil, fmt.Errorf("index %s: partial indexes are not supported", ix.Name)
+		case ix.hasExpressions():
+			return nil, fmt.Errorf("index %s: indexes on expressions are not supported", ix.Name)
+		}
+	}
+	return &tableTarget{Name: name, Root: root, Schema: schema, Indexes: indexes}, nil
+}
+
+// Names the columns of a constraint the way sqlite reports them
+func (t *tableTarget) constraintColumns(columns []int) string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = t.Name + ".rowid"
+		for name, idx := range t.Schema.ColumnMap {
+			if idx == col || (col < 0 && idx == t.Schema.RowidColumn) {
+				names[i] = t.Name + "." + name
+			}
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Inserts a row and its index entries. Rows that collide with the new
+// one on the rowid or a UNIQUE index are handled according to action.
+// Keys containing NULL never collide.
+func (tx *writeTxn) insertRow(t *tableTarget, rowID *int64, values []any, action ConflictAction) error {
+	if rowID == nil {
+		maxRowID, err := tx.maxRowID(t.Root)
+		if err != nil {
+			return err
+		}
+		if maxRowID == math.MaxInt64 {
+			return errors.New("database or disk is full: rowid space exhausted")
+		}
+		next := maxRowID + 1
+		rowID = &next
+	}
+	_, exists, err := tx.readRow(t, *rowID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		switch action {
+		case ConflictIgnore:
+			return nil
+		case ConflictReplace:
+			if err := tx.deleteRow(t, *rowID); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("UNIQUE constraint failed: %s", t.constraintColumns([]int{-1}))
+		}
+	}
+	for _, ix := range t.Indexes {
+		if !ix.Unique {
+			continue
+		}
+		key := ix.Key(*rowID, values)
+		if hasNull(key) {
+			continue
+		}
+		existing, found, err := tx.findIndexKey(ix, key)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		switch action {
+		case ConflictIgnore:
+			return nil
+		case ConflictReplace:
+			if err := tx.deleteRow(t, existing); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("UNIQUE constraint failed: %s", t.constraintColumns(ix.Columns))
+		}
+	}
+	if err := tx.insertTableRow(t.Root, t.Name, rowID, values); err != nil {
+		return err
+	}
+	for _, ix := range t.Indexes {
+		if err := tx.insertIndexEntry(ix, *rowID, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Looks up the record values of a row by its rowid
+func (tx *writeTxn) readRow(t *tableTarget, rowID int64) ([]any, bool, error) {
+	leaf, _, err := tx.findTableLeaf(t.Root, rowID)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := 0; i < leaf.CellCount(); i++ {
+		if leaf.CellRowID(i) != rowID {
+			continue
+		}
+		c, err := tx.cellRecord(leaf, i)
+		if err != nil {
+			return nil, false, err
+		}
+		values, err := recordValues(c, t.Schema.ColumnCount())
+		return values, err == nil, err
+	}
+	return nil, false, nil
+}
+
+// Deletes a row together with its index entries
+func (tx *writeTxn) deleteRow(t *tableTarget, rowID int64) error {
+	values, ok, err := tx.readRow(t, rowID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("row %d not found", rowID)
+	}
+	for _, ix := range t.Indexes {
+		if err := tx.deleteIndexEntry(ix, rowID, values); err != nil {
+			return err
+		}
+	}
+	return tx.deleteTableRow(t.Root, rowID)
+}
+
+// Maps the column list of an INSERT to record positions. Without an
+// explicit list values are given for every column in table order.
+// The rowid itself is addressed with -1.
+func insertColumnIndices(cols sqlparser.Columns, schema *Record) ([]int, error) {
+	indices := []int{}
+	if len(cols) == 0 {
+		for i := 0; i < schema.ColumnCount(); i++ {
+			indices = append(indices, i)
+		}
+		return indices, nil
+	}
+	for _, col := range cols {
+		name := CleanKeyString(col.String())
+		idx, ok := schema.ColumnMap[name]
+		if !ok {
+			if name != "rowid" && name != "_rowid_" && name != "oid" {
+				return nil, fmt.Errorf("table has no column named %s", name)
+			}
+			idx = -1
+		}
+		indices = append(indices, idx)
+	}
+	return indices, nil
+}
+
+// Builds the record values for one VALUES tuple, applying column
+// affinity. Returns the rowid when given explicitly, either through
+// the rowid itself or an INTEGER PRIMARY KEY column which is stored
+// as NULL in the record.
+func insertRowValues(row sqlparser.ValTuple, columns []int, schema *Record) (*int64, []any, error) {
+	if len(row) != len(columns) {
+		return nil, nil, fmt.Errorf("%d values for %d columns", len(row), len(columns))
+	}
+	var rowID *int64
+	values := make([]any, schema.ColumnCount())
+	for i, expr := range row {
+		v, err := sqlExprToValue(expr)
+		if err != nil {
+			return nil, nil, err
+		}
+		idx := columns[i]
+		if idx == -1 || idx == schema.RowidColumn {
+			if v == nil {
+				continue
+			}
+			id, ok := applyColumnAffinity(AffinityInteger, v).(int64)
+			if !ok {
+				return nil, nil, errors.New("datatype mismatch: rowid must be an integer")
+			}
+			rowID = &id
+			continue
+		}
+		values[idx] = applyColumnAffinity(schema.ColumnAffinity[idx], v)
+	}
+	return rowID, values, nil
+}
+
+// Converts a literal from the parsed statement into a Go value
+func sqlExprToValue(expr sqlparser.Expr) (any, error) {
+	switch e := expr.(type) {
+	case *sqlparser.NullVal:
+		return nil, nil
+	case sqlparser.BoolVal:
+		if e {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case *sqlparser.ParenExpr:
+		return sqlExprToValue(e.Expr)
+	case *sqlparser.UnaryExpr:
+		v, err := sqlExprToValue(e.Expr)
+		if err != nil || e.Operator == sqlparser.UPlusStr {
+			return v, err
+		}
+		if e.Operator == sqlparser.UMinusStr {
+			switch v := v.(type) {
+			case int64:
+				return -v, nil
+			case float64:
+				return -v, nil
+			}
+		}
+	case *sqlparser.SQLVal:
+		switch e.Type {
+		case sqlparser.StrVal:
+			return string(e.Val), nil
+		case sqlparser.IntVal:
+			if i, err := strconv.ParseInt(string(e.Val), 10, 64); err == nil {
+				return i, nil
+			}
+			return strconv.ParseFloat(string(e.Val), 64)
+		case sqlparser.FloatVal:
+			return strconv.ParseFloat(string(e.Val), 64)
+		case sqlparser.HexNum:
+			u, err := strconv.ParseUint(string(e.Val[2:]), 16, 64)
+			return int64(u), err
+		case sqlparser.HexVal:
+			return hex.DecodeString(string(e.Val))
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %s", sqlparser.String(expr))
+}
+
+// Converts a value to the storage class preferred by the column affinity
+// https://www.sqlite.org/datatype3.html#type_affinity
+func applyColumnAffinity(a ColumnAffinity, v any) any {
+	switch a {
+	case AffinityText:
+		switch v.(type) {
+		case int64, float64:
+			return FormatValue(v)
+		}
+	case AffinityInteger, AffinityNumeric, AffinityReal:
+		if s, ok := v.(string); ok {
+			if n, ok := parseNumeric(s); ok {
+				v = n
+			}
+		}
+		switch n := v.(type) {
+		case int64:
+			if a == AffinityReal {
+				return float64(n)
+			}
+		case float64:
+			if a != AffinityReal && n == math.Trunc(n) &&
+				n >= math.MinInt64 && n < math.MaxInt64 {
+				return int64(n)
+			}
+		}
+	}
+	return v
+}
+
+func parseNumeric(s string) (any, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 || strings.ContainsAny(s, "xXpP_") ||
+		strings.ContainsAny(s[len(s)-1:], "iInNfF") {
+		return nil, false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	return nil, false
+}
+
+// Inserts a row into the table b-tree rooted at root. Without an explicit
+// rowid the next one after the current largest is used, as sqlite does
+// for tables without AUTOINCREMENT.
+func (tx *writeTxn) insertTableRow(root int64, tableName string, rowID *int64, values []any) error {
+	payload, err := tx.encodeRecord(values)
+	if err != nil {
+		return err
+	}
+	if rowID == nil {
+		maxRowID, err := tx.maxRowID(root)
+		if err != nil {
+			return err
+		}
+		if maxRowID == math.MaxInt64 {
+			return errors.New("database or disk is full: rowid space exhausted")
+		}
+		next := maxRowID + 1
+		rowID = &next
+	}
+	leaf, path, err := tx.findTableLeaf(root, *rowID)
+	if err != nil {
+		return err
+	}
+	idx := 0
+	for ; idx < leaf.CellCount(); idx++ {
+		cellRowID := leaf.CellRowID(idx)
+		if cellRowID == *rowID {
+			return fmt.Errorf("UNIQUE constraint failed: %s.rowid", tableName)
+		}
+		if cellRowID > *rowID {
+			break
+		}
+	}
+	header := AppendVarint([]byte{}, int64(len(payload)))
+	header = AppendVarint(header, *rowID)
+	cell, overflow := tx.payloadCell(header, payload, true)
+	if overflow != nil {
+		if err := tx.writeOverflow(cell, overflow); err != nil {
+			return err
+		}
+	}
+	return tx.insertCell(path, leaf, idx, cell)
+}
+
+// One step of a descent through a b-tree: the interior page
+// and the index of the child followed, where the cell count
+// of the page stands for the right-most pointer
+type btreeStep struct {
+	Page  *RawPage
+	Child int
+}
+
+// Descends the table b-tree to the leaf page where rowID belongs,
+// also returning the interior pages passed on the way down.
+// Interior cells hold the largest rowid of their left subtree.
+func (tx *writeTxn) findTableLeaf(root int64, rowID int64) (*RawPage, []btreeStep, error) {
+	path := []btreeStep{}
+	p, err := tx.Page(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		switch p.PageType() {
+		case LeafTableType:
+			return p, path, nil
+		case InteriorTableType:
+		default:
+			return nil, nil, fmt.Errorf("page %d is not a table b-tree page", p.Number)
+		}
+		child := p.CellCount()
+		for i := 0; i < p.CellCount(); i++ {
+			if rowID <= p.CellRowID(i) {
+				child = i
+				break
+			}
+		}
+		path = append(path, btreeStep{p, child})
+		if p, err = tx.Page(int64(p.ChildPage(child))); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// Follows the right-most pointers down to the last leaf
+func (tx *writeTxn) maxRowID(root int64) (int64, error) {
+	p, err := tx.Page(root)
+	if err != nil {
+		return 0, err
+	}
+	for p.PageType() == InteriorTableType {
+		if p, err = tx.Page(int64(p.RightMostPointer())); err != nil {
+			return 0, err
+		}
+	}
+	if p.PageType() != LeafTableType {
+		return 0, fmt.Errorf("page %d is not a table b-tree page", p.Number)
+	}
+	if p.CellCount() == 0 {
+		return 0, nil
+	}
+	return p.CellRowID(p.CellCount() - 1), nil
+}
+
+func execDelete(stmt *sqlparser.Delete, db *Database) error {
+	tableName := sqlNodeToTrimmedString(stmt.TableExprs)[0]
+	t, err := newTableTarget(db, tableName)
+	if err != nil {
+		return err
+	}
+	filter, err := newRowFilter(stmt.Where, t.Schema)
+	if err != nil {
+		return err
+	}
+	tx, err := beginWrite(db)
+	if err != nil {
+		return err
+	}
+	rowIDs := []int64{}
+	err = tx.walkTableLeaves(t.Root, func(p *RawPage) error {
+		for i := 0; i < p.CellCount(); i++ {
+			c, err := tx.cellRecord(p, i)
+			if err != nil {
+				return err
+			}
+			ok, err := filter.match(c)
+			if err != nil {
+				return err
+			}
+			if ok {
+				rowIDs = append(rowIDs, c.RowID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, rowID := range rowIDs {
+		if err := tx.deleteRow(t, rowID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Removes the row from the leaf holding it and frees its overflow pages.
+// sqlite considers empty non-root pages corrupt, so a leaf left without
+// cells is unlinked from its parent.
+func (tx *writeTxn) deleteTableRow(root int64, rowID int64) error {
+	leaf, path, err := tx.findTableLeaf(root, rowID)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < leaf.CellCount(); i++ {
+		if leaf.CellRowID(i) != rowID {
+			continue
+		}
+		if _, _, overflow := leaf.CellPayload(i); overflow != 0 {
+			if err := tx.freeOverflowChain(overflow); err != nil {
+				return err
+			}
+		}
+		leaf.DropCell(i)
+		tx.Write(leaf)
+		if leaf.CellCount() == 0 && len(path) > 0 {
+			return tx.removeEmptyChild(path)
+		}
+		return nil
+	}
+	return fmt.Errorf("row %d not found", rowID)
+}
+
+// Unlinks the empty child at the end of the path from its parent and
+// frees it. A parent left with only its right-most pointer is replaced
+// by that child, and a root in that state takes over its child's
+// content, shrinking the tree by one level.
+func (tx *writeTxn) removeEmptyChild(path []btreeStep) error {
+	step := path[len(path)-1]
+	parent := step.Page
+	empty := int64(parent.ChildPage(step.Child))
+	if step.Child == parent.CellCount() {
+		last := parent.CellCount() - 1
+		parent.SetRightMostPointer(parent.CellLeftChild(last))
+		parent.DropCell(last)
+	} else {
+		parent.DropCell(step.Child)
+	}
+	tx.Write(parent)
+	if err := tx.freePage(empty); err != nil {
+		return err
+	}
+	if parent.CellCount() > 0 {
+		return nil
+	}
+	return tx.replaceWithOnlyChild(path)
+}
+
+// Replaces the interior page at the end of the path, which has no cells
+// left, by the child its right-most pointer leads to. The root keeps its
+// page number by taking over the cells of the child, which shrinks the
+// tree by one level.
+func (tx *writeTxn) replaceWithOnlyChild(path []btreeStep) error {
+	parent := path[len(path)-1].Page
+	only := int64(parent.RightMostPointer())
+	if len(path) > 1 {
+		grandparent := path[len(path)-2]
+		grandparent.Page.SetChildPage(grandparent.Child, uint32(only))
+		tx.Write(grandparent.Page)
+		return tx.freePage(parent.Number)
+	}
+	child, err := tx.Page(only)
+	if err != nil {
+		return err
+	}
+	cells := child.Cells()
+	parent.Reset(child.PageType())
+	if !child.IsLeaf() {
+		parent.SetRightMostPointer(child.RightMostPointer())
+	}
+	// page 1 has less room than the child due to the database header
+	if err := parent.SetCells(cells); err != nil {
+		return fmt.Errorf("cannot move page %d into root page %d: %s", only, parent.Number, err)
+	}
+	tx.Write(parent)
+	return tx.freePage(only)
+}
+
+// Calls fn for every leaf page of the table b-tree in rowid order
+func (tx *writeTxn) walkTableLeaves(pageNumber int64, fn func(p *RawPage) error) error {
+	p, err := tx.Page(pageNumber)
+	if err != nil {
+		return err
+	}
+	switch p.PageType() {
+	case LeafTableType:
+		return fn(p)
+	case InteriorTableType:
+		for i := 0; i < p.CellCount(); i++ {
+			if err := tx.walkTableLeaves(int64(p.CellLeftChild(i)), fn); err != nil {
+				return err
+			}
+		}
+		return tx.walkTableLeaves(int64(p.RightMostPointer()), fn)
+	}
+	return fmt.Errorf("page %d is not a table b-tree page", p.Number)
+}
+
+// Reassembles the full payload of the ith cell, following
+// its overflow chain when the payload does not fit the page
+func (tx *writeTxn) cellPayload(p *RawPage, i int) ([]byte, error) {
+	return AssembleCellPayload(p, i, tx.Page)
+}
+
+// Reassembles a cell payload from its local part and the overflow
+// pages fetched through page, each holding a next page pointer
+// followed by up to usable size minus 4 bytes of payload
+func AssembleCellPayload(p *RawPage, i int, page func(n int64) (*RawPage, error)) ([]byte, error) {
+	payloadSize, local, overflow := p.CellPayload(i)
+	payload := make([]byte, 0, payloadSize)
+	payload = append(payload, local...)
+	for overflow != 0 && len(payload) < payloadSize {
+		op, err := page(int64(overflow))
+		if err != nil {
+			return nil, err
+		}
+		n := minInt(payloadSize-len(payload), p.Usable-4)
+		payload = append(payload, op.Data[4:4+n]...)
+		overflow = binary.BigEndian.Uint32(op.Data)
+	}
+	if len(payload) < payloadSize {
+		return nil, fmt.Errorf("overflow chain of cell %d on page %d is too short", i, p.Number)
+	}
+	return payload, nil
+}
+
+// Decodes the record of the ith cell of a table leaf page
+func (tx *writeTxn) cellRecord(p *RawPage, i int) (*Record, error) {
+	payload, err := tx.cellPayload(p, i)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordCell(p.CellRowID(i), payload)
+}
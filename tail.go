@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Set with --tail to follow the WAL and print the rows changed by each
+// transaction other processes commit, instead of running a command
+var tail bool
+
+// Checks the WAL every WatchInterval and writes each transaction
+// committed since as a line of JSON, with the rows it inserted, updated
+// and deleted. Runs until interrupted.
+func runTail(db *sqlitefile.Database) error {
+	t, err := db.TailWal()
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		commit, err := t.Next()
+		if err != nil {
+			return err
+		}
+		if commit == nil {
+			time.Sleep(WatchInterval)
+			continue
+		}
+		for _, change := range commit.Changes {
+			for _, values := range [][]any{change.Before, change.After} {
+				for i, v := range values {
+					values[i] = serveValue(v)
+				}
+			}
+		}
+		if err := enc.Encode(commit); err != nil {
+			return err
+		}
+	}
+}
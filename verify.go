@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Handles `.verify-unique index`, walking a UNIQUE index and printing
+// every key more than one entry holds along with their rows. Finding
+// any fails the command, so scripts can check an index with it.
+func HandleVerifyUnique(cmd string, db *sqlitefile.Database) error {
+	fields := strings.Fields(cmd)
+	if len(fields) != 2 {
+		return usageError(".verify-unique index")
+	}
+	duplicates, err := db.VerifyUniqueIndex(fields[1])
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		type duplicate struct {
+			Key    string  `json:"key"`
+			Rowids []int64 `json:"rowids"`
+		}
+		result := []duplicate{}
+		for _, d := range duplicates {
+			result = append(result, duplicate{sqlitefile.FormatValueTuple(d.Key), d.Rowids})
+		}
+		if err := writeJSONDocument(result); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range duplicates {
+			rowids := make([]string, len(d.Rowids))
+			for i, r := range d.Rowids {
+				rowids[i] = strconv.FormatInt(r, 10)
+			}
+			fmt.Fprintf(output, "%s in rows %s\n", sqlitefile.FormatValueTuple(d.Key), strings.Join(rowids, ", "))
+		}
+		if len(duplicates) == 0 {
+			fmt.Fprintln(output, "ok")
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("index %s has %d duplicate keys", fields[1], len(duplicates))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lindeneg/sql-exploration/sqlitefile"
+)
+
+// Set with --watch to run the command again whenever the database changes
+var watch bool
+
+// How often a watched database is checked for changes
+const WatchInterval = time.Second
+
+// Runs cmd, then checks the database every WatchInterval and runs cmd
+// again after another process committed to it. Commits are noticed by
+// the file change counter in the header. In WAL mode the counter is
+// left alone, so the end of the WAL and the time the database file was
+// last written, which changes when a checkpoint copies frames into it,
+// are compared as well. Runs until interrupted.
+func runWatch(cmd string, db *sqlitefile.Database) error {
+	if err := runCommand(cmd, db); err != nil {
+		return err
+	}
+	last, err := readWatchVersion(db)
+	if err != nil {
+		return err
+	}
+	for {
+		time.Sleep(WatchInterval)
+		if err := db.Reload(); err != nil {
+			return err
+		}
+		version, err := readWatchVersion(db)
+		if err != nil {
+			return err
+		}
+		if version == last {
+			continue
+		}
+		last = version
+		fmt.Fprintf(os.Stderr, "-- %s, change counter %d\n", time.Now().Format(time.TimeOnly), version.Counter)
+		if err := runCommandRecovered(cmd, db); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+	}
+}
+
+// What tells one version of a watched database from the next
+type watchVersion struct {
+	Counter  uint32
+	Salt1    uint32
+	WalEnd   int64
+	Modified time.Time
+}
+
+func readWatchVersion(db *sqlitefile.Database) (watchVersion, error) {
+	v := watchVersion{Counter: db.Header.FileChangeCounter}
+	// files not read from the local file system only have the counter
+	if db.File != nil {
+		info, err := db.File.Stat()
+		if err != nil {
+			return watchVersion{}, err
+		}
+		v.Modified = info.ModTime()
+	}
+	if db.Wal != nil {
+		v.Salt1, v.WalEnd = db.Wal.Salt1, db.Wal.End
+	}
+	return v, nil
+}